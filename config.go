@@ -3,10 +3,35 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"tbd/model"
 )
 
 func checkConfig() {
-	requiredConfig := []string{"JWT_SECRET", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_BUCKET_NAME", "AWS_REGION", "DOMAIN", "PGP_PASSPHRASE"}
+	requiredConfig := []string{"JWT_SECRET", "DOMAIN", "PGP_PASSPHRASE"}
+
+	switch DB_DRIVER() {
+	case "sqlite":
+	case "postgres":
+		requiredConfig = append(requiredConfig, "DB_DSN")
+	default:
+		panic("Unsupported database driver: " + DB_DRIVER())
+	}
+
+	switch STORAGE_DRIVER() {
+	case "s3":
+		requiredConfig = append(requiredConfig, "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_BUCKET_NAME", "AWS_REGION")
+	case "local":
+	default:
+		panic("Unsupported storage driver: " + STORAGE_DRIVER())
+	}
+
+	if !model.CurrencyIsValid(CURRENCY()) {
+		panic("Unsupported currency: " + CURRENCY())
+	}
 
 	// Loop over reqired config and check if they are set, and not ""
 	for _, v := range requiredConfig {
@@ -43,6 +68,21 @@ func checkConfig() {
 	}
 }
 
+// Supported drivers are: sqlite, postgres
+func DB_DRIVER() string {
+	// Fall back to sqlite if not set
+	if os.Getenv("DB_DRIVER") == "" {
+		return "sqlite"
+	}
+	return os.Getenv("DB_DRIVER")
+}
+
+// Only used by the postgres driver; for ex. host=localhost user=tbd password=tbd dbname=tbd port=5432 sslmode=disable
+func DB_DSN() string {
+	return os.Getenv("DB_DSN")
+}
+
+// Only used by the sqlite driver
 func DB_PATH() string {
 	// Fall back to default tbd.db if not set
 	if os.Getenv("DB_PATH") == "" {
@@ -50,3 +90,226 @@ func DB_PATH() string {
 	}
 	return os.Getenv("DB_PATH")
 }
+
+// Apply pending migrations on start; same as --migrate
+func AUTO_MIGRATE() bool {
+	autoMigrate, _ := strconv.ParseBool(os.Getenv("AUTO_MIGRATE"))
+	return autoMigrate
+}
+
+// Supported drivers are: s3, local
+func STORAGE_DRIVER() string {
+	// Fall back to s3 if not set
+	if os.Getenv("STORAGE_DRIVER") == "" {
+		return "s3"
+	}
+	return os.Getenv("STORAGE_DRIVER")
+}
+
+// Only used by the local driver
+func STORAGE_PATH() string {
+	// Fall back to default uploads if not set
+	if os.Getenv("STORAGE_PATH") == "" {
+		return "uploads"
+	}
+	return os.Getenv("STORAGE_PATH")
+}
+
+// Provisional files older than this are deleted by the file reaper
+func FILE_PROVISIONAL_TTL() time.Duration {
+	return durationFromEnv("FILE_PROVISIONAL_TTL", 24*time.Hour)
+}
+
+func FILE_REAPER_INTERVAL() time.Duration {
+	return durationFromEnv("FILE_REAPER_INTERVAL", time.Hour)
+}
+
+// Only log what would be deleted
+func FILE_REAPER_DRY_RUN() bool {
+	dryRun, _ := strconv.ParseBool(os.Getenv("FILE_REAPER_DRY_RUN"))
+	return dryRun
+}
+
+// How often entries past their expiry are moved to expired
+func ENTRY_SWEEPER_INTERVAL() time.Duration {
+	return durationFromEnv("ENTRY_SWEEPER_INTERVAL", 10*time.Minute)
+}
+
+// How often imported entry calendars are fetched again
+func CALENDAR_SYNC_INTERVAL() time.Duration {
+	return durationFromEnv("CALENDAR_SYNC_INTERVAL", time.Hour)
+}
+
+// Allow importing calendars from private and loopback addresses; for development and tests
+func CALENDAR_IMPORT_ALLOW_PRIVATE() bool {
+	allow, _ := strconv.ParseBool(os.Getenv("CALENDAR_IMPORT_ALLOW_PRIVATE"))
+	return allow
+}
+
+// How often saved searches are checked for new matches; entry changes also trigger a check right away
+func SAVED_SEARCH_INTERVAL() time.Duration {
+	return durationFromEnv("SAVED_SEARCH_INTERVAL", time.Minute)
+}
+
+// Channels users are notified through, comma separated. Supported are: inbox, email
+func NOTIFIERS() []string {
+	// Fall back to the in-app inbox and email if not set
+	if os.Getenv("NOTIFIERS") == "" {
+		return []string{"inbox", "email"}
+	}
+
+	notifiers := []string{}
+	for _, n := range strings.Split(os.Getenv("NOTIFIERS"), ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			notifiers = append(notifiers, n)
+		}
+	}
+	return notifiers
+}
+
+// Supported drivers are: smtp, log, file
+func MAIL_DRIVER() string {
+	// Fall back to logging emails if not set
+	if os.Getenv("MAIL_DRIVER") == "" {
+		return "log"
+	}
+	return os.Getenv("MAIL_DRIVER")
+}
+
+// Sender of all emails
+func MAIL_FROM() string {
+	// Fall back to noreply@DOMAIN if not set
+	if os.Getenv("MAIL_FROM") == "" {
+		return "noreply@" + os.Getenv("DOMAIN")
+	}
+	return os.Getenv("MAIL_FROM")
+}
+
+// Only used by the file mail driver; where emails are written to
+func MAIL_PATH() string {
+	// Fall back to default mails if not set
+	if os.Getenv("MAIL_PATH") == "" {
+		return "mails"
+	}
+	return os.Getenv("MAIL_PATH")
+}
+
+// How long the token sent to confirm an email is valid
+func EMAIL_VERIFICATION_TTL() time.Duration {
+	return durationFromEnv("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+}
+
+// Only users who confirmed their email may create entries, comment and vote
+func REQUIRE_CONFIRMED_EMAIL() bool {
+	require, _ := strconv.ParseBool(os.Getenv("REQUIRE_CONFIRMED_EMAIL"))
+	return require
+}
+
+// Supported drivers are: log, file, webhook
+func SMS_DRIVER() string {
+	// Fall back to logging text messages if not set
+	if os.Getenv("SMS_DRIVER") == "" {
+		return "log"
+	}
+	return os.Getenv("SMS_DRIVER")
+}
+
+// Only used by the file sms driver; where text messages are written to
+func SMS_PATH() string {
+	// Fall back to default sms if not set
+	if os.Getenv("SMS_PATH") == "" {
+		return "sms"
+	}
+	return os.Getenv("SMS_PATH")
+}
+
+// How long the token sent to reset a password is valid
+func PASSWORD_RESET_TTL() time.Duration {
+	return durationFromEnv("PASSWORD_RESET_TTL", time.Hour)
+}
+
+// How long an access token is valid; clients get a new one with their refresh token
+func ACCESS_TOKEN_TTL() time.Duration {
+	return durationFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// Sessions that aren't refreshed in this time expire
+func REFRESH_TOKEN_TTL() time.Duration {
+	return durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// How often sessions revoked on other instances are picked up
+func SESSION_DENYLIST_INTERVAL() time.Duration {
+	return durationFromEnv("SESSION_DENYLIST_INTERVAL", 10*time.Second)
+}
+
+// How long roles and account state are cached; changes on other instances take effect after this
+func ACCOUNT_CACHE_TTL() time.Duration {
+	return durationFromEnv("ACCOUNT_CACHE_TTL", 10*time.Second)
+}
+
+// Only used by the smtp mail driver
+func SMTP_PORT() int {
+	if os.Getenv("SMTP_PORT") == "" {
+		return 587
+	}
+
+	port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+	if err != nil || port <= 0 {
+		panic("Invalid config: SMTP_PORT")
+	}
+	return port
+}
+
+// Enabled payment providers, comma separated; the first is the default. Supported are: manual, webhook
+func PAYMENT_PROVIDERS() []string {
+	// Fall back to cash on pickup if not set
+	if os.Getenv("PAYMENT_PROVIDERS") == "" {
+		return []string{"manual"}
+	}
+
+	providers := []string{}
+	for _, p := range strings.Split(os.Getenv("PAYMENT_PROVIDERS"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+// Shown to buyers who pay manually; for ex. bank details
+func PAYMENT_MANUAL_INSTRUCTIONS() string {
+	return os.Getenv("PAYMENT_MANUAL_INSTRUCTIONS")
+}
+
+// Only used by the webhook provider; where checkouts are started
+func PAYMENT_WEBHOOK_URL() string {
+	return os.Getenv("PAYMENT_WEBHOOK_URL")
+}
+
+// Only used by the webhook provider; signs requests in both directions
+func PAYMENT_WEBHOOK_SECRET() string {
+	return os.Getenv("PAYMENT_WEBHOOK_SECRET")
+}
+
+// Prices are compared in this currency, unless a query asks for another one (ISO 4217)
+func CURRENCY() string {
+	// Fall back to USD if not set
+	if os.Getenv("CURRENCY") == "" {
+		return "USD"
+	}
+	return strings.ToUpper(os.Getenv("CURRENCY"))
+}
+
+// Accepts Go durations; for ex. 24h, 90m
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	if os.Getenv(key) == "" {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		panic("Invalid config: " + key)
+	}
+	return d
+}
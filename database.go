@@ -0,0 +1,26 @@
+package main
+
+import (
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SQLite never enforced foreign keys (PRAGMA foreign_keys is off), so we don't create them on Postgres either
+// This keeps both engines behaving the same, for ex. on cascading deletes
+func openDatabase() (*gorm.DB, error) {
+	config := &gorm.Config{
+		TranslateError: true,
+	}
+
+	var dialector gorm.Dialector
+	switch DB_DRIVER() {
+	case "postgres":
+		dialector = postgres.Open(DB_DSN())
+		config.DisableForeignKeyConstraintWhenMigrating = true
+	default:
+		dialector = sqlite.Open(DB_PATH())
+	}
+
+	return gorm.Open(dialector, config)
+}
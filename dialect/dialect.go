@@ -0,0 +1,99 @@
+package dialect
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SQLite   = "sqlite"
+	Postgres = "postgres"
+)
+
+// Produces engine specific SQL for the queries we assemble by hand
+// Anything the ORM builds for us does not need this
+//
+// Notes:
+//   - Column names are inserted as-is; never pass user input
+//   - JSON paths are inserted too, so only safe segments are accepted; see CheckJSONPath
+//   - Values always go through placeholders (?)
+type Dialect struct {
+	Name string
+}
+
+func For(db *gorm.DB) Dialect {
+	return Dialect{Name: db.Dialector.Name()}
+}
+
+var jsonPathSegment = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Segments of JSON paths may only contain letters, numbers and underscores, since they're inserted into the query
+func CheckJSONPath(path ...string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("empty JSON path")
+	}
+	for _, segment := range path {
+		if !jsonPathSegment.MatchString(segment) {
+			return fmt.Errorf("unsafe JSON path segment %q", segment)
+		}
+	}
+	return nil
+}
+
+// Returns the value at path as text (Postgres) or its JSON type (SQLite)
+// Compare against numbers with Cast; for ex. JSONExtract("data", "address", "city")
+// Panics if the path isn't safe; check paths that aren't constants with CheckJSONPath first
+func (d Dialect) JSONExtract(column string, path ...string) string {
+	if err := CheckJSONPath(path...); err != nil {
+		panic(err)
+	}
+
+	switch d.Name {
+	case Postgres:
+		// Cast, so this works on both json and text columns
+		if len(path) == 1 {
+			return fmt.Sprintf("CAST(%s AS JSONB)->>'%s'", column, path[0])
+		}
+		return fmt.Sprintf("CAST(%s AS JSONB)#>>'{%s}'", column, strings.Join(path, ","))
+	default:
+		return fmt.Sprintf("json_extract(%s, '$.%s')", column, strings.Join(path, "."))
+	}
+}
+
+// Supported types are: integer, text
+//
+// Notes:
+//   - On Postgres, integer casts to NUMERIC, since values like "12.50" would fail otherwise
+//     expr is expected to be text there; for ex. the result of JSONExtract
+func (d Dialect) Cast(expr, castType string) string {
+	switch castType {
+	case "integer":
+		if d.Name == Postgres {
+			return fmt.Sprintf("CAST(NULLIF(%s, '') AS NUMERIC)", expr)
+		}
+		return fmt.Sprintf("CAST(%s AS INTEGER)", expr)
+	case "text":
+		return fmt.Sprintf("CAST(%s AS TEXT)", expr)
+	default:
+		return expr
+	}
+}
+
+// Largest integer not greater than expr; SQLite has no FLOOR without its math functions, and CAST truncates toward zero
+func (d Dialect) Floor(expr string) string {
+	if d.Name == Postgres {
+		return fmt.Sprintf("CAST(FLOOR(%s) AS BIGINT)", expr)
+	}
+	return fmt.Sprintf("(CAST(%[1]s AS INTEGER) - (%[1]s < CAST(%[1]s AS INTEGER)))", expr)
+}
+
+// Case-insensitive LIKE; SQLite's LIKE already is for ASCII
+func (d Dialect) Like() string {
+	if d.Name == Postgres {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
@@ -0,0 +1,104 @@
+package dialect_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"tbd/dialect"
+)
+
+type dialectItem struct {
+	ID   int
+	Data datatypes.JSON
+}
+
+// SQLite always runs; Postgres only if TEST_POSTGRES_DSN is set
+// for ex. TEST_POSTGRES_DSN="host=localhost user=tbd password=tbd dbname=tbd_test sslmode=disable"
+func openDatabases(t *testing.T) map[string]*gorm.DB {
+	dbs := map[string]*gorm.DB{}
+
+	sqliteDB, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	dbs[dialect.SQLite] = sqliteDB
+
+	if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+		pgDB, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		assert.NoError(t, err)
+		dbs[dialect.Postgres] = pgDB
+	} else {
+		t.Log("TEST_POSTGRES_DSN not set; skipping Postgres")
+	}
+
+	return dbs
+}
+
+func seedItems(t *testing.T, db *gorm.DB) {
+	assert.NoError(t, db.Migrator().DropTable(&dialectItem{}))
+	assert.NoError(t, db.AutoMigrate(&dialectItem{}))
+	t.Cleanup(func() { db.Migrator().DropTable(&dialectItem{}) })
+
+	items := []dialectItem{
+		{ID: 1, Data: datatypes.JSON(`{"title": "Cozy Flat", "price": "12.50", "address": {"city": "Berlin"}}`)},
+		{ID: 2, Data: datatypes.JSON(`{"title": "Bike", "price": "9", "address": {"city": "Hamburg"}}`)},
+		{ID: 3, Data: datatypes.JSON(`{"title": "Dog sitting", "price": "100", "address": {"city": "Berlin"}}`)},
+	}
+	assert.NoError(t, db.Create(&items).Error)
+}
+
+func TestDialect(t *testing.T) {
+	for name, db := range openDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			seedItems(t, db)
+			d := dialect.For(db)
+			assert.Equal(t, name, d.Name)
+
+			// Nested JSON path
+			var ids []int
+			query := fmt.Sprintf("SELECT id FROM dialect_items WHERE %s = ? ORDER BY id", d.JSONExtract("data", "address", "city"))
+			assert.NoError(t, db.Raw(query, "Berlin").Scan(&ids).Error)
+			assert.Equal(t, []int{1, 3}, ids)
+
+			// Numeric comparison on a JSON string
+			ids = []int{}
+			query = fmt.Sprintf("SELECT id FROM dialect_items WHERE %s > ? ORDER BY id", d.Cast(d.JSONExtract("data", "price"), "integer"))
+			assert.NoError(t, db.Raw(query, 10).Scan(&ids).Error)
+			assert.Equal(t, []int{1, 3}, ids)
+
+			// Case-insensitive LIKE
+			ids = []int{}
+			query = fmt.Sprintf("SELECT id FROM dialect_items WHERE %s %s ? ORDER BY id", d.JSONExtract("data", "title"), d.Like())
+			assert.NoError(t, db.Raw(query, "%cozy%").Scan(&ids).Error)
+			assert.Equal(t, []int{1}, ids)
+
+			// Text cast
+			var titles []string
+			query = fmt.Sprintf("SELECT %s FROM dialect_items WHERE %s = ?", d.JSONExtract("data", "title"), d.Cast("id", "text"))
+			assert.NoError(t, db.Raw(query, "2").Scan(&titles).Error)
+			assert.Equal(t, []string{"Bike"}, titles)
+
+			// Floor, also of negative values
+			var floors []int
+			query = fmt.Sprintf("SELECT %s FROM dialect_items ORDER BY id", d.Floor("(id - 2) * 1.5"))
+			assert.NoError(t, db.Raw(query).Scan(&floors).Error)
+			assert.Equal(t, []int{-2, 0, 1}, floors)
+		})
+	}
+}
+
+func TestCheckJSONPath(t *testing.T) {
+	assert.NoError(t, dialect.CheckJSONPath("address", "postal_code"))
+	for _, path := range [][]string{{}, {"city'"}, {"address", "city') OR 1=1 --"}, {"a.b"}, {""}} {
+		assert.Error(t, dialect.CheckJSONPath(path...), path)
+	}
+
+	d := dialect.Dialect{Name: dialect.SQLite}
+	assert.Panics(t, func() { d.JSONExtract("data", "title'") })
+}
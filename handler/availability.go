@@ -0,0 +1,368 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"tbd/dialect"
+	"tbd/ical"
+	"tbd/model"
+)
+
+// Accepts a date (2006-01-02) or RFC 3339
+func parseDateParam(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t.UTC(), err
+}
+
+// Optional from and to query params; both or neither
+func parsePeriodParams(fromParam, toParam string) (*time.Time, *time.Time, error) {
+	if fromParam == "" && toParam == "" {
+		return nil, nil, nil
+	}
+	if fromParam == "" || toParam == "" {
+		return nil, nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: "Both start and end of the period are required."}
+	}
+
+	from, err := parseDateParam(fromParam)
+	if err != nil {
+		return nil, nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid start date."}
+	}
+	to, err := parseDateParam(toParam)
+	if err != nil {
+		return nil, nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid end date."}
+	}
+	if !to.After(from) {
+		return nil, nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: "End date must be after start date."}
+	}
+
+	return &from, &to, nil
+}
+
+func (h *Handler) bookableEntryTypes() ([]string, error) {
+	names := []string{}
+	for _, t := range model.BuiltinEntryTypes() {
+		if t.Bookable {
+			names = append(names, t.Name)
+		}
+	}
+
+	runtimeNames := []string{}
+	if err := h.DB.Model(&model.EntryType{}).Where("bookable = ?", true).Pluck("name", &runtimeNames).Error; err != nil {
+		return nil, err
+	}
+
+	return append(names, runtimeNames...), nil
+}
+
+// Bookable entries that have neither an accepted reservation nor a block in [from, to)
+// If the entry has from / to in data, the period must be within them
+func (h *Handler) appendAvailableBetween(d dialect.Dialect, query string, params *[]interface{}, from, to time.Time) (string, error) {
+	types, err := h.bookableEntryTypes()
+	if err != nil {
+		return query, err
+	}
+
+	dataFrom := d.JSONExtract("entries.data", "from")
+	dataTo := d.JSONExtract("entries.data", "to")
+
+	query += fmt.Sprintf(` AND entries.type IN ?
+		AND NOT EXISTS (SELECT 1 FROM reservations WHERE reservations.entry_id = entries.id
+			AND reservations.status = ? AND reservations.start_date < ? AND reservations.end_date > ?)
+		AND NOT EXISTS (SELECT 1 FROM availability_blocks WHERE availability_blocks.entry_id = entries.id
+			AND availability_blocks.start_date < ? AND availability_blocks.end_date > ?)
+		AND (%[1]s IS NULL OR %[1]s = '' OR %[1]s <= ?)
+		AND (%[2]s IS NULL OR %[2]s = '' OR %[2]s >= ?)`, dataFrom, dataTo)
+
+	*params = append(*params,
+		types,
+		model.ReservationStatusAccepted, to, from,
+		to, from,
+		from.Format(time.RFC3339), to.Format(time.RFC3339),
+	)
+	return query, nil
+}
+
+// Accepted reservations and blocks of an entry, ordered by start; limited to [from, to) if given
+func (h *Handler) busyPeriods(entryID string, from, to *time.Time) ([]model.BusyPeriod, error) {
+	reservations := []model.Reservation{}
+	query := h.DB.Where("entry_id = ? AND status = ?", entryID, model.ReservationStatusAccepted)
+	if from != nil {
+		query = query.Where("start_date < ? AND end_date > ?", *to, *from)
+	}
+	if err := query.Order("start_date ASC").Find(&reservations).Error; err != nil {
+		return nil, err
+	}
+
+	blocks := []model.AvailabilityBlock{}
+	query = h.DB.Where("entry_id = ?", entryID)
+	if from != nil {
+		query = query.Where("start_date < ? AND end_date > ?", *to, *from)
+	}
+	if err := query.Order("start_date ASC").Find(&blocks).Error; err != nil {
+		return nil, err
+	}
+
+	periods := []model.BusyPeriod{}
+	for _, r := range reservations {
+		periods = append(periods, model.BusyPeriod{StartDate: r.StartDate, EndDate: r.EndDate, Reason: "reserved"})
+	}
+	for _, b := range blocks {
+		periods = append(periods, model.BusyPeriod{StartDate: b.StartDate, EndDate: b.EndDate, Reason: "blocked"})
+	}
+	sort.SliceStable(periods, func(i, j int) bool { return periods[i].StartDate.Before(periods[j].StartDate) })
+
+	return periods, nil
+}
+
+func (h *Handler) fetchEntryByParam(c echo.Context) (*model.Entry, error) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid UUID."}
+	}
+
+	entry := model.Entry{}
+	if err := h.DB.First(&entry, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &echo.HTTPError{Code: http.StatusNotFound, Message: "Entry not found."}
+		}
+		log.Println(err)
+		return nil, &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch entry."}
+	}
+	return &entry, nil
+}
+
+// Busy periods of an entry; optionally within ?from=&to=
+func (h *Handler) FetchEntryAvailability(c echo.Context) error {
+	entry, err := h.fetchEntryByParam(c)
+	if err != nil {
+		return err
+	}
+
+	from, to, err := parsePeriodParams(c.QueryParam("from"), c.QueryParam("to"))
+	if err != nil {
+		return err
+	}
+
+	periods, err := h.busyPeriods(entry.ID, from, to)
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch availability."}
+	}
+
+	return c.JSON(http.StatusOK, ListResponse{Total: int64(len(periods)), Items: periods})
+}
+
+func (h *Handler) CreateAvailabilityBlock(c echo.Context) error {
+	if _, err := h.isOwnerOrAdmin(c, c.Param("id"), "entry"); err != nil {
+		return err
+	}
+
+	s := model.SubmitAvailabilityBlock{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+
+	block := model.AvailabilityBlock{
+		EntryID:   c.Param("id"),
+		StartDate: s.StartDate.UTC(),
+		EndDate:   s.EndDate.UTC(),
+		Note:      s.Note,
+		Source:    model.AvailabilitySourceManual,
+	}
+	if !block.EndDate.After(block.StartDate) {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "End date must be after start date."}
+	}
+
+	if err := h.DB.Create(&block).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create availability block."}
+	}
+
+	return c.JSON(http.StatusCreated, block)
+}
+
+// Blocks from an imported calendar come back on the next sync, unless removed from that calendar
+func (h *Handler) DeleteAvailabilityBlock(c echo.Context) error {
+	if _, err := h.isOwnerOrAdmin(c, c.Param("id"), "entry"); err != nil {
+		return err
+	}
+
+	if _, err := uuid.Parse(c.Param("block_id")); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid UUID."}
+	}
+
+	r := h.DB.Where("id = ? AND entry_id = ?", c.Param("block_id"), c.Param("id")).Delete(&model.AvailabilityBlock{})
+	if r.Error != nil {
+		log.Println(r.Error)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to delete availability block."}
+	}
+
+	if r.RowsAffected == 0 {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "Availability block not found."}
+	}
+
+	return c.JSON(http.StatusOK, DeleteResponse{Deleted: r.RowsAffected})
+}
+
+// Accepted reservations and blocks as iCalendar, for other calendars to subscribe to
+// Only busy periods are shared; no names or notes
+func (h *Handler) ExportEntryCalendar(c echo.Context) error {
+	entry, err := h.fetchEntryByParam(c)
+	if err != nil {
+		return err
+	}
+
+	periods, err := h.busyPeriods(entry.ID, nil, nil)
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch availability."}
+	}
+
+	domain := os.Getenv("DOMAIN")
+	events := []ical.Event{}
+	for _, p := range periods {
+		summary := "Reserved"
+		if p.Reason == "blocked" {
+			summary = "Not available"
+		}
+		events = append(events, ical.Event{
+			UID:     fmt.Sprintf("%s-%d-%d@%s", entry.ID, p.StartDate.Unix(), p.EndDate.Unix(), domain),
+			Summary: summary,
+			Start:   p.StartDate,
+			End:     p.EndDate,
+			AllDay:  isMidnight(p.StartDate) && isMidnight(p.EndDate),
+		})
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "text/calendar; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+	return ical.Encode(c.Response(), fmt.Sprintf("-//tbd//%s//EN", domain), events)
+}
+
+func isMidnight(t time.Time) bool {
+	t = t.UTC()
+	return t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 && t.Nanosecond() == 0
+}
+
+func (h *Handler) FetchEntryCalendar(c echo.Context) error {
+	if _, err := h.isOwnerOrAdmin(c, c.Param("id"), "entry"); err != nil {
+		return err
+	}
+
+	calendar := model.EntryCalendar{}
+	if err := h.DB.First(&calendar, "entry_id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "Calendar not found."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch calendar."}
+	}
+
+	return c.JSON(http.StatusOK, calendar)
+}
+
+// Sets the remote calendar to import, and syncs it right away
+// A failed sync is not an error here; it's reported in last_error, and retried with the next sync
+func (h *Handler) SetEntryCalendar(c echo.Context) error {
+	if _, err := h.isOwnerOrAdmin(c, c.Param("id"), "entry"); err != nil {
+		return err
+	}
+
+	s := model.SubmitEntryCalendar{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "URL must be http or https."}
+	}
+
+	calendar := model.EntryCalendar{}
+	err = h.DB.First(&calendar, "entry_id = ?", c.Param("id")).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch calendar."}
+	}
+
+	calendar.EntryID = c.Param("id")
+	calendar.URL = s.URL
+	if err := h.DB.Save(&calendar).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to save calendar."}
+	}
+
+	if err := h.CalendarSync.Sync(c.Request().Context(), &calendar); err != nil {
+		log.Printf("Failed to sync calendar of entry %s: %v", calendar.EntryID, err)
+	}
+
+	return c.JSON(http.StatusOK, calendar)
+}
+
+func (h *Handler) SyncEntryCalendar(c echo.Context) error {
+	if _, err := h.isOwnerOrAdmin(c, c.Param("id"), "entry"); err != nil {
+		return err
+	}
+
+	calendar := model.EntryCalendar{}
+	if err := h.DB.First(&calendar, "entry_id = ?", c.Param("id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "Calendar not found."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch calendar."}
+	}
+
+	if err := h.CalendarSync.Sync(c.Request().Context(), &calendar); err != nil {
+		log.Printf("Failed to sync calendar of entry %s: %v", calendar.EntryID, err)
+	}
+
+	return c.JSON(http.StatusOK, calendar)
+}
+
+// Removes the calendar, together with the blocks it imported
+func (h *Handler) DeleteEntryCalendar(c echo.Context) error {
+	if _, err := h.isOwnerOrAdmin(c, c.Param("id"), "entry"); err != nil {
+		return err
+	}
+
+	var deleted int64
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		r := tx.Where("entry_id = ?", c.Param("id")).Delete(&model.EntryCalendar{})
+		if r.Error != nil {
+			return r.Error
+		}
+		deleted = r.RowsAffected
+		return tx.Where("entry_id = ? AND source = ?", c.Param("id"), model.AvailabilitySourceICal).Delete(&model.AvailabilityBlock{}).Error
+	})
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to delete calendar."}
+	}
+
+	if deleted == 0 {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "Calendar not found."}
+	}
+
+	return c.JSON(http.StatusOK, DeleteResponse{Deleted: deleted})
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"tbd/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Short-term rental that's on offer for years, with a price no other entry has
+func createUniqueRental(t *testing.T, token string) (string, string) {
+	money, price := uniquePrice()
+
+	entryData := genEntryData("apartment-short-term-rental", nil)
+	rental := entryData["data"].(model.EntryApartmentShortTermRental)
+	rental.Price = money
+	rental.StartDate = "2020-01-01T00:00:00Z"
+	rental.EndDate = "2040-01-01T00:00:00Z"
+	entryData["data"] = rental
+
+	return createEntry(t, token, entryData).ID, price
+}
+
+func rentalIsAvailable(t *testing.T, id, price, from, to string) bool {
+	url := fmt.Sprintf("http://localhost:1323/entries?type=apartment-short-term-rental&currency=USD&price=eq,%s&available_from=%s&available_to=%s", price, from, to)
+	rec := performRequest(t, http.MethodGet, url, "", nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response struct {
+		Items []model.PublicEntry `json:"items"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	assert.NoError(t, err)
+
+	for _, entry := range response.Items {
+		if entry.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestAvailabilityBlocks(t *testing.T) {
+	token := signupAndLogin(t)
+	id, price := createUniqueRental(t, token)
+
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 10)
+	date := func(days int) string { return day.AddDate(0, 0, days).Format("2006-01-02") }
+
+	assert.True(t, rentalIsAvailable(t, id, price, date(0), date(3)))
+
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/entries/"+id+"/availability", token, model.SubmitAvailabilityBlock{
+		StartDate: day.AddDate(0, 0, 1),
+		EndDate:   day.AddDate(0, 0, 2),
+		Note:      "Renovation",
+	})
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+
+	var block model.AvailabilityBlock
+	err := json.NewDecoder(rec.Body).Decode(&block)
+	assert.NoError(t, err)
+
+	assert.False(t, rentalIsAvailable(t, id, price, date(0), date(3)))
+	assert.True(t, rentalIsAvailable(t, id, price, date(2), date(5)))
+
+	// Outside of what the entry offers
+	assert.False(t, rentalIsAvailable(t, id, price, "2041-01-01", "2041-01-05"))
+
+	// Public, without the note
+	rec = performRequest(t, http.MethodGet, fmt.Sprintf("http://localhost:1323/entries/%s/availability?from=%s&to=%s", id, date(0), date(3)), "", nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	body, _ := io.ReadAll(rec.Body)
+	assert.Contains(t, string(body), `"reason":"blocked"`)
+	assert.NotContains(t, string(body), "Renovation")
+
+	// Only the owner changes availability
+	anotherUserToken := signupAndLogin(t)
+	rec = performRequest(t, http.MethodDelete, "http://localhost:1323/entries/"+id+"/availability/"+block.ID, anotherUserToken, nil)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodDelete, "http://localhost:1323/entries/"+id+"/availability/"+block.ID, token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.True(t, rentalIsAvailable(t, id, price, date(0), date(3)))
+}
+
+func TestAvailabilityAcceptedReservation(t *testing.T) {
+	ownerToken := signupAndLogin(t)
+	id, price := createUniqueRental(t, ownerToken)
+
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 10)
+	date := func(days int) string { return day.AddDate(0, 0, days).Format("2006-01-02") }
+
+	requesterToken := signupAndLogin(t)
+	reservation := createReservation(t, requesterToken, id, day, day.AddDate(0, 0, 2))
+
+	// Requested reservations don't block
+	assert.True(t, rentalIsAvailable(t, id, price, date(1), date(3)))
+
+	assert.Equal(t, http.StatusOK, setReservationStatus(t, ownerToken, reservation.ID, model.ReservationStatusAccepted))
+	assert.False(t, rentalIsAvailable(t, id, price, date(1), date(3)))
+	assert.True(t, rentalIsAvailable(t, id, price, date(2), date(4)))
+
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries/"+id+"/calendar.ics", "", nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.True(t, strings.HasPrefix(rec.Header.Get("Content-Type"), "text/calendar"))
+
+	body, _ := io.ReadAll(rec.Body)
+	assert.Contains(t, string(body), "BEGIN:VEVENT")
+	assert.Contains(t, string(body), "DTSTART;VALUE=DATE:"+day.Format("20060102"))
+	assert.Contains(t, string(body), "SUMMARY:Reserved")
+}
+
+func TestAvailabilityBlockedReservation(t *testing.T) {
+	ownerToken := signupAndLogin(t)
+	id, _ := createUniqueRental(t, ownerToken)
+
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 10)
+
+	// Requested before the owner blocked the period
+	requesterToken := signupAndLogin(t)
+	reservation := createReservation(t, requesterToken, id, day, day.AddDate(0, 0, 2))
+
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/entries/"+id+"/availability", ownerToken, model.SubmitAvailabilityBlock{
+		StartDate: day.AddDate(0, 0, 1),
+		EndDate:   day.AddDate(0, 0, 3),
+	})
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+
+	rec = reserveEntry(t, signupAndLogin(t), id, day.AddDate(0, 0, 2), day.AddDate(0, 0, 4))
+	assert.Equal(t, http.StatusConflict, rec.StatusCode)
+	assert.Equal(t, http.StatusConflict, setReservationStatus(t, ownerToken, reservation.ID, model.ReservationStatusAccepted))
+
+	// Right after the block is fine
+	createReservation(t, requesterToken, id, day.AddDate(0, 0, 3), day.AddDate(0, 0, 5))
+}
+
+func TestAvailabilityInvalidPeriod(t *testing.T) {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries?available_from=2030-01-05&available_to=2030-01-01", "", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/entries?available_from=2030-01-05", "", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+}
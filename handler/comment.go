@@ -4,7 +4,6 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"strconv"
 	"tbd/model"
 
 	"github.com/google/uuid"
@@ -19,21 +18,37 @@ func (h *Handler) FetchComments(c echo.Context) error {
 		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "You need to supply an entry ID (entry_id) query param to fetch comments."}
 	}
 
-	limit, _ := strconv.Atoi(c.QueryParam("limit"))
-	offset, _ := strconv.Atoi(c.QueryParam("offset"))
+	page, order, after, err := bindPage(c, creationSorts("comments"), "newest")
+	if err != nil {
+		return err
+	}
+
+	// Offset is only used without a cursor
+	offset := page.Offset
+	// A session, so counting doesn't change the query
+	query := h.DB.Model(&model.Comment{}).Where("comments.entry_id = ?", entryID).Session(&gorm.Session{})
+
+	response := PageResponse{}
+	if page.Total {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch comments."}
+		}
+		response.Total = &count
+	}
 
-	if limit == 0 {
-		limit = 20
+	if after != nil {
+		params := []interface{}{}
+		query = query.Where(order.after(after, &params), params...)
+		offset = 0
 	}
 
 	comments := []model.Comment{}
-	var count int64
-	err := h.DB.Model(&model.Comment{}).
+	err = query.
 		Preload("CreatedBy").
-		Where("entry_id = ?", entryID).
-		Count(&count).
-		Order("created_at DESC").
-		Limit(limit).
+		Order(order.orderBy()).
+		Limit(page.Limit + 1).
 		Offset(offset).
 		Find(&comments).Error
 	if err != nil {
@@ -44,17 +59,24 @@ func (h *Handler) FetchComments(c echo.Context) error {
 		}
 	}
 
-	return c.JSON(
-		http.StatusOK,
-		ListResponse{
-			Total: count,
-			Items: responseArrFormatter[model.Comment](comments, nil, os.Getenv("DOMAIN")),
-		},
-	)
+	if len(comments) > page.Limit {
+		comments = comments[:page.Limit]
+		response.NextCursor, err = h.nextCursor(order, "comments", "comments.id", comments[len(comments)-1].ID)
+		if err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch comments."}
+		}
+	}
+
+	response.Items = responseArrFormatter[model.Comment](comments, nil, os.Getenv("DOMAIN"))
+	return c.JSON(http.StatusOK, response)
 }
 
 func (h *Handler) MakeComment(c echo.Context) error {
 	reqUser := c.Get("user").(*model.AuthUser)
+	if err := h.requireConfirmedEmail(*reqUser); err != nil {
+		return err
+	}
 	user := model.User{ID: reqUser.ID}
 	err := h.DB.Model(&model.User{}).First(&user).Error
 	if err != nil {
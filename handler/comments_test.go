@@ -51,7 +51,7 @@ func TestCommentLifecycle(t *testing.T) {
 	commentID := createdComment.ID
 
 	// List entry comments
-	url := fmt.Sprintf("http://localhost:1323/comments?entry_id=%v", entryID)
+	url := fmt.Sprintf("http://localhost:1323/comments?entry_id=%v&total=true", entryID)
 	rec := performRequest(t, http.MethodGet, url, token, nil)
 	assert.Equal(t, http.StatusOK, rec.StatusCode)
 
@@ -1,9 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 	"strings"
+	"tbd/dialect"
 	"tbd/model"
+
+	"github.com/labstack/echo/v4"
 )
 
 type UpdateResponse struct {
@@ -14,6 +19,12 @@ type DeleteResponse struct {
 	Deleted int64 `json:"deleted"`
 }
 
+// Returned with 400, if one or more fields are invalid
+type ValidationErrorResponse struct {
+	Message string                `json:"message"`
+	Errors  model.EntryDataErrors `json:"errors"`
+}
+
 type ListResponse struct {
 	Total int64       `json:"total"`
 	Items interface{} `json:"items"`
@@ -47,13 +58,9 @@ func getOperatorAndValue(param string) (string, []string) {
 	return "eq", []string{param}
 }
 
-func appendQuery(query, field, op, castType string, value []string, params *[]interface{}) string {
-	fieldCast := field
-	if castType == "integer" {
-		fieldCast = fmt.Sprintf("CAST(%s AS INTEGER)", field)
-	} else if castType == "text" {
-		fieldCast = fmt.Sprintf("CAST(%s AS TEXT)", field)
-	}
+// Values are usually strings from the query; pass numbers to compare against expressions without a column type
+func appendQuery[T any](d dialect.Dialect, query, field, op, castType string, value []T, params *[]interface{}) string {
+	fieldCast := d.Cast(field, castType)
 
 	switch op {
 	case "gt":
@@ -75,8 +82,19 @@ func appendQuery(query, field, op, castType string, value []string, params *[]in
 		query += fmt.Sprintf(" AND %s BETWEEN ? AND ?", fieldCast)
 		*params = append(*params, value[0], value[1])
 	case "lk":
-		query += fmt.Sprintf(" AND %s LIKE ?", fieldCast)
-		*params = append(*params, "%"+value[0]+"%")
+		query += fmt.Sprintf(" AND %s %s ?", fieldCast, d.Like())
+		*params = append(*params, fmt.Sprintf("%%%v%%", value[0]))
 	}
 	return query
 }
+
+func entryDataHTTPError(err error) *echo.HTTPError {
+	var dataErrs model.EntryDataErrors
+	if errors.As(err, &dataErrs) {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: ValidationErrorResponse{
+			Message: "Data is invalid.",
+			Errors:  dataErrs,
+		}}
+	}
+	return &echo.HTTPError{Code: http.StatusBadRequest, Message: err.Error()}
+}
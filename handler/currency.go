@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm/clause"
+
+	"tbd/model"
+)
+
+// Price of an entry in minor units of currency, as SQL; without convert, entries in other currencies are left out
+// With convert, prices are converted with the rate table; entries in currencies without a rate are left out
+//
+// Notes:
+//   - Rates are inlined; currency codes are checked against ISO 4217 and rates are numbers, so that's safe
+//   - Returns the expression, and the condition to add to the query
+func (h *Handler) priceExpression(currency string, convert bool, params *[]interface{}) (string, string, error) {
+	if !convert {
+		*params = append(*params, currency)
+		return "entries.price_amount", " AND entries.price_currency = ?", nil
+	}
+
+	rates := []model.CurrencyRate{}
+	if err := h.DB.Find(&rates).Error; err != nil {
+		return "", "", err
+	}
+
+	factors := model.ConversionFactors(rates, currency)
+	currencies := make([]string, 0, len(factors))
+	for c := range factors {
+		currencies = append(currencies, c)
+	}
+	sort.Strings(currencies)
+
+	expr := "CASE entries.price_currency"
+	for _, c := range currencies {
+		if !model.CurrencyIsValid(c) {
+			continue
+		}
+		expr += fmt.Sprintf(" WHEN '%s' THEN entries.price_amount * %s", c, strconv.FormatFloat(factors[c], 'g', -1, 64))
+	}
+	expr += " END"
+
+	return expr, fmt.Sprintf(" AND entries.price_amount IS NOT NULL AND (%s) IS NOT NULL", expr), nil
+}
+
+// Adds the price filter (in major units of currency; for ex. price=bt,10,20.50) and returns the expression to sort on
+// Returns an empty expression if neither price, currency nor a price sort are requested
+func (h *Handler) appendPriceFilter(queryParams *model.EntryQueryParams, query string, params *[]interface{}) (string, string, error) {
+	sortsByPrice := queryParams.Sort == "price_asc" || queryParams.Sort == "price_desc"
+	if queryParams.Price == "" && queryParams.Currency == "" && !sortsByPrice {
+		return query, "", nil
+	}
+
+	currency := strings.ToUpper(queryParams.Currency)
+	if currency == "" {
+		currency = h.Currency
+	}
+	if !model.CurrencyIsValid(currency) {
+		return query, "", &echo.HTTPError{Code: http.StatusBadRequest, Message: "Currency is not supported."}
+	}
+
+	expr, condition, err := h.priceExpression(currency, queryParams.Convert, params)
+	if err != nil {
+		log.Println(err)
+		return query, "", &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch currency rates."}
+	}
+	query += condition
+
+	if queryParams.Price != "" {
+		op, values := getOperatorAndValue(queryParams.Price)
+		amounts := []int64{}
+		for _, v := range values {
+			amount, err := model.ParseAmount(v, currency)
+			if err != nil {
+				return query, "", &echo.HTTPError{Code: http.StatusBadRequest, Message: "Price is invalid."}
+			}
+			amounts = append(amounts, amount)
+		}
+		if op == "lk" || (op == "bt" && len(amounts) != 2) {
+			return query, "", &echo.HTTPError{Code: http.StatusBadRequest, Message: "Price is invalid."}
+		}
+		query = appendQuery(h.dialect(), query, expr, op, "", amounts, params)
+	}
+
+	return query, expr, nil
+}
+
+func (h *Handler) FetchCurrencyRates(c echo.Context) error {
+	rates := []model.CurrencyRate{}
+	if err := h.DB.Order("base, quote").Find(&rates).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch currency rates."}
+	}
+
+	return c.JSON(http.StatusOK, ListResponse{Total: int64(len(rates)), Items: rates})
+}
+
+func currencyPairParams(c echo.Context) (string, string, error) {
+	base := strings.ToUpper(c.Param("base"))
+	quote := strings.ToUpper(c.Param("quote"))
+	if !model.CurrencyIsValid(base) || !model.CurrencyIsValid(quote) {
+		return "", "", &echo.HTTPError{Code: http.StatusBadRequest, Message: "Currency is not supported."}
+	}
+	if base == quote {
+		return "", "", &echo.HTTPError{Code: http.StatusBadRequest, Message: "Base and quote must differ."}
+	}
+	return base, quote, nil
+}
+
+// Sets the rate of a pair, for ex. PUT /admin/currency-rates/EUR/USD {"rate": 1.08}
+func (h *Handler) SetCurrencyRate(c echo.Context) error {
+	if err := isAdmin(c); err != nil {
+		return err
+	}
+
+	base, quote, err := currencyPairParams(c)
+	if err != nil {
+		return err
+	}
+
+	s := model.SubmitCurrencyRate{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+
+	rate := model.CurrencyRate{Base: base, Quote: quote, Rate: s.Rate, UpdatedAt: time.Now().UTC()}
+	err = h.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base"}, {Name: "quote"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+	}).Create(&rate).Error
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to set currency rate."}
+	}
+
+	return c.JSON(http.StatusOK, rate)
+}
+
+func (h *Handler) DeleteCurrencyRate(c echo.Context) error {
+	if err := isAdmin(c); err != nil {
+		return err
+	}
+
+	base, quote, err := currencyPairParams(c)
+	if err != nil {
+		return err
+	}
+
+	r := h.DB.Where("base = ? AND quote = ?", base, quote).Delete(&model.CurrencyRate{})
+	if r.Error != nil {
+		log.Println(r.Error)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to delete currency rate."}
+	}
+
+	if r.RowsAffected == 0 {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "Currency rate not found."}
+	}
+
+	return c.JSON(http.StatusOK, DeleteResponse{Deleted: r.RowsAffected})
+}
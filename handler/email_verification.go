@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"tbd/mail"
+	"tbd/model"
+)
+
+var errEmailNotConfirmed = &echo.HTTPError{Code: http.StatusForbidden, Message: "Please confirm your email first."}
+
+// Users wait this long before they can ask for another token
+const emailVerificationCooldown = time.Minute
+
+func (h *Handler) emailVerificationTTL() time.Duration {
+	if h.EmailVerificationTTL <= 0 {
+		return 24 * time.Hour
+	}
+	return h.EmailVerificationTTL
+}
+
+// Emails a new token to confirm the email of the user; earlier tokens stop working
+// Users without an email, or without a mailer, are skipped
+func (h *Handler) sendEmailVerification(ctx context.Context, user model.User) error {
+	if user.Email == nil || *user.Email == "" || h.Mailer == nil {
+		return nil
+	}
+
+	ttl := h.emailVerificationTTL()
+	userToken, token, err := model.NewUserToken(user.ID, model.UserTokenVerifyEmail, ttl)
+	if err != nil {
+		return err
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, model.UserTokenVerifyEmail).Delete(&model.UserToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&userToken).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("Confirm your email on %s with this token:\n\n%s\n\nIt expires in %s. If you didn't sign up, ignore this email.", os.Getenv("DOMAIN"), token, ttl)
+	return h.Mailer.Send(ctx, mail.Message{To: *user.Email, Subject: "Confirm your email", Body: body})
+}
+
+// Only lets users who confirmed their email through, when the community requires it; admins always pass
+// Whether they did comes from the account, as the authorization middleware resolved it
+func (h *Handler) requireConfirmedEmail(user model.AuthUser) error {
+	if !h.RequireConfirmedEmail || user.IsAdmin || user.IsConfirmed {
+		return nil
+	}
+	return errEmailNotConfirmed
+}
+
+// Confirms the email of a user with the token they were sent; tokens work once, until they expire
+// Notes:
+//   - Doesn't require a login, so the token can be used from any device
+func (h *Handler) VerifyEmail(c echo.Context) error {
+	req := model.VerifyEmailReq{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	invalid := &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid or expired token."}
+
+	user := model.User{}
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		userToken := model.UserToken{}
+		r := tx.Where("token_hash = ? AND purpose = ?", model.HashToken(req.Token), model.UserTokenVerifyEmail).First(&userToken)
+		if r.Error != nil {
+			if r.Error == gorm.ErrRecordNotFound {
+				return invalid
+			}
+			return r.Error
+		}
+		if userToken.UsedAt != nil || time.Now().After(userToken.ExpiresAt) {
+			return invalid
+		}
+
+		// Only one request gets to use it
+		now := time.Now()
+		r = tx.Model(&model.UserToken{}).Where("id = ? AND used_at IS NULL", userToken.ID).Update("used_at", now)
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			return invalid
+		}
+
+		if err := tx.Where("id = ? AND deleted_at IS NULL", userToken.UserID).First(&user).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return invalid
+			}
+			return err
+		}
+		user.IsConfirmed = true
+		return tx.Model(&model.User{}).Where("id = ?", user.ID).Update("is_confirmed", true).Error
+	})
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+
+	h.Accounts.Invalidate(user.ID)
+
+	return c.JSON(http.StatusOK, user.ToUserPrivateFormat(os.Getenv("DOMAIN")))
+}
+
+// Sends another token to confirm the email of the user; at most once a minute
+func (h *Handler) ResendVerification(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	user := model.User{}
+	if err := h.DB.Where("id = ?", reqUser.ID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "User not found."}
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	if user.IsConfirmed {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Email is already confirmed."}
+	}
+	if user.Email == nil || *user.Email == "" {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "There's no email to confirm."}
+	}
+
+	var recent int64
+	since := time.Now().Add(-emailVerificationCooldown)
+	r := h.DB.Model(&model.UserToken{}).Where("user_id = ? AND purpose = ? AND created_at > ?", user.ID, model.UserTokenVerifyEmail, since).Count(&recent)
+	if r.Error != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	if recent > 0 {
+		return &echo.HTTPError{Code: http.StatusTooManyRequests, Message: "Please wait a minute before asking again."}
+	}
+
+	if err := h.sendEmailVerification(c.Request().Context(), user); err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Something went wrong. Please try again later."}
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
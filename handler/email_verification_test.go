@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icrowley/fake"
+	"github.com/stretchr/testify/assert"
+
+	"tbd/model"
+)
+
+var mailTokenPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// The token in the last of at least count messages to the address, in the directory of the env variable; waits a few seconds
+// for them, since some are sent in the background. Requires the server to run with the file driver and the same directory
+func waitForToken(t *testing.T, dirEnv, address string, count int) string {
+	if os.Getenv(dirEnv) == "" {
+		t.Skipf("%s is not set; start the server and the tests with the file driver and the same %s", dirEnv, dirEnv)
+	}
+
+	files := []string{}
+	for i := 0; i < 50 && len(files) < count; i++ {
+		if i > 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		var err error
+		files, err = filepath.Glob(filepath.Join(os.Getenv(dirEnv), "*-"+address+".txt"))
+		assert.NoError(t, err)
+	}
+	if len(files) < count {
+		t.Fatalf("%d of %d messages to %s", len(files), count, address)
+	}
+	sort.Strings(files)
+
+	content, err := os.ReadFile(files[len(files)-1])
+	assert.NoError(t, err)
+	return mailTokenPattern.FindString(string(content))
+}
+
+func TestEmailVerification(t *testing.T) {
+	email := "Verify." + fake.EmailAddress()
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/signup", "", model.SignupUserReq{Name: fake.FullName(), Email: email, Password: "password123"})
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+
+	var user model.PrivateUser
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&user))
+	if assert.NotNil(t, user.Email) {
+		assert.Equal(t, strings.ToLower(email), *user.Email)
+	}
+	assert.False(t, user.IsConfirmed)
+
+	token := waitForToken(t, "MAIL_PATH", strings.ToLower(email), 1)
+	assert.NotEmpty(t, token)
+
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/login", "", model.LoginUserReq{Email: email, Password: "password123"})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	var login model.LoginUserReqResponse
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&login))
+
+	// Asking again right away is too soon
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/me/verify", login.Token, nil)
+	assert.Equal(t, http.StatusTooManyRequests, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/verify", "", model.VerifyEmailReq{Token: strings.Repeat("0", 64)})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/verify", "", model.VerifyEmailReq{Token: token})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&user))
+	assert.True(t, user.IsConfirmed)
+
+	// Tokens work once
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/verify", "", model.VerifyEmailReq{Token: token})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me", login.Token, nil)
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&user))
+	assert.True(t, user.IsConfirmed)
+
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/me/verify", login.Token, nil)
+	assert.Equal(t, http.StatusConflict, rec.StatusCode)
+}
+
+func TestRequireConfirmedEmail(t *testing.T) {
+	h := &Handler{}
+	assert.NoError(t, h.requireConfirmedEmail(model.AuthUser{ID: "unconfirmed"}))
+
+	h.RequireConfirmedEmail = true
+	assert.Equal(t, errEmailNotConfirmed, h.requireConfirmedEmail(model.AuthUser{ID: "unconfirmed"}))
+	assert.NoError(t, h.requireConfirmedEmail(model.AuthUser{ID: "confirmed", IsConfirmed: true}))
+	assert.NoError(t, h.requireConfirmedEmail(model.AuthUser{ID: "unconfirmed", IsAdmin: true}))
+}
@@ -1,13 +1,14 @@
 package handler
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/go-playground/validator"
 	"github.com/google/uuid"
@@ -18,167 +19,230 @@ import (
 	"tbd/pgp"
 )
 
-func (h *Handler) FetchEntries(c echo.Context) error {
+func bindEntryQueryParams(c echo.Context) (*model.EntryQueryParams, error) {
 	queryParams := new(model.EntryQueryParams)
 	if err := (&echo.DefaultBinder{}).BindQueryParams(c, queryParams); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
 	// Validate query params
 	var validate = validator.New()
 	if err := validate.Struct(queryParams); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
+	return queryParams, nil
+}
 
-	// defaults
-	if queryParams.Offset < 0 {
-		queryParams.Offset = 0
-	}
-	if queryParams.Limit < 1 {
-		queryParams.Limit = 20
-	}
+// Binds saved searches the same way as requests
+var queryBinder = echo.New()
 
-	var entries []model.PublicEntry
-	var count int64
-	var params []interface{}
+func parseEntryQueryParams(values url.Values) (*model.EntryQueryParams, error) {
+	req := &http.Request{Method: http.MethodGet, URL: &url.URL{RawQuery: values.Encode()}}
+	return bindEntryQueryParams(queryBinder.NewContext(req, nil))
+}
 
-	query := ""
+// Conditions of the entry list, to go after WHERE 1=1 on entries joined with cities
+// Shared by FetchEntries and FetchEntriesGeoJSON, so the map shows what the list does
+type entryFilter struct {
+	query  string
+	params []interface{}
+	// Expressions to sort on; see appendPriceFilter and appendGeoFilter
+	priceExpr    string
+	distanceExpr string
+	// Set if searching near a point
+	center *model.Point
+}
+
+// values are the raw query params; data.* filters are read from them
+func (h *Handler) entryFilters(values url.Values, queryParams *model.EntryQueryParams) (entryFilter, error) {
+	d := h.dialect()
+
+	// Drafts, paused, sold, expired and archived entries are not listed
+	query, params := visibleEntries()
+	query = " AND " + query
 
 	if queryParams.Type != "" {
 		query += " AND type = ?"
 		params = append(params, queryParams.Type)
 	}
-	fmt.Println("Parameters TYPE: ", params)
 
-	if queryParams.Price != "" {
-		op, val := getOperatorAndValue(queryParams.Price)
-		query = appendQuery(query, "JSON_EXTRACT(data, '$.price')", op, "integer", val, &params)
+	// Filters on fields the type declares as filterable; for ex. data.price=gt,100
+	query, err := h.appendDataFilters(values, queryParams.Type, query, &params)
+	if err != nil {
+		return entryFilter{}, err
+	}
+
+	// Prices are compared in one currency; see appendPriceFilter
+	query, priceExpr, err := h.appendPriceFilter(queryParams, query, &params)
+	if err != nil {
+		return entryFilter{}, err
 	}
-	fmt.Println("Parameters PRICE: ", params)
 
 	if queryParams.StartDate != "" {
 		op, val := getOperatorAndValue(queryParams.StartDate)
-		query = appendQuery(query, "JSON_EXTRACT(data, '$.start_date')", op, "", val, &params)
+		query = appendQuery(d, query, d.JSONExtract("data", "start_date"), op, "", val, &params)
 	}
 
 	if queryParams.EndDate != "" {
 		op, val := getOperatorAndValue(queryParams.EndDate)
-		query = appendQuery(query, "JSON_EXTRACT(data, '$.end_date')", op, "integer", val, &params)
+		query = appendQuery(d, query, d.JSONExtract("data", "end_date"), op, "integer", val, &params)
 	}
 
 	if queryParams.Country != "" {
 		op, val := getOperatorAndValue(queryParams.Country)
-		query = appendQuery(query, "cities.country_code", op, "", val, &params)
+		query = appendQuery(d, query, "cities.country_code", op, "", val, &params)
 	}
 
 	if queryParams.City != "" {
 		op, val := getOperatorAndValue(queryParams.City)
-		query = appendQuery(query, "cities.name", op, "", val, &params)
+		query = appendQuery(d, query, "cities.name", op, "", val, &params)
 	}
 
 	if queryParams.CitySlug != "" {
 		op, val := getOperatorAndValue(queryParams.CitySlug)
-		query = appendQuery(query, "cities.slug", op, "", val, &params)
+		query = appendQuery(d, query, "cities.slug", op, "", val, &params)
 	}
 
 	if queryParams.CityGlobID != "" {
 		op, val := getOperatorAndValue(queryParams.CityGlobID)
-		query = appendQuery(query, "cities.glob_id", op, "", val, &params)
+		query = appendQuery(d, query, "cities.glob_id", op, "", val, &params)
 	}
 
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM entries LEFT JOIN cities ON entries.city_id = cities.id WHERE 1=1 %v", (query + ".")[:len(query)])
-	query = fmt.Sprintf("SELECT entries.* FROM entries LEFT JOIN cities ON entries.city_id = cities.id WHERE 1=1 %v", query)
+	// Around a point or in a box; see appendGeoFilter
+	query, center, distanceExpr, err := appendGeoFilter(queryParams, query, &params)
+	if err != nil {
+		return entryFilter{}, err
+	}
 
-	query += " ORDER BY entries.created_at DESC LIMIT ? OFFSET ?"
-	params = append(params, queryParams.Limit, queryParams.Offset)
+	availableFrom, availableTo, err := parsePeriodParams(queryParams.AvailableFrom, queryParams.AvailableTo)
+	if err != nil {
+		return entryFilter{}, err
+	}
+	if availableFrom != nil {
+		query, err = h.appendAvailableBetween(d, query, &params, *availableFrom, *availableTo)
+		if err != nil {
+			log.Println(err)
+			return entryFilter{}, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	return entryFilter{query: query, params: params, priceExpr: priceExpr, distanceExpr: distanceExpr, center: center}, nil
+}
+
+// Ties are broken by newest, then id
+func (f entryFilter) sortOrder(sort string) sortOrder {
+	newest := []sortKey{{expr: "entries.created_at", desc: true, time: true}, {expr: "entries.id", desc: true}}
+
+	switch sort {
+	case "price_asc":
+		return sortOrder{name: sort, keys: append([]sortKey{{expr: f.priceExpr}}, newest...)}
+	case "price_desc":
+		return sortOrder{name: sort, keys: append([]sortKey{{expr: f.priceExpr, desc: true}}, newest...)}
+	case "expiring":
+		// Entries that don't expire come last
+		return sortOrder{name: sort, keys: append([]sortKey{{expr: "entries.expires_at", time: true, nullable: true}}, newest...)}
+	case "upvoted":
+		upvotes := "(SELECT COUNT(*) FROM votes WHERE votes.entry_id = entries.id AND votes.vote = 0)"
+		return sortOrder{name: sort, keys: append([]sortKey{{expr: upvotes, desc: true}}, newest...)}
+	case "distance":
+		return sortOrder{name: sort, keys: append([]sortKey{{expr: f.distanceExpr}}, newest...)}
+	default:
+		return sortOrder{name: "newest", keys: newest}
+	}
+}
 
-	// Run the queries
-	rows, err := h.DB.Raw(query, params...).Rows()
+func (h *Handler) FetchEntries(c echo.Context) error {
+	queryParams, err := bindEntryQueryParams(c)
 	if err != nil {
-		log.Println(err)
 		return err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var entry model.Entry
-		var upvotes int64
-		var downvotes int64
-
-		if err := h.DB.ScanRows(rows, &entry); err != nil {
-			log.Println(err)
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-		}
+	// defaults
+	if queryParams.Offset < 0 {
+		queryParams.Offset = 0
+	}
+	if queryParams.Limit < 1 {
+		queryParams.Limit = pageDefaultLimit
+	}
+	if queryParams.Limit > pageMaxLimit {
+		queryParams.Limit = pageMaxLimit
+	}
 
-		// Query for Files
-		fileQuery := `SELECT files.* FROM files
-        INNER JOIN entry_files ON entry_files.file_id = files.id
-        WHERE entry_files.entry_id = ?`
-		if err := h.DB.Raw(fileQuery, entry.ID).Find(&entry.Files).Error; err != nil {
-			log.Println(err)
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-		}
+	entries := []model.PublicEntry{}
 
-		// Query for CreatedBy
-		createdByQuery := `SELECT users.* FROM users WHERE users.id = ?`
-		if err := h.DB.Raw(createdByQuery, entry.CreatedByID).Scan(&entry.CreatedBy).Error; err != nil {
-			log.Println(err)
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-		}
+	filter, err := h.entryFilters(c.QueryParams(), queryParams)
+	if err != nil {
+		return err
+	}
+	order := filter.sortOrder(queryParams.Sort)
+	from := "entries LEFT JOIN cities ON entries.city_id = cities.id"
 
-		// Query for City
-		cityQuery := `SELECT cities.* FROM cities WHERE cities.id = ?`
-		if err := h.DB.Raw(cityQuery, entry.CityID).Scan(&entry.City).Error; err != nil {
-			log.Println(err)
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	// Pages continue after the cursor; offset is only used without one
+	query := filter.query
+	params := append([]interface{}{}, filter.params...)
+	offset := queryParams.Offset
+	if queryParams.Cursor != "" {
+		values, err := order.decodeCursor(queryParams.Cursor)
+		if err != nil {
+			return err
 		}
+		query += " AND " + order.after(values, &params)
+		offset = 0
+	}
 
-		// Query for votes
-		votesQuery := `SELECT 
-		SUM(CASE WHEN Vote = 0 THEN 1 ELSE 0 END) as up, 
-		SUM(CASE WHEN Vote = 1 THEN 1 ELSE 0 END) as down 
-		FROM votes 
-		WHERE entry_id = ?`
-		row := h.DB.Raw(votesQuery, entry.ID).Row()
+	// One more than the limit, to know if there's a next page
+	query = fmt.Sprintf("SELECT entries.* FROM %s WHERE 1=1 %v ORDER BY %s LIMIT ? OFFSET ?", from, query, order.orderBy())
+	params = append(params, queryParams.Limit+1, offset)
 
-		var up sql.NullInt64
-		var down sql.NullInt64
-		if err := row.Scan(&up, &down); err != nil {
-			log.Println(err)
-			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
-		}
+	// Run the queries; relations are loaded for the whole page at once
+	page := []model.Entry{}
+	if err := h.DB.Raw(query, params...).Scan(&page).Error; err != nil {
+		log.Println(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
 
-		if up.Valid {
-			upvotes = up.Int64
-		} else {
-			upvotes = 0
-		}
+	tallies, err := h.loadEntryRelations(page)
+	if err != nil {
+		log.Println(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
 
-		if down.Valid {
-			downvotes = down.Int64
-		} else {
-			downvotes = 0
-		}
+	for _, entry := range page {
+		upvotes := tallies[entry.ID].Up
+		downvotes := tallies[entry.ID].Down
+		favorites := tallies[entry.ID].Favorites
 
 		pub := entry.ToPublicFormat(os.Getenv("DOMAIN")).(model.PublicEntry)
 		pub.UpVotes = &upvotes
 		pub.DownVotes = &downvotes
+		pub.Favorites = &favorites
+		pub.DistanceKm = entryDistanceKm(entry, filter.center)
 
 		entries = append(entries, pub)
 	}
 
-	if err := h.DB.Raw(countQuery, params...).Count(&count).Error; err != nil {
-		log.Println(err)
-		return err
+	response := PageResponse{}
+	if len(entries) > queryParams.Limit {
+		entries = entries[:queryParams.Limit]
+		response.NextCursor, err = h.nextCursor(order, from, "entries.id", entries[len(entries)-1].ID)
+		if err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch entries."}
+		}
 	}
 
-	return c.JSON(
-		http.StatusOK,
-		ListResponse{
-			Total: count,
-			Items: responseArrFormatter[model.PublicEntry](entries, nil, os.Getenv("DOMAIN")),
-		},
-	)
+	if queryParams.Total {
+		var count int64
+		countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE 1=1 %v", from, filter.query)
+		if err := h.DB.Raw(countQuery, filter.params...).Count(&count).Error; err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to count entries."}
+		}
+		response.Total = &count
+	}
+
+	response.Items = responseArrFormatter[model.PublicEntry](entries, nil, os.Getenv("DOMAIN"))
+	return c.JSON(http.StatusOK, response)
 }
 
 func (h *Handler) FetchEntry(c echo.Context) error {
@@ -198,8 +262,8 @@ func (h *Handler) FetchEntry(c echo.Context) error {
 	}
 
 	votesQuery := `SELECT 
-		IFNULL(SUM(CASE WHEN Vote = 0 THEN 1 ELSE 0 END), 0) as up, 
-		IFNULL(SUM(CASE WHEN Vote = 1 THEN 1 ELSE 0 END), 0) as down 
+		COALESCE(SUM(CASE WHEN vote = 0 THEN 1 ELSE 0 END), 0) as up, 
+		COALESCE(SUM(CASE WHEN vote = 1 THEN 1 ELSE 0 END), 0) as down 
 		FROM votes 
 		WHERE entry_id = ?`
 	row := h.DB.Raw(votesQuery, entry.ID).Row()
@@ -211,9 +275,16 @@ func (h *Handler) FetchEntry(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
+	var favorites int64
+	if err := h.DB.Model(&model.Favorite{}).Where("entry_id = ?", entry.ID).Count(&favorites).Error; err != nil {
+		log.Println(err)
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
 	publicEntry := entry.ToPublicFormat(os.Getenv("DOMAIN")).(model.PublicEntry)
 	publicEntry.UpVotes = &upvotes
 	publicEntry.DownVotes = &downvotes
+	publicEntry.Favorites = &favorites
 
 	return c.JSON(
 		http.StatusOK,
@@ -223,6 +294,9 @@ func (h *Handler) FetchEntry(c echo.Context) error {
 
 func (h *Handler) CreateEntry(c echo.Context) error {
 	reqUser := c.Get("user").(*model.AuthUser)
+	if err := h.requireConfirmedEmail(*reqUser); err != nil {
+		return err
+	}
 	user := model.User{ID: reqUser.ID}
 	err := h.DB.Model(&model.User{}).First(&user).Error
 	if err != nil {
@@ -242,12 +316,35 @@ func (h *Handler) CreateEntry(c echo.Context) error {
 		return err
 	}
 
-	// TODO: Validate data
 	e := model.Entry{
 		Type: s.Type,
 		Data: s.Data,
 	}
 
+	entryType, err := h.entryType(e.Type)
+	if err != nil {
+		return err
+	}
+
+	if err := entryType.ValidateData(e.Data); err != nil {
+		log.Println(err)
+		return entryDataHTTPError(err)
+	}
+	if err := e.SetPrice(); err != nil {
+		return entryDataHTTPError(err)
+	}
+	if err := e.SetLocation(); err != nil {
+		return entryDataHTTPError(err)
+	}
+
+	// Drafts get their expiry once they're published
+	e.Status = model.EntryStatusPublished
+	if s.Status == model.EntryStatusDraft {
+		e.Status = model.EntryStatusDraft
+	} else {
+		e.ExpiresAt = entryType.ExpiresAt(time.Now())
+	}
+
 	// Extract city and country
 	dataContent := model.BaseEntry{}
 	if err := json.Unmarshal([]byte(e.Data), &dataContent); err != nil {
@@ -258,7 +355,7 @@ func (h *Handler) CreateEntry(c echo.Context) error {
 			if err != nil {
 				log.Println(err)
 			} else {
-				e.CityID = city.ID
+				e.CityID = &city.ID
 			}
 		}
 	}
@@ -267,11 +364,6 @@ func (h *Handler) CreateEntry(c echo.Context) error {
 		e.Files = s.Files
 	}
 
-	if !e.TypeIsValid() {
-		log.Printf(fmt.Sprintf("Type %s is not supported.", e.Type))
-		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Type is not supported."}
-	}
-
 	// If entry has files, loop over them, and make sure they exist in the DB
 	// TODO: Do it with one query
 	if len(e.Files) > 0 {
@@ -324,21 +416,23 @@ func (h *Handler) CreateEntry(c echo.Context) error {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to mark files as provisioned."}
 	}
 
+	h.SavedSearchAlerts.Kick()
+
 	return c.JSON(http.StatusCreated, e)
 }
 
 func (h *Handler) UpdateEntry(c echo.Context) error {
-	_, err := h.isOwnerOrAdmin(c, c.Param("id"), "entry")
+	dbEntry, err := h.isOwnerOrAdmin(c, c.Param("id"), "entry")
 	if err != nil {
 		return err
 	}
-	user := model.User{}
-	if err := h.DB.Model(&model.User{}).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return &echo.HTTPError{Code: http.StatusNotFound, Message: "User not found."}
-		}
-		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch user."}
+	current := dbEntry.(*model.Entry)
+
+	// Entries are signed with the key of their owner
+	if current.CreatedBy == nil {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "User not found."}
 	}
+	user := *current.CreatedBy
 
 	id := c.Param("id")
 
@@ -349,9 +443,44 @@ func (h *Handler) UpdateEntry(c echo.Context) error {
 
 	updateData := make(map[string]interface{})
 	if len(e.Data) > 0 {
+		// Data replaces what's stored, so it's validated as a whole
+		entryType, err := h.entryType(current.Type)
+		if err != nil {
+			return err
+		}
+
+		if err := entryType.ValidateData(e.Data); err != nil {
+			log.Println(err)
+			return entryDataHTTPError(err)
+		}
+
 		updateData["data"] = e.Data
 
-		// TODO: Check if data is valid and has changed
+		if err := e.SetPrice(); err != nil {
+			return entryDataHTTPError(err)
+		}
+		updateData["price_amount"] = e.PriceAmount
+		updateData["price_currency"] = e.PriceCurrency
+
+		if err := e.SetLocation(); err != nil {
+			return entryDataHTTPError(err)
+		}
+		updateData["latitude"] = e.Latitude
+		updateData["longitude"] = e.Longitude
+
+		// Extract city state and country; data without a city takes the entry out of its old one
+		updateData["city_id"] = nil
+		dataContent := model.BaseEntry{}
+		if err := json.Unmarshal([]byte(e.Data), &dataContent); err != nil {
+			log.Println(err)
+		} else if dataContent.Address.City != "" {
+			city, err := h.GetAndCreateIfNotFoundCity(dataContent.Address)
+			if err != nil {
+				log.Println(err)
+			} else {
+				updateData["city_id"] = city.ID
+			}
+		}
 
 		// Signature
 		passphrase := []byte(os.Getenv("PGP_PASSPHRASE"))
@@ -374,27 +503,14 @@ func (h *Handler) UpdateEntry(c echo.Context) error {
 		}
 	}
 
-	// Extract city state and country
-	dataContent := model.BaseEntry{}
-	if err := json.Unmarshal([]byte(e.Data), &dataContent); err != nil {
-		log.Println(err)
-	} else {
-		if dataContent.Address.City != "" {
-			city, err := h.GetAndCreateIfNotFoundCity(dataContent.Address)
-			if err != nil {
-				log.Println(err)
-			} else {
-				updateData["city_id"] = city.ID
-			}
-		}
-	}
-
 	if len(updateData) > 0 {
 		r := h.DB.Model(&model.Entry{ID: id}).Updates(updateData)
 		if r.Error != nil {
 			log.Println(r.Error)
 			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to update entry."}
 		}
+		h.SavedSearchAlerts.Kick()
+		h.favoriteChanges(*current, updateData)
 	}
 
 	if len(e.Files) > 0 {
@@ -406,6 +522,11 @@ func (h *Handler) UpdateEntry(c echo.Context) error {
 		}
 
 		h.DB.Model(&currentEntry).Association("Files").Replace(&e.Files)
+
+		if err := h.markFilesAsProvisioned(e.Files); err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to mark files as provisioned."}
+		}
 	}
 
 	return c.JSON(http.StatusOK, UpdateResponse{Updated: 1}) // Assume 1 row affected since the entry exists and you're here.
@@ -419,16 +540,26 @@ func (h *Handler) DeleteEntry(c echo.Context) error {
 
 	id := c.Param("id")
 
-	r := h.DB.Delete(model.Entry{ID: id})
-	if r.Error != nil {
+	// Favorites go with the entry
+	var deleted int64
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("entry_id = ?", id).Delete(&model.Favorite{}).Error; err != nil {
+			return err
+		}
+		r := tx.Delete(model.Entry{ID: id})
+		deleted = r.RowsAffected
+		return r.Error
+	})
+	if err != nil {
+		log.Println(err)
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to delete entry."}
 	}
 
-	if r.RowsAffected == 0 {
+	if deleted == 0 {
 		return &echo.HTTPError{Code: http.StatusNotFound, Message: "Entry not found."}
 	}
 
-	return c.JSON(http.StatusOK, DeleteResponse{Deleted: r.RowsAffected})
+	return c.JSON(http.StatusOK, DeleteResponse{Deleted: deleted})
 }
 
 func (h *Handler) EntriesByCity(c echo.Context) error {
@@ -449,19 +580,24 @@ func (h *Handler) EntriesByCity(c echo.Context) error {
 
 	var results []Result
 
+	visible, params := visibleEntries()
+
 	if name != "" {
-		h.DB.Raw(`SELECT cities.name as city, cities.slug as slug, cities.country_code as country_code, count(*) as results 
+		params = append(params, "%"+name+"%", limit)
+		h.DB.Raw(fmt.Sprintf(`SELECT cities.name as city, cities.slug as slug, cities.country_code as country_code, count(*) as results 
 				  FROM entries 
 				  INNER JOIN cities ON entries.city_id = cities.id
-				  WHERE cities.name LIKE ? 
+				  WHERE %s AND cities.name %s ? 
 				  GROUP BY cities.name, cities.slug, cities.country_code
-				  LIMIT ?`, "%"+name+"%", limit).Scan(&results)
+				  LIMIT ?`, visible, h.dialect().Like()), params...).Scan(&results)
 	} else {
-		h.DB.Raw(`SELECT cities.name as city, cities.slug as slug, cities.country_code as country_code, count(*) as results 
+		params = append(params, limit)
+		h.DB.Raw(fmt.Sprintf(`SELECT cities.name as city, cities.slug as slug, cities.country_code as country_code, count(*) as results 
 				  FROM entries 
 				  INNER JOIN cities ON entries.city_id = cities.id
+				  WHERE %s
 				  GROUP BY cities.name, cities.slug, cities.country_code
-				  LIMIT ?`, limit).Scan(&results)
+				  LIMIT ?`, visible), params...).Scan(&results)
 	}
 	return c.JSON(http.StatusOK, results)
 }
@@ -474,10 +610,12 @@ func (h *Handler) EntriesByCountry(c echo.Context) error {
 	}
 
 	var results []Result
-	h.DB.Raw(`SELECT cities.country as country, count(*) as results 
+	visible, params := visibleEntries()
+	h.DB.Raw(fmt.Sprintf(`SELECT cities.country_code as country, count(*) as results 
 			  FROM entries 
 			  INNER JOIN cities ON entries.city_id = cities.id
-			  GROUP BY cities.country`).Scan(&results)
+			  WHERE %s
+			  GROUP BY cities.country_code`, visible), params...).Scan(&results)
 	return c.JSON(http.StatusOK, results)
 }
 
@@ -493,26 +631,27 @@ func (h *Handler) EntriesByType(c echo.Context) error {
 
 	var results []Result
 	var query string
-	var params []interface{}
+	visible, params := visibleEntries()
 
 	if citySlug != "" {
-		query = `SELECT entries.type, COUNT(*) AS results
+		query = fmt.Sprintf(`SELECT entries.type, COUNT(*) AS results
 				 FROM entries 
 				 INNER JOIN cities ON entries.city_id = cities.id 
-				 WHERE cities.slug = ? 
-				 GROUP BY entries.type`
+				 WHERE %s AND cities.slug = ? 
+				 GROUP BY entries.type`, visible)
 		params = append(params, citySlug)
 	} else if country != "" {
-		query = `SELECT entries.type, COUNT(*) AS results
+		query = fmt.Sprintf(`SELECT entries.type, COUNT(*) AS results
 				 FROM entries 
 				 INNER JOIN cities ON entries.city_id = cities.id 
-				 WHERE cities.country_code = ? 
-				 GROUP BY entries.type`
+				 WHERE %s AND cities.country_code = ? 
+				 GROUP BY entries.type`, visible)
 		params = append(params, country)
 	} else {
-		query = `SELECT entries.type, COUNT(*) AS results
+		query = fmt.Sprintf(`SELECT entries.type, COUNT(*) AS results
 				 FROM entries 
-				 GROUP BY entries.type`
+				 WHERE %s
+				 GROUP BY entries.type`, visible)
 	}
 
 	h.DB.Raw(query, params...).Scan(&results)
@@ -0,0 +1,307 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"tbd/model"
+)
+
+func (h *Handler) entryConsumptions(entryID string) ([]model.EntryConsumption, error) {
+	consumptions := []model.EntryConsumption{}
+	err := h.DB.Preload("ConsumedEntry").Where("entry_id = ?", entryID).Order("created_at ASC").Find(&consumptions).Error
+	return consumptions, err
+}
+
+// Quotes an entry with everything it consumes; the errors are the ones the API returns
+func (h *Handler) quoteEntry(entry *model.Entry, req model.QuoteRequest) (model.Quote, error) {
+	consumptions, err := h.entryConsumptions(entry.ID)
+	if err != nil {
+		log.Println(err)
+		return model.Quote{}, &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch consumed entries."}
+	}
+
+	for _, ec := range consumptions {
+		if ec.ConsumedEntry == nil || ec.ConsumedEntry.Status != model.EntryStatusPublished {
+			return model.Quote{}, &echo.HTTPError{Code: http.StatusConflict, Message: "A consumed entry is not available."}
+		}
+	}
+
+	rates := []model.CurrencyRate{}
+	if len(consumptions) > 0 {
+		if err := h.DB.Find(&rates).Error; err != nil {
+			log.Println(err)
+			return model.Quote{}, &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch currency rates."}
+		}
+	}
+
+	q, err := model.QuoteEntry(*entry, consumptions, req, rates)
+	switch {
+	case errors.Is(err, model.ErrNoPrice):
+		return q, &echo.HTTPError{Code: http.StatusConflict, Message: "Entry has no price."}
+	case errors.Is(err, model.ErrNoRate):
+		return q, &echo.HTTPError{Code: http.StatusConflict, Message: "A consumed entry is priced in a currency without a rate."}
+	case errors.Is(err, model.ErrNoDistance):
+		return q, &echo.HTTPError{Code: http.StatusBadRequest, Message: "Distance is required."}
+	case err != nil:
+		log.Println(err)
+		return q, &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to quote entry."}
+	}
+	return q, nil
+}
+
+// Entries an entry consumes, for ex. the delivery of a pizza
+func (h *Handler) FetchEntryConsumptions(c echo.Context) error {
+	entry, err := h.fetchEntryByParam(c)
+	if err != nil {
+		return err
+	}
+
+	consumptions, err := h.entryConsumptions(entry.ID)
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch consumed entries."}
+	}
+
+	return c.JSON(
+		http.StatusOK,
+		ListResponse{
+			Total: int64(len(consumptions)),
+			Items: responseArrFormatter[model.EntryConsumption](consumptions, nil, os.Getenv("DOMAIN")),
+		},
+	)
+}
+
+func (h *Handler) CreateEntryConsumption(c echo.Context) error {
+	dbEntry, err := h.isOwnerOrAdmin(c, c.Param("id"), "entry")
+	if err != nil {
+		return err
+	}
+	entry := dbEntry.(*model.Entry)
+
+	s := model.SubmitEntryConsumption{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+
+	if s.ConsumedEntryID == entry.ID {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "An entry cannot consume itself."}
+	}
+
+	consumed := model.Entry{}
+	if err := h.DB.First(&consumed, "id = ?", s.ConsumedEntryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "Consumed entry not found."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch entry."}
+	}
+	if consumed.Status != model.EntryStatusPublished {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Consumed entry is not available."}
+	}
+	if consumed.PriceAmount == nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Consumed entry has no price."}
+	}
+
+	// One level deep: the consumed entry can't consume, and the entry can't be consumed
+	var nested int64
+	err = h.DB.Model(&model.EntryConsumption{}).
+		Where("entry_id = ? OR consumed_entry_id = ?", consumed.ID, entry.ID).
+		Count(&nested).Error
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create consumed entry."}
+	}
+	if nested > 0 {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Consumed entries cannot be nested."}
+	}
+
+	ec := model.EntryConsumption{
+		EntryID:         entry.ID,
+		ConsumedEntryID: consumed.ID,
+		PricingRule:     s.PricingRule,
+	}
+	if err := h.DB.Create(&ec).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return &echo.HTTPError{Code: http.StatusConflict, Message: "Entry already consumes this entry."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create consumed entry."}
+	}
+	ec.ConsumedEntry = &consumed
+
+	return c.JSON(http.StatusCreated, ec.ToPublicFormat(os.Getenv("DOMAIN")))
+}
+
+func (h *Handler) DeleteEntryConsumption(c echo.Context) error {
+	if _, err := h.isOwnerOrAdmin(c, c.Param("id"), "entry"); err != nil {
+		return err
+	}
+
+	consumptionID := c.Param("consumption_id")
+	if _, err := uuid.Parse(consumptionID); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid UUID."}
+	}
+
+	r := h.DB.Where("id = ? AND entry_id = ?", consumptionID, c.Param("id")).Delete(&model.EntryConsumption{})
+	if r.Error != nil {
+		log.Println(r.Error)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to delete consumed entry."}
+	}
+
+	if r.RowsAffected == 0 {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "Consumed entry not found."}
+	}
+
+	return c.JSON(http.StatusOK, DeleteResponse{Deleted: r.RowsAffected})
+}
+
+// Price of an entry and everything it consumes; for ex. ?quantity=2&distance_km=3.5
+func (h *Handler) QuoteEntry(c echo.Context) error {
+	entry, err := h.fetchEntryByParam(c)
+	if err != nil {
+		return err
+	}
+
+	req := model.QuoteRequest{}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &req); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid quote request."}
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	q, err := h.quoteEntry(entry, req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, q)
+}
+
+// Sub-orders stop with their order or reservation; column is order_id or reservation_id
+func cancelSubOrders(tx *gorm.DB, column, id string) error {
+	return tx.Model(&model.SubOrder{}).
+		Where(column+" = ? AND status IN ?", id, []string{model.SubOrderStatusRequested, model.SubOrderStatusAccepted}).
+		Update("status", model.SubOrderStatusCancelled).Error
+}
+
+// Owners of consumed entries accept or decline what's requested from them
+func (h *Handler) UpdateSubOrderStatus(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid UUID."}
+	}
+
+	s := model.SubmitSubOrderStatus{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+
+	so := model.SubOrder{}
+	if err := h.DB.Preload("Entry").First(&so, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "Sub-order not found."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch sub-order."}
+	}
+
+	if !reqUser.IsAdmin && (so.Entry == nil || so.Entry.CreatedByID != reqUser.ID) {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "You do not have permission to access this sub-order."}
+	}
+	if !so.CanTransitionTo(s.Status) {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Sub-order cannot be moved from " + so.Status + " to " + s.Status + "."}
+	}
+
+	result := h.DB.Model(&model.SubOrder{}).Where("id = ? AND status = ?", so.ID, so.Status).Update("status", s.Status)
+	if result.Error != nil {
+		log.Println(result.Error)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to update sub-order."}
+	}
+	if result.RowsAffected == 0 {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Sub-order has changed; try again."}
+	}
+
+	return c.JSON(http.StatusOK, UpdateResponse{Updated: 1})
+}
+
+// Sub-orders on entries of the user; filter by status, for ex. ?status=requested; newest first by default
+func (h *Handler) FetchReceivedSubOrders(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	page, order, after, err := bindPage(c, creationSorts("sub_orders"), "newest")
+	if err != nil {
+		return err
+	}
+
+	query := h.DB.Model(&model.SubOrder{}).
+		Joins("INNER JOIN entries ON entries.id = sub_orders.entry_id").
+		Where("entries.created_by_id = ?", reqUser.ID)
+
+	if status := c.QueryParam("status"); status != "" {
+		if !model.SubOrderStatusIsValid(status) {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Status is not supported."}
+		}
+		query = query.Where("sub_orders.status = ?", status)
+	}
+
+	// Offset is only used without a cursor
+	offset := page.Offset
+	// A session, so counting doesn't change the query
+	query = query.Session(&gorm.Session{})
+
+	response := PageResponse{}
+	if page.Total {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch sub-orders."}
+		}
+		response.Total = &count
+	}
+
+	if after != nil {
+		params := []interface{}{}
+		query = query.Where(order.after(after, &params), params...)
+		offset = 0
+	}
+
+	subOrders := []model.SubOrder{}
+	err = query.
+		Preload("Entry").
+		Order(order.orderBy()).
+		Limit(page.Limit + 1).
+		Offset(offset).
+		Find(&subOrders).Error
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch sub-orders."}
+	}
+
+	if len(subOrders) > page.Limit {
+		subOrders = subOrders[:page.Limit]
+		response.NextCursor, err = h.nextCursor(order, "sub_orders", "sub_orders.id", subOrders[len(subOrders)-1].ID)
+		if err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch sub-orders."}
+		}
+	}
+
+	response.Items = responseArrFormatter[model.SubOrder](subOrders, nil, os.Getenv("DOMAIN"))
+	return c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"tbd/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func consumeEntry(t *testing.T, token, entryID, consumedID, rule string) *http.Response {
+	return performRequest(t, http.MethodPost, "http://localhost:1323/entries/"+entryID+"/consumes", token, model.SubmitEntryConsumption{
+		ConsumedEntryID: consumedID,
+		PricingRule:     rule,
+	})
+}
+
+func fetchQuote(t *testing.T, entryID, query string) (int, model.Quote) {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries/"+entryID+"/quote?"+query, "", nil)
+
+	var q model.Quote
+	if rec.StatusCode == http.StatusOK {
+		err := json.NewDecoder(rec.Body).Decode(&q)
+		assert.NoError(t, err)
+	}
+	return rec.StatusCode, q
+}
+
+func setSubOrderStatus(t *testing.T, token, id, status string) int {
+	rec := performRequest(t, http.MethodPatch, "http://localhost:1323/sub-orders/"+id+"/status", token, model.SubmitSubOrderStatus{Status: status})
+	return rec.StatusCode
+}
+
+func TestEntryConsumptionOrder(t *testing.T) {
+	sellerToken := signupAndLogin(t)
+	pizzaID := createItemSale(t, sellerToken, "", withPrice(&model.Money{Amount: 1000, Currency: "USD"}))
+
+	courierToken := signupAndLogin(t)
+	deliveryID := createItemSale(t, courierToken, "", withPrice(&model.Money{Amount: 150, Currency: "USD"}))
+
+	// Only the owner of the composite decides what it consumes
+	rec := consumeEntry(t, courierToken, pizzaID, deliveryID, model.PricingRulePerKm)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+
+	rec = consumeEntry(t, sellerToken, pizzaID, deliveryID, model.PricingRulePerKm)
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+
+	rec = consumeEntry(t, sellerToken, pizzaID, deliveryID, model.PricingRuleFlat)
+	assert.Equal(t, http.StatusConflict, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/entries/"+pizzaID+"/consumes", "", nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var consumptions struct {
+		Total int64                          `json:"total"`
+		Items []model.PublicEntryConsumption `json:"items"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&consumptions)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), consumptions.Total)
+
+	// Per km parts need a distance
+	status, _ := fetchQuote(t, pizzaID, "quantity=2")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, q := fetchQuote(t, pizzaID, "quantity=2&distance_km=4")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, model.Money{Amount: 2000 + 600, Currency: "USD"}, q.Total)
+
+	buyerToken := signupAndLogin(t)
+	order := createOrder(t, buyerToken, pizzaID, model.SubmitOrder{Quantity: 2, DistanceKm: 4})
+	assert.Equal(t, int64(2600), order.Amount)
+	assert.Len(t, order.SubOrders, 1)
+	subOrderID := order.SubOrders[0].ID
+	assert.Equal(t, model.SubOrderStatusRequested, order.SubOrders[0].Status)
+
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me/sub-orders?status=requested", courierToken, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var received struct {
+		Items []model.PublicSubOrder `json:"items"`
+	}
+	err = json.NewDecoder(rec.Body).Decode(&received)
+	assert.NoError(t, err)
+	assert.Len(t, received.Items, 1)
+	assert.Equal(t, subOrderID, received.Items[0].ID)
+
+	// Only the owner of the consumed entry accepts
+	assert.Equal(t, http.StatusForbidden, setSubOrderStatus(t, sellerToken, subOrderID, model.SubOrderStatusAccepted))
+	assert.Equal(t, http.StatusOK, setSubOrderStatus(t, courierToken, subOrderID, model.SubOrderStatusAccepted))
+	assert.Equal(t, http.StatusConflict, setSubOrderStatus(t, courierToken, subOrderID, model.SubOrderStatusDeclined))
+
+	// Cancelling the order cancels what it consumes
+	assert.Equal(t, http.StatusOK, setOrderStatus(t, buyerToken, order.ID, model.OrderStatusCancelled))
+	order = fetchOrder(t, buyerToken, order.ID)
+	assert.Equal(t, model.SubOrderStatusCancelled, order.SubOrders[0].Status)
+
+	// Newest first, a page at a time
+	second := createOrder(t, buyerToken, pizzaID, model.SubmitOrder{DistanceKm: 2})
+	var page struct {
+		Items      []model.PublicSubOrder `json:"items"`
+		NextCursor string                 `json:"next_cursor"`
+	}
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me/sub-orders?limit=1", courierToken, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	if assert.Len(t, page.Items, 1) && assert.Len(t, second.SubOrders, 1) {
+		assert.Equal(t, second.SubOrders[0].ID, page.Items[0].ID)
+	}
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me/sub-orders?limit=1&cursor="+page.NextCursor, courierToken, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	page.Items, page.NextCursor = nil, ""
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	if assert.Len(t, page.Items, 1) {
+		assert.Equal(t, subOrderID, page.Items[0].ID)
+	}
+	assert.Empty(t, page.NextCursor)
+
+	for _, query := range []string{"limit=abc", "limit=1000", "offset=-5", "sort=nope"} {
+		rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me/sub-orders?"+query, courierToken, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.StatusCode, query)
+	}
+}
+
+func TestEntryConsumptionInvalid(t *testing.T) {
+	token := signupAndLogin(t)
+	pizzaID := createItemSale(t, token, "", withPrice(&model.Money{Amount: 1000, Currency: "USD"}))
+	deliveryID := createItemSale(t, token, "", withPrice(&model.Money{Amount: 150, Currency: "USD"}))
+	carID := createItemSale(t, token, "", withPrice(&model.Money{Amount: 5000, Currency: "USD"}))
+
+	rec := consumeEntry(t, token, pizzaID, pizzaID, model.PricingRuleFlat)
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	rec = consumeEntry(t, token, pizzaID, deliveryID, "per_hour")
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	rec = consumeEntry(t, token, pizzaID, deliveryID, model.PricingRuleFlat)
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+
+	var consumption model.PublicEntryConsumption
+	err := json.NewDecoder(rec.Body).Decode(&consumption)
+	assert.NoError(t, err)
+
+	// One level deep
+	rec = consumeEntry(t, token, deliveryID, carID, model.PricingRuleFlat)
+	assert.Equal(t, http.StatusConflict, rec.StatusCode)
+	rec = consumeEntry(t, token, carID, pizzaID, model.PricingRuleFlat)
+	assert.Equal(t, http.StatusConflict, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodDelete, "http://localhost:1323/entries/"+pizzaID+"/consumes/"+consumption.ID, token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	status, q := fetchQuote(t, pizzaID, "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(1000), q.Total.Amount)
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"tbd/model"
+)
+
+// Votes and favorites of an entry
+type entryTally struct {
+	EntryID   string
+	Up        int64
+	Down      int64
+	Favorites int64
+}
+
+// Loads files, creators, cities, vote tallies and favorite counts of a page of entries, with one query each
+// Notes:
+//   - Entries without votes or favorites are left out of the map
+//   - Deleted files are left out; deleted creators are loaded, like before
+func (h *Handler) loadEntryRelations(entries []model.Entry) (map[string]entryTally, error) {
+	tallies := map[string]entryTally{}
+	if len(entries) == 0 {
+		return tallies, nil
+	}
+
+	entryIDs := make([]string, len(entries))
+	userIDs := []string{}
+	cityIDs := []string{}
+	for i, entry := range entries {
+		entryIDs[i] = entry.ID
+		userIDs = append(userIDs, entry.CreatedByID)
+		if entry.CityID != nil {
+			cityIDs = append(cityIDs, *entry.CityID)
+		}
+	}
+
+	type entryFile struct {
+		model.File
+		EntryID string
+	}
+	files := []entryFile{}
+	fileQuery := `SELECT files.*, entry_files.entry_id AS entry_id FROM files
+		INNER JOIN entry_files ON entry_files.file_id = files.id
+		WHERE entry_files.entry_id IN ? AND files.deleted_at IS NULL`
+	if err := h.DB.Raw(fileQuery, entryIDs).Scan(&files).Error; err != nil {
+		return nil, err
+	}
+	filesByEntry := map[string][]model.File{}
+	for _, file := range files {
+		filesByEntry[file.EntryID] = append(filesByEntry[file.EntryID], file.File)
+	}
+
+	users := []model.User{}
+	if err := h.DB.Raw(`SELECT users.* FROM users WHERE users.id IN ?`, userIDs).Scan(&users).Error; err != nil {
+		return nil, err
+	}
+	usersByID := map[string]*model.User{}
+	for i := range users {
+		usersByID[users[i].ID] = &users[i]
+	}
+
+	citiesByID := map[string]*model.City{}
+	if len(cityIDs) > 0 {
+		cities := []model.City{}
+		if err := h.DB.Raw(`SELECT cities.* FROM cities WHERE cities.id IN ?`, cityIDs).Scan(&cities).Error; err != nil {
+			return nil, err
+		}
+		for i := range cities {
+			citiesByID[cities[i].ID] = &cities[i]
+		}
+	}
+
+	votes := []entryTally{}
+	votesQuery := `SELECT entry_id,
+		SUM(CASE WHEN vote = 0 THEN 1 ELSE 0 END) AS up,
+		SUM(CASE WHEN vote = 1 THEN 1 ELSE 0 END) AS down
+		FROM votes
+		WHERE entry_id IN ?
+		GROUP BY entry_id`
+	if err := h.DB.Raw(votesQuery, entryIDs).Scan(&votes).Error; err != nil {
+		return nil, err
+	}
+	for _, tally := range votes {
+		tallies[tally.EntryID] = tally
+	}
+
+	favorites := []entryTally{}
+	favoritesQuery := `SELECT entry_id, COUNT(*) AS favorites FROM favorites WHERE entry_id IN ? GROUP BY entry_id`
+	if err := h.DB.Raw(favoritesQuery, entryIDs).Scan(&favorites).Error; err != nil {
+		return nil, err
+	}
+	for _, tally := range favorites {
+		t := tallies[tally.EntryID]
+		t.EntryID = tally.EntryID
+		t.Favorites = tally.Favorites
+		tallies[tally.EntryID] = t
+	}
+
+	for i := range entries {
+		entries[i].Files = filesByEntry[entries[i].ID]
+		entries[i].CreatedBy = usersByID[entries[i].CreatedByID]
+		if entries[i].CityID != nil {
+			entries[i].City = citiesByID[*entries[i].CityID]
+		}
+	}
+	return tallies, nil
+}
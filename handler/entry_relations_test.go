@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"tbd/migrations"
+	"tbd/model"
+)
+
+// Counts the statements that reach the database
+type queryCounter struct {
+	logger.Interface
+	count int64
+}
+
+func (q *queryCounter) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	atomic.AddInt64(&q.count, 1)
+}
+
+// Entries with a file, a city and votes each, by a few users
+func seedEntryPage(t testing.TB, n int) (*Handler, *queryCounter) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	assert.NoError(t, err)
+	_, err = migrations.New(db).Up()
+	assert.NoError(t, err)
+
+	users := make([]model.User, 3)
+	for i := range users {
+		users[i] = model.User{ID: fmt.Sprintf("00000000-0000-0000-0000-%012d", i+1), Username: fmt.Sprintf("user%d", i)}
+		assert.NoError(t, db.Session(&gorm.Session{SkipHooks: true}).Create(&users[i]).Error)
+	}
+	city := model.City{Slug: "berlin", GlobID: "de:berlin", Name: "Berlin", CountryCode: "de"}
+	assert.NoError(t, db.Create(&city).Error)
+
+	for i := 0; i < n; i++ {
+		entry := model.Entry{
+			Type:        "item-sale",
+			Status:      model.EntryStatusPublished,
+			Data:        datatypes.JSON(fmt.Sprintf(`{"title": "Entry %d"}`, i)),
+			CreatedByID: users[i%len(users)].ID,
+			CityID:      &city.ID,
+			Files:       []model.File{{Title: "Photo", Path: "photo.jpg", Mime: "image/jpeg", CreatedByID: users[0].ID}},
+		}
+		assert.NoError(t, db.Create(&entry).Error)
+		for _, user := range users {
+			vote := model.Vote{Vote: i % 2, CreatedByID: user.ID, EntryID: &entry.ID}
+			assert.NoError(t, db.Create(&vote).Error)
+		}
+	}
+
+	counter := &queryCounter{Interface: logger.Discard}
+	return &Handler{DB: db.Session(&gorm.Session{Logger: counter}), Currency: "USD"}, counter
+}
+
+func fetchEntryPageInProcess(t testing.TB, h *Handler, limit int) PageResponse {
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/entries?limit=%d", limit), nil)
+	rec := httptest.NewRecorder()
+	assert.NoError(t, h.FetchEntries(echo.New().NewContext(req, rec)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	response := PageResponse{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	return response
+}
+
+// The page itself, then files, users, cities, votes and favorites; no matter how many entries
+const entryPageQueries = 6
+
+func TestFetchEntriesQueryCount(t *testing.T) {
+	h, counter := seedEntryPage(t, 30)
+
+	for _, limit := range []int{1, 10, 30} {
+		atomic.StoreInt64(&counter.count, 0)
+		response := fetchEntryPageInProcess(t, h, limit)
+		items := response.Items.([]interface{})
+		assert.Len(t, items, limit)
+
+		queries := atomic.LoadInt64(&counter.count)
+		// With a next page, its cursor is looked up once
+		if response.NextCursor != "" {
+			queries--
+		}
+		assert.Equal(t, int64(entryPageQueries), queries, "limit %d", limit)
+	}
+
+	// Relations are still filled in
+	response := fetchEntryPageInProcess(t, h, 2)
+	entry := response.Items.([]interface{})[0].(map[string]interface{})
+	assert.Len(t, entry["files"], 1)
+	assert.Equal(t, "Berlin", entry["city"].(map[string]interface{})["name"])
+	assert.NotEmpty(t, entry["created_by"].(map[string]interface{})["username"])
+	assert.Equal(t, float64(3), entry["up_votes"].(float64)+entry["down_votes"].(float64))
+}
+
+func BenchmarkFetchEntries(b *testing.B) {
+	h, counter := seedEntryPage(b, pageMaxLimit)
+	atomic.StoreInt64(&counter.count, 0)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fetchEntryPageInProcess(b, h, pageMaxLimit)
+	}
+	b.StopTimer()
+
+	queries := float64(atomic.LoadInt64(&counter.count)) / float64(b.N)
+	b.ReportMetric(queries, "queries/page")
+	if queries != entryPageQueries {
+		b.Fatalf("%v queries per page, want %d", queries, entryPageQueries)
+	}
+}
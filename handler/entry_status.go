@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"tbd/model"
+)
+
+// Condition for entries that are listed, searched and counted
+// Expiry is checked by date too, since the sweeper only runs every so often
+func visibleEntries() (string, []interface{}) {
+	return "entries.status = ? AND (entries.expires_at IS NULL OR entries.expires_at > ?)",
+		[]interface{}{model.EntryStatusPublished, time.Now().UTC()}
+}
+
+// Moves an entry along its lifecycle; see model/entry_status.go for the allowed transitions
+func (h *Handler) UpdateEntryStatus(c echo.Context) error {
+	dbEntry, err := h.isOwnerOrAdmin(c, c.Param("id"), "entry")
+	if err != nil {
+		return err
+	}
+	entry := dbEntry.(*model.Entry)
+
+	s := model.SubmitEntryStatus{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+
+	if !model.EntryStatusIsValid(s.Status) {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Status is not supported."}
+	}
+	if s.Status == model.EntryStatusExpired {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Entries expire on their own."}
+	}
+	if !entry.CanTransitionTo(s.Status) {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Entry cannot be moved from " + entry.Status + " to " + s.Status + "."}
+	}
+
+	updateData := map[string]interface{}{"status": s.Status}
+
+	// Publishing starts a new listing period, unless a paused entry still has time left
+	if s.Status == model.EntryStatusPublished {
+		now := time.Now()
+		if entry.Status != model.EntryStatusPaused || (entry.ExpiresAt != nil && !entry.ExpiresAt.After(now)) {
+			entryType, err := h.entryType(entry.Type)
+			if err != nil {
+				return err
+			}
+			updateData["expires_at"] = entryType.ExpiresAt(now)
+		}
+	}
+
+	if err := h.DB.Model(&model.Entry{}).Where("id = ?", entry.ID).Updates(updateData).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to update entry."}
+	}
+
+	h.SavedSearchAlerts.Kick()
+	h.favoriteChanges(*entry, updateData)
+
+	return c.JSON(http.StatusOK, UpdateResponse{Updated: 1})
+}
+
+// Pushes the expiry out by the default of the entry type; an expired entry is published again
+func (h *Handler) RenewEntry(c echo.Context) error {
+	dbEntry, err := h.isOwnerOrAdmin(c, c.Param("id"), "entry")
+	if err != nil {
+		return err
+	}
+	entry := dbEntry.(*model.Entry)
+
+	switch entry.Status {
+	case model.EntryStatusPublished, model.EntryStatusPaused, model.EntryStatusExpired:
+	default:
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Only published, paused or expired entries can be renewed."}
+	}
+
+	entryType, err := h.entryType(entry.Type)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := entryType.ExpiresAt(time.Now())
+	if expiresAt == nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Entries of this type do not expire."}
+	}
+
+	updateData := map[string]interface{}{"expires_at": expiresAt}
+	if entry.Status == model.EntryStatusExpired {
+		updateData["status"] = model.EntryStatusPublished
+	}
+
+	if err := h.DB.Model(&model.Entry{}).Where("id = ?", entry.ID).Updates(updateData).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to renew entry."}
+	}
+
+	h.SavedSearchAlerts.Kick()
+	h.favoriteChanges(*entry, updateData)
+
+	return c.JSON(http.StatusOK, UpdateResponse{Updated: 1})
+}
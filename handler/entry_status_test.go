@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"tbd/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Price no other entry has, so an entry can be found with price=eq,<price>&currency=USD
+func uniquePrice() (*model.Money, string) {
+	units := 1000000000 + rand.Int63n(1000000000)
+	return &model.Money{Amount: units * 100, Currency: "USD"}, fmt.Sprintf("%d", units)
+}
+
+// Sets a unique price, so tests can find the entry by it
+func withPrice(money *model.Money) func(*model.EntryItemSale) {
+	return func(itemSale *model.EntryItemSale) {
+		itemSale.Price = money
+	}
+}
+
+func entryIsListed(t *testing.T, id, price string) bool {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries?type=item-sale&currency=USD&price=eq,"+price, "", nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response struct {
+		Items []model.PublicEntry `json:"items"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	assert.NoError(t, err)
+
+	for _, entry := range response.Items {
+		if entry.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func setEntryStatus(t *testing.T, token, id, status string) int {
+	rec := performRequest(t, http.MethodPatch, "http://localhost:1323/entries/"+id+"/status", token, map[string]string{"status": status})
+	return rec.StatusCode
+}
+
+func TestEntryStatusLifecycle(t *testing.T) {
+	token := signupAndLogin(t)
+
+	money, price := uniquePrice()
+	id := createItemSale(t, token, "", withPrice(money))
+
+	entry := getEntry(t, token, id)
+	assert.Equal(t, model.EntryStatusPublished, entry.Status)
+	assert.NotNil(t, entry.ExpiresAt)
+	assert.True(t, entry.ExpiresAt.After(time.Now().AddDate(0, 0, 29)))
+	assert.True(t, entryIsListed(t, id, price))
+
+	assert.Equal(t, http.StatusOK, setEntryStatus(t, token, id, model.EntryStatusPaused))
+	assert.False(t, entryIsListed(t, id, price))
+
+	assert.Equal(t, http.StatusOK, setEntryStatus(t, token, id, model.EntryStatusPublished))
+	assert.True(t, entryIsListed(t, id, price))
+
+	assert.Equal(t, http.StatusOK, setEntryStatus(t, token, id, model.EntryStatusSold))
+	assert.False(t, entryIsListed(t, id, price))
+
+	// Sold entries can only be archived
+	assert.Equal(t, http.StatusConflict, setEntryStatus(t, token, id, model.EntryStatusPublished))
+	assert.Equal(t, http.StatusOK, setEntryStatus(t, token, id, model.EntryStatusArchived))
+	assert.Equal(t, http.StatusConflict, setEntryStatus(t, token, id, model.EntryStatusPublished))
+}
+
+func TestEntryStatusInvalid(t *testing.T) {
+	token := signupAndLogin(t)
+
+	id := createItemSale(t, token, "", nil)
+
+	assert.Equal(t, http.StatusBadRequest, setEntryStatus(t, token, id, "deleted"))
+	assert.Equal(t, http.StatusBadRequest, setEntryStatus(t, token, id, model.EntryStatusExpired))
+
+	anotherUserToken := signupAndLogin(t)
+	assert.Equal(t, http.StatusForbidden, setEntryStatus(t, anotherUserToken, id, model.EntryStatusPaused))
+}
+
+func TestEntryDraft(t *testing.T) {
+	token := signupAndLogin(t)
+
+	money, price := uniquePrice()
+	id := createItemSale(t, token, model.EntryStatusDraft, withPrice(money))
+
+	entry := getEntry(t, token, id)
+	assert.Equal(t, model.EntryStatusDraft, entry.Status)
+	assert.Nil(t, entry.ExpiresAt)
+	assert.False(t, entryIsListed(t, id, price))
+
+	// Drafts are published, not renewed
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/entries/"+id+"/renew", token, nil)
+	assert.Equal(t, http.StatusConflict, rec.StatusCode)
+
+	assert.Equal(t, http.StatusOK, setEntryStatus(t, token, id, model.EntryStatusPublished))
+	entry = getEntry(t, token, id)
+	assert.NotNil(t, entry.ExpiresAt)
+	assert.True(t, entryIsListed(t, id, price))
+}
+
+func TestEntryRenew(t *testing.T) {
+	token := signupAndLogin(t)
+
+	id := createItemSale(t, token, "", nil)
+	before := getEntry(t, token, id)
+
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/entries/"+id+"/renew", token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	after := getEntry(t, token, id)
+	assert.Equal(t, model.EntryStatusPublished, after.Status)
+	assert.True(t, after.ExpiresAt.After(*before.ExpiresAt))
+
+	anotherUserToken := signupAndLogin(t)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/entries/"+id+"/renew", anotherUserToken, nil)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+}
@@ -49,6 +49,25 @@ func getEntry(t *testing.T, token string, id string) model.Entry {
 	return getResponse
 }
 
+// Item-sale data from genEntryData, after mutate changed it; for ex. to set a price that tests can filter by
+func itemSaleData(status string, mutate func(*model.EntryItemSale)) map[string]interface{} {
+	entryData := genEntryData("item-sale", nil)
+	itemSale := entryData["data"].(model.EntryItemSale)
+	if mutate != nil {
+		mutate(&itemSale)
+	}
+	entryData["data"] = itemSale
+	if status != "" {
+		entryData["status"] = status
+	}
+	return entryData
+}
+
+// Creates an item-sale with the data of itemSaleData; returns its id
+func createItemSale(t *testing.T, token, status string, mutate func(*model.EntryItemSale)) string {
+	return createEntry(t, token, itemSaleData(status, mutate)).ID
+}
+
 func createEntry(t *testing.T, token string, entryData map[string]interface{}) struct {
 	ID   string `json:"id"`
 	Type string `json:"type"`
@@ -85,7 +104,7 @@ func randate() time.Time {
 func genEntryData(listingType string, files []model.File) map[string]interface{} {
 	fake := faker.New()
 
-	fakePrice := fmt.Sprintf("%.2f", float64(fake.Currency().Number()))
+	fakePrice := &model.Money{Amount: int64(fake.Currency().Number()) * 100, Currency: "USD"}
 
 	fakeAddress := fake.Address()
 	address := model.Address{
@@ -173,13 +192,116 @@ func TestEntryPostValid(t *testing.T) {
 	assert.Equal(t, createdEntry.Type, retrievedEntry.Type)
 }
 
+func TestEntryPostInvalidData(t *testing.T) {
+	token := signupAndLogin(t)
+
+	entryData := itemSaleData("", withPrice(nil))
+
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/entries", token, entryData)
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	var response struct {
+		Errors []struct {
+			Field string `json:"field"`
+			Rule  string `json:"rule"`
+		} `json:"errors"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	assert.NoError(t, err)
+	assert.Len(t, response.Errors, 1)
+	assert.Equal(t, "price", response.Errors[0].Field)
+	assert.Equal(t, "required", response.Errors[0].Rule)
+}
+
+func TestEntryPostUnknownDataField(t *testing.T) {
+	token := signupAndLogin(t)
+
+	entryData := genEntryData("looking-for", nil)
+	entryData["data"] = map[string]interface{}{
+		"title":       "Looking for a bike",
+		"description": "Any size",
+		"address":     map[string]interface{}{"city": "Berlin"},
+		"price":       "10.00",
+	}
+
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/entries", token, entryData)
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+}
+
+func TestEntryUpdateInvalidData(t *testing.T) {
+	token := signupAndLogin(t)
+
+	entryData := genEntryData("pet-sitter", nil)
+	createdEntry := createEntry(t, token, entryData)
+
+	updateData := map[string]interface{}{
+		"data": map[string]interface{}{
+			"price": "",
+		},
+	}
+
+	rec := performRequest(t, http.MethodPatch, "http://localhost:1323/entries/"+createdEntry.ID, token, updateData)
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	// Nothing was stored
+	retrievedEntry := getEntry(t, token, createdEntry.ID)
+	dataMap := make(map[string]interface{})
+	err := json.Unmarshal(retrievedEntry.Data, &dataMap)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, dataMap["price"])
+}
+
+// Data replaces what's stored; fields left out are gone, and required ones are missed
+func TestEntryUpdateReplacesData(t *testing.T) {
+	token := signupAndLogin(t)
+	money, price := uniquePrice()
+	id := createItemSale(t, token, "", withPrice(money))
+
+	rec := performRequest(t, http.MethodPatch, "http://localhost:1323/entries/"+id, token, map[string]interface{}{
+		"data": itemSaleData("", withPrice(nil))["data"],
+	})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+	assert.True(t, entryIsListed(t, id, price))
+}
+
+func TestEntryUpdateWithoutCity(t *testing.T) {
+	token := signupAndLogin(t)
+	city := uniqueWord()
+	withCity := func(itemSale *model.EntryItemSale) {
+		itemSale.Address = model.Address{City: city}
+	}
+	id := createItemSale(t, token, "", withCity)
+
+	inCity := func() bool {
+		rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries?city_slug="+model.CitySlug(city), "", nil)
+		assert.Equal(t, http.StatusOK, rec.StatusCode)
+		var response struct {
+			Items []model.PublicEntry `json:"items"`
+		}
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+		for _, entry := range response.Items {
+			if entry.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+	assert.True(t, inCity())
+
+	// The address is replaced with the rest of the data
+	updateEntry(t, token, id, map[string]interface{}{
+		"data": itemSaleData("", func(itemSale *model.EntryItemSale) { itemSale.Address = model.Address{} })["data"],
+	})
+	assert.False(t, inCity())
+}
+
 func TestEntryList(t *testing.T) {
 	token := signupAndLogin(t)
 
 	entryData := genEntryData("apartment-short-term-rental", nil)
 	createEntry(t, token, entryData)
 
-	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries", token, nil)
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries?total=true", token, nil)
 	assert.Equal(t, http.StatusOK, rec.StatusCode)
 
 	var response = ListResponse{
@@ -255,13 +377,11 @@ func TestEntryUpdate(t *testing.T) {
 
 	assert.Equal(t, len(files), len(retrievedEntry.Files))
 
-	// Update the entry title
+	// Update the entry title; data is replaced as a whole
 	newTitle := fake.Lorem().Text(40)
+	aptShortTermRental.Title = newTitle
 	updateData := map[string]interface{}{
-		"data": map[string]interface{}{
-			"title":       newTitle,
-			"description": aptShortTermRental.Description,
-		},
+		"data": aptShortTermRental,
 	}
 
 	updateEntry(t, token, createdEntry.ID, updateData)
@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"tbd/dialect"
+	"tbd/model"
+)
+
+// Built-in types first; runtime types can't shadow them, since their names are reserved
+func (h *Handler) lookupEntryType(name string) (model.EntryType, bool, error) {
+	if t, ok := model.LookupBuiltinEntryType(name); ok {
+		return t, true, nil
+	}
+
+	t := model.EntryType{}
+	err := h.DB.Where("name = ?", name).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return t, false, nil
+	}
+	if err != nil {
+		return t, false, err
+	}
+	return t, true, nil
+}
+
+// Same as lookupEntryType, but with the errors the API returns
+func (h *Handler) entryType(name string) (model.EntryType, error) {
+	t, ok, err := h.lookupEntryType(name)
+	if err != nil {
+		log.Println(err)
+		return t, &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch entry type."}
+	}
+	if !ok {
+		log.Printf("Type %s is not supported.", name)
+		return t, &echo.HTTPError{Code: http.StatusBadRequest, Message: "Type is not supported."}
+	}
+	return t, nil
+}
+
+// Lists built-in and runtime types, ordered by position; clients can render forms from each schema
+func (h *Handler) FetchEntryTypes(c echo.Context) error {
+	runtimeTypes := []model.EntryType{}
+	if err := h.DB.Find(&runtimeTypes).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch entry types."}
+	}
+
+	types := append(model.BuiltinEntryTypes(), runtimeTypes...)
+	sort.SliceStable(types, func(i, j int) bool {
+		if types[i].Position != types[j].Position {
+			return types[i].Position < types[j].Position
+		}
+		return types[i].Name < types[j].Name
+	})
+
+	return c.JSON(http.StatusOK, ListResponse{Total: int64(len(types)), Items: types})
+}
+
+func (h *Handler) FetchEntryType(c echo.Context) error {
+	t, ok, err := h.lookupEntryType(c.Param("name"))
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch entry type."}
+	}
+	if !ok {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "Entry type not found."}
+	}
+
+	return c.JSON(http.StatusOK, t)
+}
+
+func (h *Handler) CreateEntryType(c echo.Context) error {
+	if err := isAdmin(c); err != nil {
+		return err
+	}
+
+	s := new(model.SubmitEntryType)
+	if err := c.Bind(s); err != nil {
+		return err
+	}
+	if err := c.Validate(s); err != nil {
+		return err
+	}
+
+	t := model.EntryType{
+		Name:             s.Name,
+		Label:            s.Label,
+		Description:      s.Description,
+		Icon:             s.Icon,
+		Position:         s.Position,
+		Schema:           s.Schema,
+		FilterableFields: s.FilterableFields,
+		ExpiresAfterDays: s.ExpiresAfterDays,
+		Bookable:         s.Bookable,
+		Purchasable:      s.Purchasable,
+	}
+	if t.FilterableFields == nil {
+		t.FilterableFields = []model.FilterableField{}
+	}
+
+	if err := t.Check(); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	if err := h.DB.Create(&t).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return &echo.HTTPError{Code: http.StatusConflict, Message: "Entry type already exists."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create entry type."}
+	}
+
+	return c.JSON(http.StatusCreated, t)
+}
+
+// Changing the schema doesn't touch existing entries; they're validated against the new schema on their next update
+func (h *Handler) UpdateEntryType(c echo.Context) error {
+	if err := isAdmin(c); err != nil {
+		return err
+	}
+
+	name := c.Param("name")
+	if _, ok := model.LookupBuiltinEntryType(name); ok {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Built-in entry types cannot be changed."}
+	}
+
+	t := model.EntryType{}
+	if err := h.DB.Where("name = ?", name).First(&t).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "Entry type not found."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch entry type."}
+	}
+
+	u := new(model.UpdateEntryType)
+	if err := c.Bind(u); err != nil {
+		return err
+	}
+	if err := c.Validate(u); err != nil {
+		return err
+	}
+
+	if u.Label != nil {
+		t.Label = *u.Label
+	}
+	if u.Description != nil {
+		t.Description = *u.Description
+	}
+	if u.Icon != nil {
+		t.Icon = *u.Icon
+	}
+	if u.Position != nil {
+		t.Position = *u.Position
+	}
+	if len(u.Schema) > 0 {
+		t.Schema = u.Schema
+	}
+	if u.FilterableFields != nil {
+		t.FilterableFields = *u.FilterableFields
+	}
+	if u.ExpiresAfterDays != nil {
+		t.ExpiresAfterDays = *u.ExpiresAfterDays
+	}
+	if u.Bookable != nil {
+		t.Bookable = *u.Bookable
+	}
+	if u.Purchasable != nil {
+		t.Purchasable = *u.Purchasable
+	}
+
+	if err := t.Check(); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	if err := h.DB.Save(&t).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to update entry type."}
+	}
+
+	return c.JSON(http.StatusOK, UpdateResponse{Updated: 1})
+}
+
+// Types that are in use cannot be deleted; entries would be left without a schema
+func (h *Handler) DeleteEntryType(c echo.Context) error {
+	if err := isAdmin(c); err != nil {
+		return err
+	}
+
+	name := c.Param("name")
+	if _, ok := model.LookupBuiltinEntryType(name); ok {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Built-in entry types cannot be deleted."}
+	}
+
+	var count int64
+	if err := h.DB.Model(&model.Entry{}).Where("type = ?", name).Count(&count).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to delete entry type."}
+	}
+	if count > 0 {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Entry type is in use."}
+	}
+
+	r := h.DB.Where("name = ?", name).Delete(&model.EntryType{})
+	if r.Error != nil {
+		log.Println(r.Error)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to delete entry type."}
+	}
+
+	if r.RowsAffected == 0 {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "Entry type not found."}
+	}
+
+	return c.JSON(http.StatusOK, DeleteResponse{Deleted: r.RowsAffected})
+}
+
+// Adds a condition for every data.<field> query param; the field must be filterable on the type
+func (h *Handler) appendDataFilters(values url.Values, typeName, query string, params *[]interface{}) (string, error) {
+	fields := []string{}
+	for key := range values {
+		if strings.HasPrefix(key, "data.") {
+			fields = append(fields, strings.TrimPrefix(key, "data."))
+		}
+	}
+	if len(fields) == 0 {
+		return query, nil
+	}
+	if typeName == "" {
+		return query, &echo.HTTPError{Code: http.StatusBadRequest, Message: "Filtering on data requires a type."}
+	}
+
+	t, err := h.entryType(typeName)
+	if err != nil {
+		return query, err
+	}
+
+	// Keeps the order of params stable
+	sort.Strings(fields)
+
+	d := h.dialect()
+	for _, field := range fields {
+		f, ok := t.FilterableField(field)
+		if !ok {
+			return query, &echo.HTTPError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Field %s is not filterable.", field)}
+		}
+
+		castType := ""
+		if f.Type == "number" {
+			castType = "integer"
+		}
+
+		path := strings.Split(f.Field, ".")
+		if err := dialect.CheckJSONPath(path...); err != nil {
+			log.Println(err)
+			return query, &echo.HTTPError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Field %s is not filterable.", field)}
+		}
+
+		op, val := getOperatorAndValue(values.Get("data." + field))
+		query = appendQuery(d, query, d.JSONExtract("data", path...), op, castType, val, params)
+	}
+
+	return query, nil
+}
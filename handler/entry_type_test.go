@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"tbd/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntryTypesList(t *testing.T) {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entry-types", "", nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response struct {
+		Total int64             `json:"total"`
+		Items []model.EntryType `json:"items"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	assert.NoError(t, err)
+
+	names := []string{}
+	for _, entryType := range response.Items {
+		names = append(names, entryType.Name)
+		assert.NotEmpty(t, entryType.Schema)
+	}
+	assert.Subset(t, names, []string{"apartment-short-term-rental", "apartment-long-term-rental", "pet-sitter", "item-sale", "looking-for"})
+}
+
+func TestEntryTypeGet(t *testing.T) {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entry-types/apartment-short-term-rental", "", nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var entryType model.EntryType
+	err := json.NewDecoder(rec.Body).Decode(&entryType)
+	assert.NoError(t, err)
+	assert.True(t, entryType.IsBuiltin)
+	assert.NotEmpty(t, entryType.FilterableFields)
+
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/entry-types/does-not-exist", "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.StatusCode)
+}
+
+func TestEntryTypeAdminForbiddenForMembers(t *testing.T) {
+	token := signupAndLogin(t)
+
+	entryType := map[string]interface{}{
+		"name":   "job",
+		"label":  "Job",
+		"schema": map[string]interface{}{"type": "object"},
+	}
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/admin/entry-types", token, entryType)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodDelete, "http://localhost:1323/admin/entry-types/job", token, nil)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+}
+
+func TestEntryListDataFilter(t *testing.T) {
+	token := signupAndLogin(t)
+
+	// A start date no other entry has
+	from := fmt.Sprintf("2099-01-01T00:00:%02d.%09dZ", rand.Intn(60), rand.Intn(1000000000))
+
+	entryData := genEntryData("apartment-short-term-rental", nil)
+	rental := entryData["data"].(model.EntryApartmentShortTermRental)
+	rental.StartDate = from
+	entryData["data"] = rental
+	createdEntry := createEntry(t, token, entryData)
+
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries?type=apartment-short-term-rental&data.from=eq,"+url.QueryEscape(from), token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response struct {
+		Total int64               `json:"total"`
+		Items []model.PublicEntry `json:"items"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	assert.NoError(t, err)
+
+	ids := []string{}
+	for _, entry := range response.Items {
+		ids = append(ids, entry.ID)
+	}
+	assert.Contains(t, ids, createdEntry.ID)
+
+	// Only fields the type declares are filterable
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/entries?type=item-sale&data.title=lk,foo", token, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/entries?data.from=gt,2020", token, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+}
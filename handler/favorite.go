@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"tbd/jobs"
+	"tbd/model"
+)
+
+// For ex. 12.50 EUR; for favorite alerts
+func priceLabel(amount *int64, currency *string) string {
+	if amount == nil || currency == nil {
+		return "no price"
+	}
+	return model.Money{Amount: *amount, Currency: *currency}.String()
+}
+
+// Queues favorite alerts for what changed between before and the update; price and status are compared
+func (h *Handler) favoriteChanges(before model.Entry, update map[string]interface{}) {
+	if amount, ok := update["price_amount"]; ok {
+		newAmount, _ := amount.(*int64)
+		newCurrency, _ := update["price_currency"].(*string)
+		from := priceLabel(before.PriceAmount, before.PriceCurrency)
+		to := priceLabel(newAmount, newCurrency)
+		if from != to {
+			h.FavoriteAlerts.Changed(jobs.FavoriteChange{EntryID: before.ID, Kind: model.FavoriteChangePrice, From: from, To: to})
+		}
+	}
+
+	if status, ok := update["status"].(string); ok && status != before.Status {
+		h.FavoriteAlerts.Changed(jobs.FavoriteChange{EntryID: before.ID, Kind: model.FavoriteChangeStatus, From: before.Status, To: status})
+	}
+}
+
+func (h *Handler) fetchMyFavorite(c echo.Context) (*model.Favorite, error) {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	f := model.Favorite{}
+	if err := h.DB.First(&f, "entry_id = ? AND user_id = ?", c.Param("entry_id"), reqUser.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &echo.HTTPError{Code: http.StatusNotFound, Message: "Favorite not found."}
+		}
+		log.Println(err)
+		return nil, &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch favorite."}
+	}
+	return &f, nil
+}
+
+// Newest first; entries are included whatever their status, so users see what was sold or expired
+func (h *Handler) FetchMyFavorites(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	page, order, after, err := bindPage(c, creationSorts("favorites"), "newest")
+	if err != nil {
+		return err
+	}
+
+	// Offset is only used without a cursor
+	offset := page.Offset
+	// A session, so counting doesn't change the query
+	query := h.DB.Model(&model.Favorite{}).Where("favorites.user_id = ?", reqUser.ID).Session(&gorm.Session{})
+
+	response := PageResponse{}
+	if page.Total {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch favorites."}
+		}
+		response.Total = &count
+	}
+
+	if after != nil {
+		params := []interface{}{}
+		query = query.Where(order.after(after, &params), params...)
+		offset = 0
+	}
+
+	favorites := []model.Favorite{}
+	err = query.
+		Preload("Entry.City").
+		Preload("Entry.CreatedBy").
+		Preload("Entry.Files").
+		Order(order.orderBy()).
+		Limit(page.Limit + 1).
+		Offset(offset).
+		Find(&favorites).Error
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch favorites."}
+	}
+
+	if len(favorites) > page.Limit {
+		favorites = favorites[:page.Limit]
+		response.NextCursor, err = h.nextCursor(order, "favorites", "favorites.id", favorites[len(favorites)-1].ID)
+		if err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch favorites."}
+		}
+	}
+
+	response.Items = responseArrFormatter[model.Favorite](favorites, nil, os.Getenv("DOMAIN"))
+	return c.JSON(http.StatusOK, response)
+}
+
+// Only listed entries of others can be added; notify defaults to true
+func (h *Handler) CreateFavorite(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	s := model.SubmitFavorite{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+
+	entry := model.Entry{}
+	if err := h.DB.First(&entry, "id = ?", s.EntryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "Entry not found."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch entry."}
+	}
+	if !entry.IsListed(time.Now()) {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "Entry not found."}
+	}
+	if entry.CreatedByID == reqUser.ID {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "You cannot favorite your own entry."}
+	}
+
+	var count int64
+	if err := h.DB.Model(&model.Favorite{}).Where("user_id = ?", reqUser.ID).Count(&count).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create favorite."}
+	}
+	if count >= model.MaxFavoritesPerUser {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Too many favorites."}
+	}
+
+	f := model.Favorite{UserID: reqUser.ID, EntryID: entry.ID, Notify: true}
+	if s.Notify != nil {
+		f.Notify = *s.Notify
+	}
+	if err := h.DB.Create(&f).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return &echo.HTTPError{Code: http.StatusConflict, Message: "Entry is already a favorite."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create favorite."}
+	}
+
+	f.Entry = &entry
+	return c.JSON(http.StatusCreated, responseFormatter[model.Favorite](f, nil, os.Getenv("DOMAIN")))
+}
+
+func (h *Handler) UpdateFavorite(c echo.Context) error {
+	f, err := h.fetchMyFavorite(c)
+	if err != nil {
+		return err
+	}
+
+	u := model.UpdateFavorite{}
+	if err := c.Bind(&u); err != nil {
+		return err
+	}
+
+	if err := h.DB.Model(&model.Favorite{}).Where("id = ?", f.ID).Update("notify", u.Notify).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to update favorite."}
+	}
+
+	return c.JSON(http.StatusOK, UpdateResponse{Updated: 1})
+}
+
+func (h *Handler) DeleteFavorite(c echo.Context) error {
+	f, err := h.fetchMyFavorite(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.DB.Delete(&model.Favorite{}, "id = ?", f.ID).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to delete favorite."}
+	}
+
+	return c.JSON(http.StatusOK, DeleteResponse{Deleted: 1})
+}
+
+// How many users favorited an entry, recently and in total; owner or admin only
+func (h *Handler) FetchEntryInterest(c echo.Context) error {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid entry ID"}
+	}
+	if _, err := h.isOwnerOrAdmin(c, id, "entry"); err != nil {
+		return err
+	}
+
+	// created_at is written in local time; SQLite compares it as text
+	now := time.Now()
+	interest := model.FavoriteInterest{EntryID: id}
+	err := h.DB.Raw(`SELECT
+		COUNT(*) AS favorites,
+		COALESCE(SUM(CASE WHEN created_at > ? THEN 1 ELSE 0 END), 0) AS last7_days,
+		COALESCE(SUM(CASE WHEN created_at > ? THEN 1 ELSE 0 END), 0) AS last30_days,
+		COALESCE(SUM(CASE WHEN notify = ? THEN 1 ELSE 0 END), 0) AS notified
+		FROM favorites WHERE entry_id = ?`, now.AddDate(0, 0, -7).Local(), now.AddDate(0, 0, -30).Local(), true, id).
+		Row().Scan(&interest.Favorites, &interest.Last7Days, &interest.Last30Days, &interest.Notified)
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch interest."}
+	}
+
+	return c.JSON(http.StatusOK, interest)
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"tbd/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type favoriteNotification struct {
+	Kind  string `json:"kind"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+	Data  struct {
+		EntryID string `json:"entry_id"`
+		Change  string `json:"change"`
+		To      string `json:"to"`
+	} `json:"data"`
+}
+
+// Favorite notifications of an entry; waits a few seconds for at least count of them, since alerts are sent in the background
+func waitForFavoriteAlerts(t *testing.T, token, entryID string, count int) []favoriteNotification {
+	alerts := []favoriteNotification{}
+	for i := 0; i < 50; i++ {
+		rec := performRequest(t, http.MethodGet, "http://localhost:1323/account/me/notifications", token, nil)
+		var response struct {
+			Items []favoriteNotification `json:"items"`
+		}
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+
+		alerts = []favoriteNotification{}
+		for _, n := range response.Items {
+			if n.Kind == model.NotificationKindFavorite && n.Data.EntryID == entryID {
+				alerts = append(alerts, n)
+			}
+		}
+		if len(alerts) >= count {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return alerts
+}
+
+func fetchFavorites(t *testing.T, token string) []model.PublicFavorite {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/account/me/favorites", token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response struct {
+		Items []model.PublicFavorite `json:"items"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	return response.Items
+}
+
+func TestFavorites(t *testing.T) {
+	sellerToken := signupAndLogin(t)
+	token := signupAndLogin(t)
+	quietToken := signupAndLogin(t)
+	entryID := createItemSale(t, sellerToken, "", nil)
+
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/account/me/favorites", token, map[string]interface{}{"entry_id": entryID})
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+	var created model.PublicFavorite
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&created))
+	assert.True(t, created.Notify)
+	if assert.NotNil(t, created.Entry) {
+		assert.Equal(t, entryID, created.Entry.ID)
+	}
+
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/me/favorites", quietToken, map[string]interface{}{"entry_id": entryID, "notify": false})
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+
+	// Once per user, and not your own
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/me/favorites", token, map[string]interface{}{"entry_id": entryID})
+	assert.Equal(t, http.StatusConflict, rec.StatusCode)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/me/favorites", sellerToken, map[string]interface{}{"entry_id": entryID})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/me/favorites", token, map[string]interface{}{"entry_id": "6ec84364-931e-4e8b-a5ec-5d4f68e4a1ba"})
+	assert.Equal(t, http.StatusNotFound, rec.StatusCode)
+
+	favorites := fetchFavorites(t, token)
+	if assert.Len(t, favorites, 1) {
+		assert.Equal(t, entryID, favorites[0].Entry.ID)
+	}
+
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/entries/"+entryID, "", nil)
+	var entry model.PublicEntry
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&entry))
+	if assert.NotNil(t, entry.Favorites) {
+		assert.Equal(t, int64(2), *entry.Favorites)
+	}
+
+	// Only the owner sees the interest
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/entries/"+entryID+"/interest", sellerToken, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	var interest model.FavoriteInterest
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&interest))
+	assert.Equal(t, model.FavoriteInterest{EntryID: entryID, Favorites: 2, Last7Days: 2, Last30Days: 2, Notified: 1}, interest)
+
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/entries/"+entryID+"/interest", token, nil)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+
+	// Price and status changes are alerted to those who want to know
+	money, _ := uniquePrice()
+	updateEntry(t, sellerToken, entryID, map[string]interface{}{"data": itemSaleData("", withPrice(money))["data"]})
+
+	rec = performRequest(t, http.MethodPatch, "http://localhost:1323/entries/"+entryID+"/status", sellerToken, map[string]interface{}{"status": model.EntryStatusSold})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	alerts := waitForFavoriteAlerts(t, token, entryID, 2)
+	if assert.Len(t, alerts, 2) {
+		changes := map[string]string{}
+		for _, alert := range alerts {
+			changes[alert.Data.Change] = alert.Data.To
+		}
+		assert.Equal(t, money.String(), changes[model.FavoriteChangePrice])
+		assert.Equal(t, model.EntryStatusSold, changes[model.FavoriteChangeStatus])
+	}
+	assert.Empty(t, waitForFavoriteAlerts(t, quietToken, entryID, 0))
+
+	// Sold entries stay in the list, so users see what happened
+	favorites = fetchFavorites(t, token)
+	if assert.Len(t, favorites, 1) {
+		assert.Equal(t, model.EntryStatusSold, favorites[0].Entry.Status)
+	}
+
+	rec = performRequest(t, http.MethodPatch, "http://localhost:1323/account/me/favorites/"+entryID, token, map[string]interface{}{"notify": false})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.False(t, fetchFavorites(t, token)[0].Notify)
+
+	rec = performRequest(t, http.MethodDelete, "http://localhost:1323/account/me/favorites/"+entryID, sellerToken, nil)
+	assert.Equal(t, http.StatusNotFound, rec.StatusCode)
+	rec = performRequest(t, http.MethodDelete, "http://localhost:1323/account/me/favorites/"+entryID, token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.Empty(t, fetchFavorites(t, token))
+}
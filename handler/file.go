@@ -1,18 +1,16 @@
 package handler
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"strconv"
 	"tbd/model"
+	"tbd/storage"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 
 	"github.com/google/uuid"
 )
@@ -51,16 +49,6 @@ func (h *Handler) CreateFiles(c echo.Context) error {
 	}
 	files := form.File["files"]
 
-	// Create S3 client
-	// This will pickup env variables
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(os.Getenv("AWS_REGION")))
-	if err != nil {
-		log.Printf("error: %v", err)
-		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to configure upload client."}
-	}
-
-	client := s3.NewFromConfig(cfg)
-
 	dbFiles := []model.File{}
 
 	for _, file := range files {
@@ -94,15 +82,7 @@ func (h *Handler) CreateFiles(c echo.Context) error {
 		dbFile.IsProvisional = true
 
 		// Upload file
-		uploader := manager.NewUploader(client)
-		bucket := os.Getenv("AWS_BUCKET_NAME")
-
-		result, err := uploader.Upload(context.TODO(), &s3.PutObjectInput{
-			Bucket: aws.String(bucket),
-			Key:    aws.String(dbFile.Path),
-			Body:   src,
-		})
-
+		err = h.Storage.Put(c.Request().Context(), dbFile.Path, src, dbFile.Mime)
 		if err != nil {
 			log.Printf("Failed to upload file: %v", err)
 			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to upload file."}
@@ -115,7 +95,7 @@ func (h *Handler) CreateFiles(c echo.Context) error {
 			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to save file to DB"}
 		}
 
-		log.Println(fmt.Sprintf("File uploaded to %s", result.Location))
+		log.Println(fmt.Sprintf("File uploaded to %s", dbFile.Path))
 		dbFiles = append(dbFiles, dbFile)
 	}
 
@@ -132,27 +112,15 @@ func (h *Handler) DeleteFile(c echo.Context) error {
 
 	file := dbFile.(*model.File)
 
-	// Delete file from S3
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(os.Getenv("AWS_REGION")))
-	if err != nil {
-		log.Printf("error: %v", err)
-		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to configure client."}
-	}
-
-	client := s3.NewFromConfig(cfg)
-
-	bucket := os.Getenv("AWS_BUCKET_NAME")
-	_, err = client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(file.Path),
-	})
+	// Delete file from storage
+	err = h.Storage.Delete(c.Request().Context(), file.Path)
 	if err != nil {
-		log.Printf("Failed to delete file from S3: %v", err)
-		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to delete file from S3"}
+		log.Printf("Failed to delete file from storage: %v", err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to delete file from storage"}
 	}
 
 	// Delete file from DB
-	r := h.DB.Delete(model.File{
+	r := h.DB.Delete(&model.File{
 		ID: file.ID,
 	})
 	if r.Error != nil {
@@ -175,40 +143,38 @@ func (h *Handler) DownloadFile(c echo.Context) error {
 		file := model.File{}
 		r := h.DB.First(&file, "id = ?", id)
 		if r.Error != nil {
+			if r.Error == gorm.ErrRecordNotFound {
+				return &echo.HTTPError{Code: http.StatusNotFound, Message: "File not found."}
+			}
 			log.Printf("Failed to get file from DB: %v", r.Error)
 			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to get file from DB"}
 		}
 		filePath = file.Path
 	}
 
-	// Create S3 client
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(os.Getenv("AWS_REGION")))
-	if err != nil {
-		log.Printf("error: %v", err)
-		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to configure download client."}
-	}
-
-	client := s3.NewFromConfig(cfg)
-
 	// Get object
-	output, err := client.GetObject(context.TODO(), &s3.GetObjectInput{
-		Bucket: aws.String(os.Getenv("AWS_BUCKET_NAME")),
-		Key:    aws.String(filePath),
-	})
+	body, obj, err := h.Storage.Stream(c.Request().Context(), filePath)
 	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "File not found."}
+		}
 		log.Printf("Failed to download file: %v", err)
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to download file."}
 	}
+	defer body.Close()
 
 	// Get the content type
-	contentType := *output.ContentType
+	contentType := obj.ContentType
+	if contentType == "" {
+		contentType = echo.MIMEOctetStream
+	}
 
 	// Set the headers you want on the response.
 	c.Response().Header().Set(echo.HeaderContentType, contentType)
 	c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename="+id)
 
 	// Use Stream to provide your response body
-	return c.Stream(http.StatusOK, contentType, output.Body)
+	return c.Stream(http.StatusOK, contentType, body)
 }
 
 func (h *Handler) markFilesAsProvisioned(files []model.File) error {
@@ -223,3 +189,28 @@ func (h *Handler) markFilesAsProvisioned(files []model.File) error {
 
 	return nil
 }
+
+func (h *Handler) FileReaperMetrics(c echo.Context) error {
+	if err := isAdmin(c); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, h.FileReaper.Metrics())
+}
+
+// Runs the reaper immediately; pass dry_run=true to only list what would be deleted
+func (h *Handler) RunFileReaper(c echo.Context) error {
+	if err := isAdmin(c); err != nil {
+		return err
+	}
+
+	dryRun, _ := strconv.ParseBool(c.QueryParam("dry_run"))
+
+	result, err := h.FileReaper.Reap(c.Request().Context(), dryRun)
+	if err != nil {
+		log.Printf("Failed to reap files: %v", err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to reap files."}
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
@@ -121,3 +121,13 @@ func TestFileLifecycleWithUnauthorizedUser(t *testing.T) {
 	// Expect the server to return a 403 Forbidden status code
 	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
 }
+
+func TestFileReaperForbiddenForMembers(t *testing.T) {
+	token := signupAndLogin(t)
+
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/admin/files/reaper", token, nil)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/admin/files/reaper?dry_run=true", token, nil)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+}
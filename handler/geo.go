@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"tbd/model"
+)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Keeps entries with coordinates in the box; a box that crosses the antimeridian wraps around
+func bboxCondition(box model.BBox, params *[]interface{}) string {
+	condition := " AND entries.latitude BETWEEN ? AND ?"
+	*params = append(*params, box.MinLat, box.MaxLat)
+
+	if box.MinLng <= box.MaxLng {
+		*params = append(*params, box.MinLng, box.MaxLng)
+		return condition + " AND entries.longitude BETWEEN ? AND ?"
+	}
+	*params = append(*params, box.MinLng, box.MaxLng)
+	return condition + " AND (entries.longitude >= ? OR entries.longitude <= ?)"
+}
+
+// Squared distance from center in degrees of latitude, as SQL; equirectangular, so it only needs arithmetic
+//
+// Notes:
+//   - SQLite has no trigonometric functions without extensions; the cosine is worked out here and inlined, as are the coordinates (parsed floats)
+//   - Accurate to well under 1% for radii of a few hundred km; the distance in the response is the great-circle distance
+//   - Longitudes are wrapped, so points across the antimeridian are near
+func distanceExpression(center model.Point) string {
+	dLng := fmt.Sprintf("(entries.longitude - %s)", formatFloat(center.Lng))
+	wrapped := fmt.Sprintf("(CASE WHEN %[1]s > 180 THEN %[1]s - 360 WHEN %[1]s < -180 THEN %[1]s + 360 ELSE %[1]s END)", dLng)
+	x := fmt.Sprintf("(%s * %s)", wrapped, formatFloat(math.Cos(center.Lat*math.Pi/180)))
+	y := fmt.Sprintf("(entries.latitude - %s)", formatFloat(center.Lat))
+	return fmt.Sprintf("(%[1]s * %[1]s + %[2]s * %[2]s)", x, y)
+}
+
+// Adds the near / radius_km and bbox filters; returns the point to measure distances from, and the expression to sort on
+// Returns a nil point and an empty expression if near isn't requested
+func appendGeoFilter(queryParams *model.EntryQueryParams, query string, params *[]interface{}) (string, *model.Point, string, error) {
+	if queryParams.BBox != "" {
+		box, err := model.ParseBBox(queryParams.BBox)
+		if err != nil {
+			return query, nil, "", &echo.HTTPError{Code: http.StatusBadRequest, Message: "Bbox is invalid; expected min_lng,min_lat,max_lng,max_lat."}
+		}
+		query += bboxCondition(box, params)
+	}
+
+	if queryParams.Near == "" {
+		if queryParams.RadiusKm > 0 || queryParams.Sort == "distance" {
+			return query, nil, "", &echo.HTTPError{Code: http.StatusBadRequest, Message: "Near is required for radius_km and sorting by distance."}
+		}
+		return query, nil, "", nil
+	}
+
+	center, err := model.ParsePoint(queryParams.Near)
+	if err != nil {
+		return query, nil, "", &echo.HTTPError{Code: http.StatusBadRequest, Message: "Near is invalid; expected lat,lng."}
+	}
+
+	expr := distanceExpression(center)
+	if queryParams.RadiusKm > 0 {
+		// The box narrows it down on the index, the distance decides
+		query += bboxCondition(model.BBoxAround(center, queryParams.RadiusKm), params)
+		query += fmt.Sprintf(" AND %s <= ?", expr)
+		radius := queryParams.RadiusKm / model.KmPerDegree
+		*params = append(*params, radius*radius)
+	} else {
+		query += " AND entries.latitude IS NOT NULL AND entries.longitude IS NOT NULL"
+	}
+
+	return query, &center, expr, nil
+}
+
+// Great-circle distance from center, rounded to meters; nil if the entry has no coordinates
+func entryDistanceKm(entry model.Entry, center *model.Point) *float64 {
+	if center == nil || entry.Latitude == nil || entry.Longitude == nil {
+		return nil
+	}
+	d := model.DistanceKm(*center, model.Point{Lat: *entry.Latitude, Lng: *entry.Longitude})
+	d = math.Round(d*1000) / 1000
+	return &d
+}
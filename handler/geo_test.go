@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"tbd/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Somewhere in the southern Pacific, so no other entry is nearby
+func uniqueLocation() model.Point {
+	return model.Point{Lat: -40 + rand.Float64()*10, Lng: -140 + rand.Float64()*10}
+}
+
+func withLocation(lat, lng float64) func(*model.EntryItemSale) {
+	return func(itemSale *model.EntryItemSale) {
+		itemSale.Address.Latitude = fmt.Sprint(lat)
+		itemSale.Address.Longitude = fmt.Sprint(lng)
+	}
+}
+
+func fetchEntriesNear(t *testing.T, query string) []model.PublicEntry {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries?"+query, "", nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response struct {
+		Items []model.PublicEntry `json:"items"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	assert.NoError(t, err)
+	return response.Items
+}
+
+func TestEntryGeoSearch(t *testing.T) {
+	token := signupAndLogin(t)
+	center := uniqueLocation()
+
+	// Roughly 1, 5 and 50 km north
+	near := createItemSale(t, token, "", withLocation(center.Lat+0.009, center.Lng))
+	middle := createItemSale(t, token, "", withLocation(center.Lat+0.045, center.Lng))
+	far := createItemSale(t, token, "", withLocation(center.Lat+0.45, center.Lng))
+
+	entries := fetchEntriesNear(t, fmt.Sprintf("near=%f,%f&radius_km=10&sort=distance", center.Lat, center.Lng))
+	assert.Len(t, entries, 2)
+	if len(entries) == 2 {
+		assert.Equal(t, near, entries[0].ID)
+		assert.Equal(t, middle, entries[1].ID)
+		assert.InDelta(t, 1, *entries[0].DistanceKm, 0.1)
+		assert.InDelta(t, 5, *entries[1].DistanceKm, 0.1)
+	}
+
+	entries = fetchEntriesNear(t, fmt.Sprintf("near=%f,%f&radius_km=100&sort=distance&limit=3", center.Lat, center.Lng))
+	assert.Len(t, entries, 3)
+	if len(entries) == 3 {
+		assert.Equal(t, far, entries[2].ID)
+	}
+
+	bbox := fmt.Sprintf("%f,%f,%f,%f", center.Lng-0.1, center.Lat+0.02, center.Lng+0.1, center.Lat+0.5)
+	entries = fetchEntriesNear(t, "bbox="+bbox)
+	ids := []string{}
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+		assert.Nil(t, entry.DistanceKm)
+	}
+	assert.ElementsMatch(t, []string{middle, far}, ids)
+
+	// Moving the entry moves it out of the radius
+	rec := performRequest(t, http.MethodPatch, "http://localhost:1323/entries/"+near, token, map[string]interface{}{
+		"data": itemSaleData("", withLocation(center.Lat+1, center.Lng))["data"],
+	})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	entries = fetchEntriesNear(t, fmt.Sprintf("near=%f,%f&radius_km=10", center.Lat, center.Lng))
+	assert.Len(t, entries, 1)
+}
+
+func TestEntryGeoSearchAntimeridian(t *testing.T) {
+	token := signupAndLogin(t)
+	lat := -50 + rand.Float64()*5
+
+	east := createItemSale(t, token, "", withLocation(lat, 179.99))
+	west := createItemSale(t, token, "", withLocation(lat, -179.99))
+
+	entries := fetchEntriesNear(t, fmt.Sprintf("near=%f,179.995&radius_km=5&sort=distance", lat))
+	ids := []string{}
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	assert.Contains(t, ids, east)
+	assert.Contains(t, ids, west)
+
+	entries = fetchEntriesNear(t, fmt.Sprintf("bbox=179.9,%f,-179.9,%f", lat-0.01, lat+0.01))
+	ids = []string{}
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	assert.Contains(t, ids, east)
+	assert.Contains(t, ids, west)
+}
+
+func TestEntryGeoSearchInvalid(t *testing.T) {
+	for _, query := range []string{"near=91,0", "near=abc", "radius_km=5", "sort=distance", "near=0,0&radius_km=-1", "bbox=1,2,3", "bbox=0,10,1,5"} {
+		rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries?"+query, "", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.StatusCode, query)
+	}
+
+	token := signupAndLogin(t)
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/entries", token, itemSaleData("", withLocation(100, 0)))
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+}
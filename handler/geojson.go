@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"tbd/model"
+)
+
+const (
+	// Entries a map request returns by default, and at most; clustering is the way to show more
+	mapDefaultLimit = 500
+	mapMaxLimit     = 5000
+)
+
+// Entries as a GeoJSON FeatureCollection, with the filters of FetchEntries; only entries with coordinates
+// With cluster=true&zoom=, entries are grouped into grid cells, and each cell is a point with a count
+//
+// Notes:
+//   - A cluster is at the average position of its entries, with the bbox of its cell; clusters of one entry have its entry_id
+//   - Clusters are sorted by count, and limited like entries
+func (h *Handler) FetchEntriesGeoJSON(c echo.Context) error {
+	queryParams, err := bindEntryQueryParams(c)
+	if err != nil {
+		return err
+	}
+
+	mapParams := new(model.MapQueryParams)
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, mapParams); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(mapParams); err != nil {
+		return err
+	}
+	if mapParams.Cluster && !c.QueryParams().Has("zoom") {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Zoom is required for clustering."}
+	}
+
+	if queryParams.Offset < 0 {
+		queryParams.Offset = 0
+	}
+	if queryParams.Limit < 1 {
+		queryParams.Limit = mapDefaultLimit
+	}
+	if queryParams.Limit > mapMaxLimit {
+		queryParams.Limit = mapMaxLimit
+	}
+
+	filter, err := h.entryFilters(c.QueryParams(), queryParams)
+	if err != nil {
+		return err
+	}
+	filter.query += " AND entries.latitude IS NOT NULL AND entries.longitude IS NOT NULL"
+
+	var count int64
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM entries LEFT JOIN cities ON entries.city_id = cities.id WHERE 1=1 %v", filter.query)
+	if err := h.DB.Raw(countQuery, filter.params...).Count(&count).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch entries."}
+	}
+
+	var features []model.Feature
+	if mapParams.Cluster {
+		features, err = h.entryClusters(filter, mapParams.Zoom, queryParams.Limit)
+	} else {
+		features, err = h.entryFeatures(filter, queryParams)
+	}
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch entries."}
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, "application/geo+json")
+	return c.JSON(http.StatusOK, model.NewFeatureCollection(features, count))
+}
+
+func (h *Handler) entryFeatures(filter entryFilter, queryParams *model.EntryQueryParams) ([]model.Feature, error) {
+	query := fmt.Sprintf("SELECT entries.* FROM entries LEFT JOIN cities ON entries.city_id = cities.id WHERE 1=1 %v", filter.query)
+	query += " ORDER BY " + filter.sortOrder(queryParams.Sort).orderBy()
+	query += " LIMIT ? OFFSET ?"
+	params := append(filter.params, queryParams.Limit, queryParams.Offset)
+
+	entries := []model.Entry{}
+	if err := h.DB.Raw(query, params...).Scan(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	features := []model.Feature{}
+	for _, entry := range entries {
+		properties := map[string]interface{}{
+			"type":  entry.Type,
+			"title": entryTitle(entry.Data),
+		}
+		if entry.PriceAmount != nil && entry.PriceCurrency != nil {
+			properties["price"] = model.Money{Amount: *entry.PriceAmount, Currency: *entry.PriceCurrency}
+		}
+		if distance := entryDistanceKm(entry, filter.center); distance != nil {
+			properties["distance_km"] = *distance
+		}
+
+		features = append(features, model.NewPointFeature(entry.ID, model.Point{Lat: *entry.Latitude, Lng: *entry.Longitude}, properties))
+	}
+	return features, nil
+}
+
+func (h *Handler) entryClusters(filter entryFilter, zoom, limit int) ([]model.Feature, error) {
+	d := h.dialect()
+	size := model.ClusterCellSize(zoom)
+
+	// Longitude and latitude are shifted to be positive, so cells count from the south-west corner
+	x := d.Floor(fmt.Sprintf("((entries.longitude + 180) / %s)", formatFloat(size)))
+	y := d.Floor(fmt.Sprintf("((entries.latitude + 90) / %s)", formatFloat(size)))
+
+	query := fmt.Sprintf(`SELECT %s AS x, %s AS y, COUNT(*) AS count,
+		AVG(entries.latitude) AS lat, AVG(entries.longitude) AS lng, MIN(%s) AS entry_id
+		FROM entries LEFT JOIN cities ON entries.city_id = cities.id WHERE 1=1 %v
+		GROUP BY 1, 2 ORDER BY count DESC, 1, 2 LIMIT ?`, x, y, d.Cast("entries.id", "text"), filter.query)
+	params := append(filter.params, limit)
+
+	cells := []struct {
+		X       int64
+		Y       int64
+		Count   int64
+		Lat     float64
+		Lng     float64
+		EntryID string
+	}{}
+	if err := h.DB.Raw(query, params...).Scan(&cells).Error; err != nil {
+		return nil, err
+	}
+
+	features := []model.Feature{}
+	for _, cell := range cells {
+		properties := map[string]interface{}{
+			"cluster": true,
+			"count":   cell.Count,
+		}
+		if cell.Count == 1 {
+			properties["entry_id"] = cell.EntryID
+		}
+
+		feature := model.NewPointFeature(fmt.Sprintf("%d/%d/%d", zoom, cell.X, cell.Y), model.Point{Lat: cell.Lat, Lng: cell.Lng}, properties)
+		feature.BBox = model.ClusterCellBBox(cell.X, cell.Y, size)
+		features = append(features, feature)
+	}
+	return features, nil
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"tbd/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fetchGeoJSON(t *testing.T, query string) model.FeatureCollection {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries.geojson?"+query, "", nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.Equal(t, "application/geo+json", rec.Header.Get("Content-Type"))
+
+	var collection model.FeatureCollection
+	err := json.NewDecoder(rec.Body).Decode(&collection)
+	assert.NoError(t, err)
+	return collection
+}
+
+func TestEntriesGeoJSON(t *testing.T) {
+	token := signupAndLogin(t)
+
+	// In the middle of a cell at zoom 12, so the first two share it
+	center := uniqueLocation()
+	size := model.ClusterCellSize(12)
+	center.Lat = -90 + (math.Floor((center.Lat+90)/size)+0.5)*size
+	center.Lng = -180 + (math.Floor((center.Lng+180)/size)+0.5)*size
+
+	// Two next to each other, one about 20 km east
+	a := createItemSale(t, token, "", withLocation(center.Lat, center.Lng))
+	b := createItemSale(t, token, "", withLocation(center.Lat+0.001, center.Lng+0.001))
+	far := createItemSale(t, token, "", withLocation(center.Lat, center.Lng+0.25))
+
+	bbox := fmt.Sprintf("bbox=%f,%f,%f,%f", center.Lng-0.01, center.Lat-0.01, center.Lng+0.3, center.Lat+0.01)
+
+	collection := fetchGeoJSON(t, bbox)
+	assert.Equal(t, "FeatureCollection", collection.Type)
+	assert.Equal(t, int64(3), collection.Total)
+
+	ids := []string{}
+	for _, feature := range collection.Features {
+		ids = append(ids, feature.ID)
+		assert.Equal(t, "Point", feature.Geometry.Type)
+		assert.Equal(t, "item-sale", feature.Properties["type"])
+		assert.NotEmpty(t, feature.Properties["title"])
+		assert.NotNil(t, feature.Properties["price"])
+	}
+	assert.ElementsMatch(t, []string{a, b, far}, ids)
+
+	// Same filters as the list
+	collection = fetchGeoJSON(t, fmt.Sprintf("near=%f,%f&radius_km=1", center.Lat, center.Lng))
+	assert.Equal(t, int64(2), collection.Total)
+
+	// Zoomed out, one cell has all of them
+	collection = fetchGeoJSON(t, bbox+"&cluster=true&zoom=0")
+	assert.Equal(t, int64(3), collection.Total)
+	assert.Len(t, collection.Features, 1)
+	if len(collection.Features) == 1 {
+		cluster := collection.Features[0]
+		assert.Equal(t, true, cluster.Properties["cluster"])
+		assert.Equal(t, float64(3), cluster.Properties["count"])
+		assert.Len(t, cluster.BBox, 4)
+		assert.LessOrEqual(t, cluster.BBox[0], center.Lng)
+		assert.GreaterOrEqual(t, cluster.BBox[2], center.Lng+0.25)
+	}
+
+	// Zoomed in, the far one is on its own
+	collection = fetchGeoJSON(t, bbox+"&cluster=true&zoom=12")
+	assert.Len(t, collection.Features, 2)
+	if len(collection.Features) == 2 {
+		assert.Equal(t, float64(2), collection.Features[0].Properties["count"])
+		assert.Equal(t, float64(1), collection.Features[1].Properties["count"])
+		assert.Equal(t, far, collection.Features[1].Properties["entry_id"])
+	}
+}
+
+func TestEntriesGeoJSONInvalid(t *testing.T) {
+	for _, query := range []string{"cluster=true", "cluster=true&zoom=30", "zoom=-1", "bbox=1,2,3"} {
+		rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries.geojson?"+query, "", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.StatusCode, query)
+	}
+}
@@ -1,11 +1,50 @@
 package handler
 
 import (
+	"time"
+
+	"tbd/dialect"
+	"tbd/jobs"
+	"tbd/mail"
+	"tbd/payment"
+	"tbd/session"
+	"tbd/sms"
+	"tbd/storage"
+
 	"gorm.io/gorm"
 )
 
 type (
 	Handler struct {
-		DB *gorm.DB
+		DB         *gorm.DB
+		Storage    storage.Storage
+		FileReaper *jobs.FileReaper
+		// Imports the remote calendar of an entry right away, when it's set
+		CalendarSync *jobs.CalendarSync
+		// Payment providers the community accepts, and the currency prices are compared in by default (ISO 4217)
+		Payments *payment.Registry
+		Currency string
+		// Checks saved searches right away, when an entry was written
+		SavedSearchAlerts *jobs.SavedSearchAlerts
+		// Tells users who favorited an entry that it changed
+		FavoriteAlerts *jobs.FavoriteAlerts
+		// Sends the token to confirm an email, valid for EmailVerificationTTL
+		Mailer               mail.Mailer
+		EmailVerificationTTL time.Duration
+		// Only users who confirmed their email may create entries, comment and vote
+		RequireConfirmedEmail bool
+		// Sends password reset tokens to phones; tokens are valid for PasswordResetTTL
+		SMS              sms.Sender
+		PasswordResetTTL time.Duration
+		// Revoked sessions; access tokens are valid for AccessTokenTTL, refresh tokens for RefreshTokenTTL since they were last used
+		Sessions *session.Denylist
+		// Cached roles and account state; changed accounts are invalidated
+		Accounts        *session.Accounts
+		AccessTokenTTL  time.Duration
+		RefreshTokenTTL time.Duration
 	}
 )
+
+func (h *Handler) dialect() dialect.Dialect {
+	return dialect.For(h.DB)
+}
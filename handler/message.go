@@ -0,0 +1,626 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"tbd/model"
+	"tbd/pgp"
+)
+
+var errBlocked = &echo.HTTPError{Code: http.StatusForbidden, Message: "You cannot message this user."}
+
+// Sorts of conversations; recent is by last message
+func conversationSorts() map[string]sortOrder {
+	sorts := creationSorts("conversations")
+	sorts["recent"] = sortOrder{name: "recent", keys: []sortKey{
+		{expr: "conversations.last_message_at", desc: true, time: true},
+		{expr: "conversations.id", desc: true},
+	}}
+	return sorts
+}
+
+// Messages of others the user hasn't read, by conversation; messages before the user deleted the conversation don't count
+func (h *Handler) unreadMessages(userID string, conversationIDs []string) (map[string]int64, error) {
+	unread := map[string]int64{}
+	if len(conversationIDs) == 0 {
+		return unread, nil
+	}
+
+	rows := []struct {
+		ConversationID string
+		Unread         int64
+	}{}
+	err := h.DB.Raw(`SELECT messages.conversation_id, COUNT(*) AS unread FROM messages
+		INNER JOIN conversation_participants p ON p.conversation_id = messages.conversation_id AND p.user_id = ?
+		WHERE messages.conversation_id IN ? AND messages.sender_id <> ?
+		AND (p.last_read_at IS NULL OR messages.created_at > p.last_read_at)
+		AND (p.cleared_at IS NULL OR messages.created_at > p.cleared_at)
+		GROUP BY messages.conversation_id`, userID, conversationIDs, userID).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		unread[row.ConversationID] = row.Unread
+	}
+	return unread, nil
+}
+
+// Whether any of userIDs blocked senderID
+func (h *Handler) blockedBy(senderID string, userIDs []string) (bool, error) {
+	var count int64
+	err := h.DB.Model(&model.UserBlock{}).Where("blocked_id = ? AND user_id IN ?", senderID, userIDs).Count(&count).Error
+	return count > 0, err
+}
+
+// The conversation of the id param, if the user takes part in it
+func (h *Handler) fetchMyConversation(c echo.Context) (*model.Conversation, *model.ConversationParticipant, error) {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid conversation ID."}
+	}
+
+	conversation := model.Conversation{}
+	err := h.DB.Preload("Participants.User").First(&conversation, "id = ?", id).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Println(err)
+		return nil, nil, &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch conversation."}
+	}
+
+	for i, p := range conversation.Participants {
+		if p.UserID == reqUser.ID {
+			return &conversation, &conversation.Participants[i], nil
+		}
+	}
+	return nil, nil, &echo.HTTPError{Code: http.StatusNotFound, Message: "Conversation not found."}
+}
+
+// User ids of the participants other than userID
+func otherParticipants(conversation *model.Conversation, userID string) []string {
+	ids := []string{}
+	for _, p := range conversation.Participants {
+		if p.UserID != userID {
+			ids = append(ids, p.UserID)
+		}
+	}
+	return ids
+}
+
+// Adds a message to a conversation, and marks the conversation read for the sender
+// With encrypted, the body must be an armored PGP message encrypted to the public keys of all participants; it's stored as is
+func addMessage(tx *gorm.DB, conversation *model.Conversation, senderID, body string, encrypted bool) (*model.Message, error) {
+	if encrypted {
+		publicKeys := []string{}
+		for _, p := range conversation.Participants {
+			if p.User == nil || p.User.PublicKey == "" {
+				return nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: "Not all participants have a public key."}
+			}
+			publicKeys = append(publicKeys, p.User.PublicKey)
+		}
+
+		err := pgp.CheckEncryptedTo(body, publicKeys)
+		if errors.Is(err, pgp.ErrNotEncrypted) || errors.Is(err, pgp.ErrMissingRecipient) {
+			return nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: "Message must be encrypted to the public keys of all participants."}
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else if utf8.RuneCountInString(body) > model.MaxMessageLength {
+		return nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: fmt.Sprintf("Message can't be longer than %d characters.", model.MaxMessageLength)}
+	}
+
+	m := model.Message{ConversationID: conversation.ID, SenderID: senderID, Body: body, Encrypted: encrypted}
+	if err := tx.Create(&m).Error; err != nil {
+		return nil, err
+	}
+
+	err := tx.Model(&model.Conversation{}).Where("id = ?", conversation.ID).Update("last_message_at", m.CreatedAt).Error
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Model(&model.ConversationParticipant{}).
+		Where("conversation_id = ? AND user_id = ?", conversation.ID, senderID).
+		Update("last_read_at", m.CreatedAt).Error
+	if err != nil {
+		return nil, err
+	}
+
+	conversation.LastMessageAt = m.CreatedAt
+	return &m, nil
+}
+
+func (h *Handler) publicConversation(conversation model.Conversation, userID string) (model.PublicConversation, error) {
+	unread, err := h.unreadMessages(userID, []string{conversation.ID})
+	if err != nil {
+		return model.PublicConversation{}, err
+	}
+
+	pc := conversation.ToPublicFormat(os.Getenv("DOMAIN")).(model.PublicConversation)
+	pc.Unread = unread[conversation.ID]
+	return pc, nil
+}
+
+// Starts a conversation about an entry with its owner, and optionally others
+// If the same users already talk about the entry, the message is added to their conversation
+func (h *Handler) CreateConversation(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	s := model.SubmitConversation{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+
+	entry := model.Entry{}
+	if err := h.DB.First(&entry, "id = ?", s.EntryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "Entry not found."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch entry."}
+	}
+	// Owners may still reach out about entries that aren't listed anymore
+	if entry.CreatedByID != reqUser.ID && !entry.IsListed(time.Now()) {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "Entry not found."}
+	}
+
+	userIDs := []string{reqUser.ID}
+	seen := map[string]bool{reqUser.ID: true}
+	for _, id := range append([]string{entry.CreatedByID}, s.ParticipantIDs...) {
+		if !seen[id] {
+			seen[id] = true
+			userIDs = append(userIDs, id)
+		}
+	}
+	if len(userIDs) < 2 {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "A conversation needs someone to talk to."}
+	}
+	if len(userIDs) > model.MaxConversationParticipants {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Too many participants."}
+	}
+
+	users := []model.User{}
+	if err := h.DB.Where("id IN ? AND deleted_at IS NULL", userIDs).Find(&users).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create conversation."}
+	}
+	if len(users) != len(userIDs) {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "User not found."}
+	}
+
+	blocked, err := h.blockedBy(reqUser.ID, userIDs[1:])
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create conversation."}
+	}
+	if blocked {
+		return errBlocked
+	}
+
+	// The conversation of exactly these users about the entry, if there is one
+	existing := []model.Conversation{}
+	err = h.DB.Preload("Participants.User").
+		Where("entry_id = ? AND id IN (SELECT conversation_id FROM conversation_participants WHERE user_id = ?)", entry.ID, reqUser.ID).
+		Find(&existing).Error
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create conversation."}
+	}
+	var conversation *model.Conversation
+	for i, e := range existing {
+		if len(e.Participants) != len(userIDs) {
+			continue
+		}
+		same := true
+		for _, p := range e.Participants {
+			same = same && seen[p.UserID]
+		}
+		if same {
+			conversation = &existing[i]
+			break
+		}
+	}
+
+	status := http.StatusOK
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if conversation == nil {
+			status = http.StatusCreated
+			conversation = &model.Conversation{EntryID: entry.ID, CreatedByID: reqUser.ID, LastMessageAt: time.Now()}
+			if err := tx.Create(conversation).Error; err != nil {
+				return err
+			}
+			for i := range users {
+				p := model.ConversationParticipant{ConversationID: conversation.ID, UserID: users[i].ID, User: &users[i]}
+				if err := tx.Omit("User").Create(&p).Error; err != nil {
+					return err
+				}
+				conversation.Participants = append(conversation.Participants, p)
+			}
+		}
+
+		_, err := addMessage(tx, conversation, reqUser.ID, s.Body, s.Encrypted)
+		return err
+	})
+	if err != nil {
+		var httpError *echo.HTTPError
+		if errors.As(err, &httpError) {
+			return httpError
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create conversation."}
+	}
+
+	conversation.Entry = &entry
+	pc, err := h.publicConversation(*conversation, reqUser.ID)
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch conversation."}
+	}
+	return c.JSON(status, pc)
+}
+
+// Conversations the user takes part in, and hasn't deleted; most recent first. Filter with ?entry_id=
+func (h *Handler) FetchMyConversations(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	page, order, after, err := bindPage(c, conversationSorts(), "recent")
+	if err != nil {
+		return err
+	}
+
+	// Offset is only used without a cursor
+	offset := page.Offset
+	// A session, so counting doesn't change the query
+	query := h.DB.Model(&model.Conversation{}).
+		Joins("INNER JOIN conversation_participants p ON p.conversation_id = conversations.id AND p.user_id = ?", reqUser.ID).
+		Where("(p.cleared_at IS NULL OR conversations.last_message_at > p.cleared_at)")
+	if entryID := c.QueryParam("entry_id"); entryID != "" {
+		query = query.Where("conversations.entry_id = ?", entryID)
+	}
+	query = query.Session(&gorm.Session{})
+
+	response := PageResponse{}
+	if page.Total {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch conversations."}
+		}
+		response.Total = &count
+	}
+
+	if after != nil {
+		params := []interface{}{}
+		query = query.Where(order.after(after, &params), params...)
+		offset = 0
+	}
+
+	conversations := []model.Conversation{}
+	err = query.
+		Preload("Entry").
+		Preload("Participants.User").
+		Order(order.orderBy()).
+		Limit(page.Limit + 1).
+		Offset(offset).
+		Find(&conversations).Error
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch conversations."}
+	}
+
+	if len(conversations) > page.Limit {
+		conversations = conversations[:page.Limit]
+		response.NextCursor, err = h.nextCursor(order, "conversations", "conversations.id", conversations[len(conversations)-1].ID)
+		if err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch conversations."}
+		}
+	}
+
+	ids := []string{}
+	for _, conversation := range conversations {
+		ids = append(ids, conversation.ID)
+	}
+	unread, err := h.unreadMessages(reqUser.ID, ids)
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch conversations."}
+	}
+
+	items := []model.PublicConversation{}
+	for _, conversation := range conversations {
+		pc := conversation.ToPublicFormat(os.Getenv("DOMAIN")).(model.PublicConversation)
+		pc.Unread = unread[conversation.ID]
+		items = append(items, pc)
+	}
+
+	response.Items = responseArrFormatter[model.PublicConversation](items, nil, os.Getenv("DOMAIN"))
+	return c.JSON(http.StatusOK, response)
+}
+
+// For badges; the number of unread messages, and in how many conversations
+func (h *Handler) FetchMyUnreadMessages(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	unread := model.UnreadMessages{}
+	err := h.DB.Raw(`SELECT COUNT(DISTINCT messages.conversation_id), COUNT(*) FROM messages
+		INNER JOIN conversation_participants p ON p.conversation_id = messages.conversation_id AND p.user_id = ?
+		WHERE messages.sender_id <> ?
+		AND (p.last_read_at IS NULL OR messages.created_at > p.last_read_at)
+		AND (p.cleared_at IS NULL OR messages.created_at > p.cleared_at)`, reqUser.ID, reqUser.ID).
+		Row().Scan(&unread.Conversations, &unread.Messages)
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch unread messages."}
+	}
+
+	return c.JSON(http.StatusOK, unread)
+}
+
+func (h *Handler) FetchConversation(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	conversation, _, err := h.fetchMyConversation(c)
+	if err != nil {
+		return err
+	}
+
+	entry := model.Entry{}
+	if err := h.DB.First(&entry, "id = ?", conversation.EntryID).Error; err == nil {
+		conversation.Entry = &entry
+	}
+
+	pc, err := h.publicConversation(*conversation, reqUser.ID)
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch conversation."}
+	}
+	return c.JSON(http.StatusOK, pc)
+}
+
+// Newest first by default; messages from before the user deleted the conversation are left out
+// Fetching doesn't mark messages read; see ReadConversation
+func (h *Handler) FetchMessages(c echo.Context) error {
+	conversation, participant, err := h.fetchMyConversation(c)
+	if err != nil {
+		return err
+	}
+
+	page, order, after, err := bindPage(c, creationSorts("messages"), "newest")
+	if err != nil {
+		return err
+	}
+
+	// Offset is only used without a cursor
+	offset := page.Offset
+	query := h.DB.Model(&model.Message{}).Where("messages.conversation_id = ?", conversation.ID)
+	if participant.ClearedAt != nil {
+		query = query.Where("messages.created_at > ?", *participant.ClearedAt)
+	}
+	// A session, so counting doesn't change the query
+	query = query.Session(&gorm.Session{})
+
+	response := PageResponse{}
+	if page.Total {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch messages."}
+		}
+		response.Total = &count
+	}
+
+	if after != nil {
+		params := []interface{}{}
+		query = query.Where(order.after(after, &params), params...)
+		offset = 0
+	}
+
+	messages := []model.Message{}
+	err = query.
+		Preload("Sender").
+		Order(order.orderBy()).
+		Limit(page.Limit + 1).
+		Offset(offset).
+		Find(&messages).Error
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch messages."}
+	}
+
+	if len(messages) > page.Limit {
+		messages = messages[:page.Limit]
+		response.NextCursor, err = h.nextCursor(order, "messages", "messages.id", messages[len(messages)-1].ID)
+		if err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch messages."}
+		}
+	}
+
+	response.Items = responseArrFormatter[model.Message](messages, nil, os.Getenv("DOMAIN"))
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) SendMessage(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	conversation, participant, err := h.fetchMyConversation(c)
+	if err != nil {
+		return err
+	}
+
+	s := model.SubmitMessage{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+
+	blocked, err := h.blockedBy(reqUser.ID, otherParticipants(conversation, reqUser.ID))
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to send message."}
+	}
+	if blocked {
+		return errBlocked
+	}
+
+	var m *model.Message
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		m, err = addMessage(tx, conversation, reqUser.ID, s.Body, s.Encrypted)
+		return err
+	})
+	if err != nil {
+		var httpError *echo.HTTPError
+		if errors.As(err, &httpError) {
+			return httpError
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to send message."}
+	}
+
+	m.Sender = participant.User
+	return c.JSON(http.StatusCreated, responseFormatter[model.Message](*m, nil, os.Getenv("DOMAIN")))
+}
+
+// Marks all messages of the conversation read
+func (h *Handler) ReadConversation(c echo.Context) error {
+	conversation, participant, err := h.fetchMyConversation(c)
+	if err != nil {
+		return err
+	}
+
+	err = h.DB.Model(&model.ConversationParticipant{}).
+		Where("id = ?", participant.ID).
+		Update("last_read_at", conversation.LastMessageAt).Error
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to update conversation."}
+	}
+
+	return c.JSON(http.StatusOK, UpdateResponse{Updated: 1})
+}
+
+// Deletes the conversation for the user only; it comes back with the next message, without the history
+// Once every participant deleted it, it's deleted for good
+func (h *Handler) DeleteConversation(c echo.Context) error {
+	conversation, participant, err := h.fetchMyConversation(c)
+	if err != nil {
+		return err
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.ConversationParticipant{}).
+			Where("id = ?", participant.ID).
+			Updates(map[string]interface{}{"cleared_at": conversation.LastMessageAt, "last_read_at": conversation.LastMessageAt}).Error
+		if err != nil {
+			return err
+		}
+
+		var remaining int64
+		err = tx.Model(&model.ConversationParticipant{}).
+			Where("conversation_id = ? AND (cleared_at IS NULL OR cleared_at < ?)", conversation.ID, conversation.LastMessageAt).
+			Count(&remaining).Error
+		if err != nil || remaining > 0 {
+			return err
+		}
+
+		if err := tx.Where("conversation_id = ?", conversation.ID).Delete(&model.Message{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("conversation_id = ?", conversation.ID).Delete(&model.ConversationParticipant{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Conversation{}, "id = ?", conversation.ID).Error
+	})
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to delete conversation."}
+	}
+
+	return c.JSON(http.StatusOK, DeleteResponse{Deleted: 1})
+}
+
+func (h *Handler) FetchMyBlocks(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	blocks := []model.UserBlock{}
+	if err := h.DB.Preload("Blocked").Where("user_id = ?", reqUser.ID).Order("created_at DESC").Find(&blocks).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch blocked users."}
+	}
+
+	return c.JSON(
+		http.StatusOK,
+		ListResponse{
+			Total: int64(len(blocks)),
+			Items: responseArrFormatter[model.UserBlock](blocks, nil, os.Getenv("DOMAIN")),
+		},
+	)
+}
+
+// Blocked users can't start conversations with the user, or send messages in theirs
+func (h *Handler) BlockUser(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	s := model.SubmitUserBlock{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+	if s.UserID == reqUser.ID {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "You cannot block yourself."}
+	}
+
+	user := model.User{}
+	if err := h.DB.First(&user, "id = ?", s.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "User not found."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch user."}
+	}
+
+	b := model.UserBlock{UserID: reqUser.ID, BlockedID: user.ID}
+	if err := h.DB.Create(&b).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return &echo.HTTPError{Code: http.StatusConflict, Message: "User is already blocked."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to block user."}
+	}
+
+	b.Blocked = &user
+	return c.JSON(http.StatusCreated, responseFormatter[model.UserBlock](b, nil, os.Getenv("DOMAIN")))
+}
+
+func (h *Handler) UnblockUser(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	r := h.DB.Where("user_id = ? AND blocked_id = ?", reqUser.ID, c.Param("user_id")).Delete(&model.UserBlock{})
+	if r.Error != nil {
+		log.Println(r.Error)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to unblock user."}
+	}
+	if r.RowsAffected == 0 {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "User is not blocked."}
+	}
+
+	return c.JSON(http.StatusOK, DeleteResponse{Deleted: r.RowsAffected})
+}
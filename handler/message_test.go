@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"tbd/model"
+	"tbd/pgp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func myUserID(t *testing.T, token string) string {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/account/me", token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var me struct {
+		ID string `json:"id"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&me))
+	return me.ID
+}
+
+func startConversation(t *testing.T, token string, data map[string]interface{}) (int, model.PublicConversation) {
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/conversations", token, data)
+
+	var conversation model.PublicConversation
+	if rec.StatusCode == http.StatusCreated || rec.StatusCode == http.StatusOK {
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&conversation))
+	}
+	return rec.StatusCode, conversation
+}
+
+func sendMessage(t *testing.T, token, conversationID string, data map[string]interface{}) int {
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/conversations/"+conversationID+"/messages", token, data)
+	return rec.StatusCode
+}
+
+func fetchMessages(t *testing.T, token, conversationID, query string) (int, []model.PublicMessage, string) {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/conversations/"+conversationID+"/messages?"+query, token, nil)
+
+	var response struct {
+		Items      []model.PublicMessage `json:"items"`
+		NextCursor string                `json:"next_cursor"`
+	}
+	if rec.StatusCode == http.StatusOK {
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	}
+	return rec.StatusCode, response.Items, response.NextCursor
+}
+
+func fetchConversations(t *testing.T, token string) []model.PublicConversation {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/account/me/conversations", token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response struct {
+		Items []model.PublicConversation `json:"items"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	return response.Items
+}
+
+func fetchUnread(t *testing.T, token string) model.UnreadMessages {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/account/me/conversations/unread", token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var unread model.UnreadMessages
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&unread))
+	return unread
+}
+
+func TestConversation(t *testing.T) {
+	sellerToken := signupAndLogin(t)
+	buyerToken := signupAndLogin(t)
+	strangerToken := signupAndLogin(t)
+	entryID := createItemSale(t, sellerToken, "", nil)
+
+	status, conversation := startConversation(t, buyerToken, map[string]interface{}{"entry_id": entryID, "body": "Is it still available?"})
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Len(t, conversation.Participants, 2)
+	assert.Equal(t, int64(0), conversation.Unread)
+	if assert.NotNil(t, conversation.Entry) {
+		assert.Equal(t, entryID, conversation.Entry.ID)
+	}
+
+	// The same users about the same entry continue their conversation
+	status, again := startConversation(t, buyerToken, map[string]interface{}{"entry_id": entryID, "body": "Could you deliver?"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, conversation.ID, again.ID)
+
+	// Owners need someone else to talk to
+	status, _ = startConversation(t, sellerToken, map[string]interface{}{"entry_id": entryID, "body": "Hello?"})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	assert.Equal(t, model.UnreadMessages{Conversations: 1, Messages: 2}, fetchUnread(t, sellerToken))
+	conversations := fetchConversations(t, sellerToken)
+	if assert.Len(t, conversations, 1) {
+		assert.Equal(t, int64(2), conversations[0].Unread)
+	}
+
+	status, _, _ = fetchMessages(t, strangerToken, conversation.ID, "")
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, http.StatusNotFound, sendMessage(t, strangerToken, conversation.ID, map[string]interface{}{"body": "Hi"}))
+
+	assert.Equal(t, http.StatusBadRequest, sendMessage(t, sellerToken, conversation.ID, map[string]interface{}{"body": strings.Repeat("a", model.MaxMessageLength+1)}))
+
+	// Encrypted messages are encrypted by the sender to the public keys of all participants, and returned as they were sent
+	publicKeys := []string{}
+	for _, p := range conversation.Participants {
+		publicKeys = append(publicKeys, p.PublicKey)
+	}
+	encrypted, err := pgp.EncryptMessage("Yes, pick it up any time", publicKeys)
+	assert.NoError(t, err)
+	onlyBuyer, err := pgp.EncryptMessage("Yes, pick it up any time", publicKeys[:1])
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, sendMessage(t, sellerToken, conversation.ID, map[string]interface{}{"body": "Yes, pick it up any time", "encrypted": true}))
+	assert.Equal(t, http.StatusBadRequest, sendMessage(t, sellerToken, conversation.ID, map[string]interface{}{"body": onlyBuyer, "encrypted": true}))
+	assert.Equal(t, http.StatusCreated, sendMessage(t, sellerToken, conversation.ID, map[string]interface{}{"body": encrypted, "encrypted": true}))
+
+	status, messages, cursor := fetchMessages(t, buyerToken, conversation.ID, "limit=2")
+	assert.Equal(t, http.StatusOK, status)
+	if assert.Len(t, messages, 2) {
+		assert.Equal(t, encrypted, messages[0].Body)
+		assert.True(t, messages[0].Encrypted)
+		assert.Equal(t, "Could you deliver?", messages[1].Body)
+		assert.False(t, messages[1].Encrypted)
+	}
+	_, messages, _ = fetchMessages(t, buyerToken, conversation.ID, "limit=2&cursor="+cursor)
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "Is it still available?", messages[0].Body)
+	}
+
+	assert.Equal(t, model.UnreadMessages{Conversations: 1, Messages: 1}, fetchUnread(t, buyerToken))
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/conversations/"+conversation.ID+"/read", buyerToken, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.Equal(t, model.UnreadMessages{}, fetchUnread(t, buyerToken))
+
+	// Blocked users can't write to those who blocked them
+	buyerID := myUserID(t, buyerToken)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/me/blocks", sellerToken, map[string]interface{}{"user_id": buyerID})
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/me/blocks", sellerToken, map[string]interface{}{"user_id": buyerID})
+	assert.Equal(t, http.StatusConflict, rec.StatusCode)
+
+	assert.Equal(t, http.StatusForbidden, sendMessage(t, buyerToken, conversation.ID, map[string]interface{}{"body": "Hello?"}))
+	status, _ = startConversation(t, buyerToken, map[string]interface{}{"entry_id": entryID, "body": "Hello?"})
+	assert.Equal(t, http.StatusForbidden, status)
+
+	rec = performRequest(t, http.MethodDelete, "http://localhost:1323/account/me/blocks/"+buyerID, sellerToken, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.Equal(t, http.StatusCreated, sendMessage(t, buyerToken, conversation.ID, map[string]interface{}{"body": "Tomorrow at 5?"}))
+
+	// Deleting only deletes it for the user; it comes back with the next message, without the history
+	rec = performRequest(t, http.MethodDelete, "http://localhost:1323/conversations/"+conversation.ID, buyerToken, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.Empty(t, fetchConversations(t, buyerToken))
+	assert.Len(t, fetchConversations(t, sellerToken), 1)
+
+	assert.Equal(t, http.StatusCreated, sendMessage(t, sellerToken, conversation.ID, map[string]interface{}{"body": "Works for me"}))
+	assert.Len(t, fetchConversations(t, buyerToken), 1)
+	_, messages, _ = fetchMessages(t, buyerToken, conversation.ID, "")
+	if assert.Len(t, messages, 1) {
+		assert.Equal(t, "Works for me", messages[0].Body)
+	}
+	_, messages, _ = fetchMessages(t, sellerToken, conversation.ID, "")
+	assert.Len(t, messages, 5)
+}
+
+func TestConversationWithMoreParticipants(t *testing.T) {
+	sellerToken := signupAndLogin(t)
+	buyerToken := signupAndLogin(t)
+	friendToken := signupAndLogin(t)
+	entryID := createItemSale(t, sellerToken, "", nil)
+
+	status, conversation := startConversation(t, buyerToken, map[string]interface{}{
+		"entry_id":        entryID,
+		"participant_ids": []string{myUserID(t, friendToken)},
+		"body":            "My friend wants one too",
+	})
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Len(t, conversation.Participants, 3)
+	assert.Equal(t, model.UnreadMessages{Conversations: 1, Messages: 1}, fetchUnread(t, friendToken))
+
+	// Only with users that exist
+	status, _ = startConversation(t, buyerToken, map[string]interface{}{
+		"entry_id":        entryID,
+		"participant_ids": []string{"6ec84364-931e-4e8b-a5ec-5d4f68e4a1ba"},
+		"body":            "Hello?",
+	})
+	assert.Equal(t, http.StatusNotFound, status)
+}
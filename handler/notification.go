@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"tbd/model"
+)
+
+// The in-app inbox, newest first by default; unread=true leaves out what was read
+func (h *Handler) FetchMyNotifications(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	page, order, after, err := bindPage(c, creationSorts("notifications"), "newest")
+	if err != nil {
+		return err
+	}
+
+	query := h.DB.Model(&model.Notification{}).Where("notifications.user_id = ?", reqUser.ID)
+	if unread, _ := strconv.ParseBool(c.QueryParam("unread")); unread {
+		query = query.Where("notifications.read_at IS NULL")
+	}
+
+	// Offset is only used without a cursor
+	offset := page.Offset
+	// A session, so counting doesn't change the query
+	query = query.Session(&gorm.Session{})
+
+	response := PageResponse{}
+	if page.Total {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch notifications."}
+		}
+		response.Total = &count
+	}
+
+	if after != nil {
+		params := []interface{}{}
+		query = query.Where(order.after(after, &params), params...)
+		offset = 0
+	}
+
+	notifications := []model.Notification{}
+	err = query.
+		Order(order.orderBy()).
+		Limit(page.Limit + 1).
+		Offset(offset).
+		Find(&notifications).Error
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch notifications."}
+	}
+
+	if len(notifications) > page.Limit {
+		notifications = notifications[:page.Limit]
+		response.NextCursor, err = h.nextCursor(order, "notifications", "notifications.id", notifications[len(notifications)-1].ID)
+		if err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch notifications."}
+		}
+	}
+
+	response.Items = responseArrFormatter[model.Notification](notifications, nil, os.Getenv("DOMAIN"))
+	return c.JSON(http.StatusOK, response)
+}
+
+// Marks notifications read; all unread ones, if no ids are given
+func (h *Handler) ReadMyNotifications(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	s := model.ReadNotifications{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+
+	query := h.DB.Model(&model.Notification{}).Where("user_id = ? AND read_at IS NULL", reqUser.ID)
+	if len(s.IDs) > 0 {
+		query = query.Where("id IN ?", s.IDs)
+	}
+
+	r := query.Update("read_at", time.Now())
+	if r.Error != nil {
+		log.Println(r.Error)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to update notifications."}
+	}
+
+	return c.JSON(http.StatusOK, UpdateResponse{Updated: r.RowsAffected})
+}
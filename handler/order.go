@@ -0,0 +1,379 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+
+	"tbd/model"
+	"tbd/payment"
+)
+
+// Places an order and starts the checkout with the payment provider
+// The response has what the buyer needs to do next: follow checkout_url, or the instructions
+func (h *Handler) CreateOrder(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	entryID := c.Param("id")
+	if _, err := uuid.Parse(entryID); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid UUID."}
+	}
+
+	entry := model.Entry{}
+	if err := h.DB.First(&entry, "id = ?", entryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "Entry not found."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch entry."}
+	}
+
+	entryType, err := h.entryType(entry.Type)
+	if err != nil {
+		return err
+	}
+	if !entryType.Purchasable {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Entries of this type cannot be ordered."}
+	}
+	if entry.Status != model.EntryStatusPublished || (entry.ExpiresAt != nil && !entry.ExpiresAt.After(time.Now())) {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Entry is not available."}
+	}
+	if entry.CreatedByID == reqUser.ID {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "You cannot order your own entry."}
+	}
+
+	s := model.SubmitOrder{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+	if s.Quantity == 0 {
+		s.Quantity = 1
+	}
+
+	provider, err := h.Payments.Default()
+	if s.Provider != "" {
+		provider, err = h.Payments.Get(s.Provider)
+	}
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Payment provider is not supported."}
+	}
+
+	if entry.PriceAmount == nil || entry.PriceCurrency == nil || *entry.PriceAmount <= 0 {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Entry has no price."}
+	}
+
+	// Includes whatever the entry consumes; each part goes out as a sub-order
+	q, err := h.quoteEntry(&entry, model.QuoteRequest{Quantity: s.Quantity, DistanceKm: s.DistanceKm})
+	if err != nil {
+		return err
+	}
+
+	o := model.Order{
+		EntryID:    entry.ID,
+		BuyerID:    reqUser.ID,
+		Quantity:   s.Quantity,
+		UnitAmount: *entry.PriceAmount,
+		Amount:     q.Total.Amount,
+		Currency:   q.Total.Currency,
+		Status:     model.OrderStatusPending,
+		Provider:   provider.Name(),
+		SubOrders:  model.SubOrdersFromQuote(q),
+	}
+	if err := h.DB.Create(&o).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create order."}
+	}
+
+	checkout, err := provider.Checkout(c.Request().Context(), payment.Order{
+		ID:          o.ID,
+		Amount:      o.Amount,
+		Currency:    o.Currency,
+		Description: entryTitle(entry.Data),
+	})
+	if err != nil {
+		log.Println(err)
+		if err := h.moveOrder(&o, model.OrderStatusFailed); err != nil {
+			log.Println(err)
+		}
+		return &echo.HTTPError{Code: http.StatusBadGateway, Message: "Payment provider is not available."}
+	}
+
+	o.PaymentReference = checkout.Reference
+	o.CheckoutURL = checkout.RedirectURL
+	o.Instructions = checkout.Instructions
+	err = h.DB.Model(&model.Order{}).Where("id = ?", o.ID).Updates(map[string]interface{}{
+		"payment_reference": o.PaymentReference,
+		"checkout_url":      o.CheckoutURL,
+		"instructions":      o.Instructions,
+	}).Error
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create order."}
+	}
+
+	return c.JSON(http.StatusCreated, o.ToPublicFormat(os.Getenv("DOMAIN")))
+}
+
+// Describes the order to the payment provider
+func entryTitle(data datatypes.JSON) string {
+	fields := struct {
+		Title string `json:"title"`
+	}{}
+	json.Unmarshal(data, &fields)
+	return fields.Title
+}
+
+// The buyer, the seller (owner of the entry) or an admin; returns whether the user may act as seller
+func (h *Handler) orderForUser(c echo.Context, id string) (*model.Order, bool, error) {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, false, &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid UUID."}
+	}
+
+	o := model.Order{}
+	err := h.DB.Preload("Entry.CreatedBy").Preload("Buyer").Preload("SubOrders").First(&o, "id = ?", id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, &echo.HTTPError{Code: http.StatusNotFound, Message: "Order not found."}
+		}
+		log.Println(err)
+		return nil, false, &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch order."}
+	}
+
+	isSeller := reqUser.IsAdmin || (o.Entry != nil && o.Entry.CreatedByID == reqUser.ID)
+	if !isSeller && o.BuyerID != reqUser.ID {
+		return nil, false, &echo.HTTPError{Code: http.StatusForbidden, Message: "You do not have permission to access this order."}
+	}
+
+	return &o, isSeller, nil
+}
+
+func (h *Handler) FetchOrder(c echo.Context) error {
+	o, _, err := h.orderForUser(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, o.ToPublicFormat(os.Getenv("DOMAIN")))
+}
+
+// Only move on from the status that was checked; a webhook or another request may have changed it meanwhile
+// Sub-orders are cancelled once the order won't be fulfilled
+func (h *Handler) moveOrder(o *model.Order, status string) error {
+	return h.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Order{}).Where("id = ? AND status = ?", o.ID, o.Status).Update("status", status)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		switch status {
+		case model.OrderStatusCancelled, model.OrderStatusFailed, model.OrderStatusRefunded:
+			return cancelSubOrders(tx, "order_id", o.ID)
+		}
+		return nil
+	})
+}
+
+// Buyers and sellers cancel pending orders; sellers fulfill paid orders
+// With a manually settled provider, the seller also marks orders paid, and refunded
+func (h *Handler) UpdateOrderStatus(c echo.Context) error {
+	o, isSeller, err := h.orderForUser(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	s := model.SubmitOrderStatus{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+
+	if !model.OrderStatusIsValid(s.Status) {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Status is not supported."}
+	}
+
+	manuallySettled := false
+	if provider, err := h.Payments.Get(o.Provider); err == nil {
+		manuallySettled = provider.ManuallySettled()
+	}
+
+	if !o.CanTransitionTo(s.Status, isSeller, isSeller && manuallySettled) {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Order cannot be moved from " + o.Status + " to " + s.Status + "."}
+	}
+
+	err = h.moveOrder(o, s.Status)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Order has changed; try again."}
+	}
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to update order."}
+	}
+
+	return c.JSON(http.StatusOK, UpdateResponse{Updated: 1})
+}
+
+// Status changes reported by a payment provider; the request is verified by the provider
+// Webhooks may be delivered more than once; a status the order already has is acknowledged, without changes
+func (h *Handler) PaymentWebhook(c echo.Context) error {
+	provider, err := h.Payments.Get(c.Param("provider"))
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "Payment provider not found."}
+	}
+
+	event, err := provider.ParseWebhook(c.Request())
+	if errors.Is(err, payment.ErrWebhooksNotSupported) {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "Payment provider not found."}
+	}
+	if errors.Is(err, payment.ErrInvalidSignature) {
+		return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "Invalid signature."}
+	}
+	if errors.Is(err, payment.ErrStaleWebhook) {
+		return &echo.HTTPError{Code: http.StatusUnauthorized, Message: "Webhook is too old."}
+	}
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid webhook."}
+	}
+
+	o := model.Order{}
+	err = h.DB.Where("provider = ? AND payment_reference = ?", provider.Name(), event.Reference).First(&o).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "Order not found."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch order."}
+	}
+
+	if o.Status == event.Status {
+		return c.JSON(http.StatusOK, UpdateResponse{Updated: 0})
+	}
+	if !o.CanTransitionTo(event.Status, false, true) {
+		log.Printf("Order %s cannot be moved from %s to %s.", o.ID, o.Status, event.Status)
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Order cannot be moved from " + o.Status + " to " + event.Status + "."}
+	}
+
+	err = h.moveOrder(&o, event.Status)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Order has changed; try again."}
+	}
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to update order."}
+	}
+
+	return c.JSON(http.StatusOK, UpdateResponse{Updated: 1})
+}
+
+type PaymentProviderResponse struct {
+	Name            string `json:"name"`
+	ManuallySettled bool   `json:"manually_settled"`
+}
+
+// Providers the community accepts; the first is the default
+func (h *Handler) FetchPaymentProviders(c echo.Context) error {
+	providers := []PaymentProviderResponse{}
+	for _, name := range h.Payments.Names() {
+		p, _ := h.Payments.Get(name)
+		providers = append(providers, PaymentProviderResponse{Name: p.Name(), ManuallySettled: p.ManuallySettled()})
+	}
+
+	return c.JSON(http.StatusOK, ListResponse{Total: int64(len(providers)), Items: providers})
+}
+
+// Filter by status, for ex. ?status=paid; newest first by default
+func (h *Handler) listOrders(c echo.Context, query *gorm.DB) error {
+	page, order, after, err := bindPage(c, creationSorts("orders"), "newest")
+	if err != nil {
+		return err
+	}
+
+	if status := c.QueryParam("status"); status != "" {
+		if !model.OrderStatusIsValid(status) {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Status is not supported."}
+		}
+		query = query.Where("orders.status = ?", status)
+	}
+
+	// Offset is only used without a cursor
+	offset := page.Offset
+	// A session, so counting doesn't change the query
+	query = query.Session(&gorm.Session{})
+
+	response := PageResponse{}
+	if page.Total {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch orders."}
+		}
+		response.Total = &count
+	}
+
+	if after != nil {
+		params := []interface{}{}
+		query = query.Where(order.after(after, &params), params...)
+		offset = 0
+	}
+
+	orders := []model.Order{}
+	err = query.
+		Preload("Entry.CreatedBy").
+		Preload("Buyer").
+		Preload("SubOrders").
+		Order(order.orderBy()).
+		Limit(page.Limit + 1).
+		Offset(offset).
+		Find(&orders).Error
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch orders."}
+	}
+
+	if len(orders) > page.Limit {
+		orders = orders[:page.Limit]
+		response.NextCursor, err = h.nextCursor(order, "orders", "orders.id", orders[len(orders)-1].ID)
+		if err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch orders."}
+		}
+	}
+
+	response.Items = responseArrFormatter[model.Order](orders, nil, os.Getenv("DOMAIN"))
+	return c.JSON(http.StatusOK, response)
+}
+
+// Orders the user placed
+func (h *Handler) FetchMyOrders(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	return h.listOrders(c, h.DB.Model(&model.Order{}).Where("orders.buyer_id = ?", reqUser.ID))
+}
+
+// Orders on entries of the user
+func (h *Handler) FetchReceivedOrders(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	query := h.DB.Model(&model.Order{}).
+		Joins("INNER JOIN entries ON entries.id = orders.entry_id").
+		Where("entries.created_by_id = ?", reqUser.ID)
+	return h.listOrders(c, query)
+}
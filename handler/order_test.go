@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"tbd/model"
+	"tbd/payment"
+	"tbd/payment/paymenttest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func placeOrder(t *testing.T, token, entryID string, order model.SubmitOrder) *http.Response {
+	return performRequest(t, http.MethodPost, "http://localhost:1323/entries/"+entryID+"/orders", token, order)
+}
+
+func createOrder(t *testing.T, token, entryID string, order model.SubmitOrder) model.PublicOrder {
+	rec := placeOrder(t, token, entryID, order)
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+
+	var o model.PublicOrder
+	err := json.NewDecoder(rec.Body).Decode(&o)
+	assert.NoError(t, err)
+
+	return o
+}
+
+func setOrderStatus(t *testing.T, token, id, status string) int {
+	rec := performRequest(t, http.MethodPatch, "http://localhost:1323/orders/"+id+"/status", token, map[string]string{"status": status})
+	return rec.StatusCode
+}
+
+func fetchOrder(t *testing.T, token, id string) model.PublicOrder {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/orders/"+id, token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var o model.PublicOrder
+	err := json.NewDecoder(rec.Body).Decode(&o)
+	assert.NoError(t, err)
+
+	return o
+}
+
+func fetchOrderIDs(t *testing.T, token, url string) []string {
+	rec := performRequest(t, http.MethodGet, url, token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response struct {
+		Items []model.PublicOrder `json:"items"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	assert.NoError(t, err)
+
+	ids := []string{}
+	for _, o := range response.Items {
+		ids = append(ids, o.ID)
+	}
+	return ids
+}
+
+func TestOrderManualPayment(t *testing.T) {
+	sellerToken := signupAndLogin(t)
+	entryID := createItemSale(t, sellerToken, "", withPrice(&model.Money{Amount: 1250, Currency: "EUR"}))
+
+	buyerToken := signupAndLogin(t)
+	order := createOrder(t, buyerToken, entryID, model.SubmitOrder{Quantity: 2, Provider: "manual"})
+	assert.Equal(t, model.OrderStatusPending, order.Status)
+	assert.Equal(t, "manual", order.Provider)
+	assert.Equal(t, int64(1250), order.UnitAmount)
+	assert.Equal(t, int64(2500), order.Amount)
+	assert.Equal(t, "EUR", order.Currency)
+	assert.NotEmpty(t, order.Instructions)
+
+	// The buyer can't confirm their own payment
+	assert.Equal(t, http.StatusConflict, setOrderStatus(t, buyerToken, order.ID, model.OrderStatusPaid))
+	assert.Equal(t, http.StatusConflict, setOrderStatus(t, sellerToken, order.ID, model.OrderStatusFulfilled))
+	assert.Equal(t, http.StatusOK, setOrderStatus(t, sellerToken, order.ID, model.OrderStatusPaid))
+
+	// Paid orders can only be refunded, not cancelled
+	assert.Equal(t, http.StatusConflict, setOrderStatus(t, buyerToken, order.ID, model.OrderStatusCancelled))
+	assert.Equal(t, http.StatusOK, setOrderStatus(t, sellerToken, order.ID, model.OrderStatusFulfilled))
+	assert.Equal(t, model.OrderStatusFulfilled, fetchOrder(t, buyerToken, order.ID).Status)
+
+	// Someone else
+	otherToken := signupAndLogin(t)
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/orders/"+order.ID, otherToken, nil)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+
+	assert.Contains(t, fetchOrderIDs(t, buyerToken, "http://localhost:1323/account/me/orders"), order.ID)
+	assert.Contains(t, fetchOrderIDs(t, sellerToken, "http://localhost:1323/account/me/orders/received?status=fulfilled"), order.ID)
+	assert.NotContains(t, fetchOrderIDs(t, sellerToken, "http://localhost:1323/account/me/orders"), order.ID)
+
+	// Newest first, a page at a time
+	second := createOrder(t, buyerToken, entryID, model.SubmitOrder{Provider: "manual"})
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me/orders?limit=1", buyerToken, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	var page struct {
+		Items      []model.PublicOrder `json:"items"`
+		NextCursor string              `json:"next_cursor"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	if assert.Len(t, page.Items, 1) {
+		assert.Equal(t, second.ID, page.Items[0].ID)
+	}
+	assert.Equal(t, []string{order.ID}, fetchOrderIDs(t, buyerToken, "http://localhost:1323/account/me/orders?limit=1&cursor="+page.NextCursor))
+
+	for _, query := range []string{"limit=abc", "limit=1000", "offset=-5", "sort=nope"} {
+		rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me/orders?"+query, buyerToken, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.StatusCode, query)
+	}
+}
+
+func TestOrderCancel(t *testing.T) {
+	sellerToken := signupAndLogin(t)
+	entryID := createItemSale(t, sellerToken, "", withPrice(&model.Money{Amount: 500, Currency: "USD"}))
+
+	buyerToken := signupAndLogin(t)
+	order := createOrder(t, buyerToken, entryID, model.SubmitOrder{})
+	assert.Equal(t, 1, order.Quantity)
+	assert.Equal(t, int64(500), order.Amount)
+
+	assert.Equal(t, http.StatusOK, setOrderStatus(t, buyerToken, order.ID, model.OrderStatusCancelled))
+	assert.Equal(t, http.StatusConflict, setOrderStatus(t, sellerToken, order.ID, model.OrderStatusPaid))
+	assert.Equal(t, http.StatusBadRequest, setOrderStatus(t, sellerToken, order.ID, "lost"))
+}
+
+func TestOrderInvalid(t *testing.T) {
+	sellerToken := signupAndLogin(t)
+	entryID := createItemSale(t, sellerToken, "", withPrice(&model.Money{Amount: 500, Currency: "USD"}))
+	buyerToken := signupAndLogin(t)
+
+	// Own entry
+	assert.Equal(t, http.StatusBadRequest, placeOrder(t, sellerToken, entryID, model.SubmitOrder{}).StatusCode)
+	// Unknown provider
+	assert.Equal(t, http.StatusBadRequest, placeOrder(t, buyerToken, entryID, model.SubmitOrder{Provider: "paypal"}).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, placeOrder(t, buyerToken, entryID, model.SubmitOrder{Quantity: -1}).StatusCode)
+
+	// Not purchasable
+	petSitter := createEntry(t, sellerToken, genEntryData("pet-sitter", nil))
+	assert.Equal(t, http.StatusBadRequest, placeOrder(t, buyerToken, petSitter.ID, model.SubmitOrder{}).StatusCode)
+
+	// Given away
+	freeID := createItemSale(t, sellerToken, "", withPrice(&model.Money{Amount: 0, Currency: "USD"}))
+	assert.Equal(t, http.StatusConflict, placeOrder(t, buyerToken, freeID, model.SubmitOrder{}).StatusCode)
+
+	// Not published
+	draftID := createItemSale(t, sellerToken, model.EntryStatusDraft, nil)
+	assert.Equal(t, http.StatusConflict, placeOrder(t, buyerToken, draftID, model.SubmitOrder{}).StatusCode)
+}
+
+func TestPaymentWebhookManual(t *testing.T) {
+	// Manual payments are confirmed by the seller; there's nothing to call
+	res, err := paymenttest.NewFake("secret").Notify(context.Background(), "http://localhost:1323/payments/webhooks/manual", "ref", payment.StatusPaid)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, err = paymenttest.NewFake("secret").Notify(context.Background(), "http://localhost:1323/payments/webhooks/paypal", "ref", payment.StatusPaid)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+// Requires the server to run with the webhook provider, pointing at the fake this test starts:
+// PAYMENT_PROVIDERS=manual,webhook PAYMENT_WEBHOOK_URL=http://localhost:1324/checkouts PAYMENT_WEBHOOK_SECRET=...
+func TestOrderWebhookPayment(t *testing.T) {
+	secret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	checkoutURL, err := url.Parse(os.Getenv("PAYMENT_WEBHOOK_URL"))
+	if secret == "" || err != nil || checkoutURL.Host == "" {
+		t.Skip("PAYMENT_WEBHOOK_URL and PAYMENT_WEBHOOK_SECRET are not set")
+	}
+
+	fake := paymenttest.NewFake(secret)
+	listener, err := net.Listen("tcp", checkoutURL.Host)
+	assert.NoError(t, err)
+	server := &http.Server{Handler: fake}
+	go server.Serve(listener)
+	defer server.Close()
+
+	sellerToken := signupAndLogin(t)
+	entryID := createItemSale(t, sellerToken, "", withPrice(&model.Money{Amount: 2000, Currency: "USD"}))
+
+	buyerToken := signupAndLogin(t)
+	order := createOrder(t, buyerToken, entryID, model.SubmitOrder{Provider: "webhook"})
+	assert.Equal(t, model.OrderStatusPending, order.Status)
+	assert.NotEmpty(t, order.CheckoutURL)
+
+	checkout, ok := fake.CheckoutFor(order.ID)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2000), checkout.Amount)
+
+	// Only the provider confirms payments
+	assert.Equal(t, http.StatusConflict, setOrderStatus(t, sellerToken, order.ID, model.OrderStatusPaid))
+
+	webhookURL := "http://localhost:1323/payments/webhooks/webhook"
+
+	// Not signed by the provider
+	res, err := paymenttest.NewFake("wrong").Notify(context.Background(), webhookURL, checkout.Reference, payment.StatusPaid)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(t, model.OrderStatusPending, fetchOrder(t, buyerToken, order.ID).Status)
+
+	// Captured a while ago and replayed
+	res, err = fake.NotifyAt(context.Background(), webhookURL, checkout.Reference, payment.StatusPaid, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(t, model.OrderStatusPending, fetchOrder(t, buyerToken, order.ID).Status)
+
+	// Delivered twice
+	for i := 0; i < 2; i++ {
+		res, err = fake.Notify(context.Background(), webhookURL, checkout.Reference, payment.StatusPaid)
+		assert.NoError(t, err)
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+	assert.Equal(t, model.OrderStatusPaid, fetchOrder(t, buyerToken, order.ID).Status)
+
+	// Refunds go through the provider as well
+	assert.Equal(t, http.StatusConflict, setOrderStatus(t, sellerToken, order.ID, model.OrderStatusRefunded))
+	res, err = fake.Notify(context.Background(), webhookURL, checkout.Reference, payment.StatusRefunded)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, model.OrderStatusRefunded, fetchOrder(t, buyerToken, order.ID).Status)
+
+	res, err = fake.Notify(context.Background(), webhookURL, "unknown", payment.StatusPaid)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
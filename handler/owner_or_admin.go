@@ -94,3 +94,14 @@ func isSelfOrAdmin(c echo.Context, userID string) error {
 
 	return nil
 }
+
+func isAdmin(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	if !reqUser.IsAdmin {
+		log.Println("User is not admin.")
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "You do not have permission to access this resource."}
+	}
+
+	return nil
+}
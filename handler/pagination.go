@@ -0,0 +1,259 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"tbd/model"
+)
+
+const (
+	pageDefaultLimit = 20
+	pageMaxLimit     = 100
+)
+
+// Lists that are paged with a cursor; NextCursor is empty on the last page, and Total only set if asked for
+type PageResponse struct {
+	Total      *int64      `json:"total,omitempty"`
+	Items      interface{} `json:"items"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// A column or expression a list is sorted on
+type sortKey struct {
+	expr string
+	desc bool
+	// Values are times; cursors keep them as RFC 3339
+	time bool
+	// NULLs sort last, on both engines; only needed for keys that may be NULL
+	nullable bool
+}
+
+// The keys a list is sorted on, in order; the last must be unique (the id), so every row has its own position
+//
+// Notes:
+//   - Pages continue after the values of the last row (keyset pagination), so they don't shift when rows are added
+//   - Cursors carry the name of the sort, and are rejected for another one
+type sortOrder struct {
+	name string
+	keys []sortKey
+}
+
+var errInvalidCursor = &echo.HTTPError{Code: http.StatusBadRequest, Message: "Cursor is invalid."}
+
+// Nullable keys are preceded by whether they are NULL
+func (o sortOrder) expanded() []sortKey {
+	keys := []sortKey{}
+	for _, key := range o.keys {
+		if key.nullable {
+			keys = append(keys, sortKey{expr: fmt.Sprintf("CASE WHEN %s IS NULL THEN 1 ELSE 0 END", key.expr)})
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Without ORDER BY, so it fits gorm's Order
+func (o sortOrder) orderBy() string {
+	parts := []string{}
+	for _, key := range o.expanded() {
+		direction := "ASC"
+		if key.desc {
+			direction = "DESC"
+		}
+		parts = append(parts, key.expr+" "+direction)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Expressions to select, to get the values for a cursor
+func (o sortOrder) columns() []string {
+	columns := []string{}
+	for _, key := range o.expanded() {
+		columns = append(columns, key.expr)
+	}
+	return columns
+}
+
+// Condition for the rows after the given values; see cursorValues
+func (o sortOrder) after(values []interface{}, params *[]interface{}) string {
+	keys := o.expanded()
+	terms := []string{}
+	for i, key := range keys {
+		// Nothing sorts after NULL among NULLs; the next key decides
+		if values[i] == nil {
+			continue
+		}
+
+		conditions := []string{}
+		for j := 0; j < i; j++ {
+			if values[j] == nil {
+				conditions = append(conditions, keys[j].expr+" IS NULL")
+				continue
+			}
+			conditions = append(conditions, keys[j].expr+" = ?")
+			*params = append(*params, values[j])
+		}
+
+		op := ">"
+		if key.desc {
+			op = "<"
+		}
+		conditions = append(conditions, fmt.Sprintf("%s %s ?", key.expr, op))
+		*params = append(*params, values[i])
+
+		terms = append(terms, "("+strings.Join(conditions, " AND ")+")")
+	}
+	if len(terms) == 0 {
+		return "1=0"
+	}
+	return "(" + strings.Join(terms, " OR ") + ")"
+}
+
+type pageCursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+}
+
+// Values are the ones of columns(), of the last row of a page
+func (o sortOrder) encodeCursor(values []interface{}) string {
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			values[i] = string(b)
+		}
+	}
+
+	data, err := json.Marshal(pageCursor{Sort: o.name, Values: values})
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (o sortOrder) decodeCursor(cursor string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	c := pageCursor{}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&c); err != nil {
+		return nil, errInvalidCursor
+	}
+
+	keys := o.expanded()
+	if c.Sort != o.name {
+		return nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: "Cursor is for another sort."}
+	}
+	if len(c.Values) != len(keys) {
+		return nil, errInvalidCursor
+	}
+
+	for i, v := range c.Values {
+		switch v := v.(type) {
+		case nil:
+			if !keys[i].nullable {
+				return nil, errInvalidCursor
+			}
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				c.Values[i] = n
+			} else if f, err := v.Float64(); err == nil {
+				c.Values[i] = f
+			} else {
+				return nil, errInvalidCursor
+			}
+		case string:
+			if keys[i].time {
+				t, err := time.Parse(time.RFC3339Nano, v)
+				if err != nil {
+					return nil, errInvalidCursor
+				}
+				c.Values[i] = t
+			}
+		default:
+			return nil, errInvalidCursor
+		}
+	}
+	return c.Values, nil
+}
+
+// Binds paging of lists other than entries; sorts are the ones the list supports, by name
+// Returns the sort to use, and the values of the cursor, if there is one
+func bindPage(c echo.Context, sorts map[string]sortOrder, defaultSort string) (model.PageQueryParams, sortOrder, []interface{}, error) {
+	page := model.PageQueryParams{}
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, &page); err != nil {
+		return page, sortOrder{}, nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(page); err != nil {
+		return page, sortOrder{}, nil, err
+	}
+	if page.Limit == 0 {
+		page.Limit = pageDefaultLimit
+	}
+	if page.Sort == "" {
+		page.Sort = defaultSort
+	}
+
+	order, ok := sorts[page.Sort]
+	if !ok {
+		return page, order, nil, &echo.HTTPError{Code: http.StatusBadRequest, Message: "Sort is not supported."}
+	}
+
+	var values []interface{}
+	if page.Cursor != "" {
+		var err error
+		if values, err = order.decodeCursor(page.Cursor); err != nil {
+			return page, order, nil, err
+		}
+	}
+	return page, order, values, nil
+}
+
+// Sorts of lists by creation; for lists other than entries
+func creationSorts(table string) map[string]sortOrder {
+	return map[string]sortOrder{
+		"newest": {name: "newest", keys: []sortKey{{expr: table + ".created_at", desc: true, time: true}, {expr: table + ".id", desc: true}}},
+		"oldest": {name: "oldest", keys: []sortKey{{expr: table + ".created_at", time: true}, {expr: table + ".id"}}},
+	}
+}
+
+// Values of the sort keys of one row, for the cursor to the next page; from is the FROM clause of the list
+func (h *Handler) cursorValues(o sortOrder, from, idColumn, id string) ([]interface{}, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", strings.Join(o.columns(), ", "), from, idColumn)
+	rows, err := h.DB.Raw(query, id).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make([]interface{}, len(o.columns()))
+	pointers := make([]interface{}, len(values))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if !rows.Next() {
+		return nil, fmt.Errorf("row %s not found", id)
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+	return values, rows.Err()
+}
+
+// The cursor to the page after the one that ends with id
+func (h *Handler) nextCursor(o sortOrder, from, idColumn, id string) (string, error) {
+	values, err := h.cursorValues(o, from, idColumn, id)
+	if err != nil {
+		return "", err
+	}
+	return o.encodeCursor(values), nil
+}
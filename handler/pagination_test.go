@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"tbd/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type entryPage struct {
+	Total      *int64              `json:"total"`
+	Items      []model.PublicEntry `json:"items"`
+	NextCursor string              `json:"next_cursor"`
+}
+
+func fetchEntryPage(t *testing.T, query string) entryPage {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries?"+query, "", nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode, query)
+
+	page := entryPage{}
+	err := json.NewDecoder(rec.Body).Decode(&page)
+	assert.NoError(t, err)
+	return page
+}
+
+// Follows the cursors through all pages, from the cursor of a page before if set; returns the ids in order
+func fetchAllEntryIDs(t *testing.T, query, cursor string) []string {
+	ids := []string{}
+	for i := 0; i < 20; i++ {
+		page := fetchEntryPage(t, query+"&cursor="+cursor)
+		for _, entry := range page.Items {
+			ids = append(ids, entry.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	return ids
+}
+
+func TestSortOrderAfter(t *testing.T) {
+	order := sortOrder{name: "expiring", keys: []sortKey{
+		{expr: "expires_at", time: true, nullable: true},
+		{expr: "id", desc: true},
+	}}
+	assert.Equal(t, "CASE WHEN expires_at IS NULL THEN 1 ELSE 0 END ASC, expires_at ASC, id DESC", order.orderBy())
+
+	params := []interface{}{}
+	condition := order.after([]interface{}{int64(0), "2024-01-01", "b"}, &params)
+	assert.Equal(t, "((CASE WHEN expires_at IS NULL THEN 1 ELSE 0 END > ?)"+
+		" OR (CASE WHEN expires_at IS NULL THEN 1 ELSE 0 END = ? AND expires_at > ?)"+
+		" OR (CASE WHEN expires_at IS NULL THEN 1 ELSE 0 END = ? AND expires_at = ? AND id < ?))", condition)
+	assert.Equal(t, []interface{}{int64(0), int64(0), "2024-01-01", int64(0), "2024-01-01", "b"}, params)
+
+	// After a NULL, only the rest of the NULLs
+	params = []interface{}{}
+	condition = order.after([]interface{}{int64(1), nil, "b"}, &params)
+	assert.Equal(t, "((CASE WHEN expires_at IS NULL THEN 1 ELSE 0 END > ?)"+
+		" OR (CASE WHEN expires_at IS NULL THEN 1 ELSE 0 END = ? AND expires_at IS NULL AND id < ?))", condition)
+	assert.Equal(t, []interface{}{int64(1), int64(1), "b"}, params)
+}
+
+func TestSortOrderCursor(t *testing.T) {
+	order := sortOrder{name: "newest", keys: []sortKey{{expr: "created_at", desc: true, time: true}, {expr: "price"}, {expr: "id", desc: true}}}
+	created := time.Date(2024, 3, 1, 8, 30, 0, 123456789, time.FixedZone("", 2*60*60))
+
+	values, err := order.decodeCursor(order.encodeCursor([]interface{}{created, 12.5, []byte("b")}))
+	assert.NoError(t, err)
+	assert.Equal(t, "2024-03-01 08:30:00.123456789+02:00", values[0].(time.Time).Format("2006-01-02 15:04:05.999999999-07:00"))
+	assert.Equal(t, 12.5, values[1])
+	assert.Equal(t, "b", values[2])
+
+	values, err = order.decodeCursor(order.encodeCursor([]interface{}{created, int64(1250), "b"}))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1250), values[1])
+
+	other := sortOrder{name: "oldest", keys: order.keys}
+	_, err = other.decodeCursor(order.encodeCursor([]interface{}{created, 1, "b"}))
+	assert.Error(t, err)
+
+	for _, cursor := range []string{"nope!", "bm9wZQ", order.encodeCursor([]interface{}{created, nil, "b"}), order.encodeCursor([]interface{}{"b"})} {
+		_, err = order.decodeCursor(cursor)
+		assert.Error(t, err, cursor)
+	}
+}
+
+func TestEntryCursorPagination(t *testing.T) {
+	token := signupAndLogin(t)
+	money, price := uniquePrice()
+
+	created := []string{}
+	for i := 0; i < 5; i++ {
+		id := createItemSale(t, token, "", withPrice(&model.Money{Amount: money.Amount + int64(i)*100, Currency: "USD"}))
+		created = append(created, id)
+	}
+
+	query := fmt.Sprintf("type=item-sale&currency=USD&price=bt,%s,%d&limit=2", price, money.Amount/100+4)
+
+	// Newest first
+	first := fetchEntryPage(t, query+"&total=true")
+	if assert.NotNil(t, first.Total) {
+		assert.Equal(t, int64(5), *first.Total)
+	}
+	assert.Len(t, first.Items, 2)
+	assert.NotEmpty(t, first.NextCursor)
+
+	// An entry added in between doesn't shift the next pages
+	createItemSale(t, token, "", nil)
+	ids := []string{}
+	for _, entry := range first.Items {
+		ids = append(ids, entry.ID)
+	}
+	ids = append(ids, fetchAllEntryIDs(t, query, first.NextCursor)...)
+	assert.Equal(t, []string{created[4], created[3], created[2], created[1], created[0]}, ids)
+
+	// Total is left out, unless asked for
+	assert.Nil(t, fetchEntryPage(t, query).Total)
+
+	assert.Equal(t, created, fetchAllEntryIDs(t, query+"&sort=price_asc", ""))
+	assert.Equal(t, []string{created[4], created[3], created[2], created[1], created[0]}, fetchAllEntryIDs(t, query+"&sort=price_desc", ""))
+	assert.ElementsMatch(t, created, fetchAllEntryIDs(t, query+"&sort=expiring", ""))
+	assert.ElementsMatch(t, created, fetchAllEntryIDs(t, query+"&sort=upvoted", ""))
+
+	// Cursors only work with their sort
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries?"+query+"&sort=price_asc&cursor="+first.NextCursor, "", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/entries?"+query+"&cursor=nope", "", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+}
+
+func TestCommentAndUserCursorPagination(t *testing.T) {
+	token := signupAndLogin(t)
+	entryID := createItemSale(t, token, "", nil)
+
+	created := []string{}
+	for i := 0; i < 3; i++ {
+		created = append(created, createComment(t, token, map[string]interface{}{"entry_id": entryID, "body": fmt.Sprint("Comment ", i)}).ID)
+	}
+
+	ids := []string{}
+	cursor := ""
+	for i := 0; i < 5; i++ {
+		rec := performRequest(t, http.MethodGet, "http://localhost:1323/comments?sort=oldest&limit=2&entry_id="+entryID+"&cursor="+cursor, token, nil)
+		assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+		var page struct {
+			Items      []model.PublicComment `json:"items"`
+			NextCursor string                `json:"next_cursor"`
+		}
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+		for _, comment := range page.Items {
+			ids = append(ids, comment.ID)
+		}
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, created, ids)
+
+	// Users by username; every page continues after the last one
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/users?sort=username&limit=2&total=true", token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	var users struct {
+		Total      *int64             `json:"total"`
+		Items      []model.PublicUser `json:"items"`
+		NextCursor string             `json:"next_cursor"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&users))
+	assert.NotNil(t, users.Total)
+	if assert.Len(t, users.Items, 2) && assert.NotEmpty(t, users.NextCursor) {
+		last := users.Items[1].Username
+
+		rec = performRequest(t, http.MethodGet, "http://localhost:1323/users?sort=username&limit=2&cursor="+users.NextCursor, token, nil)
+		assert.Equal(t, http.StatusOK, rec.StatusCode)
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&users))
+		for _, user := range users.Items {
+			assert.Greater(t, user.Username, last)
+		}
+	}
+
+	for _, query := range []string{"sort=nope", "limit=1000", "limit=abc", "offset=-5", "cursor=nope"} {
+		rec = performRequest(t, http.MethodGet, "http://localhost:1323/users?"+query, token, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.StatusCode, query)
+	}
+}
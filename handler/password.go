@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"tbd/mail"
+	"tbd/model"
+	"tbd/sms"
+)
+
+// Users get at most one reset token in this time; more requests are ignored
+const passwordResetCooldown = time.Minute
+
+func (h *Handler) passwordResetTTL() time.Duration {
+	if h.PasswordResetTTL <= 0 {
+		return time.Hour
+	}
+	return h.PasswordResetTTL
+}
+
+// Sends a new token to reset the password, to the email or phone the user asked with; earlier tokens stop working
+func (h *Handler) sendPasswordReset(ctx context.Context, user model.User, channel string) error {
+	var recent int64
+	since := time.Now().Add(-passwordResetCooldown)
+	r := h.DB.Model(&model.UserToken{}).Where("user_id = ? AND purpose = ? AND created_at > ?", user.ID, model.UserTokenResetPassword, since).Count(&recent)
+	if r.Error != nil {
+		return r.Error
+	}
+	if recent > 0 {
+		return nil
+	}
+
+	ttl := h.passwordResetTTL()
+	userToken, token, err := model.NewUserToken(user.ID, model.UserTokenResetPassword, ttl)
+	if err != nil {
+		return err
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, model.UserTokenResetPassword).Delete(&model.UserToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&userToken).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	domain := os.Getenv("DOMAIN")
+	if channel == "phone" {
+		if h.SMS == nil {
+			return errors.New("no sms sender to send the password reset with")
+		}
+		body := fmt.Sprintf("Your %s password reset token: %s (expires in %s)", domain, token, ttl)
+		return h.SMS.Send(ctx, sms.Message{To: *user.Phone, Body: body})
+	}
+
+	if h.Mailer == nil {
+		return errors.New("no mailer to send the password reset with")
+	}
+	body := fmt.Sprintf("Reset your password on %s with this token:\n\n%s\n\nIt expires in %s. If you didn't ask for it, ignore this email; your password stays the same.", domain, token, ttl)
+	return h.Mailer.Send(ctx, mail.Message{To: *user.Email, Subject: "Reset your password", Body: body})
+}
+
+// Sets a new password and bumps the token version, so access tokens issued before stop working
+func setPassword(tx *gorm.DB, userID, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password":      string(hash),
+		"token_version": gorm.Expr("token_version + 1"),
+	}).Error
+}
+
+// Sends a token to reset the password to the email or phone of the account
+// Notes:
+//   - Always accepted, whether there's an account or not; the token is sent in the background, so the timing doesn't tell either
+//   - At most one token a minute; more requests are ignored
+func (h *Handler) ForgotPassword(c echo.Context) error {
+	f := model.ForgotPasswordReq{}
+	if err := c.Bind(&f); err != nil {
+		return err
+	}
+
+	channel := f.Type
+	if channel == "" {
+		channel = "email"
+		if f.Email == "" && f.Phone != "" {
+			channel = "phone"
+		}
+	}
+
+	query := h.DB.Where("deleted_at IS NULL")
+	switch channel {
+	case "email":
+		if !model.IsValidEmail(f.Email) {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Improperly formatted email address."}
+		}
+		query = query.Where("email = ?", model.StripEmail(f.Email))
+	case "phone":
+		if !model.IsValidPhone(*model.StripPhone(f.Phone)) {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Improperly formatted phone number."}
+		}
+		query = query.Where("phone = ?", model.StripPhone(f.Phone))
+	default:
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Type must be email or phone."}
+	}
+
+	users := []model.User{}
+	if err := query.Limit(1).Find(&users).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+
+	if len(users) > 0 {
+		go func(user model.User) {
+			if err := h.sendPasswordReset(context.Background(), user, channel); err != nil {
+				log.Println(err)
+			}
+		}(users[0])
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+// Sets a new password with a token from ForgotPassword; tokens work once, until they expire
+// All logins of the user stop working, and they login again with the new password
+func (h *Handler) ResetPassword(c echo.Context) error {
+	req := model.ResetPasswordReq{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	invalid := &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid or expired token."}
+
+	revoked := []string{}
+	userID := ""
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		userToken := model.UserToken{}
+		r := tx.Where("token_hash = ? AND purpose = ?", model.HashToken(req.Token), model.UserTokenResetPassword).First(&userToken)
+		if r.Error != nil {
+			if r.Error == gorm.ErrRecordNotFound {
+				return invalid
+			}
+			return r.Error
+		}
+		if userToken.UsedAt != nil || time.Now().After(userToken.ExpiresAt) {
+			return invalid
+		}
+
+		// Only one request gets to use it
+		r = tx.Model(&model.UserToken{}).Where("id = ? AND used_at IS NULL", userToken.ID).Update("used_at", time.Now())
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			return invalid
+		}
+
+		var users int64
+		if err := tx.Model(&model.User{}).Where("id = ? AND deleted_at IS NULL", userToken.UserID).Count(&users).Error; err != nil {
+			return err
+		}
+		if users == 0 {
+			return invalid
+		}
+
+		userID = userToken.UserID
+		if err := setPassword(tx, userToken.UserID, req.Password); err != nil {
+			return err
+		}
+		ids, err := revokeSessions(tx, userToken.UserID, "")
+		revoked = ids
+		return err
+	})
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	h.Sessions.Revoke(revoked...)
+	h.Accounts.Invalidate(userID)
+
+	return c.NoContent(http.StatusOK)
+}
+
+// Changes the password of the user, who confirms it with the old one
+// Other sessions are revoked; the response has a new access token for this one
+func (h *Handler) ChangePassword(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	req := model.ChangePasswordReq{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	user := model.User{}
+	if err := h.DB.Where("id = ?", reqUser.ID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "User not found."}
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.OldPassword)) != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Old password is incorrect."}
+	}
+
+	revoked := []string{}
+	err := h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := setPassword(tx, user.ID, req.NewPassword); err != nil {
+			return err
+		}
+		ids, err := revokeSessions(tx, user.ID, reqUser.SessionID)
+		revoked = ids
+		return err
+	})
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	h.Sessions.Revoke(revoked...)
+	h.Accounts.Invalidate(user.ID)
+
+	// The session stays; its access token has the new token version
+	if err := h.DB.Where("id = ?", user.ID).First(&user).Error; err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	accessToken, expiresAt, err := h.signAccessToken(user, reqUser.SessionID)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Something went wrong. Please try again later."}
+	}
+
+	return c.JSON(http.StatusOK, model.LoginUserReqResponse{Token: accessToken, ExpiresAt: &expiresAt})
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/icrowley/fake"
+	"github.com/stretchr/testify/assert"
+
+	"tbd/model"
+)
+
+func login(t *testing.T, data model.LoginUserReq) (int, string) {
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/login", "", data)
+
+	var response model.LoginUserReqResponse
+	if rec.StatusCode == http.StatusOK {
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	}
+	return rec.StatusCode, response.Token
+}
+
+func TestPasswordReset(t *testing.T) {
+	email := strings.ToLower(fake.EmailAddress())
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/signup", "", model.SignupUserReq{Name: fake.FullName(), Email: email, Password: "password123"})
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+	status, token := login(t, model.LoginUserReq{Email: email, Password: "password123"})
+	assert.Equal(t, http.StatusOK, status)
+
+	// Whether there's an account or not, the response is the same
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/password/forgot", "", model.ForgotPasswordReq{Email: "nobody." + email})
+	assert.Equal(t, http.StatusAccepted, rec.StatusCode)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/password/forgot", "", model.ForgotPasswordReq{Email: email})
+	assert.Equal(t, http.StatusAccepted, rec.StatusCode)
+
+	// After the email to confirm the address
+	resetToken := waitForToken(t, "MAIL_PATH", email, 2)
+
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/password/reset", "", model.ResetPasswordReq{Token: resetToken, Password: "short"})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/password/reset", "", model.ResetPasswordReq{Token: resetToken, Password: "new password"})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/password/reset", "", model.ResetPasswordReq{Token: resetToken, Password: "another password"})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	// Logins from before stop working
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me", token, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.StatusCode)
+
+	status, _ = login(t, model.LoginUserReq{Email: email, Password: "password123"})
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, token = login(t, model.LoginUserReq{Email: email, Password: "new password"})
+	assert.Equal(t, http.StatusOK, status)
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me", token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+}
+
+func TestPasswordResetByPhone(t *testing.T) {
+	phone := fmt.Sprintf("+49151%08d", rand.Intn(100000000))
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/signup", "", model.SignupUserReq{Phone: phone, Password: "password123"})
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/password/forgot", "", model.ForgotPasswordReq{Phone: phone})
+	assert.Equal(t, http.StatusAccepted, rec.StatusCode)
+
+	resetToken := waitForToken(t, "SMS_PATH", phone, 1)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/password/reset", "", model.ResetPasswordReq{Token: resetToken, Password: "new password"})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	status, _ := login(t, model.LoginUserReq{Phone: phone, Password: "new password"})
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestPasswordChange(t *testing.T) {
+	email := strings.ToLower(fake.EmailAddress())
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/signup", "", model.SignupUserReq{Name: fake.FullName(), Email: email, Password: "password123"})
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+	_, token := login(t, model.LoginUserReq{Email: email, Password: "password123"})
+	_, otherToken := login(t, model.LoginUserReq{Email: email, Password: "password123"})
+
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/password/change", token, model.ChangePasswordReq{OldPassword: "wrong password", NewPassword: "new password"})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/password/change", token, model.ChangePasswordReq{OldPassword: "password123", NewPassword: "short"})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/password/change", token, model.ChangePasswordReq{OldPassword: "password123", NewPassword: "new password"})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	var response model.LoginUserReqResponse
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+
+	// Only the new token works
+	for _, old := range []string{token, otherToken} {
+		rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me", old, nil)
+		assert.Equal(t, http.StatusUnauthorized, rec.StatusCode)
+	}
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me", response.Token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	status, _ := login(t, model.LoginUserReq{Email: email, Password: "new password"})
+	assert.Equal(t, http.StatusOK, status)
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"tbd/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fetchEntriesByPrice(t *testing.T, query string) []model.PublicEntry {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries?type=item-sale&"+query, "", nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response struct {
+		Items []model.PublicEntry `json:"items"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	assert.NoError(t, err)
+
+	return response.Items
+}
+
+func entryIDs(entries []model.PublicEntry) []string {
+	ids := []string{}
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestEntryPriceFilterCurrency(t *testing.T) {
+	token := signupAndLogin(t)
+
+	// Same amount, different currencies
+	units := 1000000000 + rand.Int63n(1000000000)
+	eurID := createItemSale(t, token, "", withPrice(&model.Money{Amount: units*100 + 50, Currency: "EUR"}))
+	usdID := createItemSale(t, token, "", withPrice(&model.Money{Amount: units*100 + 50, Currency: "USD"}))
+
+	entries := fetchEntriesByPrice(t, fmt.Sprintf("currency=EUR&price=eq,%d.50", units))
+	assert.Equal(t, []string{eurID}, entryIDs(entries))
+	assert.Equal(t, &model.Money{Amount: units*100 + 50, Currency: "EUR"}, entries[0].Price)
+
+	// Defaults to the currency of the community
+	assert.Equal(t, []string{usdID}, entryIDs(fetchEntriesByPrice(t, fmt.Sprintf("price=eq,%d.5", units))))
+
+	// Without rates, only the target currency is converted
+	assert.Equal(t, []string{usdID}, entryIDs(fetchEntriesByPrice(t, fmt.Sprintf("currency=USD&convert=true&price=eq,%d.50", units))))
+}
+
+func TestEntryPriceSort(t *testing.T) {
+	token := signupAndLogin(t)
+
+	units := 1000000000 + rand.Int63n(1000000000)
+	cheap := createItemSale(t, token, "", withPrice(&model.Money{Amount: units * 100, Currency: "USD"}))
+	expensive := createItemSale(t, token, "", withPrice(&model.Money{Amount: units*100 + 1, Currency: "USD"}))
+	middle := createItemSale(t, token, "", withPrice(&model.Money{Amount: units * 100, Currency: "USD"}))
+	_ = createItemSale(t, token, "", withPrice(&model.Money{Amount: units * 100, Currency: "EUR"}))
+
+	query := fmt.Sprintf("currency=USD&price=bt,%d,%d.01&sort=", units, units)
+
+	// Same price: newest first
+	assert.Equal(t, []string{middle, cheap, expensive}, entryIDs(fetchEntriesByPrice(t, query+"price_asc")))
+	assert.Equal(t, []string{expensive, middle, cheap}, entryIDs(fetchEntriesByPrice(t, query+"price_desc")))
+}
+
+func TestEntryPriceInvalid(t *testing.T) {
+	for _, query := range []string{"currency=EURO", "price=abc", "price=1.001", "price=lk,1", "price=bt,1", "sort=cheapest"} {
+		rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries?"+query, "", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.StatusCode, query)
+	}
+
+	token := signupAndLogin(t)
+	entryData := itemSaleData("", withPrice(&model.Money{Amount: 100, Currency: "EURO"}))
+
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/entries", token, entryData)
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	var response struct {
+		Errors []struct {
+			Field string `json:"field"`
+			Rule  string `json:"rule"`
+		} `json:"errors"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	assert.NoError(t, err)
+	assert.Len(t, response.Errors, 1)
+	assert.Equal(t, "price.currency", response.Errors[0].Field)
+	assert.Equal(t, "iso4217", response.Errors[0].Rule)
+}
+
+func TestEntryPriceUpdate(t *testing.T) {
+	token := signupAndLogin(t)
+	money, price := uniquePrice()
+	id := createItemSale(t, token, "", withPrice(money))
+
+	// The whole data is sent, with the new price
+	money, newPrice := uniquePrice()
+	rec := performRequest(t, http.MethodPatch, "http://localhost:1323/entries/"+id, token, map[string]interface{}{
+		"data": itemSaleData("", withPrice(money))["data"],
+	})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	assert.False(t, entryIsListed(t, id, price))
+	assert.True(t, entryIsListed(t, id, newPrice))
+}
+
+func TestCurrencyRates(t *testing.T) {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/currency-rates", "", nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	// Admins only
+	token := signupAndLogin(t)
+	rec = performRequest(t, http.MethodPut, "http://localhost:1323/admin/currency-rates/EUR/USD", token, model.SubmitCurrencyRate{Rate: 1.08})
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+}
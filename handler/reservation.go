@@ -0,0 +1,334 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"tbd/model"
+)
+
+var (
+	errReservationOverlaps = errors.New("reservation overlaps an accepted reservation")
+	errReservationBlocked  = errors.New("reservation overlaps an availability block")
+)
+
+// Locks the entry for the rest of the transaction, so two overlapping reservations can't be accepted at once
+// Blocked periods, by the owner or from an iCal import, can't be booked either
+// SQLite has no row locks, but only allows one writer at a time anyway
+func checkReservationOverlap(tx *gorm.DB, entryID string, start, end time.Time, excludeID string) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&model.Entry{}, "id = ?", entryID).Error; err != nil {
+		return err
+	}
+
+	var count int64
+	query := tx.Model(&model.Reservation{}).
+		Where("entry_id = ? AND status = ? AND start_date < ? AND end_date > ?", entryID, model.ReservationStatusAccepted, end, start)
+	if excludeID != "" {
+		query = query.Where("id <> ?", excludeID)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return errReservationOverlaps
+	}
+
+	err := tx.Model(&model.AvailabilityBlock{}).
+		Where("entry_id = ? AND start_date < ? AND end_date > ?", entryID, end, start).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errReservationBlocked
+	}
+	return nil
+}
+
+func (h *Handler) CreateReservation(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	entryID := c.Param("id")
+	if _, err := uuid.Parse(entryID); err != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid UUID."}
+	}
+
+	entry := model.Entry{}
+	if err := h.DB.First(&entry, "id = ?", entryID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "Entry not found."}
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch entry."}
+	}
+
+	entryType, err := h.entryType(entry.Type)
+	if err != nil {
+		return err
+	}
+	if !entryType.Bookable {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Entries of this type cannot be reserved."}
+	}
+	if entry.Status != model.EntryStatusPublished {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Entry is not available."}
+	}
+	if entry.CreatedByID == reqUser.ID {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "You cannot reserve your own entry."}
+	}
+
+	s := model.SubmitReservation{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		log.Println(err)
+		return err
+	}
+
+	// Whatever the entry consumes goes out as sub-orders
+	q, err := h.quoteEntry(&entry, model.QuoteRequest{DistanceKm: s.DistanceKm})
+	if err != nil {
+		return err
+	}
+
+	r := model.Reservation{
+		EntryID:     entry.ID,
+		CreatedByID: reqUser.ID,
+		StartDate:   s.StartDate.UTC(),
+		EndDate:     s.EndDate.UTC(),
+		Message:     s.Message,
+		Status:      model.ReservationStatusRequested,
+		SubOrders:   model.SubOrdersFromQuote(q),
+	}
+
+	if !r.EndDate.After(r.StartDate) {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "End date must be after start date."}
+	}
+	if !r.EndDate.After(time.Now()) {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Reservation must end in the future."}
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkReservationOverlap(tx, r.EntryID, r.StartDate, r.EndDate, ""); err != nil {
+			return err
+		}
+		return tx.Create(&r).Error
+	})
+	if errors.Is(err, errReservationOverlaps) {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Entry is already booked for this period."}
+	}
+	if errors.Is(err, errReservationBlocked) {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Entry is not available for this period."}
+	}
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create reservation."}
+	}
+
+	return c.JSON(http.StatusCreated, r.ToPublicFormat(os.Getenv("DOMAIN")))
+}
+
+// The requester, the owner of the entry or an admin; returns whether the user may act as owner
+func (h *Handler) reservationForUser(c echo.Context, id string) (*model.Reservation, bool, error) {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, false, &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid UUID."}
+	}
+
+	r := model.Reservation{}
+	err := h.DB.Preload("Entry.CreatedBy").Preload("CreatedBy").Preload("SubOrders").First(&r, "id = ?", id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, false, &echo.HTTPError{Code: http.StatusNotFound, Message: "Reservation not found."}
+		}
+		log.Println(err)
+		return nil, false, &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch reservation."}
+	}
+
+	isOwner := reqUser.IsAdmin || (r.Entry != nil && r.Entry.CreatedByID == reqUser.ID)
+	if !isOwner && r.CreatedByID != reqUser.ID {
+		return nil, false, &echo.HTTPError{Code: http.StatusForbidden, Message: "You do not have permission to access this reservation."}
+	}
+
+	return &r, isOwner, nil
+}
+
+func (h *Handler) FetchReservation(c echo.Context) error {
+	r, _, err := h.reservationForUser(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, r.ToPublicFormat(os.Getenv("DOMAIN")))
+}
+
+// Owners accept, decline and complete; requesters and owners cancel
+func (h *Handler) UpdateReservationStatus(c echo.Context) error {
+	r, isOwner, err := h.reservationForUser(c, c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	s := model.SubmitReservationStatus{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+
+	if !model.ReservationStatusIsValid(s.Status) {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Status is not supported."}
+	}
+	if !r.CanTransitionTo(s.Status, isOwner) {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Reservation cannot be moved from " + r.Status + " to " + s.Status + "."}
+	}
+	if s.Status == model.ReservationStatusCompleted && r.EndDate.After(time.Now()) {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Reservation has not ended yet."}
+	}
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if s.Status == model.ReservationStatusAccepted {
+			if err := checkReservationOverlap(tx, r.EntryID, r.StartDate, r.EndDate, r.ID); err != nil {
+				return err
+			}
+		}
+
+		// Only move on from the status that was checked; another request may have changed it meanwhile
+		result := tx.Model(&model.Reservation{}).Where("id = ? AND status = ?", r.ID, r.Status).Update("status", s.Status)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		switch s.Status {
+		case model.ReservationStatusDeclined, model.ReservationStatusCancelled:
+			return cancelSubOrders(tx, "reservation_id", r.ID)
+		}
+		return nil
+	})
+	if errors.Is(err, errReservationOverlaps) {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Entry is already booked for this period."}
+	}
+	if errors.Is(err, errReservationBlocked) {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Entry is not available for this period."}
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Reservation has changed; try again."}
+	}
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to update reservation."}
+	}
+
+	return c.JSON(http.StatusOK, UpdateResponse{Updated: 1})
+}
+
+// Sorts of reservations; start is by the first day, soonest first
+func reservationSorts() map[string]sortOrder {
+	sorts := creationSorts("reservations")
+	sorts["start"] = sortOrder{name: "start", keys: []sortKey{
+		{expr: "reservations.start_date", time: true},
+		{expr: "reservations.id"},
+	}}
+	return sorts
+}
+
+// Filter by status, for ex. ?status=requested; by start by default
+func (h *Handler) listReservations(c echo.Context, query *gorm.DB) error {
+	page, order, after, err := bindPage(c, reservationSorts(), "start")
+	if err != nil {
+		return err
+	}
+
+	if status := c.QueryParam("status"); status != "" {
+		if !model.ReservationStatusIsValid(status) {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Status is not supported."}
+		}
+		query = query.Where("reservations.status = ?", status)
+	}
+
+	// Offset is only used without a cursor
+	offset := page.Offset
+	// A session, so counting doesn't change the query
+	query = query.Session(&gorm.Session{})
+
+	response := PageResponse{}
+	if page.Total {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch reservations."}
+		}
+		response.Total = &count
+	}
+
+	if after != nil {
+		params := []interface{}{}
+		query = query.Where(order.after(after, &params), params...)
+		offset = 0
+	}
+
+	reservations := []model.Reservation{}
+	err = query.
+		Preload("Entry.CreatedBy").
+		Preload("CreatedBy").
+		Preload("SubOrders").
+		Order(order.orderBy()).
+		Limit(page.Limit + 1).
+		Offset(offset).
+		Find(&reservations).Error
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch reservations."}
+	}
+
+	if len(reservations) > page.Limit {
+		reservations = reservations[:page.Limit]
+		response.NextCursor, err = h.nextCursor(order, "reservations", "reservations.id", reservations[len(reservations)-1].ID)
+		if err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch reservations."}
+		}
+	}
+
+	response.Items = responseArrFormatter[model.Reservation](reservations, nil, os.Getenv("DOMAIN"))
+	return c.JSON(http.StatusOK, response)
+}
+
+// Reservations of an entry; only for its owner
+func (h *Handler) FetchEntryReservations(c echo.Context) error {
+	if _, err := h.isOwnerOrAdmin(c, c.Param("id"), "entry"); err != nil {
+		return err
+	}
+
+	return h.listReservations(c, h.DB.Model(&model.Reservation{}).Where("reservations.entry_id = ?", c.Param("id")))
+}
+
+// Reservations the user requested
+func (h *Handler) FetchMyReservations(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	return h.listReservations(c, h.DB.Model(&model.Reservation{}).Where("reservations.created_by_id = ?", reqUser.ID))
+}
+
+// Reservations on entries of the user
+func (h *Handler) FetchReceivedReservations(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	query := h.DB.Model(&model.Reservation{}).
+		Joins("INNER JOIN entries ON entries.id = reservations.entry_id").
+		Where("entries.created_by_id = ?", reqUser.ID)
+	return h.listReservations(c, query)
+}
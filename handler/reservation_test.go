@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"tbd/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func reserveEntry(t *testing.T, token, entryID string, start, end time.Time) *http.Response {
+	return performRequest(t, http.MethodPost, "http://localhost:1323/entries/"+entryID+"/reservations", token, model.SubmitReservation{
+		StartDate: start,
+		EndDate:   end,
+		Message:   "Hello",
+	})
+}
+
+func createReservation(t *testing.T, token, entryID string, start, end time.Time) model.PublicReservation {
+	rec := reserveEntry(t, token, entryID, start, end)
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+
+	var reservation model.PublicReservation
+	err := json.NewDecoder(rec.Body).Decode(&reservation)
+	assert.NoError(t, err)
+
+	return reservation
+}
+
+func setReservationStatus(t *testing.T, token, id, status string) int {
+	rec := performRequest(t, http.MethodPatch, "http://localhost:1323/reservations/"+id+"/status", token, map[string]string{"status": status})
+	return rec.StatusCode
+}
+
+func fetchReservations(t *testing.T, token, url string) []model.PublicReservation {
+	rec := performRequest(t, http.MethodGet, url, token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response struct {
+		Items []model.PublicReservation `json:"items"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	assert.NoError(t, err)
+
+	return response.Items
+}
+
+func reservationIDs(reservations []model.PublicReservation) []string {
+	ids := []string{}
+	for _, r := range reservations {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestReservationOverlap(t *testing.T) {
+	ownerToken := signupAndLogin(t)
+	entry := createEntry(t, ownerToken, genEntryData("pet-sitter", nil))
+
+	day := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+
+	firstToken := signupAndLogin(t)
+	first := createReservation(t, firstToken, entry.ID, day, day.AddDate(0, 0, 2))
+	assert.Equal(t, model.ReservationStatusRequested, first.Status)
+
+	// Nothing is accepted yet, so overlapping requests are fine
+	secondToken := signupAndLogin(t)
+	second := createReservation(t, secondToken, entry.ID, day.AddDate(0, 0, 1), day.AddDate(0, 0, 3))
+
+	// Only the owner accepts
+	assert.Equal(t, http.StatusConflict, setReservationStatus(t, firstToken, first.ID, model.ReservationStatusAccepted))
+	assert.Equal(t, http.StatusOK, setReservationStatus(t, ownerToken, first.ID, model.ReservationStatusAccepted))
+
+	// Overlaps the accepted reservation
+	thirdToken := signupAndLogin(t)
+	rec := reserveEntry(t, thirdToken, entry.ID, day.AddDate(0, 0, 1), day.AddDate(0, 0, 4))
+	assert.Equal(t, http.StatusConflict, rec.StatusCode)
+	assert.Equal(t, http.StatusConflict, setReservationStatus(t, ownerToken, second.ID, model.ReservationStatusAccepted))
+
+	// Starts the day the accepted reservation ends
+	createReservation(t, thirdToken, entry.ID, day.AddDate(0, 0, 2), day.AddDate(0, 0, 4))
+
+	// Once cancelled, the period is free again
+	assert.Equal(t, http.StatusOK, setReservationStatus(t, firstToken, first.ID, model.ReservationStatusCancelled))
+	assert.Equal(t, http.StatusOK, setReservationStatus(t, ownerToken, second.ID, model.ReservationStatusAccepted))
+}
+
+func TestReservationInvalid(t *testing.T) {
+	ownerToken := signupAndLogin(t)
+	day := time.Now().UTC().AddDate(0, 0, 1)
+
+	// Not a bookable type
+	itemSale := createEntry(t, ownerToken, genEntryData("item-sale", nil))
+	requesterToken := signupAndLogin(t)
+	rec := reserveEntry(t, requesterToken, itemSale.ID, day, day.AddDate(0, 0, 1))
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	rental := createEntry(t, ownerToken, genEntryData("apartment-short-term-rental", nil))
+
+	// Own entry
+	rec = reserveEntry(t, ownerToken, rental.ID, day, day.AddDate(0, 0, 1))
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	// Ends before it starts
+	rec = reserveEntry(t, requesterToken, rental.ID, day, day.AddDate(0, 0, -1))
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	// In the past
+	rec = reserveEntry(t, requesterToken, rental.ID, day.AddDate(0, 0, -10), day.AddDate(0, 0, -8))
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+}
+
+func TestReservationLists(t *testing.T) {
+	ownerToken := signupAndLogin(t)
+	entry := createEntry(t, ownerToken, genEntryData("apartment-long-term-rental", nil))
+
+	requesterToken := signupAndLogin(t)
+	day := time.Now().UTC().AddDate(0, 0, 1)
+	reservation := createReservation(t, requesterToken, entry.ID, day, day.AddDate(0, 1, 0))
+
+	mine := fetchReservations(t, requesterToken, "http://localhost:1323/account/me/reservations")
+	assert.Equal(t, []string{reservation.ID}, reservationIDs(mine))
+
+	received := fetchReservations(t, ownerToken, "http://localhost:1323/account/me/reservations/received?status=requested")
+	assert.Equal(t, []string{reservation.ID}, reservationIDs(received))
+	assert.NotNil(t, received[0].Entry)
+
+	received = fetchReservations(t, ownerToken, "http://localhost:1323/account/me/reservations/received?status=accepted")
+	assert.Empty(t, received)
+
+	ofEntry := fetchReservations(t, ownerToken, "http://localhost:1323/entries/"+entry.ID+"/reservations")
+	assert.Equal(t, []string{reservation.ID}, reservationIDs(ofEntry))
+
+	// Only the owner sees all reservations of an entry
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/entries/"+entry.ID+"/reservations", requesterToken, nil)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+
+	// Soonest first, a page at a time
+	later := createReservation(t, requesterToken, entry.ID, day.AddDate(0, 2, 0), day.AddDate(0, 3, 0))
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me/reservations?limit=1&total=true", requesterToken, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	var page struct {
+		Total      *int64                    `json:"total"`
+		Items      []model.PublicReservation `json:"items"`
+		NextCursor string                    `json:"next_cursor"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&page))
+	if assert.NotNil(t, page.Total) {
+		assert.Equal(t, int64(2), *page.Total)
+	}
+	assert.Equal(t, []string{reservation.ID}, reservationIDs(page.Items))
+	mine = fetchReservations(t, requesterToken, "http://localhost:1323/account/me/reservations?limit=1&cursor="+page.NextCursor)
+	assert.Equal(t, []string{later.ID}, reservationIDs(mine))
+
+	for _, query := range []string{"limit=abc", "limit=1000", "offset=-5", "sort=nope"} {
+		rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me/reservations?"+query, requesterToken, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.StatusCode, query)
+	}
+
+	// Both parties see the reservation, nobody else does
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/reservations/"+reservation.ID, ownerToken, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/reservations/"+reservation.ID, signupAndLogin(t), nil)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+}
@@ -0,0 +1,264 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"tbd/model"
+)
+
+// Checks a saved query the way /entries would; returns it normalized
+func (h *Handler) savedSearchQuery(query string) (string, error) {
+	values, err := model.ParseSavedSearchQuery(query)
+	if err != nil {
+		return "", &echo.HTTPError{Code: http.StatusBadRequest, Message: "Query is not a valid query string."}
+	}
+
+	queryParams, err := parseEntryQueryParams(values)
+	if err != nil {
+		return "", err
+	}
+	if _, err := h.entryFilters(values, queryParams); err != nil {
+		return "", err
+	}
+	return values.Encode(), nil
+}
+
+// Entries updated in (since, until] that match a saved search; entries of its owner are left out
+// Used by jobs.SavedSearchAlerts
+func (h *Handler) MatchSavedSearch(ctx context.Context, s model.SavedSearch, since, until time.Time) ([]string, error) {
+	values, err := model.ParseSavedSearchQuery(s.Query)
+	if err != nil {
+		return nil, err
+	}
+	queryParams, err := parseEntryQueryParams(values)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := h.entryFilters(values, queryParams)
+	if err != nil {
+		return nil, err
+	}
+
+	// updated_at is written in local time; SQLite compares it as text
+	query := fmt.Sprintf(`SELECT entries.id FROM entries LEFT JOIN cities ON entries.city_id = cities.id
+		WHERE 1=1 %v AND entries.updated_at > ? AND entries.updated_at <= ? AND entries.created_by_id <> ?`, filter.query)
+	params := append(filter.params, since.Local(), until.Local(), s.UserID)
+
+	ids := []string{}
+	if err := h.DB.WithContext(ctx).Raw(query, params...).Scan(&ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (h *Handler) fetchMySavedSearch(c echo.Context) (*model.SavedSearch, error) {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	s := model.SavedSearch{}
+	if err := h.DB.First(&s, "id = ? AND user_id = ?", c.Param("id"), reqUser.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &echo.HTTPError{Code: http.StatusNotFound, Message: "Saved search not found."}
+		}
+		log.Println(err)
+		return nil, &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch saved search."}
+	}
+	return &s, nil
+}
+
+func (h *Handler) FetchMySavedSearches(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	searches := []model.SavedSearch{}
+	if err := h.DB.Where("user_id = ?", reqUser.ID).Order("created_at DESC").Find(&searches).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch saved searches."}
+	}
+
+	return c.JSON(
+		http.StatusOK,
+		ListResponse{
+			Total: int64(len(searches)),
+			Items: responseArrFormatter[model.SavedSearch](searches, nil, os.Getenv("DOMAIN")),
+		},
+	)
+}
+
+// Only entries created or updated from now on are alerted; frequency defaults to instant
+func (h *Handler) CreateSavedSearch(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	s := model.SubmitSavedSearch{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+
+	query, err := h.savedSearchQuery(s.Query)
+	if err != nil {
+		return err
+	}
+
+	var count int64
+	if err := h.DB.Model(&model.SavedSearch{}).Where("user_id = ?", reqUser.ID).Count(&count).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create saved search."}
+	}
+	if count >= model.MaxSavedSearchesPerUser {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Too many saved searches."}
+	}
+
+	frequency := s.Frequency
+	if frequency == "" {
+		frequency = model.AlertFrequencyInstant
+	}
+
+	search := model.SavedSearch{
+		UserID:    reqUser.ID,
+		Name:      s.Name,
+		Query:     query,
+		Frequency: frequency,
+		CheckedAt: time.Now(),
+	}
+	if err := h.DB.Create(&search).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to create saved search."}
+	}
+
+	return c.JSON(http.StatusCreated, search.ToPublicFormat(os.Getenv("DOMAIN")))
+}
+
+func (h *Handler) UpdateSavedSearch(c echo.Context) error {
+	search, err := h.fetchMySavedSearch(c)
+	if err != nil {
+		return err
+	}
+
+	s := model.UpdateSavedSearch{}
+	if err := c.Bind(&s); err != nil {
+		return err
+	}
+	if err := c.Validate(&s); err != nil {
+		return err
+	}
+
+	updateData := map[string]interface{}{}
+	if s.Name != nil {
+		updateData["name"] = *s.Name
+	}
+	if s.Frequency != nil {
+		updateData["frequency"] = *s.Frequency
+	}
+	if s.Query != nil {
+		query, err := h.savedSearchQuery(*s.Query)
+		if err != nil {
+			return err
+		}
+		if query != search.Query {
+			updateData["query"] = query
+			updateData["checked_at"] = time.Now()
+		}
+	}
+	if len(updateData) == 0 {
+		return c.JSON(http.StatusOK, UpdateResponse{Updated: 0})
+	}
+
+	if err := h.DB.Model(&model.SavedSearch{}).Where("id = ?", search.ID).Updates(updateData).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to update saved search."}
+	}
+
+	return c.JSON(http.StatusOK, UpdateResponse{Updated: 1})
+}
+
+func (h *Handler) DeleteSavedSearch(c echo.Context) error {
+	search, err := h.fetchMySavedSearch(c)
+	if err != nil {
+		return err
+	}
+
+	// Foreign keys aren't enforced, so matches are deleted here
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("saved_search_id = ?", search.ID).Delete(&model.SavedSearchMatch{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.SavedSearch{}, "id = ?", search.ID).Error
+	})
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to delete saved search."}
+	}
+
+	return c.JSON(http.StatusOK, DeleteResponse{Deleted: 1})
+}
+
+// Entries the search matched, newest first by default; including the ones that weren't sent yet
+func (h *Handler) FetchSavedSearchMatches(c echo.Context) error {
+	search, err := h.fetchMySavedSearch(c)
+	if err != nil {
+		return err
+	}
+
+	page, order, after, err := bindPage(c, creationSorts("saved_search_matches"), "newest")
+	if err != nil {
+		return err
+	}
+
+	query := h.DB.Model(&model.SavedSearchMatch{}).Where("saved_search_matches.saved_search_id = ?", search.ID)
+
+	// Offset is only used without a cursor
+	offset := page.Offset
+	// A session, so counting doesn't change the query
+	query = query.Session(&gorm.Session{})
+
+	response := PageResponse{}
+	if page.Total {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch matches."}
+		}
+		response.Total = &count
+	}
+
+	if after != nil {
+		params := []interface{}{}
+		query = query.Where(order.after(after, &params), params...)
+		offset = 0
+	}
+
+	matches := []model.SavedSearchMatch{}
+	err = query.
+		Preload("Entry.City").
+		Preload("Entry.CreatedBy").
+		Order(order.orderBy()).
+		Limit(page.Limit + 1).
+		Offset(offset).
+		Find(&matches).Error
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch matches."}
+	}
+
+	if len(matches) > page.Limit {
+		matches = matches[:page.Limit]
+		response.NextCursor, err = h.nextCursor(order, "saved_search_matches", "saved_search_matches.id", matches[len(matches)-1].ID)
+		if err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch matches."}
+		}
+	}
+
+	response.Items = responseArrFormatter[model.SavedSearchMatch](matches, nil, os.Getenv("DOMAIN"))
+	return c.JSON(http.StatusOK, response)
+}
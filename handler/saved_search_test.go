@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"tbd/model"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type savedSearchNotification struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+	Data struct {
+		SavedSearchID string   `json:"saved_search_id"`
+		EntryIDs      []string `json:"entry_ids"`
+	} `json:"data"`
+	ReadAt *time.Time `json:"read_at"`
+}
+
+func createSavedSearch(t *testing.T, token string, data map[string]interface{}) (int, model.PublicSavedSearch) {
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/account/me/saved-searches", token, data)
+
+	var search model.PublicSavedSearch
+	if rec.StatusCode == http.StatusCreated {
+		err := json.NewDecoder(rec.Body).Decode(&search)
+		assert.NoError(t, err)
+	}
+	return rec.StatusCode, search
+}
+
+func fetchNotifications(t *testing.T, token, query string) []savedSearchNotification {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/account/me/notifications?"+query, token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response struct {
+		Items []savedSearchNotification `json:"items"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	assert.NoError(t, err)
+	return response.Items
+}
+
+// Notifications of a saved search; waits a few seconds for the first one, since alerts are sent in the background
+func waitForAlerts(t *testing.T, token, searchID string) []savedSearchNotification {
+	for i := 0; i < 50; i++ {
+		alerts := []savedSearchNotification{}
+		for _, n := range fetchNotifications(t, token, "") {
+			if n.Kind == model.NotificationKindSavedSearch && n.Data.SavedSearchID == searchID {
+				alerts = append(alerts, n)
+			}
+		}
+		if len(alerts) > 0 {
+			return alerts
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestSavedSearchAlerts(t *testing.T) {
+	token := signupAndLogin(t)
+	sellerToken := signupAndLogin(t)
+	money, price := uniquePrice()
+
+	status, search := createSavedSearch(t, token, map[string]interface{}{
+		"name":  "Cheap finds",
+		"query": "/entries?type=item-sale&currency=USD&price=eq," + price + "&limit=5",
+	})
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "currency=USD&price=eq%2C"+price+"&type=item-sale", search.Query)
+	assert.Equal(t, model.AlertFrequencyInstant, search.Frequency)
+
+	// Neither the owner's own entries nor drafts are alerted
+	ownID := createItemSale(t, token, "", withPrice(money))
+	draftID := createItemSale(t, sellerToken, model.EntryStatusDraft, withPrice(money))
+	matchID := createItemSale(t, sellerToken, "", withPrice(money))
+
+	alerts := waitForAlerts(t, token, search.ID)
+	if assert.NotEmpty(t, alerts) {
+		ids := []string{}
+		for _, alert := range alerts {
+			ids = append(ids, alert.Data.EntryIDs...)
+		}
+		assert.Equal(t, []string{matchID}, ids)
+		assert.NotContains(t, ids, ownID)
+		assert.NotContains(t, ids, draftID)
+	}
+
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/account/me/saved-searches/"+search.ID+"/matches?total=true", token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	var matches struct {
+		Total *int64                         `json:"total"`
+		Items []model.PublicSavedSearchMatch `json:"items"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&matches))
+	if assert.NotNil(t, matches.Total) && assert.Equal(t, int64(1), *matches.Total) {
+		assert.Equal(t, matchID, matches.Items[0].Entry.ID)
+		assert.NotNil(t, matches.Items[0].NotifiedAt)
+	}
+
+	for _, query := range []string{"limit=abc", "limit=1000", "offset=-5", "sort=nope"} {
+		rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me/saved-searches/"+search.ID+"/matches?"+query, token, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.StatusCode, query)
+		rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me/notifications?"+query, token, nil)
+		assert.Equal(t, http.StatusBadRequest, rec.StatusCode, query)
+	}
+
+	// Read notifications aren't unread anymore
+	if len(alerts) > 0 {
+		rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/me/notifications/read", token, map[string]interface{}{
+			"ids": []string{alerts[0].ID},
+		})
+		assert.Equal(t, http.StatusOK, rec.StatusCode)
+		for _, n := range fetchNotifications(t, token, "unread=true") {
+			assert.NotEqual(t, alerts[0].ID, n.ID)
+		}
+	}
+
+	rec = performRequest(t, http.MethodPatch, "http://localhost:1323/account/me/saved-searches/"+search.ID, token, map[string]interface{}{
+		"frequency": model.AlertFrequencyWeekly,
+	})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	// Other users don't see it
+	rec = performRequest(t, http.MethodDelete, "http://localhost:1323/account/me/saved-searches/"+search.ID, sellerToken, nil)
+	assert.Equal(t, http.StatusNotFound, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodDelete, "http://localhost:1323/account/me/saved-searches/"+search.ID, token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/account/me/saved-searches/"+search.ID+"/matches", token, nil)
+	assert.Equal(t, http.StatusNotFound, rec.StatusCode)
+}
+
+func TestSavedSearchInvalid(t *testing.T) {
+	token := signupAndLogin(t)
+
+	invalid := []map[string]interface{}{
+		{"query": "type=item-sale"},
+		{"name": "No query"},
+		{"name": "Hourly", "query": "type=item-sale", "frequency": "hourly"},
+		{"name": "Data without type", "query": "data.color=red"},
+		{"name": "Bad radius", "query": "near=52.5,13.4&radius_km=-1"},
+	}
+	for _, data := range invalid {
+		status, _ := createSavedSearch(t, token, data)
+		assert.Equal(t, http.StatusBadRequest, status, data)
+	}
+
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/account/me/saved-searches", "", nil)
+	assert.NotEqual(t, http.StatusOK, rec.StatusCode)
+}
@@ -1,71 +1,69 @@
 package handler
 
 import (
+	"errors"
 	"log"
 	"net/http"
 
 	"github.com/labstack/echo/v4"
-)
 
-// Type may be one of: entry, user, city
-// title:
-// - entry.data.title
-// - city.name
-// - user.username
-// slug:
-// - entry.id
-// - city.slug
-// - user.id
-type SearchResponseItem struct {
-	Type  string `json:"type"`
-	Title string `json:"title"`
-	Slug  string `json:"slug"`
-}
+	"tbd/model"
+	"tbd/search"
+)
 
-// Search keyword will consider a number of fields
-// - entry.data.title
-// - entry.data.description
-// - city.name
-// - user.username
+// Searches entries (title, description), cities (name) and users (username), most relevant first
+// Filter with type (entry, city or user), entry_type and city_slug; for ex. ?keyword=bike&entry_type=item-sale&city_slug=berlin
+//
+// Notes:
+//   - Every word must match; the last one may be the start of a word
+//   - Only visible entries are found; see visibleEntries
+//   - Highlights are HTML-escaped, with matches in <mark>
 func (h *Handler) Search(c echo.Context) error {
-	keyword := c.QueryParam("keyword")
-
-	response := []SearchResponseItem{}
-
-	// Query
-	query := `
-		SELECT 'entry' AS type, json_extract(data, '$.title') AS title, id AS slug FROM entries
-		WHERE json_extract(data, '$.title') LIKE ? OR json_extract(data, '$.description') LIKE ?
-		UNION ALL
-		SELECT 'city' AS type, name AS title, slug FROM cities
-		WHERE name LIKE ?
-		UNION ALL
-		SELECT 'user' AS type, username AS title, id AS slug FROM users
-		WHERE username LIKE ?
-	`
+	queryParams := new(model.SearchQueryParams)
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, queryParams); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(queryParams); err != nil {
+		return err
+	}
 
-	// Params
-	params := []interface{}{"%" + keyword + "%", "%" + keyword + "%", "%" + keyword + "%", "%" + keyword + "%"}
+	if queryParams.Limit < 1 {
+		queryParams.Limit = 20
+	}
 
-	rows, err := h.DB.Raw(query, params...).Rows()
+	visible, params := visibleEntries()
+	results, count, err := search.Search(h.DB, search.Query{
+		Keyword:       queryParams.Keyword,
+		Kind:          queryParams.Type,
+		EntryType:     queryParams.EntryType,
+		CitySlug:      queryParams.CitySlug,
+		EntriesWhere:  visible,
+		EntriesParams: params,
+		Limit:         queryParams.Limit,
+		Offset:        queryParams.Offset,
+	})
 	if err != nil {
+		if errors.Is(err, search.ErrEmptyQuery) {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Keyword has no words to search for."}
+		}
 		log.Println(err)
-		return err
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to search."}
 	}
 
-	defer rows.Close()
+	return c.JSON(http.StatusOK, ListResponse{Total: count, Items: results})
+}
 
-	for rows.Next() {
-		var item SearchResponseItem
-		err := rows.Scan(&item.Type, &item.Title, &item.Slug)
-		if err != nil {
-			log.Println(err)
-			return err
-		}
-		response = append(response, item)
+// Recreates the search index from entries, cities and users
+func (h *Handler) RebuildSearchIndex(c echo.Context) error {
+	if err := isAdmin(c); err != nil {
+		return err
 	}
 
-	// TODO: Handle potential error from rows.Err()
+	count, err := search.Rebuild(h.DB)
+	if err != nil {
+		log.Printf("Failed to rebuild search index: %v", err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to rebuild search index."}
+	}
 
-	return c.JSON(http.StatusOK, response)
+	return c.JSON(http.StatusOK, map[string]int64{"documents": count})
 }
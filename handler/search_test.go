@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"tbd/model"
+	"tbd/search"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A word no other entry has
+func uniqueWord() string {
+	letters := []rune("abcdefghijklmnopqrstuvwxyz")
+	word := []rune("zq")
+	for i := 0; i < 10; i++ {
+		word = append(word, letters[rand.Intn(len(letters))])
+	}
+	return string(word)
+}
+
+func withTitle(title string) func(*model.EntryItemSale) {
+	return func(itemSale *model.EntryItemSale) {
+		itemSale.Title = title
+	}
+}
+
+func searchFor(t *testing.T, query string) (int64, []search.Result) {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/search?"+query, "", nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response struct {
+		Total int64           `json:"total"`
+		Items []search.Result `json:"items"`
+	}
+	err := json.NewDecoder(rec.Body).Decode(&response)
+	assert.NoError(t, err)
+	return response.Total, response.Items
+}
+
+func TestSearchEntries(t *testing.T) {
+	token := signupAndLogin(t)
+	word := uniqueWord()
+
+	id := createItemSale(t, token, "", withTitle("Vintage "+word+" lamp"))
+	createItemSale(t, token, model.EntryStatusDraft, withTitle(word+" draft"))
+
+	total, items := searchFor(t, "keyword="+word)
+	assert.Equal(t, int64(1), total)
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, "entry", items[0].Type)
+		assert.Equal(t, id, items[0].ID)
+		assert.Equal(t, "Vintage <mark>"+word+"</mark> lamp", items[0].Highlights.Title)
+	}
+
+	// Prefix of the last word
+	total, _ = searchFor(t, "keyword=vintage+"+word[:6])
+	assert.Equal(t, int64(1), total)
+
+	total, _ = searchFor(t, "keyword="+word+"&entry_type=pet-sitter")
+	assert.Equal(t, int64(0), total)
+
+	// Updates are searchable right away
+	rec := performRequest(t, http.MethodPatch, "http://localhost:1323/entries/"+id, token, map[string]interface{}{
+		"data": itemSaleData("", withTitle("Modern lamp"))["data"],
+	})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	total, _ = searchFor(t, "keyword="+word)
+	assert.Equal(t, int64(0), total)
+}
+
+func TestSearchInvalid(t *testing.T) {
+	for _, query := range []string{"", "keyword=", "keyword=%25%25", "keyword=lamp&type=file", "keyword=lamp&limit=1000"} {
+		rec := performRequest(t, http.MethodGet, "http://localhost:1323/search?"+query, "", nil)
+		assert.Equal(t, http.StatusBadRequest, rec.StatusCode, query)
+	}
+
+	token := signupAndLogin(t)
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/admin/search/rebuild", token, nil)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+}
@@ -0,0 +1,245 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"tbd/model"
+)
+
+// User agents are cut to this length
+const sessionUserAgentMax = 255
+
+func (h *Handler) accessTokenTTL() time.Duration {
+	if h.AccessTokenTTL <= 0 {
+		return 15 * time.Minute
+	}
+	return h.AccessTokenTTL
+}
+
+func (h *Handler) refreshTokenTTL() time.Duration {
+	if h.RefreshTokenTTL <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return h.RefreshTokenTTL
+}
+
+// Assembles the access token of a session; it's valid until it expires, the session is revoked, or the user's token version changes
+func (h *Handler) signAccessToken(u model.User, sessionID string) (string, time.Time, error) {
+	expiresAt := time.Now().Add(h.accessTokenTTL())
+	claims := &model.JwtCustomClaims{
+		Roles:        strings.Join(u.Roles, ","),
+		TokenVersion: u.TokenVersion,
+		SessionID:    sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Subject:   u.ID,
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signedToken, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return signedToken, expiresAt, err
+}
+
+// Starts a session for the user, on the device of the request; the response has the access and refresh token
+func (h *Handler) startSession(c echo.Context, u model.User) (model.LoginUserReqResponse, error) {
+	refreshToken, err := model.NewSecret()
+	if err != nil {
+		return model.LoginUserReqResponse{}, err
+	}
+
+	userAgent := c.Request().UserAgent()
+	if len(userAgent) > sessionUserAgentMax {
+		userAgent = userAgent[:sessionUserAgentMax]
+	}
+
+	now := time.Now()
+	s := model.Session{
+		UserID:           u.ID,
+		RefreshTokenHash: model.HashToken(refreshToken),
+		UserAgent:        userAgent,
+		IP:               c.RealIP(),
+		ExpiresAt:        now.Add(h.refreshTokenTTL()),
+		LastUsedAt:       now,
+	}
+	if err := h.DB.Create(&s).Error; err != nil {
+		return model.LoginUserReqResponse{}, err
+	}
+
+	accessToken, expiresAt, err := h.signAccessToken(u, s.ID)
+	if err != nil {
+		return model.LoginUserReqResponse{}, err
+	}
+	return model.LoginUserReqResponse{Token: accessToken, ExpiresAt: &expiresAt, RefreshToken: refreshToken}, nil
+}
+
+// Revokes the active sessions of a user, except one if set; returns them, to deny once the transaction is committed
+func revokeSessions(tx *gorm.DB, userID, except string) ([]string, error) {
+	query := tx.Model(&model.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if except != "" {
+		query = query.Where("id <> ?", except)
+	}
+
+	ids := []string{}
+	if err := query.Session(&gorm.Session{}).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return ids, nil
+	}
+	return ids, tx.Model(&model.Session{}).Where("id IN ?", ids).Update("revoked_at", time.Now()).Error
+}
+
+// Exchanges a refresh token for a new access and refresh token; the old refresh token stops working
+// Notes:
+//   - Doesn't require a login, since the access token may have expired
+//   - Using a refresh token that was already exchanged revokes the session; someone else has it
+func (h *Handler) RefreshSession(c echo.Context) error {
+	req := model.RefreshTokenReq{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	invalid := &echo.HTTPError{Code: http.StatusUnauthorized, Message: "Invalid or expired refresh token."}
+	hash := model.HashToken(req.RefreshToken)
+
+	s := model.Session{}
+	r := h.DB.Where("refresh_token_hash = ?", hash).First(&s)
+	if r.Error != nil {
+		if r.Error != gorm.ErrRecordNotFound {
+			return &echo.HTTPError{Code: http.StatusInternalServerError}
+		}
+
+		reused := []string{}
+		if err := h.DB.Model(&model.Session{}).Where("previous_token_hash = ? AND revoked_at IS NULL", hash).Pluck("id", &reused).Error; err != nil {
+			return &echo.HTTPError{Code: http.StatusInternalServerError}
+		}
+		if len(reused) > 0 {
+			log.Println("Refresh token used twice; revoking session", reused[0])
+			if err := h.DB.Model(&model.Session{}).Where("id IN ?", reused).Update("revoked_at", time.Now()).Error; err != nil {
+				return &echo.HTTPError{Code: http.StatusInternalServerError}
+			}
+			h.Sessions.Revoke(reused...)
+		}
+		return invalid
+	}
+	if s.RevokedAt != nil || time.Now().After(s.ExpiresAt) {
+		return invalid
+	}
+
+	user := model.User{}
+	if err := h.DB.Where("id = ? AND deleted_at IS NULL", s.UserID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return invalid
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	if user.SuspendedAt != nil {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "Account suspended."}
+	}
+
+	refreshToken, err := model.NewSecret()
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+
+	// Only one request gets to exchange it
+	now := time.Now()
+	r = h.DB.Model(&model.Session{}).Where("id = ? AND refresh_token_hash = ?", s.ID, hash).Updates(map[string]interface{}{
+		"refresh_token_hash":  model.HashToken(refreshToken),
+		"previous_token_hash": hash,
+		"last_used_at":        now,
+		"expires_at":          now.Add(h.refreshTokenTTL()),
+	})
+	if r.Error != nil {
+		log.Println(r.Error)
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	if r.RowsAffected == 0 {
+		return invalid
+	}
+
+	accessToken, expiresAt, err := h.signAccessToken(user, s.ID)
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Something went wrong. Please try again later."}
+	}
+
+	return c.JSON(http.StatusOK, model.LoginUserReqResponse{Token: accessToken, ExpiresAt: &expiresAt, RefreshToken: refreshToken})
+}
+
+// Ends the session of the request; its access and refresh token stop working
+func (h *Handler) Logout(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	r := h.DB.Model(&model.Session{}).Where("id = ? AND user_id = ? AND revoked_at IS NULL", reqUser.SessionID, reqUser.ID).Update("revoked_at", time.Now())
+	if r.Error != nil {
+		log.Println(r.Error)
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	h.Sessions.Revoke(reqUser.SessionID)
+
+	return c.NoContent(http.StatusOK)
+}
+
+// Ends all sessions of the user, on every device; including this one
+func (h *Handler) LogoutAll(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	ids, err := revokeSessions(h.DB, reqUser.ID, "")
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	h.Sessions.Revoke(ids...)
+
+	return c.JSON(http.StatusOK, UpdateResponse{Updated: int64(len(ids))})
+}
+
+// Active sessions of the user, most recently used first
+func (h *Handler) FetchMySessions(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	sessions := []model.Session{}
+	r := h.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", reqUser.ID, time.Now().Local()).Order("last_used_at DESC").Find(&sessions)
+	if r.Error != nil {
+		log.Println(r.Error)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch sessions."}
+	}
+
+	items := make([]model.PublicSession, len(sessions))
+	for i, s := range sessions {
+		items[i] = s.ToPublicFormat("").(model.PublicSession)
+		items[i].Current = s.ID == reqUser.SessionID
+	}
+
+	return c.JSON(http.StatusOK, ListResponse{Total: int64(len(items)), Items: items})
+}
+
+// Ends one session of the user; for ex. on a lost device
+func (h *Handler) RevokeSession(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	r := h.DB.Model(&model.Session{}).Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), reqUser.ID).Update("revoked_at", time.Now())
+	if r.Error != nil {
+		log.Println(r.Error)
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	if r.RowsAffected == 0 {
+		return &echo.HTTPError{Code: http.StatusNotFound, Message: "Session not found."}
+	}
+	h.Sessions.Revoke(c.Param("id"))
+
+	return c.JSON(http.StatusOK, DeleteResponse{Deleted: r.RowsAffected})
+}
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/icrowley/fake"
+	"github.com/stretchr/testify/assert"
+
+	"tbd/model"
+)
+
+func loginSession(t *testing.T, email string) model.LoginUserReqResponse {
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/login", "", model.LoginUserReq{Email: email, Password: "password123"})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response model.LoginUserReqResponse
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	return response
+}
+
+func refreshSession(t *testing.T, refreshToken string) (int, model.LoginUserReqResponse) {
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/refresh", "", model.RefreshTokenReq{RefreshToken: refreshToken})
+
+	var response model.LoginUserReqResponse
+	if rec.StatusCode == http.StatusOK {
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	}
+	return rec.StatusCode, response
+}
+
+func fetchSessions(t *testing.T, token string) []model.PublicSession {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/account/sessions", token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response struct {
+		Items []model.PublicSession `json:"items"`
+	}
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	return response.Items
+}
+
+func meStatus(t *testing.T, token string) int {
+	return performRequest(t, http.MethodGet, "http://localhost:1323/account/me", token, nil).StatusCode
+}
+
+func TestSessions(t *testing.T) {
+	email := strings.ToLower(fake.EmailAddress())
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/signup", "", model.SignupUserReq{Name: fake.FullName(), Email: email, Password: "password123"})
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+
+	phone := loginSession(t, email)
+	laptop := loginSession(t, email)
+	assert.NotEmpty(t, phone.RefreshToken)
+	assert.NotNil(t, phone.ExpiresAt)
+
+	sessions := fetchSessions(t, phone.Token)
+	if assert.Len(t, sessions, 2) {
+		current := 0
+		for _, s := range sessions {
+			if s.Current {
+				current++
+			}
+			assert.NotEmpty(t, s.UserAgent)
+		}
+		assert.Equal(t, 1, current)
+	}
+
+	// Refresh tokens work once; using one again revokes the session
+	status, refreshed := refreshSession(t, phone.RefreshToken)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEqual(t, phone.RefreshToken, refreshed.RefreshToken)
+	assert.Equal(t, http.StatusOK, meStatus(t, refreshed.Token))
+
+	status, _ = refreshSession(t, phone.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, http.StatusUnauthorized, meStatus(t, refreshed.Token))
+	status, _ = refreshSession(t, refreshed.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Len(t, fetchSessions(t, laptop.Token), 1)
+
+	// Logging out ends one session
+	tablet := loginSession(t, email)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/logout", tablet.Token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, meStatus(t, tablet.Token))
+	status, _ = refreshSession(t, tablet.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, http.StatusOK, meStatus(t, laptop.Token))
+
+	// Only your own sessions
+	otherToken := signupAndLogin(t)
+	sessions = fetchSessions(t, laptop.Token)
+	rec = performRequest(t, http.MethodDelete, "http://localhost:1323/account/sessions/"+sessions[0].ID, otherToken, nil)
+	assert.Equal(t, http.StatusNotFound, rec.StatusCode)
+
+	desktop := loginSession(t, email)
+	rec = performRequest(t, http.MethodDelete, "http://localhost:1323/account/sessions/"+sessions[0].ID, desktop.Token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, meStatus(t, laptop.Token))
+
+	// And everywhere
+	other := loginSession(t, email)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/logout/all", desktop.Token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, meStatus(t, desktop.Token))
+	assert.Equal(t, http.StatusUnauthorized, meStatus(t, other.Token))
+}
+
+func TestSessionsOfDeletedUser(t *testing.T) {
+	email := strings.ToLower(fake.EmailAddress())
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/signup", "", model.SignupUserReq{Name: fake.FullName(), Email: email, Password: "password123"})
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+	login := loginSession(t, email)
+
+	rec = performRequest(t, http.MethodDelete, "http://localhost:1323/users/"+myUserID(t, login.Token), login.Token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	assert.Equal(t, http.StatusUnauthorized, meStatus(t, login.Token))
+	status, _ := refreshSession(t, login.RefreshToken)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
@@ -0,0 +1,400 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"tbd/model"
+	"tbd/pgp"
+	"tbd/totp"
+)
+
+// Login challenges are valid this long, for this many wrong codes; then users login again
+const (
+	loginChallengeTTL      = 5 * time.Minute
+	loginChallengeAttempts = 5
+)
+
+var errInvalidTwoFactorCode = &echo.HTTPError{Code: http.StatusBadRequest, Message: "Invalid code."}
+
+// TOTP codes are digits only; anything else may be a recovery code
+func isTOTPCode(code string) bool {
+	if len(code) != totp.Digits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// The TOTP secret of the user, decrypted with their key
+func totpSecret(user model.User) (string, error) {
+	return pgp.DecryptMessage(user.TOTPSecret, user.PrivateKey, []byte(os.Getenv("PGP_PASSPHRASE")))
+}
+
+// Checks a TOTP code of the user, or one of their recovery codes if allowed; either works once
+func checkTwoFactorCode(tx *gorm.DB, user model.User, code string, allowRecovery bool) (bool, error) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+
+	if isTOTPCode(code) {
+		secret, err := totpSecret(user)
+		if err != nil {
+			return false, err
+		}
+		step, ok := totp.Validate(secret, code, time.Now(), user.TOTPLastStep)
+		if !ok {
+			return false, nil
+		}
+
+		// Only one request gets to use it
+		r := tx.Model(&model.User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).Update("totp_last_step", step)
+		return r.RowsAffected > 0, r.Error
+	}
+
+	if !allowRecovery {
+		return false, nil
+	}
+	r := tx.Model(&model.RecoveryCode{}).Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, model.HashRecoveryCode(code)).Update("used_at", time.Now())
+	return r.RowsAffected > 0, r.Error
+}
+
+// Replaces the recovery codes of the user; returns the new ones, to show once
+func replaceRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	recoveryCodes, codes, err := model.NewRecoveryCodes(userID, model.RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&recoveryCodes).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Runs fn in a transaction; HTTP errors it returns are passed on, others logged
+func (h *Handler) twoFactorTransaction(fn func(tx *gorm.DB) error) error {
+	err := h.DB.Transaction(fn)
+	if err != nil {
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			return httpErr
+		}
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	return nil
+}
+
+// Answers a login with a token for the second step, instead of a session
+func (h *Handler) startLoginChallenge(c echo.Context, u model.User) error {
+	userToken, token, err := model.NewUserToken(u.ID, model.UserTokenLoginChallenge, loginChallengeTTL)
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Something went wrong. Please try again later."}
+	}
+	if err := h.DB.Create(&userToken).Error; err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Something went wrong. Please try again later."}
+	}
+
+	return c.JSON(http.StatusAccepted, model.LoginUserReqResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    token,
+		ExpiresAt:         &userToken.ExpiresAt,
+	})
+}
+
+// The second step of a login with two-factor authentication: the challenge token, and a TOTP or recovery code
+// Notes:
+//   - Doesn't require a login; it completes one
+//   - Challenges work once; after 5 wrong codes, or 5 minutes, users login again
+func (h *Handler) LoginTwoFactor(c echo.Context) error {
+	req := model.LoginTwoFactorReq{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	invalid := &echo.HTTPError{Code: http.StatusUnauthorized, Message: "Invalid or expired challenge. Please login again."}
+
+	challenge := model.UserToken{}
+	r := h.DB.Where("token_hash = ? AND purpose = ?", model.HashToken(req.ChallengeToken), model.UserTokenLoginChallenge).First(&challenge)
+	if r.Error != nil {
+		if r.Error == gorm.ErrRecordNotFound {
+			return invalid
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	if challenge.UsedAt != nil || challenge.Attempts >= loginChallengeAttempts || time.Now().After(challenge.ExpiresAt) {
+		return invalid
+	}
+
+	user := model.User{}
+	if err := h.DB.Where("id = ? AND deleted_at IS NULL", challenge.UserID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return invalid
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	if user.SuspendedAt != nil {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "Account suspended."}
+	}
+	if user.TOTPEnabledAt == nil {
+		return invalid
+	}
+
+	err := h.twoFactorTransaction(func(tx *gorm.DB) error {
+		ok, err := checkTwoFactorCode(tx, user, req.Code, true)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+
+		// Only one request gets to use it
+		r := tx.Model(&model.UserToken{}).Where("id = ? AND used_at IS NULL", challenge.ID).Update("used_at", time.Now())
+		if r.Error != nil {
+			return r.Error
+		}
+		if r.RowsAffected == 0 {
+			return invalid
+		}
+		return nil
+	})
+	if err == errInvalidTwoFactorCode {
+		if err := h.DB.Model(&model.UserToken{}).Where("id = ?", challenge.ID).Update("attempts", gorm.Expr("attempts + 1")).Error; err != nil {
+			log.Println(err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	response, err := h.startSession(c, user)
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Something went wrong. Please try again later."}
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) twoFactorUser(c echo.Context) (model.User, error) {
+	reqUser := c.Get("user").(*model.AuthUser)
+
+	user := model.User{}
+	if err := h.DB.Where("id = ?", reqUser.ID).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return user, &echo.HTTPError{Code: http.StatusNotFound, Message: "User not found."}
+		}
+		return user, &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	return user, nil
+}
+
+// Whether two-factor authentication is enabled, and how many recovery codes are left
+func (h *Handler) FetchTwoFactor(c echo.Context) error {
+	user, err := h.twoFactorUser(c)
+	if err != nil {
+		return err
+	}
+
+	status := model.TwoFactorStatus{Enabled: user.TOTPEnabledAt != nil, EnabledAt: user.TOTPEnabledAt}
+	if status.Enabled {
+		r := h.DB.Model(&model.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&status.RecoveryCodesLeft)
+		if r.Error != nil {
+			log.Println(r.Error)
+			return &echo.HTTPError{Code: http.StatusInternalServerError}
+		}
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
+
+// Starts enrolling an authenticator app; the response has the secret, and the URI to show as QR code
+// Notes:
+//   - It's enabled once the user confirms a code from the app; setting up again replaces the secret until then
+//   - The secret is stored encrypted to the user's own key
+func (h *Handler) SetupTwoFactor(c echo.Context) error {
+	user, err := h.twoFactorUser(c)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt != nil {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Two-factor authentication is already enabled."}
+	}
+	if user.PublicKey == "" {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "The account has no keys to protect the secret with."}
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+	encrypted, err := pgp.EncryptMessage(secret, []string{user.PublicKey})
+	if err != nil {
+		log.Println(err)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Something went wrong. Please try again later."}
+	}
+
+	r := h.DB.Model(&model.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"totp_secret":    encrypted,
+		"totp_last_step": 0,
+	})
+	if r.Error != nil {
+		log.Println(r.Error)
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+
+	account := user.Username
+	if user.Email != nil && *user.Email != "" {
+		account = *user.Email
+	}
+	domain := os.Getenv("DOMAIN")
+
+	return c.JSON(http.StatusOK, model.TwoFactorSetupResponse{Secret: secret, URI: totp.ProvisioningURI(secret, domain, account)})
+}
+
+// Enables two-factor authentication with a code from the app; the response has the recovery codes
+func (h *Handler) ConfirmTwoFactor(c echo.Context) error {
+	req := model.TwoFactorCodeReq{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	user, err := h.twoFactorUser(c)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt != nil {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Two-factor authentication is already enabled."}
+	}
+	if user.TOTPSecret == "" {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Set up two-factor authentication first."}
+	}
+
+	codes := []string{}
+	err = h.twoFactorTransaction(func(tx *gorm.DB) error {
+		ok, err := checkTwoFactorCode(tx, user, req.Code, false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+
+		if err := tx.Model(&model.User{}).Where("id = ?", user.ID).Update("totp_enabled_at", time.Now()).Error; err != nil {
+			return err
+		}
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, model.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// Turns two-factor authentication off; takes the password, and a TOTP or recovery code
+func (h *Handler) DisableTwoFactor(c echo.Context) error {
+	req := model.DisableTwoFactorReq{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	user, err := h.twoFactorUser(c)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt == nil {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Two-factor authentication isn't enabled."}
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		return &echo.HTTPError{Code: http.StatusBadRequest, Message: "Password is incorrect."}
+	}
+
+	err = h.twoFactorTransaction(func(tx *gorm.DB) error {
+		ok, err := checkTwoFactorCode(tx, user, req.Code, true)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+
+		err = tx.Model(&model.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&model.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// New recovery codes, with a code from the app; the earlier ones stop working
+func (h *Handler) RegenerateRecoveryCodes(c echo.Context) error {
+	req := model.TwoFactorCodeReq{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	user, err := h.twoFactorUser(c)
+	if err != nil {
+		return err
+	}
+	if user.TOTPEnabledAt == nil {
+		return &echo.HTTPError{Code: http.StatusConflict, Message: "Two-factor authentication isn't enabled."}
+	}
+
+	codes := []string{}
+	err = h.twoFactorTransaction(func(tx *gorm.DB) error {
+		ok, err := checkTwoFactorCode(tx, user, req.Code, false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidTwoFactorCode
+		}
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, model.RecoveryCodesResponse{RecoveryCodes: codes})
+}
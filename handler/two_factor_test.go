@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icrowley/fake"
+	"github.com/stretchr/testify/assert"
+
+	"tbd/model"
+	"tbd/totp"
+)
+
+func totpCode(t *testing.T, secret string, steps int64) string {
+	code, err := totp.Code(secret, totp.Step(time.Now())+steps)
+	assert.NoError(t, err)
+	return code
+}
+
+func fetchTwoFactor(t *testing.T, token string) model.TwoFactorStatus {
+	rec := performRequest(t, http.MethodGet, "http://localhost:1323/account/2fa", token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var status model.TwoFactorStatus
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&status))
+	return status
+}
+
+func recoveryCodes(t *testing.T, rec *http.Response) []string {
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	var response model.RecoveryCodesResponse
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.Len(t, response.RecoveryCodes, model.RecoveryCodeCount)
+	return response.RecoveryCodes
+}
+
+func loginChallenge(t *testing.T, email string) string {
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/login", "", model.LoginUserReq{Email: email, Password: "password123"})
+	assert.Equal(t, http.StatusAccepted, rec.StatusCode)
+
+	var response model.LoginUserReqResponse
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	assert.True(t, response.TwoFactorRequired)
+	assert.Empty(t, response.Token)
+	assert.NotEmpty(t, response.ChallengeToken)
+	return response.ChallengeToken
+}
+
+func loginTwoFactor(t *testing.T, challengeToken, code string) (int, model.LoginUserReqResponse) {
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/login/2fa", "", model.LoginTwoFactorReq{ChallengeToken: challengeToken, Code: code})
+
+	var response model.LoginUserReqResponse
+	if rec.StatusCode == http.StatusOK {
+		assert.NoError(t, json.NewDecoder(rec.Body).Decode(&response))
+	}
+	return rec.StatusCode, response
+}
+
+func TestTwoFactor(t *testing.T) {
+	email := strings.ToLower(fake.EmailAddress())
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/signup", "", model.SignupUserReq{Name: fake.FullName(), Email: email, Password: "password123"})
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+	token := loginSession(t, email).Token
+
+	assert.False(t, fetchTwoFactor(t, token).Enabled)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/2fa/confirm", token, model.TwoFactorCodeReq{Code: "123456"})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/2fa/setup", token, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	var setup model.TwoFactorSetupResponse
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&setup))
+	assert.NotEmpty(t, setup.Secret)
+	assert.True(t, strings.HasPrefix(setup.URI, "otpauth://totp/"))
+	assert.Contains(t, setup.URI, "secret="+setup.Secret)
+
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/2fa/confirm", token, model.TwoFactorCodeReq{Code: totpCode(t, setup.Secret, -10)})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/2fa/confirm", token, model.TwoFactorCodeReq{Code: totpCode(t, setup.Secret, 0)})
+	firstCodes := recoveryCodes(t, rec)
+
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/2fa/setup", token, nil)
+	assert.Equal(t, http.StatusConflict, rec.StatusCode)
+
+	// Codes work once
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/2fa/recovery-codes", token, model.TwoFactorCodeReq{Code: totpCode(t, setup.Secret, 0)})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/2fa/recovery-codes", token, model.TwoFactorCodeReq{Code: totpCode(t, setup.Secret, 1)})
+	codes := recoveryCodes(t, rec)
+
+	// Logins take a code now; earlier recovery codes stopped working
+	challenge := loginChallenge(t, email)
+	status, _ := loginTwoFactor(t, challenge, firstCodes[0])
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, login := loginTwoFactor(t, challenge, strings.ToUpper(codes[0]))
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotEmpty(t, login.RefreshToken)
+	assert.Equal(t, http.StatusOK, meStatus(t, login.Token))
+
+	status, _ = loginTwoFactor(t, challenge, codes[1])
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// Recovery codes work once, and challenges for a few wrong codes
+	challenge = loginChallenge(t, email)
+	for i := 0; i < 5; i++ {
+		status, _ = loginTwoFactor(t, challenge, codes[0])
+		assert.Equal(t, http.StatusBadRequest, status)
+	}
+	status, _ = loginTwoFactor(t, challenge, codes[1])
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, _ = loginTwoFactor(t, strings.Repeat("0", 64), codes[1])
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	twoFactor := fetchTwoFactor(t, token)
+	assert.True(t, twoFactor.Enabled)
+	assert.Equal(t, int64(model.RecoveryCodeCount-1), twoFactor.RecoveryCodesLeft)
+
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/2fa/disable", token, model.DisableTwoFactorReq{Password: "password1234", Code: codes[1]})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/account/2fa/disable", token, model.DisableTwoFactorReq{Password: "password123", Code: codes[1]})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	assert.False(t, fetchTwoFactor(t, token).Enabled)
+	assert.NotEmpty(t, loginSession(t, email).Token)
+}
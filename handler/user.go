@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
@@ -11,7 +12,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/jaswdr/faker"
 	"github.com/labstack/echo/v4"
@@ -22,32 +22,61 @@ import (
 	"tbd/model"
 )
 
+// Sorted by newest (default), oldest or username
 func (h *Handler) FetchUsers(c echo.Context) error {
-	offset, _ := strconv.Atoi(c.QueryParam("page"))
-	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	sorts := creationSorts("users")
+	sorts["username"] = sortOrder{name: "username", keys: []sortKey{{expr: "users.username"}, {expr: "users.id"}}}
 
-	// Defaults
-	if offset == 0 {
-		offset = 1
+	page, order, after, err := bindPage(c, sorts, "newest")
+	if err != nil {
+		return err
+	}
+
+	// Page numbers are only used without a cursor
+	pageNumber, _ := strconv.Atoi(c.QueryParam("page"))
+	if pageNumber < 1 || after != nil {
+		pageNumber = 1
 	}
-	if limit == 0 {
-		limit = 100
+
+	// A session, so counting doesn't change the query
+	query := h.DB.Model(&model.User{}).Session(&gorm.Session{})
+
+	response := PageResponse{}
+	if page.Total {
+		var count int64
+		if err := query.Count(&count).Error; err != nil {
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch users."}
+		}
+		response.Total = &count
+	}
+
+	if after != nil {
+		params := []interface{}{}
+		query = query.Where(order.after(after, &params), params...)
 	}
 
-	count := int64(0)
 	users := []model.User{}
-	r := h.DB.Model(&model.User{}).
-		Order("created_at desc").
-		Count(&count).
+	r := query.
+		Order(order.orderBy()).
 		Preload("Image").
-		Offset((offset - 1) * limit).
-		Limit(limit).
+		Offset((pageNumber - 1) * page.Limit).
+		Limit(page.Limit + 1).
 		Find(&users)
 	if r.Error != nil {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch users."}
 	}
 
-	return c.JSON(http.StatusOK, ListResponse{Total: int64(count), Items: responseArrFormatter[model.User](users, nil, os.Getenv("DOMAIN"))})
+	if len(users) > page.Limit {
+		users = users[:page.Limit]
+		response.NextCursor, err = h.nextCursor(order, "users", "users.id", users[len(users)-1].ID)
+		if err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to fetch users."}
+		}
+	}
+
+	response.Items = responseArrFormatter[model.User](users, nil, os.Getenv("DOMAIN"))
+	return c.JSON(http.StatusOK, response)
 }
 
 func (h *Handler) FetchUser(c echo.Context) error {
@@ -79,10 +108,21 @@ func (h *Handler) DeleteUser(c echo.Context) error {
 
 	var user = model.User{ID: id}
 
-	r := h.DB.Delete(&user)
-	if r.Error != nil {
+	// Deleted users are logged out everywhere
+	revoked := []string{}
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&user).Error; err != nil {
+			return err
+		}
+		ids, err := revokeSessions(tx, id, "")
+		revoked = ids
+		return err
+	})
+	if err != nil {
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to delete user."}
 	}
+	h.Sessions.Revoke(revoked...)
+	h.Accounts.Invalidate(id)
 
 	// TODO: Delete user's entries, files, etc.
 
@@ -133,7 +173,7 @@ func (h *Handler) Signup(c echo.Context) error {
 		return &echo.HTTPError{Code: http.StatusInternalServerError}
 	}
 
-	// TODO: Set unconfirmed until email or phone is confirmed
+	// Unconfirmed until the email is confirmed with the token we send
 	newUser := model.User{
 		Roles:    []string{"member"},
 		Password: string(hash),
@@ -143,12 +183,12 @@ func (h *Handler) Signup(c echo.Context) error {
 		newUser.Name = &u.Name
 	}
 
-	if u.Email == "" {
-		newUser.Email = nil
+	if u.Email != "" {
+		newUser.Email = &u.Email
 	}
 
 	if u.Phone != "" {
-		newUser.Phone = nil
+		newUser.Phone = &u.Phone
 	}
 
 	usernameIsUnique := false
@@ -177,23 +217,21 @@ func (h *Handler) Signup(c echo.Context) error {
 
 	r := h.DB.Create(&newUser)
 	if r.Error != nil {
-		// r.Error == gorm.ErrDuplicatedKey is not getting caught
-		if (r.Error).Error() == "UNIQUE constraint failed: users.username" {
-			log.Println(fmt.Sprintf("Username %s already exists", u.Username))
-			return &echo.HTTPError{Code: http.StatusConflict, Message: "User already exists. Reset password?"}
-		}
-		if (r.Error).Error() == "UNIQUE constraint failed: users.email" {
-			log.Println(fmt.Sprintf("Email %s already exists", u.Email))
-			return &echo.HTTPError{Code: http.StatusConflict, Message: "User already exists. Reset password?"}
-		}
-		if (r.Error).Error() == "UNIQUE constraint failed: users.phone" {
-			log.Println(fmt.Sprintf("Phone %s already exists", u.Phone))
+		// Username, email or phone is taken; requires TranslateError on the DB config
+		if errors.Is(r.Error, gorm.ErrDuplicatedKey) {
+			log.Println(fmt.Sprintf("User %s / %s / %s already exists", newUser.Username, u.Email, u.Phone))
 			return &echo.HTTPError{Code: http.StatusConflict, Message: "User already exists. Reset password?"}
 		}
 
+		log.Println(r.Error)
 		return &echo.HTTPError{Code: http.StatusInternalServerError}
 	}
 
+	// The user can ask for another token, if this one doesn't arrive
+	if err := h.sendEmailVerification(c.Request().Context(), newUser); err != nil {
+		log.Println(err)
+	}
+
 	return c.JSON(http.StatusCreated, newUser.ToUserPrivateFormat(os.Getenv("DOMAIN")))
 }
 
@@ -228,7 +266,7 @@ func (h *Handler) Login(c echo.Context) error {
 		}
 	}
 
-	// TODO: Check if user IsConfirmed
+	// Unconfirmed users can login; they may be kept from posting, see RequireConfirmedEmail
 	u := model.User{}
 
 	query := h.DB.Where("username = ?", model.StripUsername(f.Username))
@@ -237,6 +275,7 @@ func (h *Handler) Login(c echo.Context) error {
 	} else if loginType == "phone" {
 		query = h.DB.Where("phone = ?", model.StripPhone(f.Phone))
 	}
+	query = query.Where("deleted_at IS NULL")
 
 	r := query.First(&u)
 	if r.Error != nil {
@@ -254,23 +293,22 @@ func (h *Handler) Login(c echo.Context) error {
 		return &echo.HTTPError{Code: http.StatusUnauthorized, Message: fmt.Sprintf("Invalid %s or password.", loginType)}
 	}
 
-	// Assemble JWT
-	claims := &model.JwtCustomClaims{
-		Roles: strings.Join(u.Roles, ","),
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 72)),
-			Subject:   u.ID,
-		},
+	if u.SuspendedAt != nil {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "Account suspended."}
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	// The session starts once they entered a code, at /login/2fa
+	if u.TOTPEnabledAt != nil {
+		return h.startLoginChallenge(c, u)
+	}
 
-	signedToken, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	response, err := h.startSession(c, u)
 	if err != nil {
+		log.Println(err)
 		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Something went wrong. Please try again later."}
 	}
 
-	return c.JSON(http.StatusOK, model.LoginUserReqResponse{Token: signedToken})
+	return c.JSON(http.StatusOK, response)
 }
 
 func (h *Handler) Me(c echo.Context) error {
@@ -322,8 +360,78 @@ func (h *Handler) UpdateMe(c echo.Context) error {
 			return &echo.HTTPError{Code: http.StatusInternalServerError}
 		}
 
+		if err := h.markFilesAsProvisioned([]model.File{*nu.Image}); err != nil {
+			log.Println(err)
+			return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to mark image as provisioned."}
+		}
+
 		// TODO: Delete current image
 	}
 
 	return c.JSON(http.StatusOK, UpdateResponse{Updated: 1})
 }
+
+// Changes the roles of a user, or suspends them; takes effect on their next request
+// Notes:
+//   - Admins can't take their own admin role, or suspend themselves
+//   - Suspended users keep their sessions, so lifting it lets them back in
+func (h *Handler) UpdateUserAccount(c echo.Context) error {
+	reqUser := c.Get("user").(*model.AuthUser)
+	if !reqUser.IsAdmin {
+		return &echo.HTTPError{Code: http.StatusForbidden, Message: "Only admins can change accounts."}
+	}
+
+	req := model.UpdateUserAccountReq{}
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := c.Validate(&req); err != nil {
+		return err
+	}
+
+	id := c.Param("id")
+	if id == reqUser.ID {
+		if req.Suspended != nil && *req.Suspended {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "You can't suspend yourself."}
+		}
+		if req.Roles != nil && !model.HasRole(*req.Roles, "admin") {
+			return &echo.HTTPError{Code: http.StatusBadRequest, Message: "You can't remove your own admin role."}
+		}
+	}
+
+	user := model.User{}
+	if err := h.DB.Where("id = ? AND deleted_at IS NULL", id).First(&user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return &echo.HTTPError{Code: http.StatusNotFound, Message: "User not found."}
+		}
+		return &echo.HTTPError{Code: http.StatusInternalServerError}
+	}
+
+	updateData := map[string]interface{}{}
+	if req.Roles != nil {
+		roles, err := json.Marshal(*req.Roles)
+		if err != nil {
+			return &echo.HTTPError{Code: http.StatusInternalServerError}
+		}
+		updateData["roles"] = string(roles)
+	}
+	if req.Suspended != nil {
+		if *req.Suspended && user.SuspendedAt == nil {
+			updateData["suspended_at"] = time.Now()
+		} else if !*req.Suspended {
+			updateData["suspended_at"] = nil
+		}
+	}
+	if len(updateData) == 0 {
+		return c.JSON(http.StatusOK, UpdateResponse{Updated: 0})
+	}
+
+	r := h.DB.Model(&model.User{}).Where("id = ?", id).Updates(updateData)
+	if r.Error != nil {
+		log.Println(r.Error)
+		return &echo.HTTPError{Code: http.StatusInternalServerError, Message: "Failed to update user."}
+	}
+	h.Accounts.Invalidate(id)
+
+	return c.JSON(http.StatusOK, UpdateResponse{Updated: r.RowsAffected})
+}
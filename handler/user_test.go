@@ -5,10 +5,15 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/icrowley/fake"
 	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 
 	"tbd/model"
 )
@@ -354,3 +359,67 @@ func TestUserDeleteAnother(t *testing.T) {
 	// Assertions for attempting to delete another user's profile
 	assert.Equal(t, http.StatusForbidden, deleteRec.StatusCode)
 }
+
+// Signs up an admin; there's no endpoint to make the first one, so it's set in the database of DB_PATH
+// Requires the server to run with the sqlite driver and the same DB_PATH
+func signupAdmin(t *testing.T) (string, string) {
+	if os.Getenv("DB_PATH") == "" {
+		t.Skip("DB_PATH is not set; start the server and the tests with the same DB_PATH")
+	}
+
+	email := strings.ToLower(fake.EmailAddress())
+	rec := performRequest(t, http.MethodPost, "http://localhost:1323/signup", "", model.SignupUserReq{Name: fake.FullName(), Email: email, Password: "password123"})
+	assert.Equal(t, http.StatusCreated, rec.StatusCode)
+	var user model.PrivateUser
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&user))
+
+	db, err := gorm.Open(sqlite.Open(os.Getenv("DB_PATH")), &gorm.Config{Logger: logger.Discard})
+	assert.NoError(t, err)
+	assert.NoError(t, db.Model(&model.User{}).Where("id = ?", user.ID).Update("roles", `["member","admin"]`).Error)
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+
+	return loginSession(t, email).Token, user.ID
+}
+
+func TestUpdateUserAccount(t *testing.T) {
+	adminToken, adminID := signupAdmin(t)
+	memberToken := signupAndLogin(t)
+	memberID := myUserID(t, memberToken)
+
+	// Members can't change accounts
+	rec := performRequest(t, http.MethodPatch, "http://localhost:1323/admin/users/"+adminID, memberToken, map[string]interface{}{"roles": []string{"member"}})
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+	rec = performRequest(t, http.MethodPost, "http://localhost:1323/admin/search/rebuild", memberToken, nil)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+
+	rec = performRequest(t, http.MethodPatch, "http://localhost:1323/admin/users/"+adminID, adminToken, map[string]interface{}{"roles": []string{"member"}})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+	rec = performRequest(t, http.MethodPatch, "http://localhost:1323/admin/users/"+adminID, adminToken, map[string]interface{}{"suspended": true})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+	rec = performRequest(t, http.MethodPatch, "http://localhost:1323/admin/users/"+memberID, adminToken, map[string]interface{}{"roles": []string{"owner"}})
+	assert.Equal(t, http.StatusBadRequest, rec.StatusCode)
+	rec = performRequest(t, http.MethodPatch, "http://localhost:1323/admin/users/6ec84364-931e-4e8b-a5ec-5d4f68e4a1ba", adminToken, map[string]interface{}{"suspended": true})
+	assert.Equal(t, http.StatusNotFound, rec.StatusCode)
+
+	// Promoted members are admins with the token they have
+	rec = performRequest(t, http.MethodPatch, "http://localhost:1323/admin/users/"+memberID, adminToken, map[string]interface{}{"roles": []string{"member", "admin"}})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/admin/files/reaper", memberToken, nil)
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+
+	// And demoted right away
+	rec = performRequest(t, http.MethodPatch, "http://localhost:1323/admin/users/"+memberID, adminToken, map[string]interface{}{"roles": []string{"member"}})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	rec = performRequest(t, http.MethodGet, "http://localhost:1323/admin/files/reaper", memberToken, nil)
+	assert.Equal(t, http.StatusForbidden, rec.StatusCode)
+
+	// Suspended users are refused, with the tokens they have and at login
+	rec = performRequest(t, http.MethodPatch, "http://localhost:1323/admin/users/"+memberID, adminToken, map[string]interface{}{"suspended": true})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.Equal(t, http.StatusForbidden, meStatus(t, memberToken))
+
+	rec = performRequest(t, http.MethodPatch, "http://localhost:1323/admin/users/"+memberID, adminToken, map[string]interface{}{"suspended": false})
+	assert.Equal(t, http.StatusOK, rec.StatusCode)
+	assert.Equal(t, http.StatusOK, meStatus(t, memberToken))
+}
@@ -11,7 +11,12 @@ import (
 )
 
 // This returns a HTTP errror if anything goes wrong; to be used directly in the handler
+// Once the authorization middleware resolved the user, it's that one, with their current roles; otherwise the roles of the token
 func UserFromContext(c echo.Context) (model.AuthUser, error) {
+	if resolved, ok := c.Get("user").(*model.AuthUser); ok && resolved != nil {
+		return *resolved, nil
+	}
+
 	user := c.Get("user_auth")
 	if user == nil {
 		return model.AuthUser{}, fmt.Errorf("user not found in context")
@@ -38,9 +43,11 @@ func UserFromContext(c echo.Context) (model.AuthUser, error) {
 	}
 
 	u := model.AuthUser{
-		ID:      id.String(),
-		Roles:   strings.Split(claims.Roles, ","),
-		IsAdmin: isAdmin,
+		ID:           id.String(),
+		Roles:        strings.Split(claims.Roles, ","),
+		IsAdmin:      isAdmin,
+		TokenVersion: claims.TokenVersion,
+		SessionID:    claims.SessionID,
 	}
 
 	return u, nil
@@ -32,14 +32,14 @@ func (h *Handler) FetchVotes(c echo.Context) error {
 		Down int `json:"down"`
 	}
 
-	target := "EntryID"
+	target := "entry_id"
 	if tp == "comment" {
-		target = "CommentID"
+		target = "comment_id"
 	}
 	query := fmt.Sprintf(`
 	SELECT 
-		SUM(CASE WHEN Vote = 0 THEN 1 ELSE 0 END) as up, 
-		SUM(CASE WHEN Vote = 1 THEN 1 ELSE 0 END) as down 
+		COALESCE(SUM(CASE WHEN vote = 0 THEN 1 ELSE 0 END), 0) as up, 
+		COALESCE(SUM(CASE WHEN vote = 1 THEN 1 ELSE 0 END), 0) as down 
 	FROM votes 
 	WHERE %v = ?`, target)
 	var result Result
@@ -51,6 +51,9 @@ func (h *Handler) FetchVotes(c echo.Context) error {
 
 func (h *Handler) CastVote(c echo.Context) error {
 	reqUser := c.Get("user").(*model.AuthUser)
+	if err := h.requireConfirmedEmail(*reqUser); err != nil {
+		return err
+	}
 
 	v := model.CastVote{}
 	if err := c.Bind(&v); err != nil {
@@ -97,12 +100,17 @@ func (h *Handler) CastVote(c echo.Context) error {
 		}
 	}
 
-	err := h.DB.Create(&model.Vote{
+	vote := model.Vote{
 		Vote:        v.Vote,
 		CreatedByID: reqUser.ID,
-		EntryID:     v.EntryID,
-		CommentID:   v.CommentID,
-	}).Error
+	}
+	if v.EntryID != "" {
+		vote.EntryID = &v.EntryID
+	} else {
+		vote.CommentID = &v.CommentID
+	}
+
+	err := h.DB.Create(&vote).Error
 
 	if err != nil {
 		return &echo.HTTPError{
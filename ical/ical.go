@@ -0,0 +1,104 @@
+package ical
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// A VEVENT; only what's needed to exchange busy periods
+// End is exclusive; for all-day events it's the day after the last day
+type Event struct {
+	UID     string
+	Summary string
+	Start   time.Time
+	End     time.Time
+	AllDay  bool
+}
+
+const (
+	dateFormat     = "20060102"
+	dateTimeFormat = "20060102T150405Z"
+)
+
+// Writes a VCALENDAR (RFC 5545) with the given events
+func Encode(w io.Writer, prodID string, events []Event) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:" + escapeText(prodID),
+		"CALSCALE:GREGORIAN",
+	}
+
+	stamp := time.Now().UTC().Format(dateTimeFormat)
+	for _, e := range events {
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+escapeText(e.UID),
+			"DTSTAMP:"+stamp,
+		)
+		if e.AllDay {
+			lines = append(lines,
+				"DTSTART;VALUE=DATE:"+e.Start.Format(dateFormat),
+				"DTEND;VALUE=DATE:"+e.End.Format(dateFormat),
+			)
+		} else {
+			lines = append(lines,
+				"DTSTART:"+e.Start.UTC().Format(dateTimeFormat),
+				"DTEND:"+e.End.UTC().Format(dateTimeFormat),
+			)
+		}
+		lines = append(lines,
+			"SUMMARY:"+escapeText(e.Summary),
+			"TRANSP:OPAQUE",
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, fold(line)+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+func unescapeText(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n").Replace(s)
+}
+
+// Lines longer than 75 octets are split; continuation lines start with a space
+// Never splits inside a multi-byte character
+func fold(line string) string {
+	if len(line) <= 75 {
+		return line
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range line {
+		size := len(string(r))
+		if n+size > 75 {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += size
+	}
+	return b.String()
+}
+
+type ParseError struct {
+	Line    int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("ical: line %d: %s", e.Line, e.Message)
+}
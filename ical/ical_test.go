@@ -0,0 +1,82 @@
+package ical_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"tbd/ical"
+)
+
+func TestEncodeAndParse(t *testing.T) {
+	events := []ical.Event{
+		{
+			UID:     "reservation-1@example.com",
+			Summary: "Reserved; see notes, thanks",
+			Start:   time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC),
+			End:     time.Date(2026, 5, 4, 0, 0, 0, 0, time.UTC),
+			AllDay:  true,
+		},
+		{
+			UID:     "block-1@example.com",
+			Summary: strings.Repeat("Blocked ", 20),
+			Start:   time.Date(2026, 5, 10, 14, 30, 0, 0, time.UTC),
+			End:     time.Date(2026, 5, 10, 18, 0, 0, 0, time.UTC),
+		},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, ical.Encode(&buf, "-//tbd//example.com//EN", events))
+
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+	}
+
+	parsed, err := ical.Parse(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, events, parsed)
+}
+
+func TestParse(t *testing.T) {
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"UID:one",
+		"DTSTART;VALUE=DATE:20260601",
+		"SUMMARY:Not available",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:two",
+		"DTSTART;TZID=Europe/Berlin:20260610T100000",
+		"DTEND;TZID=Europe/Berlin:20260612T100000",
+		"SUMMARY:Folded",
+		"  summary",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:three",
+		"DTSTART:20260615T100000Z",
+		"DTEND:20260616T100000Z",
+		"STATUS:CANCELLED",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	events, err := ical.Parse(strings.NewReader(calendar))
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	// All-day without DTEND lasts one day
+	assert.Equal(t, "one", events[0].UID)
+	assert.True(t, events[0].AllDay)
+	assert.Equal(t, time.Date(2026, 6, 2, 0, 0, 0, 0, time.UTC), events[0].End)
+
+	assert.Equal(t, "Folded summary", events[1].Summary)
+	assert.Equal(t, time.Date(2026, 6, 10, 10, 0, 0, 0, time.UTC), events[1].Start)
+
+	_, err = ical.Parse(strings.NewReader("BEGIN:VEVENT\r\nUID:x\r\nEND:VEVENT\r\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+)
+
+// Reads all VEVENTs of a calendar
+//
+// Notes:
+//   - Times with a TZID are read as UTC; good enough for busy periods, which are usually all-day
+//   - Without DTEND, an all-day event lasts one day; DURATION is not supported
+//   - Events that are cancelled, or marked as free (TRANSP:TRANSPARENT), are skipped
+func Parse(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []Event{}
+	var current *Event
+	skip := false
+
+	for i, line := range lines {
+		name, params, value := splitLine(line)
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current = &Event{}
+			skip = false
+		case name == "END" && value == "VEVENT":
+			if current == nil {
+				return nil, &ParseError{Line: i + 1, Message: "END:VEVENT without BEGIN:VEVENT"}
+			}
+			if current.Start.IsZero() {
+				return nil, &ParseError{Line: i + 1, Message: "event without DTSTART"}
+			}
+			if current.End.IsZero() {
+				if current.AllDay {
+					current.End = current.Start.AddDate(0, 0, 1)
+				} else {
+					current.End = current.Start
+				}
+			}
+			if !skip && current.End.After(current.Start) {
+				events = append(events, *current)
+			}
+			current = nil
+		case current == nil:
+			continue
+		case name == "UID":
+			current.UID = unescapeText(value)
+		case name == "SUMMARY":
+			current.Summary = unescapeText(value)
+		case name == "STATUS" && strings.EqualFold(value, "CANCELLED"):
+			skip = true
+		case name == "TRANSP" && strings.EqualFold(value, "TRANSPARENT"):
+			skip = true
+		case name == "DTSTART", name == "DTEND":
+			t, allDay, err := parseTime(value, params)
+			if err != nil {
+				return nil, &ParseError{Line: i + 1, Message: "invalid " + name + ": " + value}
+			}
+			if name == "DTSTART" {
+				current.Start = t
+				current.AllDay = allDay
+			} else {
+				current.End = t
+			}
+		}
+	}
+
+	return events, nil
+}
+
+// Continuation lines start with a space or tab
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	lines := []string{}
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// For ex. DTSTART;VALUE=DATE:20240101 -> DTSTART, {VALUE: DATE}, 20240101
+func splitLine(line string) (string, map[string]string, string) {
+	params := map[string]string{}
+
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return strings.ToUpper(line), params, ""
+	}
+
+	head, value := line[:colon], line[colon+1:]
+	parts := strings.Split(head, ";")
+	for _, p := range parts[1:] {
+		if kv := strings.SplitN(p, "=", 2); len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = kv[1]
+		}
+	}
+	return strings.ToUpper(parts[0]), params, value
+}
+
+func parseTime(value string, params map[string]string) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == len(dateFormat) {
+		t, err := time.Parse(dateFormat, value)
+		return t, true, err
+	}
+
+	t, err := time.Parse("20060102T150405", strings.TrimSuffix(value, "Z"))
+	return t, false, err
+}
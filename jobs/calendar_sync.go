@@ -0,0 +1,178 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"gorm.io/gorm"
+
+	"tbd/ical"
+	"tbd/model"
+)
+
+// Imports remote iCal calendars of entries as availability blocks
+// Every sync replaces the blocks of the calendar; manual blocks are not touched
+// If fetching or parsing fails, the previous blocks are kept and the error is stored on the calendar
+type CalendarSync struct {
+	DB       *gorm.DB
+	Interval time.Duration
+	Client   *http.Client
+}
+
+// Calendars larger than this are rejected
+const calendarMaxSize = 1 << 20
+
+var errPrivateAddress = errors.New("address is not public")
+
+// Owners choose the URL, so by default only public addresses are dialed
+// allowPrivate is meant for development and tests; for ex. a calendar served from localhost
+func NewCalendarClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+				return errPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}
+}
+
+// Blocks until ctx is cancelled
+func (s *CalendarSync) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.SyncAll(ctx); err != nil {
+				log.Printf("Calendar sync failed: %v", err)
+			}
+		}
+	}
+}
+
+// Failures of single calendars are stored on them, and don't stop the others
+func (s *CalendarSync) SyncAll(ctx context.Context) error {
+	calendars := []model.EntryCalendar{}
+	if err := s.DB.WithContext(ctx).Find(&calendars).Error; err != nil {
+		return err
+	}
+
+	for i := range calendars {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.Sync(ctx, &calendars[i]); err != nil {
+			log.Printf("Failed to sync calendar of entry %s: %v", calendars[i].EntryID, err)
+		}
+	}
+	return nil
+}
+
+func (s *CalendarSync) Sync(ctx context.Context, calendar *model.EntryCalendar) error {
+	events, err := s.fetch(ctx, calendar.URL)
+	if err == nil {
+		err = s.replaceBlocks(ctx, calendar.EntryID, events)
+	}
+
+	now := time.Now().UTC()
+	calendar.LastSyncedAt = &now
+	calendar.LastError = ""
+	if err != nil {
+		calendar.LastError = err.Error()
+	}
+
+	updateErr := s.DB.WithContext(ctx).Model(&model.EntryCalendar{}).Where("id = ?", calendar.ID).Updates(map[string]interface{}{
+		"last_synced_at": calendar.LastSyncedAt,
+		"last_error":     calendar.LastError,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return updateErr
+}
+
+func (s *CalendarSync) fetch(ctx context.Context, url string) ([]ical.Event, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/calendar")
+
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, calendarMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > calendarMaxSize {
+		return nil, errors.New("calendar is too large")
+	}
+
+	return ical.Parse(bytes.NewReader(body))
+}
+
+// Events that are over are not kept
+func (s *CalendarSync) replaceBlocks(ctx context.Context, entryID string, events []ical.Event) error {
+	now := time.Now().UTC()
+
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("entry_id = ? AND source = ?", entryID, model.AvailabilitySourceICal).Delete(&model.AvailabilityBlock{}).Error
+		if err != nil {
+			return err
+		}
+
+		blocks := []model.AvailabilityBlock{}
+		for _, e := range events {
+			if !e.End.After(now) {
+				continue
+			}
+			blocks = append(blocks, model.AvailabilityBlock{
+				EntryID:     entryID,
+				StartDate:   e.Start.UTC(),
+				EndDate:     e.End.UTC(),
+				Note:        e.Summary,
+				Source:      model.AvailabilitySourceICal,
+				ExternalUID: e.UID,
+			})
+		}
+		if len(blocks) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&blocks, 100).Error
+	})
+}
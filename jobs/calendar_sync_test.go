@@ -0,0 +1,100 @@
+package jobs_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"tbd/jobs"
+	"tbd/migrations"
+	"tbd/model"
+)
+
+func TestCalendarSync(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	_, err = migrations.New(db).Up()
+	assert.NoError(t, err)
+
+	next := time.Now().UTC().AddDate(0, 0, 7).Format("20060102")
+	calendar := fmt.Sprintf("BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"+
+		"BEGIN:VEVENT\r\nUID:upcoming\r\nDTSTART;VALUE=DATE:%s\r\nSUMMARY:Booked elsewhere\r\nEND:VEVENT\r\n"+
+		"BEGIN:VEVENT\r\nUID:over\r\nDTSTART;VALUE=DATE:20200101\r\nDTEND;VALUE=DATE:20200105\r\nEND:VEVENT\r\n"+
+		"END:VCALENDAR\r\n", next)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/calendar.ics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/calendar")
+		fmt.Fprint(w, calendar)
+	}))
+	defer server.Close()
+
+	entryID := "11111111-1111-1111-1111-111111111111"
+	manual := model.AvailabilityBlock{
+		EntryID:   entryID,
+		StartDate: time.Now().UTC(),
+		EndDate:   time.Now().UTC().Add(time.Hour),
+		Source:    model.AvailabilitySourceManual,
+	}
+	assert.NoError(t, db.Create(&manual).Error)
+
+	cal := model.EntryCalendar{EntryID: entryID, URL: server.URL + "/calendar.ics"}
+	assert.NoError(t, db.Create(&cal).Error)
+
+	sync := &jobs.CalendarSync{DB: db, Interval: time.Hour, Client: jobs.NewCalendarClient(true)}
+
+	// Syncing twice must not duplicate blocks
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, sync.Sync(context.Background(), &cal))
+	}
+
+	imported := []model.AvailabilityBlock{}
+	assert.NoError(t, db.Where("entry_id = ? AND source = ?", entryID, model.AvailabilitySourceICal).Find(&imported).Error)
+	assert.Len(t, imported, 1)
+	assert.Equal(t, "upcoming", imported[0].ExternalUID)
+	assert.Equal(t, 24*time.Hour, imported[0].EndDate.Sub(imported[0].StartDate))
+
+	var manualCount int64
+	db.Model(&model.AvailabilityBlock{}).Where("source = ?", model.AvailabilitySourceManual).Count(&manualCount)
+	assert.Equal(t, int64(1), manualCount)
+
+	stored := model.EntryCalendar{}
+	assert.NoError(t, db.First(&stored, "id = ?", cal.ID).Error)
+	assert.NotNil(t, stored.LastSyncedAt)
+	assert.Empty(t, stored.LastError)
+
+	// A failed sync keeps the blocks, and stores the error
+	cal.URL = server.URL + "/missing.ics"
+	assert.Error(t, sync.Sync(context.Background(), &cal))
+	assert.NoError(t, db.First(&stored, "id = ?", cal.ID).Error)
+	assert.Contains(t, stored.LastError, "404")
+
+	var count int64
+	db.Model(&model.AvailabilityBlock{}).Where("source = ?", model.AvailabilitySourceICal).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestCalendarClientRejectsPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n")
+	}))
+	defer server.Close()
+
+	_, err := jobs.NewCalendarClient(false).Get(server.URL)
+	assert.Error(t, err)
+
+	res, err := jobs.NewCalendarClient(true).Get(server.URL)
+	assert.NoError(t, err)
+	res.Body.Close()
+}
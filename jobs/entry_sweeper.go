@@ -0,0 +1,65 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"tbd/model"
+)
+
+// Moves published and paused entries past their ExpiresAt to expired
+// Listings already hide expired entries by date; the sweeper makes the status match, so owners see it too
+type EntrySweeper struct {
+	DB       *gorm.DB
+	Interval time.Duration
+	// Told about every entry that expired; optional
+	FavoriteAlerts *FavoriteAlerts
+}
+
+// Blocks until ctx is cancelled
+func (s *EntrySweeper) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := s.Sweep(ctx); err != nil {
+				log.Printf("Entry sweeper failed: %v", err)
+			}
+		}
+	}
+}
+
+// Returns the number of entries that expired
+func (s *EntrySweeper) Sweep(ctx context.Context) (int64, error) {
+	ids := []string{}
+	err := s.DB.WithContext(ctx).Model(&model.Entry{}).
+		Where("status IN ? AND expires_at IS NOT NULL AND expires_at <= ?", model.EntryStatusesThatExpire, time.Now().UTC()).
+		Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	// Entries that changed status in the meantime are left alone
+	r := s.DB.WithContext(ctx).Model(&model.Entry{}).
+		Where("id IN ? AND status IN ?", ids, model.EntryStatusesThatExpire).
+		Update("status", model.EntryStatusExpired)
+	if r.Error != nil {
+		return 0, r.Error
+	}
+
+	for _, id := range ids {
+		s.FavoriteAlerts.Changed(FavoriteChange{EntryID: id, Kind: model.FavoriteChangeExpired, To: model.EntryStatusExpired})
+	}
+
+	if r.RowsAffected > 0 {
+		log.Printf("Entry sweeper expired %d entries", r.RowsAffected)
+	}
+	return r.RowsAffected, nil
+}
@@ -0,0 +1,57 @@
+package jobs_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"tbd/jobs"
+	"tbd/migrations"
+	"tbd/model"
+)
+
+func TestEntrySweeper(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	_, err = migrations.New(db).Up()
+	assert.NoError(t, err)
+
+	past := time.Now().UTC().Add(-time.Hour)
+	future := time.Now().UTC().Add(time.Hour)
+
+	entries := map[string]*model.Entry{
+		"published past":   {Status: model.EntryStatusPublished, ExpiresAt: &past},
+		"paused past":      {Status: model.EntryStatusPaused, ExpiresAt: &past},
+		"sold past":        {Status: model.EntryStatusSold, ExpiresAt: &past},
+		"published future": {Status: model.EntryStatusPublished, ExpiresAt: &future},
+		"published never":  {Status: model.EntryStatusPublished},
+	}
+	for _, entry := range entries {
+		entry.Type = "item-sale"
+		entry.CreatedByID = "00000000-0000-0000-0000-000000000000"
+		assert.NoError(t, db.Create(entry).Error)
+	}
+
+	sweeper := &jobs.EntrySweeper{DB: db, Interval: time.Minute}
+	expired, err := sweeper.Sweep(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), expired)
+
+	want := map[string]string{
+		"published past":   model.EntryStatusExpired,
+		"paused past":      model.EntryStatusExpired,
+		"sold past":        model.EntryStatusSold,
+		"published future": model.EntryStatusPublished,
+		"published never":  model.EntryStatusPublished,
+	}
+	for name, entry := range entries {
+		stored := model.Entry{}
+		assert.NoError(t, db.First(&stored, "id = ?", entry.ID).Error)
+		assert.Equal(t, want[name], stored.Status, name)
+	}
+}
@@ -0,0 +1,127 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"gorm.io/gorm"
+
+	"tbd/model"
+	"tbd/notify"
+)
+
+// A change of a favorited entry; From and To are for people, for ex. 12.50 EUR or sold
+type FavoriteChange struct {
+	EntryID string
+	Kind    string
+	From    string
+	To      string
+}
+
+// Tells users who favorited an entry, and want to be notified, that its price or status changed, or it expired
+//
+// Notes:
+//   - Changes are queued in memory and sent in the background, so writing an entry doesn't wait for mail
+//   - If the queue is full, or the server stops, changes are dropped; favorites are a convenience, not a record
+//   - The owner is never told about their own entry
+type FavoriteAlerts struct {
+	DB       *gorm.DB
+	Notifier notify.Notifier
+
+	once  sync.Once
+	queue chan FavoriteChange
+}
+
+// Changes waiting to be sent
+const favoriteAlertsQueueSize = 1000
+
+func (a *FavoriteAlerts) changes() chan FavoriteChange {
+	a.once.Do(func() {
+		a.queue = make(chan FavoriteChange, favoriteAlertsQueueSize)
+	})
+	return a.queue
+}
+
+// Queues a change; does nothing if a is nil
+func (a *FavoriteAlerts) Changed(change FavoriteChange) {
+	if a == nil {
+		return
+	}
+
+	select {
+	case a.changes() <- change:
+	default:
+		log.Printf("Favorite alerts queue is full, dropped %s change of entry %s", change.Kind, change.EntryID)
+	}
+}
+
+// Blocks until ctx is cancelled
+func (a *FavoriteAlerts) Start(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change := <-a.changes():
+			if _, err := a.Deliver(ctx, change); err != nil {
+				log.Printf("Favorite alerts for entry %s failed: %v", change.EntryID, err)
+			}
+		}
+	}
+}
+
+// Notifies everyone who favorited the entry, and wants to know; returns the number of notifications sent
+// Users the notifier fails for are logged and skipped
+func (a *FavoriteAlerts) Deliver(ctx context.Context, change FavoriteChange) (int, error) {
+	entry := model.Entry{}
+	if err := a.DB.WithContext(ctx).First(&entry, "id = ?", change.EntryID).Error; err != nil {
+		return 0, err
+	}
+
+	favorites := []model.Favorite{}
+	err := a.DB.WithContext(ctx).
+		Where("entry_id = ? AND notify = ? AND user_id <> ?", entry.ID, true, entry.CreatedByID).
+		Find(&favorites).Error
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, f := range favorites {
+		if err := a.Notifier.Notify(ctx, favoriteNotification(f.UserID, entry, change)); err != nil {
+			log.Printf("Favorite %s could not be sent: %v", f.ID, err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func favoriteNotification(userID string, entry model.Entry, change FavoriteChange) notify.Notification {
+	var title, body string
+	switch change.Kind {
+	case model.FavoriteChangePrice:
+		title = fmt.Sprintf("New price for %q", entry.Title())
+		body = fmt.Sprintf("From %s to %s", change.From, change.To)
+	case model.FavoriteChangeExpired:
+		title = fmt.Sprintf("%q expired", entry.Title())
+		body = "It's not listed anymore, unless the owner renews it."
+	default:
+		title = fmt.Sprintf("%q is %s", entry.Title(), change.To)
+		body = fmt.Sprintf("From %s to %s", change.From, change.To)
+	}
+
+	return notify.Notification{
+		UserID: userID,
+		Kind:   model.NotificationKindFavorite,
+		Title:  title,
+		Body:   body,
+		Data: map[string]interface{}{
+			"entry_id": entry.ID,
+			"change":   change.Kind,
+			"from":     change.From,
+			"to":       change.To,
+		},
+	}
+}
@@ -0,0 +1,90 @@
+package jobs_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"tbd/jobs"
+	"tbd/migrations"
+	"tbd/model"
+	"tbd/notify"
+)
+
+type channelNotifier struct {
+	sent chan notify.Notification
+}
+
+func (n *channelNotifier) Name() string {
+	return "channel"
+}
+
+func (n *channelNotifier) Notify(ctx context.Context, notification notify.Notification) error {
+	n.sent <- notification
+	return nil
+}
+
+func TestFavoriteAlerts(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	_, err = migrations.New(db).Up()
+	assert.NoError(t, err)
+
+	owner := "00000000-0000-0000-0000-000000000000"
+	past := time.Now().Add(-time.Hour)
+	entry := model.Entry{Type: "item-sale", Status: model.EntryStatusPublished, ExpiresAt: &past, CreatedByID: owner, Data: datatypes.JSON(`{"title": "Lamp"}`)}
+	assert.NoError(t, db.Create(&entry).Error)
+
+	favorites := []model.Favorite{
+		{UserID: "00000000-0000-0000-0000-000000000001", EntryID: entry.ID, Notify: true},
+		{UserID: "00000000-0000-0000-0000-000000000002", EntryID: entry.ID, Notify: false},
+		// The owner never hears about their own entry
+		{UserID: owner, EntryID: entry.ID, Notify: true},
+	}
+	for i := range favorites {
+		assert.NoError(t, db.Create(&favorites[i]).Error)
+	}
+
+	notifier := &recordingNotifier{}
+	alerts := &jobs.FavoriteAlerts{DB: db, Notifier: notifier}
+
+	sent, err := alerts.Deliver(context.Background(), jobs.FavoriteChange{EntryID: entry.ID, Kind: model.FavoriteChangePrice, From: "10.00 USD", To: "8.00 USD"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	if assert.Len(t, notifier.sent, 1) {
+		n := notifier.sent[0]
+		assert.Equal(t, favorites[0].UserID, n.UserID)
+		assert.Equal(t, model.NotificationKindFavorite, n.Kind)
+		assert.Equal(t, `New price for "Lamp"`, n.Title)
+		assert.Equal(t, "From 10.00 USD to 8.00 USD", n.Body)
+	}
+
+	// The sweeper queues expired entries; they are sent once the job runs
+	queued := &channelNotifier{sent: make(chan notify.Notification, 10)}
+	background := &jobs.FavoriteAlerts{DB: db, Notifier: queued}
+	sweeper := &jobs.EntrySweeper{DB: db, FavoriteAlerts: background}
+	expired, err := sweeper.Sweep(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), expired)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go background.Start(ctx)
+
+	select {
+	case n := <-queued.sent:
+		assert.Equal(t, `"Lamp" expired`, n.Title)
+	case <-time.After(2 * time.Second):
+		t.Error("Expired entry was not alerted")
+	}
+
+	// Nothing breaks without alerts
+	var none *jobs.FavoriteAlerts
+	none.Changed(jobs.FavoriteChange{EntryID: entry.ID})
+}
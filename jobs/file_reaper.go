@@ -0,0 +1,167 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"tbd/model"
+	"tbd/storage"
+)
+
+// Deletes provisional files that were never attached to an entry or user
+// A file is reaped once it's older than TTL; the object is removed from storage and the DB row is soft-deleted
+// If removing the object fails, the row is kept, so the file is picked up again on the next run
+type FileReaper struct {
+	DB       *gorm.DB
+	Storage  storage.Storage
+	TTL      time.Duration
+	Interval time.Duration
+	// Only report what would be reaped; nothing is deleted
+	DryRun bool
+
+	mu      sync.Mutex
+	metrics FileReaperMetrics
+}
+
+type ReapedFile struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type FileReaperResult struct {
+	DryRun     bool         `json:"dry_run"`
+	Files      []ReapedFile `json:"files"`
+	Reaped     int64        `json:"reaped"`
+	Bytes      int64        `json:"bytes"`
+	Failed     int64        `json:"failed"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt time.Time    `json:"finished_at"`
+}
+
+// Totals only include runs that actually deleted files
+type FileReaperMetrics struct {
+	Runs        int64             `json:"runs"`
+	FilesReaped int64             `json:"files_reaped"`
+	BytesReaped int64             `json:"bytes_reaped"`
+	Failures    int64             `json:"failures"`
+	LastRun     *FileReaperResult `json:"last_run"`
+}
+
+const fileReaperBatchSize = 100
+
+// Blocks until ctx is cancelled
+func (r *FileReaper) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := r.Reap(ctx, r.DryRun); err != nil {
+				log.Printf("File reaper failed: %v", err)
+			}
+		}
+	}
+}
+
+func (r *FileReaper) Reap(ctx context.Context, dryRun bool) (FileReaperResult, error) {
+	result := FileReaperResult{
+		DryRun:    dryRun,
+		Files:     []ReapedFile{},
+		StartedAt: time.Now(),
+	}
+	cutoff := result.StartedAt.Add(-r.TTL)
+
+	// Files that failed to delete are skipped for the rest of this run
+	skip := []string{}
+
+	for {
+		files := []model.File{}
+		query := r.DB.WithContext(ctx).
+			Where("is_provisional = ? AND created_at < ?", true, cutoff).
+			Where("NOT EXISTS (SELECT 1 FROM entry_files WHERE entry_files.file_id = files.id)").
+			Where("NOT EXISTS (SELECT 1 FROM users WHERE users.image_id = files.id)").
+			Order("created_at ASC").
+			Limit(fileReaperBatchSize)
+
+		if len(skip) > 0 {
+			query = query.Where("id NOT IN ?", skip)
+		}
+
+		// In dry-run mode nothing changes, so paging is needed to move forward
+		if dryRun {
+			query = query.Offset(len(result.Files))
+		}
+
+		if err := query.Find(&files).Error; err != nil {
+			return result, err
+		}
+
+		for _, f := range files {
+			reaped := ReapedFile{ID: f.ID, Path: f.Path, Size: f.Size, CreatedAt: f.CreatedAt}
+
+			if !dryRun {
+				if err := r.reapFile(ctx, f); err != nil {
+					log.Printf("Failed to reap file %s: %v", f.ID, err)
+					result.Failed++
+					skip = append(skip, f.ID)
+					continue
+				}
+			}
+
+			result.Files = append(result.Files, reaped)
+			result.Reaped++
+			result.Bytes += f.Size
+		}
+
+		if len(files) < fileReaperBatchSize {
+			break
+		}
+	}
+
+	result.FinishedAt = time.Now()
+	r.record(result)
+
+	if result.Reaped > 0 || result.Failed > 0 {
+		log.Printf("File reaper: reaped %d files (%d bytes), %d failed, dry run: %v", result.Reaped, result.Bytes, result.Failed, dryRun)
+	}
+
+	return result, nil
+}
+
+func (r *FileReaper) reapFile(ctx context.Context, f model.File) error {
+	if err := r.Storage.Delete(ctx, f.Path); err != nil {
+		return err
+	}
+	return r.DB.WithContext(ctx).Delete(&model.File{ID: f.ID}).Error
+}
+
+func (r *FileReaper) record(result FileReaperResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics.LastRun = &result
+	if result.DryRun {
+		return
+	}
+
+	r.metrics.Runs++
+	r.metrics.FilesReaped += result.Reaped
+	r.metrics.BytesReaped += result.Bytes
+	r.metrics.Failures += result.Failed
+}
+
+func (r *FileReaper) Metrics() FileReaperMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.metrics
+}
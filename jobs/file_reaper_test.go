@@ -0,0 +1,93 @@
+package jobs_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"tbd/jobs"
+	"tbd/migrations"
+	"tbd/model"
+	"tbd/storage"
+)
+
+func TestFileReaper(t *testing.T) {
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	_, err = migrations.New(db).Up()
+	assert.NoError(t, err)
+	store, err := storage.NewLocal(filepath.Join(t.TempDir(), "uploads"))
+	assert.NoError(t, err)
+
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	recent := time.Now().UTC().Add(-time.Minute)
+
+	files := map[string]*model.File{
+		"orphan old":     {IsProvisional: true, CreatedAt: old},
+		"orphan recent":  {IsProvisional: true, CreatedAt: recent},
+		"entry file old": {IsProvisional: true, CreatedAt: old},
+		"user image old": {IsProvisional: true, CreatedAt: old},
+		"attached old":   {IsProvisional: false, CreatedAt: old},
+	}
+	for name, file := range files {
+		file.Path = "general/" + strings.ReplaceAll(name, " ", "-") + ".txt"
+		file.Size = int64(len(name))
+		file.CreatedByID = "00000000-0000-0000-0000-000000000000"
+		assert.NoError(t, db.Create(file).Error)
+		assert.NoError(t, store.Put(ctx, file.Path, strings.NewReader(name), "text/plain"))
+	}
+
+	entry := model.Entry{Type: "item-sale", CreatedByID: "00000000-0000-0000-0000-000000000000"}
+	assert.NoError(t, db.Create(&entry).Error)
+	assert.NoError(t, db.Exec("INSERT INTO entry_files (entry_id, file_id) VALUES (?, ?)", entry.ID, files["entry file old"].ID).Error)
+	assert.NoError(t, db.Exec("INSERT INTO users (id, username, image_id) VALUES (?, ?, ?)", "11111111-1111-1111-1111-111111111111", "jane", files["user image old"].ID).Error)
+
+	reaper := &jobs.FileReaper{DB: db, Storage: store, TTL: time.Hour, Interval: time.Minute}
+	exists := func(name string) (bool, bool) {
+		var count int64
+		assert.NoError(t, db.Model(&model.File{}).Where("id = ?", files[name].ID).Count(&count).Error)
+		_, err := store.Stat(ctx, files[name].Path)
+		return count == 1, err == nil
+	}
+
+	// Dry runs only report
+	result, err := reaper.Reap(ctx, true)
+	assert.NoError(t, err)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, int64(1), result.Reaped)
+	if assert.Len(t, result.Files, 1) {
+		assert.Equal(t, files["orphan old"].ID, result.Files[0].ID)
+	}
+	for name := range files {
+		inDB, inStorage := exists(name)
+		assert.True(t, inDB, name)
+		assert.True(t, inStorage, name)
+	}
+	assert.Equal(t, int64(0), reaper.Metrics().Runs)
+
+	result, err = reaper.Reap(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), result.Reaped)
+	assert.Equal(t, files["orphan old"].Size, result.Bytes)
+	assert.Equal(t, int64(0), result.Failed)
+
+	for name := range files {
+		inDB, inStorage := exists(name)
+		assert.Equal(t, name != "orphan old", inDB, name)
+		assert.Equal(t, name != "orphan old", inStorage, name)
+	}
+	assert.Equal(t, int64(1), reaper.Metrics().Runs)
+	assert.Equal(t, int64(1), reaper.Metrics().FilesReaped)
+
+	// Nothing is left to reap
+	result, err = reaper.Reap(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), result.Reaped)
+}
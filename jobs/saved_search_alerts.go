@@ -0,0 +1,218 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"tbd/model"
+	"tbd/notify"
+)
+
+// Tells owners of saved searches about entries that were created or updated, and match
+//
+// Notes:
+//   - Match is the entry filter of the listing; it lives with the handlers, so it's passed in
+//   - Every run checks the entries updated since the last one; matches are recorded once per search and entry
+//   - Instant searches are sent on every run; daily and weekly ones as a digest, once their time has come
+//   - If the notifier fails, pending matches are sent with the next run
+type SavedSearchAlerts struct {
+	DB       *gorm.DB
+	Notifier notify.Notifier
+	Interval time.Duration
+	// IDs of the entries that match s, among the ones updated in (since, until]
+	Match func(ctx context.Context, s model.SavedSearch, since, until time.Time) ([]string, error)
+
+	once sync.Once
+	kick chan struct{}
+}
+
+// Entries updated this long before the last check are checked again; for ex. if their transaction committed late
+const savedSearchOverlap = time.Minute
+
+// Digests list this many entries; the rest are counted
+const savedSearchDigestSize = 20
+
+func (a *SavedSearchAlerts) kicks() chan struct{} {
+	a.once.Do(func() {
+		a.kick = make(chan struct{}, 1)
+	})
+	return a.kick
+}
+
+// Asks for a run right away; for ex. after an entry was written, so instant alerts don't wait for the interval
+func (a *SavedSearchAlerts) Kick() {
+	if a == nil {
+		return
+	}
+
+	select {
+	case a.kicks() <- struct{}{}:
+	default:
+	}
+}
+
+// Blocks until ctx is cancelled
+func (a *SavedSearchAlerts) Start(ctx context.Context) {
+	ticker := time.NewTicker(a.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-a.kicks():
+		}
+
+		if err := a.Run(ctx); err != nil {
+			log.Printf("Saved search alerts failed: %v", err)
+		}
+	}
+}
+
+func (a *SavedSearchAlerts) Run(ctx context.Context) error {
+	now := time.Now()
+	if _, err := a.Check(ctx, now); err != nil {
+		return err
+	}
+	_, err := a.Deliver(ctx, now)
+	return err
+}
+
+// Records the entries that match, among the ones updated since the last check; returns the number of new matches
+// Searches that fail are logged and skipped; for ex. if the type they filter on was deleted
+func (a *SavedSearchAlerts) Check(ctx context.Context, now time.Time) (int64, error) {
+	var total int64
+	searches := []model.SavedSearch{}
+
+	err := a.DB.WithContext(ctx).FindInBatches(&searches, 100, func(tx *gorm.DB, batch int) error {
+		for _, s := range searches {
+			// Entries written before the search was saved aren't new to its owner
+			since := s.CheckedAt.Add(-savedSearchOverlap)
+			if since.Before(s.CreatedAt) {
+				since = s.CreatedAt
+			}
+
+			ids, err := a.Match(ctx, s, since, now)
+			if err != nil {
+				log.Printf("Saved search %s failed: %v", s.ID, err)
+			}
+
+			for _, id := range ids {
+				r := a.DB.WithContext(ctx).
+					Clauses(clause.OnConflict{DoNothing: true}).
+					Create(&model.SavedSearchMatch{SavedSearchID: s.ID, EntryID: id})
+				if r.Error != nil {
+					return r.Error
+				}
+				total += r.RowsAffected
+			}
+
+			err = a.DB.WithContext(ctx).Model(&model.SavedSearch{}).
+				Where("id = ?", s.ID).
+				UpdateColumn("checked_at", now).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	return total, err
+}
+
+// Sends the pending matches of searches that are due; returns the number of notifications sent
+// Matches of entries that aren't listed anymore are dropped
+func (a *SavedSearchAlerts) Deliver(ctx context.Context, now time.Time) (int, error) {
+	searches := []model.SavedSearch{}
+	err := a.DB.WithContext(ctx).
+		Where("id IN (SELECT saved_search_id FROM saved_search_matches WHERE notified_at IS NULL)").
+		Find(&searches).Error
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, s := range searches {
+		if s.NextAlertAt().After(now) {
+			continue
+		}
+
+		matches := []model.SavedSearchMatch{}
+		err := a.DB.WithContext(ctx).Preload("Entry").
+			Where("saved_search_id = ? AND notified_at IS NULL", s.ID).
+			Order("created_at ASC").
+			Find(&matches).Error
+		if err != nil {
+			return sent, err
+		}
+
+		ids := []string{}
+		entries := []model.Entry{}
+		for _, m := range matches {
+			ids = append(ids, m.ID)
+			if m.Entry != nil && m.Entry.IsListed(now) {
+				entries = append(entries, *m.Entry)
+			}
+		}
+
+		if len(entries) > 0 {
+			if err := a.Notifier.Notify(ctx, savedSearchNotification(s, entries)); err != nil {
+				log.Printf("Saved search %s could not be sent: %v", s.ID, err)
+				continue
+			}
+			sent++
+
+			err := a.DB.WithContext(ctx).Model(&model.SavedSearch{}).
+				Where("id = ?", s.ID).
+				UpdateColumn("notified_at", now).Error
+			if err != nil {
+				return sent, err
+			}
+		}
+
+		err = a.DB.WithContext(ctx).Model(&model.SavedSearchMatch{}).
+			Where("id IN ?", ids).
+			Update("notified_at", now).Error
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+func savedSearchNotification(s model.SavedSearch, entries []model.Entry) notify.Notification {
+	title := fmt.Sprintf("New match for %q", s.Name)
+	if len(entries) > 1 {
+		title = fmt.Sprintf("%d new matches for %q", len(entries), s.Name)
+	}
+
+	var body strings.Builder
+	ids := []string{}
+	for i, e := range entries {
+		ids = append(ids, e.ID)
+		if i < savedSearchDigestSize {
+			fmt.Fprintf(&body, "- %s\n", e.Title())
+		}
+	}
+	if len(entries) > savedSearchDigestSize {
+		fmt.Fprintf(&body, "and %d more\n", len(entries)-savedSearchDigestSize)
+	}
+
+	return notify.Notification{
+		UserID: s.UserID,
+		Kind:   model.NotificationKindSavedSearch,
+		Title:  title,
+		Body:   body.String(),
+		Data: map[string]interface{}{
+			"saved_search_id": s.ID,
+			"entry_ids":       ids,
+		},
+	}
+}
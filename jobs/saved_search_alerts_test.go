@@ -0,0 +1,117 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"tbd/jobs"
+	"tbd/migrations"
+	"tbd/model"
+	"tbd/notify"
+)
+
+type recordingNotifier struct {
+	sent []notify.Notification
+	err  error
+}
+
+func (n *recordingNotifier) Name() string {
+	return "recording"
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, notification notify.Notification) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+func TestSavedSearchAlerts(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	_, err = migrations.New(db).Up()
+	assert.NoError(t, err)
+
+	now := time.Now()
+	entries := []*model.Entry{
+		{Status: model.EntryStatusPublished, Data: datatypes.JSON(`{"title": "Lamp"}`)},
+		{Status: model.EntryStatusPublished, Data: datatypes.JSON(`{"title": "Chair"}`)},
+		{Status: model.EntryStatusPublished, Data: datatypes.JSON(`{"title": "Sold soon"}`)},
+	}
+	for _, entry := range entries {
+		entry.Type = "item-sale"
+		entry.CreatedByID = "00000000-0000-0000-0000-000000000000"
+		assert.NoError(t, db.Create(entry).Error)
+	}
+
+	instant := model.SavedSearch{UserID: "00000000-0000-0000-0000-000000000001", Name: "Instant", Frequency: model.AlertFrequencyInstant, CheckedAt: now}
+	daily := model.SavedSearch{UserID: "00000000-0000-0000-0000-000000000002", Name: "Daily", Frequency: model.AlertFrequencyDaily, CheckedAt: now}
+	assert.NoError(t, db.Create(&instant).Error)
+	assert.NoError(t, db.Create(&daily).Error)
+
+	notifier := &recordingNotifier{}
+	alerts := &jobs.SavedSearchAlerts{
+		DB:       db,
+		Notifier: notifier,
+		Interval: time.Minute,
+		Match: func(ctx context.Context, s model.SavedSearch, since, until time.Time) ([]string, error) {
+			return []string{entries[0].ID, entries[1].ID, entries[2].ID}, nil
+		},
+	}
+
+	matched, err := alerts.Check(context.Background(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), matched)
+
+	// Matches are only recorded once
+	matched, err = alerts.Check(context.Background(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), matched)
+
+	// Unlisted entries are left out
+	assert.NoError(t, db.Model(entries[2]).Update("status", model.EntryStatusSold).Error)
+
+	// Failed notifications are retried
+	notifier.err = errors.New("unreachable")
+	sent, err := alerts.Deliver(context.Background(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	notifier.err = nil
+	sent, err = alerts.Deliver(context.Background(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	if assert.Len(t, notifier.sent, 1) {
+		n := notifier.sent[0]
+		assert.Equal(t, instant.UserID, n.UserID)
+		assert.Equal(t, model.NotificationKindSavedSearch, n.Kind)
+		assert.Equal(t, `2 new matches for "Instant"`, n.Title)
+		assert.Equal(t, "- Lamp\n- Chair\n", n.Body)
+		assert.Equal(t, []string{entries[0].ID, entries[1].ID}, n.Data["entry_ids"])
+	}
+
+	// The daily digest waits a day; nothing is sent twice
+	sent, err = alerts.Deliver(context.Background(), now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	sent, err = alerts.Deliver(context.Background(), now.Add(25*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	if assert.Len(t, notifier.sent, 2) {
+		assert.Equal(t, daily.UserID, notifier.sent[1].UserID)
+	}
+
+	var pending int64
+	assert.NoError(t, db.Model(&model.SavedSearchMatch{}).Where("notified_at IS NULL").Count(&pending).Error)
+	assert.Equal(t, int64(0), pending)
+}
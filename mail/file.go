@@ -0,0 +1,37 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Writes every email to a file in a directory instead of sending it; for development and tests
+// Files are named <unix nano>-<recipient>.txt, so they sort in the order they were sent
+type File struct {
+	dir  string
+	from string
+}
+
+func NewFile(dir, from string) (*File, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("file mailer requires a directory")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &File{dir: dir, from: from}, nil
+}
+
+func (f *File) Send(ctx context.Context, m Message) error {
+	if strings.ContainsAny(m.To, "/\\\r\n") {
+		return fmt.Errorf("invalid recipient: %q", m.To)
+	}
+
+	name := fmt.Sprintf("%d-%s.txt", time.Now().UnixNano(), m.To)
+	content := fmt.Sprintf("From: %s\nTo: %s\nSubject: %s\n\n%s\n", f.from, m.To, m.Subject, m.Body)
+	return os.WriteFile(filepath.Join(f.dir, name), []byte(content), 0o644)
+}
@@ -0,0 +1,27 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mails")
+	mailer, err := New(Config{Driver: "file", From: "noreply@example.com", Path: dir})
+	assert.NoError(t, err)
+
+	assert.NoError(t, mailer.Send(context.Background(), Message{To: "jane@example.com", Subject: "Hello", Body: "How are you?"}))
+	assert.Error(t, mailer.Send(context.Background(), Message{To: "../jane@example.com", Subject: "Hello"}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*-jane@example.com.txt"))
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		content, err := os.ReadFile(files[0])
+		assert.NoError(t, err)
+		assert.Equal(t, "From: noreply@example.com\nTo: jane@example.com\nSubject: Hello\n\nHow are you?\n", string(content))
+	}
+}
@@ -0,0 +1,20 @@
+package mail
+
+import (
+	"context"
+	"log"
+)
+
+// Writes emails to the log instead of sending them; for development
+type Log struct {
+	from string
+}
+
+func NewLog(from string) *Log {
+	return &Log{from: from}
+}
+
+func (l *Log) Send(ctx context.Context, m Message) error {
+	log.Printf("Mail from %s to %s: %s\n%s", l.from, m.To, m.Subject, m.Body)
+	return nil
+}
@@ -0,0 +1,43 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+)
+
+// A plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer is implemented by every mail backend
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Supported drivers are: smtp, log, file
+type Config struct {
+	Driver   string
+	From     string
+	Host     string
+	Port     int
+	Username string
+	Password string
+	// Only used by the file driver
+	Path string
+}
+
+func New(cfg Config) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return NewSMTP(cfg.Host, cfg.Port, cfg.Username, cfg.Password, cfg.From)
+	case "log":
+		return NewLog(cfg.From), nil
+	case "file":
+		return NewFile(cfg.Path, cfg.From)
+	default:
+		return nil, fmt.Errorf("unsupported mail driver: %s", cfg.Driver)
+	}
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"tbd/handler"
 	"tbd/model"
+	"tbd/session"
 
 	"github.com/casbin/casbin/v2"
 	"github.com/golang-jwt/jwt/v5"
@@ -14,6 +16,39 @@ import (
 
 type AuthorizationMW struct {
 	Enforcer *casbin.Enforcer
+	// Current roles and state of users; the roles in the token are only what they were at login
+	Accounts *session.Accounts
+}
+
+// Policies have read (GET, HEAD) and write (everything else)
+func policyAction(method string) string {
+	if method == http.MethodGet || method == http.MethodHead {
+		return "read"
+	}
+	return "write"
+}
+
+// Resolves the user of the token to their current account
+// Notes:
+//   - Deleted users, and logins of an older token version (from before the password changed), are logged out
+//   - Suspended users are refused
+func (cfg AuthorizationMW) currentUser(c echo.Context, user model.AuthUser) (model.AuthUser, error) {
+	account, err := cfg.Accounts.Get(c.Request().Context(), user.ID)
+	if err != nil {
+		c.Logger().Error(err)
+		return user, echo.NewHTTPError(http.StatusInternalServerError, "authorization error")
+	}
+	if account.Deleted || account.TokenVersion != user.TokenVersion {
+		return user, echo.NewHTTPError(http.StatusUnauthorized, "Session expired. Please login again.")
+	}
+	if account.Suspended {
+		return user, echo.NewHTTPError(http.StatusForbidden, "Account suspended.")
+	}
+
+	user.Roles = account.Roles
+	user.IsAdmin = account.IsAdmin()
+	user.IsConfirmed = account.IsConfirmed
+	return user, nil
 }
 
 func (cfg AuthorizationMW) Authorize(next echo.HandlerFunc) echo.HandlerFunc {
@@ -21,21 +56,20 @@ func (cfg AuthorizationMW) Authorize(next echo.HandlerFunc) echo.HandlerFunc {
 		userRoles := []string{"anonymous"}
 		user, err := handler.UserFromContext(c)
 		if err == nil {
+			user, err = cfg.currentUser(c, user)
+			if err != nil {
+				return err
+			}
 			userRoles = user.Roles
 		}
 
-		res := []bool{}
-
+		action := policyAction(c.Request().Method)
 		for _, role := range userRoles {
-			r, casbinErr := cfg.Enforcer.Enforce(role, c.Path(), c.Request().Method)
+			allowed, casbinErr := cfg.Enforcer.Enforce(role, c.Path(), action)
 			if casbinErr != nil {
-				return echo.NewHTTPError(http.StatusInternalServerError, "authorization erro")
+				return echo.NewHTTPError(http.StatusInternalServerError, "authorization error")
 			}
-			res = append(res, r)
-		}
-
-		for _, r := range res {
-			if r {
+			if allowed {
 				c.Set("user", &user)
 				return next(c)
 			}
@@ -55,14 +89,38 @@ var publicPaths = []PublicPaths{
 		Path:   "/login",
 		Method: "POST",
 	},
+	{
+		Path:   "/login/2fa",
+		Method: "POST",
+	},
 	{
 		Path:   "/signup",
 		Method: "POST",
 	},
+	{
+		Path:   "/refresh",
+		Method: "POST",
+	},
+	{
+		Path:   "/account/verify",
+		Method: "POST",
+	},
+	{
+		Path:   "/account/password/forgot",
+		Method: "POST",
+	},
+	{
+		Path:   "/account/password/reset",
+		Method: "POST",
+	},
 	{
 		Path:   "/entries",
 		Method: "GET",
 	},
+	{
+		Path:   "/entries.geojson",
+		Method: "GET",
+	},
 	{
 		Path:   "/entries/:id",
 		Method: "GET",
@@ -87,15 +145,65 @@ var publicPaths = []PublicPaths{
 		Path:   "/search",
 		Method: "GET",
 	},
+	{
+		Path:   "/entries/:id/availability",
+		Method: "GET",
+	},
+	{
+		Path:   "/entries/:id/calendar.ics",
+		Method: "GET",
+	},
+	{
+		Path:   "/entries/:id/consumes",
+		Method: "GET",
+	},
+	{
+		Path:   "/entries/:id/quote",
+		Method: "GET",
+	},
+	{
+		Path:   "/entry-types",
+		Method: "GET",
+	},
+	{
+		Path:   "/entry-types/:name",
+		Method: "GET",
+	},
+	{
+		Path:   "/currency-rates",
+		Method: "GET",
+	},
+	{
+		Path:   "/payments/providers",
+		Method: "GET",
+	},
+	{
+		Path:   "/payments/webhooks/:provider",
+		Method: "POST",
+	},
 }
 
-func getJwtMVConfig() echojwt.Config {
+// Access tokens must belong to a session that wasn't revoked; sessions are checked against the cached denylist
+func getJwtMVConfig(sessions *session.Denylist) echojwt.Config {
 	return echojwt.Config{
-		NewClaimsFunc: func(c echo.Context) jwt.Claims {
-			return new(model.JwtCustomClaims)
+		ParseTokenFunc: func(c echo.Context, auth string) (interface{}, error) {
+			claims := new(model.JwtCustomClaims)
+			token, err := jwt.ParseWithClaims(auth, claims, func(t *jwt.Token) (interface{}, error) {
+				return []byte(os.Getenv("JWT_SECRET")), nil
+			}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+			if err != nil {
+				return nil, err
+			}
+			if !token.Valid {
+				return nil, errors.New("invalid token")
+			}
+			// Tokens from before sessions were introduced can't be revoked
+			if claims.SessionID == "" || sessions.IsRevoked(claims.SessionID) {
+				return nil, errors.New("session revoked")
+			}
+			return token, nil
 		},
 		ContextKey: "user_auth",
-		SigningKey: []byte(os.Getenv("JWT_SECRET")),
 		Skipper: func(c echo.Context) bool {
 			for _, p := range publicPaths {
 				if c.Path() == p.Path && c.Request().Method == p.Method {
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"gorm.io/gorm"
+
+	"tbd/migrations"
+)
+
+const migrateUsage = `Usage: tbd migrate <command>
+
+Commands:
+  up        Apply all pending migrations
+  down [n]  Roll back the last n migrations (default 1)
+  status    List migrations and whether they are applied`
+
+// Entry point for: tbd migrate up|down|status
+func runMigrateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Println(migrateUsage)
+		return 2
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		fmt.Printf("Failed to open database: %v\n", err)
+		return 1
+	}
+
+	m := migrations.New(db)
+
+	switch args[0] {
+	case "up":
+		applied, err := m.Up()
+		for _, migration := range applied {
+			fmt.Printf("Applied %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("Nothing to apply")
+		}
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			n, err = strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Println(migrateUsage)
+				return 2
+			}
+		}
+
+		rolledBack, err := m.Down(n)
+		for _, migration := range rolledBack {
+			fmt.Printf("Rolled back %d %s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if len(rolledBack) == 0 {
+			fmt.Println("Nothing to roll back")
+		}
+	case "status":
+		status, err := m.Status()
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range status {
+			appliedAt := "pending"
+			if s.IsApplied() {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		w.Flush()
+	default:
+		fmt.Println(migrateUsage)
+		return 2
+	}
+
+	return 0
+}
+
+// The server refuses to start on an outdated schema, unless told to apply pending migrations
+func ensureMigrated(db *gorm.DB, apply bool) error {
+	m := migrations.New(db)
+
+	pending, err := m.Pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if !apply {
+		return fmt.Errorf("%d pending migration(s); run `tbd migrate up`, or start with --migrate", len(pending))
+	}
+
+	applied, err := m.Up()
+	for _, migration := range applied {
+		fmt.Printf("Applied migration %d %s\n", migration.Version, migration.Name)
+	}
+	return err
+}
@@ -0,0 +1,127 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Schema as it was created by AutoMigrate, before migrations were introduced
+// Databases that were created that way already have these tables; AutoMigrate leaves them as they are
+
+type baselineUser struct {
+	ID          string  `gorm:"type:uuid;primarykey"`
+	ImageID     *string `gorm:"type:uuid"`
+	Name        *string
+	Username    string  `gorm:"uniqueIndex"`
+	Email       *string `gorm:"uniqueIndex"`
+	Phone       *string `gorm:"uniqueIndex"`
+	Password    string
+	Roles       []string `gorm:"serializer:json;default:'[]'"`
+	Profile     string
+	Data        datatypes.JSON
+	IsConfirmed bool `gorm:"default:false"`
+	IsListed    bool `gorm:"default:false"`
+	PrivateKey  string
+	PublicKey   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   *time.Time `gorm:"index"`
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselineFile struct {
+	ID            string `gorm:"type:uuid;primarykey"`
+	Title         string
+	Path          string
+	Mime          string
+	Size          int64
+	CreatedByID   string `gorm:"type:uuid"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	ExpiresAt     time.Time
+	IsProvisional bool
+	DeletedAt     *time.Time `gorm:"index"`
+}
+
+func (baselineFile) TableName() string { return "files" }
+
+type baselineCity struct {
+	ID          string `gorm:"type:uuid;primarykey"`
+	Slug        string `gorm:"unique"`
+	GlobID      string
+	Name        string
+	CountryCode string
+	State       string
+}
+
+func (baselineCity) TableName() string { return "cities" }
+
+type baselineEntry struct {
+	ID            string `gorm:"type:uuid;primarykey"`
+	Type          string
+	Data          datatypes.JSON
+	DataSignature string
+	CreatedByID   string  `gorm:"type:uuid"`
+	CityID        *string `gorm:"type:uuid"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	ExpiresAt     time.Time
+}
+
+func (baselineEntry) TableName() string { return "entries" }
+
+type baselineEntryFile struct {
+	EntryID string `gorm:"type:uuid;primarykey"`
+	FileID  string `gorm:"type:uuid;primarykey"`
+}
+
+func (baselineEntryFile) TableName() string { return "entry_files" }
+
+type baselineComment struct {
+	ID          string `gorm:"type:uuid;primarykey"`
+	Body        string
+	EntryID     string `gorm:"type:uuid"`
+	CreatedByID string `gorm:"type:uuid"`
+	CreatedAt   string
+	UpdatedAt   string
+	DeletedAt   string
+}
+
+func (baselineComment) TableName() string { return "comments" }
+
+type baselineVote struct {
+	ID          string `gorm:"type:uuid;primarykey"`
+	Vote        int
+	CreatedByID string  `gorm:"type:uuid"`
+	EntryID     *string `gorm:"type:uuid"`
+	CommentID   *string `gorm:"type:uuid"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   *time.Time `gorm:"index"`
+}
+
+func (baselineVote) TableName() string { return "votes" }
+
+var baselineTables = []interface{}{
+	&baselineUser{},
+	&baselineFile{},
+	&baselineCity{},
+	&baselineEntry{},
+	&baselineEntryFile{},
+	&baselineComment{},
+	&baselineVote{},
+}
+
+var baseline = Migration{
+	Version: 1,
+	Name:    "baseline",
+	Up: func(tx *gorm.DB) error {
+		return tx.AutoMigrate(baselineTables...)
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(baselineTables...)
+	},
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Entry types defined at runtime by admins; built-in types stay in code
+type entryTypesV2 struct {
+	ID               string `gorm:"type:uuid;primarykey"`
+	Name             string `gorm:"uniqueIndex"`
+	Label            string
+	Description      string
+	Icon             string
+	Position         int
+	Schema           datatypes.JSON
+	FilterableFields datatypes.JSON
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+func (entryTypesV2) TableName() string { return "entry_types" }
+
+var entryTypes = Migration{
+	Version: 2,
+	Name:    "entry_types",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&entryTypesV2{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&entryTypesV2{})
+	},
+}
@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Entry lifecycle; existing entries are published and, without a date, don't expire until renewed
+type entryStatusV3 struct {
+	Status string `gorm:"default:published;index"`
+}
+
+func (entryStatusV3) TableName() string { return "entries" }
+
+type entryTypeExpiryV3 struct {
+	ExpiresAfterDays int `gorm:"default:0"`
+}
+
+func (entryTypeExpiryV3) TableName() string { return "entry_types" }
+
+var entryStatus = Migration{
+	Version: 3,
+	Name:    "entry_status",
+	Up: func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		if err := m.AddColumn(&entryStatusV3{}, "Status"); err != nil {
+			return err
+		}
+		if err := m.CreateIndex(&entryStatusV3{}, "Status"); err != nil {
+			return err
+		}
+		if err := m.AddColumn(&entryTypeExpiryV3{}, "ExpiresAfterDays"); err != nil {
+			return err
+		}
+
+		// ExpiresAt was never set, so it holds the zero time
+		return tx.Exec("UPDATE entries SET expires_at = NULL WHERE expires_at < ?", time.Date(1900, 1, 1, 0, 0, 0, 0, time.UTC)).Error
+	},
+	Down: func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		if err := m.DropColumn(&entryTypeExpiryV3{}, "ExpiresAfterDays"); err != nil {
+			return err
+		}
+		if err := m.DropIndex(&entryStatusV3{}, "Status"); err != nil {
+			return err
+		}
+		return m.DropColumn(&entryStatusV3{}, "Status")
+	},
+}
@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type reservationV4 struct {
+	ID          string `gorm:"type:uuid;primarykey"`
+	EntryID     string `gorm:"type:uuid;index"`
+	CreatedByID string `gorm:"type:uuid;index"`
+	StartDate   time.Time
+	EndDate     time.Time
+	Message     string
+	Status      string `gorm:"index"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (reservationV4) TableName() string { return "reservations" }
+
+type entryTypeBookableV4 struct {
+	Bookable bool `gorm:"default:false"`
+}
+
+func (entryTypeBookableV4) TableName() string { return "entry_types" }
+
+var reservations = Migration{
+	Version: 4,
+	Name:    "reservations",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().CreateTable(&reservationV4{}); err != nil {
+			return err
+		}
+		return tx.Migrator().AddColumn(&entryTypeBookableV4{}, "Bookable")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropColumn(&entryTypeBookableV4{}, "Bookable"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&reservationV4{})
+	},
+}
@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type availabilityBlockV5 struct {
+	ID          string `gorm:"type:uuid;primarykey"`
+	EntryID     string `gorm:"type:uuid;index"`
+	StartDate   time.Time
+	EndDate     time.Time
+	Note        string
+	Source      string
+	ExternalUID string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (availabilityBlockV5) TableName() string { return "availability_blocks" }
+
+type entryCalendarV5 struct {
+	ID           string `gorm:"type:uuid;primarykey"`
+	EntryID      string `gorm:"type:uuid;uniqueIndex"`
+	URL          string
+	LastSyncedAt *time.Time
+	LastError    string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (entryCalendarV5) TableName() string { return "entry_calendars" }
+
+var availability = Migration{
+	Version: 5,
+	Name:    "availability",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&availabilityBlockV5{}, &entryCalendarV5{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&availabilityBlockV5{}, &entryCalendarV5{})
+	},
+}
@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type orderV6 struct {
+	ID               string `gorm:"type:uuid;primarykey"`
+	EntryID          string `gorm:"type:uuid;index"`
+	BuyerID          string `gorm:"type:uuid;index"`
+	Quantity         int
+	UnitAmount       int64
+	Amount           int64
+	Currency         string
+	Status           string `gorm:"index"`
+	Provider         string
+	PaymentReference string `gorm:"index"`
+	CheckoutURL      string
+	Instructions     string
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+func (orderV6) TableName() string { return "orders" }
+
+type entryTypePurchasableV6 struct {
+	Purchasable bool `gorm:"default:false"`
+}
+
+func (entryTypePurchasableV6) TableName() string { return "entry_types" }
+
+var orders = Migration{
+	Version: 6,
+	Name:    "orders",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().CreateTable(&orderV6{}); err != nil {
+			return err
+		}
+		return tx.Migrator().AddColumn(&entryTypePurchasableV6{}, "Purchasable")
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropColumn(&entryTypePurchasableV6{}, "Purchasable"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&orderV6{})
+	},
+}
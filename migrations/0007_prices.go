@@ -0,0 +1,124 @@
+package migrations
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Normalized price of an entry, copied from data.price
+type entryPriceV7 struct {
+	PriceAmount   *int64  `gorm:"index:idx_entries_price,priority:2"`
+	PriceCurrency *string `gorm:"size:3;index:idx_entries_price,priority:1"`
+}
+
+func (entryPriceV7) TableName() string { return "entries" }
+
+type currencyRateV7 struct {
+	Base      string `gorm:"primarykey;size:3"`
+	Quote     string `gorm:"primarykey;size:3"`
+	Rate      float64
+	UpdatedAt time.Time
+}
+
+func (currencyRateV7) TableName() string { return "currency_rates" }
+
+// Prices used to be free-form strings, in whatever the community settled in
+// Those that look like an amount with up to 2 decimals are taken to be in CURRENCY (default USD); data itself is signed, so it's left as is
+func backfillPricesV7(tx *gorm.DB) error {
+	currency := strings.ToUpper(os.Getenv("CURRENCY"))
+	if currency == "" {
+		currency = "USD"
+	}
+
+	rows := []struct {
+		ID   string
+		Data string
+	}{}
+	if err := tx.Table("entries").Select("id, data").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		data := struct {
+			Price interface{} `json:"price"`
+		}{}
+		if err := json.Unmarshal([]byte(row.Data), &data); err != nil {
+			continue
+		}
+		price, ok := data.Price.(string)
+		if !ok {
+			continue
+		}
+		amount, ok := parseLegacyPriceV7(price)
+		if !ok {
+			continue
+		}
+
+		err := tx.Table("entries").Where("id = ?", row.ID).Updates(map[string]interface{}{
+			"price_amount":   amount,
+			"price_currency": currency,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseLegacyPriceV7(price string) (int64, bool) {
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(price), ".")
+	if len(fraction) > 2 {
+		return 0, false
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	units, err := strconv.ParseUint(whole, 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	cents, err := strconv.ParseUint(fraction, 10, 8)
+	if err != nil {
+		return 0, false
+	}
+	return int64(units)*100 + int64(cents), true
+}
+
+var prices = Migration{
+	Version: 7,
+	Name:    "prices",
+	Up: func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		if err := m.AddColumn(&entryPriceV7{}, "PriceAmount"); err != nil {
+			return err
+		}
+		if err := m.AddColumn(&entryPriceV7{}, "PriceCurrency"); err != nil {
+			return err
+		}
+		if err := m.CreateIndex(&entryPriceV7{}, "idx_entries_price"); err != nil {
+			return err
+		}
+		if err := m.CreateTable(&currencyRateV7{}); err != nil {
+			return err
+		}
+		return backfillPricesV7(tx)
+	},
+	Down: func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		if err := m.DropTable(&currencyRateV7{}); err != nil {
+			return err
+		}
+		if err := m.DropIndex(&entryPriceV7{}, "idx_entries_price"); err != nil {
+			return err
+		}
+		// The SQLite migrator drops columns by recreating the table, which loses its other indexes
+		if err := tx.Exec("ALTER TABLE entries DROP COLUMN price_currency").Error; err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE entries DROP COLUMN price_amount").Error
+	},
+}
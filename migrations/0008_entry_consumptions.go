@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type entryConsumptionV8 struct {
+	ID              string `gorm:"type:uuid;primarykey"`
+	EntryID         string `gorm:"type:uuid;uniqueIndex:idx_entry_consumptions_pair"`
+	ConsumedEntryID string `gorm:"type:uuid;uniqueIndex:idx_entry_consumptions_pair;index"`
+	PricingRule     string
+	CreatedAt       time.Time
+}
+
+func (entryConsumptionV8) TableName() string { return "entry_consumptions" }
+
+type subOrderV8 struct {
+	ID            string  `gorm:"type:uuid;primarykey"`
+	OrderID       *string `gorm:"type:uuid;index"`
+	ReservationID *string `gorm:"type:uuid;index"`
+	EntryID       string  `gorm:"type:uuid;index"`
+	PricingRule   string
+	Units         float64
+	Amount        int64
+	Currency      string
+	Status        string `gorm:"index"`
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+func (subOrderV8) TableName() string { return "sub_orders" }
+
+var entryConsumptions = Migration{
+	Version: 8,
+	Name:    "entry_consumptions",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().CreateTable(&entryConsumptionV8{}); err != nil {
+			return err
+		}
+		return tx.Migrator().CreateTable(&subOrderV8{})
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&subOrderV8{}); err != nil {
+			return err
+		}
+		return tx.Migrator().DropTable(&entryConsumptionV8{})
+	},
+}
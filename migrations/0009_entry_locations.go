@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Coordinates of an entry, copied from data.address
+type entryLocationV9 struct {
+	Latitude  *float64 `gorm:"index:idx_entries_location,priority:1"`
+	Longitude *float64 `gorm:"index:idx_entries_location,priority:2"`
+}
+
+func (entryLocationV9) TableName() string { return "entries" }
+
+func coordinateV9(value string, limit float64) (float64, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || f < -limit || f > limit {
+		return 0, false
+	}
+	return f, true
+}
+
+// Entries without (valid) coordinates are left out of geo searches
+func backfillLocationsV9(tx *gorm.DB) error {
+	rows := []struct {
+		ID   string
+		Data string
+	}{}
+	if err := tx.Table("entries").Select("id, data").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		data := struct {
+			Address struct {
+				Latitude  interface{} `json:"latitude"`
+				Longitude interface{} `json:"longitude"`
+			} `json:"address"`
+		}{}
+		if err := json.Unmarshal([]byte(row.Data), &data); err != nil {
+			continue
+		}
+		lat, ok := coordinateV9(stringValueV9(data.Address.Latitude), 90)
+		if !ok {
+			continue
+		}
+		lng, ok := coordinateV9(stringValueV9(data.Address.Longitude), 180)
+		if !ok {
+			continue
+		}
+
+		err := tx.Table("entries").Where("id = ?", row.ID).Updates(map[string]interface{}{
+			"latitude":  lat,
+			"longitude": lng,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Latitude and longitude are strings in the builtin types, runtime types may use numbers
+func stringValueV9(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+var entryLocations = Migration{
+	Version: 9,
+	Name:    "entry_locations",
+	Up: func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		if err := m.AddColumn(&entryLocationV9{}, "Latitude"); err != nil {
+			return err
+		}
+		if err := m.AddColumn(&entryLocationV9{}, "Longitude"); err != nil {
+			return err
+		}
+		if err := m.CreateIndex(&entryLocationV9{}, "idx_entries_location"); err != nil {
+			return err
+		}
+		return backfillLocationsV9(tx)
+	},
+	Down: func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropIndex(&entryLocationV9{}, "idx_entries_location"); err != nil {
+			return err
+		}
+		// The SQLite migrator drops columns by recreating the table, which loses its other indexes
+		if err := tx.Exec("ALTER TABLE entries DROP COLUMN longitude").Error; err != nil {
+			return err
+		}
+		return tx.Exec("ALTER TABLE entries DROP COLUMN latitude").Error
+	},
+}
@@ -0,0 +1,207 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// One row per searchable entry, city and user; kept in sync by triggers on the source tables
+type searchDocumentV10 struct {
+	ID        uint64 `gorm:"primarykey;autoIncrement"`
+	Kind      string `gorm:"not null;uniqueIndex:idx_search_documents_ref,priority:1"`
+	RefID     string `gorm:"not null;uniqueIndex:idx_search_documents_ref,priority:2"`
+	Slug      string
+	EntryType *string `gorm:"index"`
+	CityID    *string `gorm:"index"`
+	Title     *string
+	Body      *string
+}
+
+func (searchDocumentV10) TableName() string { return "search_documents" }
+
+func fts5AvailableV10(tx *gorm.DB) bool {
+	var used int
+	if err := tx.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used).Error; err != nil {
+		return false
+	}
+	return used == 1
+}
+
+// The FTS5 index reads from search_documents (external content), so it only stores the index itself
+var searchIndexSQLiteV10 = []string{
+	`CREATE VIRTUAL TABLE search_index USING fts5(title, body, content='search_documents', content_rowid='id', tokenize='porter unicode61 remove_diacritics 2')`,
+	`CREATE TRIGGER search_documents_ai AFTER INSERT ON search_documents BEGIN
+		INSERT INTO search_index(rowid, title, body) VALUES (new.id, new.title, new.body);
+	END`,
+	`CREATE TRIGGER search_documents_ad AFTER DELETE ON search_documents BEGIN
+		INSERT INTO search_index(search_index, rowid, title, body) VALUES ('delete', old.id, old.title, old.body);
+	END`,
+	`CREATE TRIGGER search_documents_au AFTER UPDATE ON search_documents BEGIN
+		INSERT INTO search_index(search_index, rowid, title, body) VALUES ('delete', old.id, old.title, old.body);
+		INSERT INTO search_index(rowid, title, body) VALUES (new.id, new.title, new.body);
+	END`,
+}
+
+var searchSyncSQLiteV10 = []string{
+	`CREATE TRIGGER search_entries_ai AFTER INSERT ON entries BEGIN
+		INSERT INTO search_documents(kind, ref_id, slug, entry_type, city_id, title, body)
+		VALUES ('entry', new.id, new.id, new.type, new.city_id, json_extract(new.data, '$.title'), json_extract(new.data, '$.description'));
+	END`,
+	`CREATE TRIGGER search_entries_au AFTER UPDATE OF type, data, city_id ON entries BEGIN
+		UPDATE search_documents SET entry_type = new.type, city_id = new.city_id,
+			title = json_extract(new.data, '$.title'), body = json_extract(new.data, '$.description')
+		WHERE kind = 'entry' AND ref_id = new.id;
+	END`,
+	`CREATE TRIGGER search_entries_ad AFTER DELETE ON entries BEGIN
+		DELETE FROM search_documents WHERE kind = 'entry' AND ref_id = old.id;
+	END`,
+	`CREATE TRIGGER search_cities_ai AFTER INSERT ON cities BEGIN
+		INSERT INTO search_documents(kind, ref_id, slug, city_id, title, body)
+		VALUES ('city', new.id, new.slug, new.id, new.name, trim(coalesce(new.state, '') || ' ' || coalesce(new.country_code, '')));
+	END`,
+	`CREATE TRIGGER search_cities_au AFTER UPDATE OF slug, name, state, country_code ON cities BEGIN
+		UPDATE search_documents SET slug = new.slug, title = new.name, body = trim(coalesce(new.state, '') || ' ' || coalesce(new.country_code, ''))
+		WHERE kind = 'city' AND ref_id = new.id;
+	END`,
+	`CREATE TRIGGER search_cities_ad AFTER DELETE ON cities BEGIN
+		DELETE FROM search_documents WHERE kind = 'city' AND ref_id = old.id;
+	END`,
+	// Soft-deleted users are taken out
+	`CREATE TRIGGER search_users_ai AFTER INSERT ON users WHEN new.deleted_at IS NULL BEGIN
+		INSERT INTO search_documents(kind, ref_id, slug, title) VALUES ('user', new.id, new.id, new.username);
+	END`,
+	`CREATE TRIGGER search_users_au AFTER UPDATE OF username, deleted_at ON users BEGIN
+		DELETE FROM search_documents WHERE kind = 'user' AND ref_id = old.id;
+		INSERT INTO search_documents(kind, ref_id, slug, title) SELECT 'user', new.id, new.id, new.username WHERE new.deleted_at IS NULL;
+	END`,
+	`CREATE TRIGGER search_users_ad AFTER DELETE ON users BEGIN
+		DELETE FROM search_documents WHERE kind = 'user' AND ref_id = old.id;
+	END`,
+}
+
+var searchSyncPostgresV10 = []string{
+	`ALTER TABLE search_documents ADD COLUMN document tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('english', coalesce(title, '')), 'A') || setweight(to_tsvector('english', coalesce(body, '')), 'B')
+	) STORED`,
+	`CREATE INDEX idx_search_documents_document ON search_documents USING GIN (document)`,
+	`CREATE FUNCTION search_sync_entries() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			DELETE FROM search_documents WHERE kind = 'entry' AND ref_id = OLD.id::text;
+			RETURN OLD;
+		END IF;
+		INSERT INTO search_documents (kind, ref_id, slug, entry_type, city_id, title, body)
+		VALUES ('entry', NEW.id::text, NEW.id::text, NEW.type, NEW.city_id::text, CAST(NEW.data AS JSONB)->>'title', CAST(NEW.data AS JSONB)->>'description')
+		ON CONFLICT (kind, ref_id) DO UPDATE SET entry_type = EXCLUDED.entry_type, city_id = EXCLUDED.city_id, title = EXCLUDED.title, body = EXCLUDED.body;
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql`,
+	`CREATE TRIGGER search_sync_entries AFTER INSERT OR UPDATE OR DELETE ON entries FOR EACH ROW EXECUTE PROCEDURE search_sync_entries()`,
+	`CREATE FUNCTION search_sync_cities() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			DELETE FROM search_documents WHERE kind = 'city' AND ref_id = OLD.id::text;
+			RETURN OLD;
+		END IF;
+		INSERT INTO search_documents (kind, ref_id, slug, city_id, title, body)
+		VALUES ('city', NEW.id::text, NEW.slug, NEW.id::text, NEW.name, trim(coalesce(NEW.state, '') || ' ' || coalesce(NEW.country_code, '')))
+		ON CONFLICT (kind, ref_id) DO UPDATE SET slug = EXCLUDED.slug, title = EXCLUDED.title, body = EXCLUDED.body;
+		RETURN NEW;
+	END;
+	$$ LANGUAGE plpgsql`,
+	`CREATE TRIGGER search_sync_cities AFTER INSERT OR UPDATE OR DELETE ON cities FOR EACH ROW EXECUTE PROCEDURE search_sync_cities()`,
+	`CREATE FUNCTION search_sync_users() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' OR NEW.deleted_at IS NOT NULL THEN
+			DELETE FROM search_documents WHERE kind = 'user' AND ref_id = OLD.id::text;
+			RETURN NULL;
+		END IF;
+		INSERT INTO search_documents (kind, ref_id, slug, title)
+		VALUES ('user', NEW.id::text, NEW.id::text, NEW.username)
+		ON CONFLICT (kind, ref_id) DO UPDATE SET title = EXCLUDED.title;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql`,
+	`CREATE TRIGGER search_sync_users AFTER INSERT OR UPDATE OR DELETE ON users FOR EACH ROW EXECUTE PROCEDURE search_sync_users()`,
+}
+
+// Existing rows; the same as search.Rebuild, frozen here
+var searchBackfillV10 = map[string][]string{
+	"sqlite": {
+		`INSERT INTO search_documents(kind, ref_id, slug, entry_type, city_id, title, body)
+		SELECT 'entry', id, id, type, city_id, json_extract(data, '$.title'), json_extract(data, '$.description') FROM entries`,
+		`INSERT INTO search_documents(kind, ref_id, slug, city_id, title, body)
+		SELECT 'city', id, slug, id, name, trim(coalesce(state, '') || ' ' || coalesce(country_code, '')) FROM cities`,
+		`INSERT INTO search_documents(kind, ref_id, slug, title)
+		SELECT 'user', id, id, username FROM users WHERE deleted_at IS NULL`,
+	},
+	"postgres": {
+		`INSERT INTO search_documents(kind, ref_id, slug, entry_type, city_id, title, body)
+		SELECT 'entry', id::text, id::text, type, city_id::text, CAST(data AS JSONB)->>'title', CAST(data AS JSONB)->>'description' FROM entries`,
+		`INSERT INTO search_documents(kind, ref_id, slug, city_id, title, body)
+		SELECT 'city', id::text, slug, id::text, name, trim(coalesce(state, '') || ' ' || coalesce(country_code, '')) FROM cities`,
+		`INSERT INTO search_documents(kind, ref_id, slug, title)
+		SELECT 'user', id::text, id::text, username FROM users WHERE deleted_at IS NULL`,
+	},
+}
+
+func execAllV10(tx *gorm.DB, statements []string) error {
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Full-text search: FTS5 on SQLite, a tsvector column on Postgres
+// SQLite needs to be built with FTS5 (go build -tags sqlite_fts5); without it, only the documents are kept, and search falls back to LIKE
+var search = Migration{
+	Version: 10,
+	Name:    "search",
+	Up: func(tx *gorm.DB) error {
+		if err := tx.Migrator().CreateTable(&searchDocumentV10{}); err != nil {
+			return err
+		}
+
+		name := tx.Dialector.Name()
+		if name == "postgres" {
+			if err := execAllV10(tx, searchSyncPostgresV10); err != nil {
+				return err
+			}
+		} else {
+			if fts5AvailableV10(tx) {
+				if err := execAllV10(tx, searchIndexSQLiteV10); err != nil {
+					return err
+				}
+			}
+			if err := execAllV10(tx, searchSyncSQLiteV10); err != nil {
+				return err
+			}
+		}
+		return execAllV10(tx, searchBackfillV10[name])
+	},
+	Down: func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			for _, table := range []string{"entries", "cities", "users"} {
+				if err := tx.Exec("DROP TRIGGER IF EXISTS search_sync_" + table + " ON " + table).Error; err != nil {
+					return err
+				}
+				if err := tx.Exec("DROP FUNCTION IF EXISTS search_sync_" + table + "()").Error; err != nil {
+					return err
+				}
+			}
+		} else {
+			for _, table := range []string{"entries", "cities", "users", "documents"} {
+				for _, op := range []string{"ai", "au", "ad"} {
+					if err := tx.Exec("DROP TRIGGER IF EXISTS search_" + table + "_" + op).Error; err != nil {
+						return err
+					}
+				}
+			}
+			if err := tx.Exec("DROP TABLE IF EXISTS search_index").Error; err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropTable(&searchDocumentV10{})
+	},
+}
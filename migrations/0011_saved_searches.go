@@ -0,0 +1,57 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+type savedSearchV11 struct {
+	ID         string `gorm:"type:uuid;primarykey"`
+	UserID     string `gorm:"type:uuid;index"`
+	Name       string
+	Query      string
+	Frequency  string
+	CheckedAt  time.Time
+	NotifiedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (savedSearchV11) TableName() string { return "saved_searches" }
+
+type savedSearchMatchV11 struct {
+	ID            string     `gorm:"type:uuid;primarykey"`
+	SavedSearchID string     `gorm:"type:uuid;uniqueIndex:idx_saved_search_matches_pair"`
+	EntryID       string     `gorm:"type:uuid;uniqueIndex:idx_saved_search_matches_pair;index"`
+	NotifiedAt    *time.Time `gorm:"index"`
+	CreatedAt     time.Time
+}
+
+func (savedSearchMatchV11) TableName() string { return "saved_search_matches" }
+
+type notificationV11 struct {
+	ID        string `gorm:"type:uuid;primarykey"`
+	UserID    string `gorm:"type:uuid;index"`
+	Kind      string
+	Title     string
+	Body      string
+	Data      datatypes.JSON
+	ReadAt    *time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+func (notificationV11) TableName() string { return "notifications" }
+
+// Saved searches, what they matched, and the in-app inbox they are sent to
+var savedSearches = Migration{
+	Version: 11,
+	Name:    "saved_searches",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&savedSearchV11{}, &savedSearchMatchV11{}, &notificationV11{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&notificationV11{}, &savedSearchMatchV11{}, &savedSearchV11{})
+	},
+}
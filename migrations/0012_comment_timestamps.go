@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+// Comments had text timestamps that were never set; they become real timestamps, so comments can be sorted and paged
+// Existing comments get the time of their entry, the earliest they could have been written
+var commentTimestampsSQLiteV12 = []string{
+	"CREATE TABLE `comments_v12` (`id` uuid,`body` text,`entry_id` uuid,`created_by_id` uuid,`created_at` datetime,`updated_at` datetime,`deleted_at` datetime,PRIMARY KEY (`id`))",
+	"INSERT INTO `comments_v12` SELECT id, body, entry_id, created_by_id, NULLIF(created_at, ''), NULLIF(updated_at, ''), NULLIF(deleted_at, '') FROM comments",
+	"DROP TABLE comments",
+	"ALTER TABLE `comments_v12` RENAME TO `comments`",
+}
+
+var commentTimestampsPostgresV12 = []string{
+	`ALTER TABLE comments
+		ALTER COLUMN created_at TYPE timestamptz USING NULLIF(created_at, '')::timestamptz,
+		ALTER COLUMN updated_at TYPE timestamptz USING NULLIF(updated_at, '')::timestamptz,
+		ALTER COLUMN deleted_at TYPE timestamptz USING NULLIF(deleted_at, '')::timestamptz`,
+}
+
+var commentTimestampsBackfillV12 = []string{
+	"UPDATE comments SET created_at = (SELECT entries.created_at FROM entries WHERE entries.id = comments.entry_id) WHERE created_at IS NULL",
+	"UPDATE comments SET updated_at = created_at WHERE updated_at IS NULL",
+	"CREATE INDEX idx_comments_entry ON comments(entry_id, created_at)",
+}
+
+var commentTimestampsDownSQLiteV12 = []string{
+	"CREATE TABLE `comments_v11` (`id` uuid,`body` text,`entry_id` uuid,`created_by_id` uuid,`created_at` text,`updated_at` text,`deleted_at` text,PRIMARY KEY (`id`))",
+	"INSERT INTO `comments_v11` SELECT id, body, entry_id, created_by_id, COALESCE(created_at, ''), COALESCE(updated_at, ''), COALESCE(deleted_at, '') FROM comments",
+	"DROP TABLE comments",
+	"ALTER TABLE `comments_v11` RENAME TO `comments`",
+}
+
+var commentTimestampsDownPostgresV12 = []string{
+	"DROP INDEX IF EXISTS idx_comments_entry",
+	`ALTER TABLE comments
+		ALTER COLUMN created_at TYPE text USING COALESCE(created_at::text, ''),
+		ALTER COLUMN updated_at TYPE text USING COALESCE(updated_at::text, ''),
+		ALTER COLUMN deleted_at TYPE text USING COALESCE(deleted_at::text, '')`,
+}
+
+var commentTimestamps = Migration{
+	Version: 12,
+	Name:    "comment_timestamps",
+	Up: func(tx *gorm.DB) error {
+		statements := commentTimestampsSQLiteV12
+		if tx.Dialector.Name() == "postgres" {
+			statements = commentTimestampsPostgresV12
+		}
+		return execAllV12(tx, append(statements, commentTimestampsBackfillV12...))
+	},
+	Down: func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			return execAllV12(tx, commentTimestampsDownPostgresV12)
+		}
+		return execAllV12(tx, commentTimestampsDownSQLiteV12)
+	},
+}
+
+func execAllV12(tx *gorm.DB, statements []string) error {
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
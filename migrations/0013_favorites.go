@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type favoriteV13 struct {
+	ID        string `gorm:"type:uuid;primarykey"`
+	UserID    string `gorm:"type:uuid;uniqueIndex:idx_favorites_pair"`
+	EntryID   string `gorm:"type:uuid;uniqueIndex:idx_favorites_pair;index"`
+	Notify    bool
+	CreatedAt time.Time
+}
+
+func (favoriteV13) TableName() string { return "favorites" }
+
+// Entries users bookmarked
+var favorites = Migration{
+	Version: 13,
+	Name:    "favorites",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&favoriteV13{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&favoriteV13{})
+	},
+}
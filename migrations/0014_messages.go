@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type conversationV14 struct {
+	ID            string    `gorm:"type:uuid;primarykey"`
+	EntryID       string    `gorm:"type:uuid;index"`
+	CreatedByID   string    `gorm:"type:uuid"`
+	LastMessageAt time.Time `gorm:"index"`
+	CreatedAt     time.Time
+}
+
+func (conversationV14) TableName() string { return "conversations" }
+
+type conversationParticipantV14 struct {
+	ID             string `gorm:"type:uuid;primarykey"`
+	ConversationID string `gorm:"type:uuid;uniqueIndex:idx_conversation_participants_pair"`
+	UserID         string `gorm:"type:uuid;uniqueIndex:idx_conversation_participants_pair;index"`
+	LastReadAt     *time.Time
+	ClearedAt      *time.Time
+	CreatedAt      time.Time
+}
+
+func (conversationParticipantV14) TableName() string { return "conversation_participants" }
+
+type messageV14 struct {
+	ID             string `gorm:"type:uuid;primarykey"`
+	ConversationID string `gorm:"type:uuid;index:idx_messages_conversation,priority:1"`
+	SenderID       string `gorm:"type:uuid"`
+	Body           string
+	Encrypted      bool
+	CreatedAt      time.Time `gorm:"index:idx_messages_conversation,priority:2"`
+}
+
+func (messageV14) TableName() string { return "messages" }
+
+type userBlockV14 struct {
+	ID        string `gorm:"type:uuid;primarykey"`
+	UserID    string `gorm:"type:uuid;uniqueIndex:idx_user_blocks_pair"`
+	BlockedID string `gorm:"type:uuid;uniqueIndex:idx_user_blocks_pair"`
+	CreatedAt time.Time
+}
+
+func (userBlockV14) TableName() string { return "user_blocks" }
+
+// Private conversations about entries, and users blocking others
+var messages = Migration{
+	Version: 14,
+	Name:    "messages",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&conversationV14{}, &conversationParticipantV14{}, &messageV14{}, &userBlockV14{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&userBlockV14{}, &messageV14{}, &conversationParticipantV14{}, &conversationV14{})
+	},
+}
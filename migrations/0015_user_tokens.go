@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type userTokenV15 struct {
+	ID        string `gorm:"type:uuid;primarykey"`
+	UserID    string `gorm:"type:uuid;index"`
+	Purpose   string
+	TokenHash string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (userTokenV15) TableName() string { return "user_tokens" }
+
+// Single-use tokens sent to users; for ex. to confirm their email
+var userTokens = Migration{
+	Version: 15,
+	Name:    "user_tokens",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&userTokenV15{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&userTokenV15{})
+	},
+}
@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"gorm.io/gorm"
+)
+
+type userTokenVersionV16 struct {
+	TokenVersion int `gorm:"not null;default:0"`
+}
+
+func (userTokenVersionV16) TableName() string { return "users" }
+
+// Bumped when the password changes, so logins issued before stop working
+var userTokenVersion = Migration{
+	Version: 16,
+	Name:    "user_token_version",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().AddColumn(&userTokenVersionV16{}, "TokenVersion")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&userTokenVersionV16{}, "TokenVersion")
+	},
+}
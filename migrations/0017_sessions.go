@@ -0,0 +1,34 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type sessionV17 struct {
+	ID                string `gorm:"type:uuid;primarykey"`
+	UserID            string `gorm:"type:uuid;index"`
+	RefreshTokenHash  string `gorm:"uniqueIndex"`
+	PreviousTokenHash string `gorm:"index"`
+	UserAgent         string
+	IP                string
+	ExpiresAt         time.Time
+	LastUsedAt        time.Time
+	RevokedAt         *time.Time `gorm:"index"`
+	CreatedAt         time.Time
+}
+
+func (sessionV17) TableName() string { return "sessions" }
+
+// Logins with refresh tokens, that can be revoked
+var sessions = Migration{
+	Version: 17,
+	Name:    "sessions",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().CreateTable(&sessionV17{})
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropTable(&sessionV17{})
+	},
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type userSuspensionV18 struct {
+	SuspendedAt *time.Time
+}
+
+func (userSuspensionV18) TableName() string { return "users" }
+
+// Suspended users can't use their account, until an admin lifts it
+var userSuspension = Migration{
+	Version: 18,
+	Name:    "user_suspension",
+	Up: func(tx *gorm.DB) error {
+		return tx.Migrator().AddColumn(&userSuspensionV18{}, "SuspendedAt")
+	},
+	Down: func(tx *gorm.DB) error {
+		return tx.Migrator().DropColumn(&userSuspensionV18{}, "SuspendedAt")
+	},
+}
@@ -0,0 +1,64 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type userTwoFactorV19 struct {
+	TOTPSecret    string
+	TOTPEnabledAt *time.Time
+	TOTPLastStep  int64 `gorm:"not null;default:0"`
+}
+
+func (userTwoFactorV19) TableName() string { return "users" }
+
+type userTokenAttemptsV19 struct {
+	Attempts int `gorm:"not null;default:0"`
+}
+
+func (userTokenAttemptsV19) TableName() string { return "user_tokens" }
+
+type recoveryCodeV19 struct {
+	ID        string `gorm:"type:uuid;primarykey"`
+	UserID    string `gorm:"type:uuid;index"`
+	CodeHash  string
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (recoveryCodeV19) TableName() string { return "recovery_codes" }
+
+// Optional TOTP for logins, with one-time recovery codes; login challenges are user tokens with a limit of attempts
+var twoFactor = Migration{
+	Version: 19,
+	Name:    "two_factor",
+	Up: func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		for _, column := range []string{"TOTPSecret", "TOTPEnabledAt", "TOTPLastStep"} {
+			if err := m.AddColumn(&userTwoFactorV19{}, column); err != nil {
+				return err
+			}
+		}
+		if err := m.AddColumn(&userTokenAttemptsV19{}, "Attempts"); err != nil {
+			return err
+		}
+		return m.CreateTable(&recoveryCodeV19{})
+	},
+	Down: func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		if err := m.DropTable(&recoveryCodeV19{}); err != nil {
+			return err
+		}
+		if err := m.DropColumn(&userTokenAttemptsV19{}, "Attempts"); err != nil {
+			return err
+		}
+		for _, column := range []string{"TOTPSecret", "TOTPEnabledAt", "TOTPLastStep"} {
+			if err := m.DropColumn(&userTwoFactorV19{}, column); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
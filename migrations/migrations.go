@@ -0,0 +1,227 @@
+package migrations
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A single, versioned schema change
+// Versions are applied in ascending order and must never change once released
+//
+// Notes:
+//   - Up and Down run in a transaction, together with the schema_migrations bookkeeping
+//   - Never reference the structs in model; they change over time. Declare a frozen copy of what the migration needs instead
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// Record of an applied migration
+type SchemaMigration struct {
+	Version   int64  `gorm:"primarykey;autoIncrement:false"`
+	Name      string `gorm:"not null"`
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+func (s MigrationStatus) IsApplied() bool {
+	return s.AppliedAt != nil
+}
+
+// All migrations, in order; append new ones at the end
+var All = []Migration{
+	baseline,
+	entryTypes,
+	entryStatus,
+	reservations,
+	availability,
+	orders,
+	prices,
+	entryConsumptions,
+	entryLocations,
+	search,
+	savedSearches,
+	commentTimestamps,
+	favorites,
+	messages,
+	userTokens,
+	userTokenVersion,
+	sessions,
+	userSuspension,
+	twoFactor,
+}
+
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration
+}
+
+func New(db *gorm.DB) *Migrator {
+	return &Migrator{DB: db, Migrations: All}
+}
+
+func (m *Migrator) init() error {
+	if err := m.DB.AutoMigrate(&SchemaMigration{}); err != nil {
+		return err
+	}
+
+	// Catch mistakes early; for ex. two migrations with the same version
+	for i := 1; i < len(m.Migrations); i++ {
+		if m.Migrations[i].Version <= m.Migrations[i-1].Version {
+			return fmt.Errorf("migration %d (%s) is out of order", m.Migrations[i].Version, m.Migrations[i].Name)
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) applied() (map[int64]SchemaMigration, error) {
+	records := []SchemaMigration{}
+	if err := m.DB.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	applied := map[int64]SchemaMigration{}
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	status := []MigrationStatus{}
+	for _, migration := range m.Migrations {
+		s := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if r, ok := applied[migration.Version]; ok {
+			appliedAt := r.AppliedAt
+			s.AppliedAt = &appliedAt
+		}
+		status = append(status, s)
+	}
+
+	return status, nil
+}
+
+func (m *Migrator) Pending() ([]Migration, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []Migration{}
+	for _, migration := range m.Migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// Applies all pending migrations, each in its own transaction
+// Stops at the first failure; everything before it stays applied
+func (m *Migrator) Up() ([]Migration, error) {
+	pending, err := m.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Migration{}
+	for _, migration := range pending {
+		err := m.DB.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+// Rolls back the last n applied migrations, newest first
+func (m *Migrator) Down(n int) ([]Migration, error) {
+	if err := m.init(); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []int64{}
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+	done := []Migration{}
+	for _, v := range versions {
+		if len(done) >= n {
+			break
+		}
+
+		migration, ok := m.find(v)
+		if !ok {
+			return done, fmt.Errorf("migration %d is applied but unknown to this build", v)
+		}
+
+		err := m.DB.Transaction(func(tx *gorm.DB) error {
+			if err := migration.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, "version = ?", migration.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("rollback of migration %d (%s) failed: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+
+	return done, nil
+}
+
+func (m *Migrator) find(version int64) (Migration, bool) {
+	for _, migration := range m.Migrations {
+		if migration.Version == version {
+			return migration, true
+		}
+	}
+	return Migration{}, false
+}
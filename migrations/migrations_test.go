@@ -0,0 +1,97 @@
+package migrations_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"tbd/migrations"
+)
+
+// SQLite always runs; Postgres only if TEST_POSTGRES_DSN is set
+// The Postgres database should be empty; every migration is rolled back at the end
+func openDatabases(t *testing.T) map[string]*gorm.DB {
+	dbs := map[string]*gorm.DB{}
+
+	sqliteDB, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	dbs["sqlite"] = sqliteDB
+
+	if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+		pgDB, err := gorm.Open(postgres.Open(dsn), &gorm.Config{DisableForeignKeyConstraintWhenMigrating: true})
+		assert.NoError(t, err)
+		dbs["postgres"] = pgDB
+	} else {
+		t.Log("TEST_POSTGRES_DSN not set; skipping Postgres")
+	}
+
+	return dbs
+}
+
+func TestMigrationsUpAndDown(t *testing.T) {
+	for name, db := range openDatabases(t) {
+		t.Run(name, func(t *testing.T) {
+			m := migrations.New(db)
+
+			pending, err := m.Pending()
+			assert.NoError(t, err)
+			assert.Equal(t, len(migrations.All), len(pending))
+
+			applied, err := m.Up()
+			assert.NoError(t, err)
+			assert.Equal(t, len(migrations.All), len(applied))
+
+			status, err := m.Status()
+			assert.NoError(t, err)
+			for _, s := range status {
+				assert.True(t, s.IsApplied(), "migration %d is not applied", s.Version)
+			}
+
+			// Nothing left to do
+			applied, err = m.Up()
+			assert.NoError(t, err)
+			assert.Empty(t, applied)
+
+			// Roll back one step and re-apply it
+			rolledBack, err := m.Down(1)
+			assert.NoError(t, err)
+			assert.Len(t, rolledBack, 1)
+			assert.Equal(t, migrations.All[len(migrations.All)-1].Version, rolledBack[0].Version)
+
+			applied, err = m.Up()
+			assert.NoError(t, err)
+			assert.Len(t, applied, 1)
+
+			// Roll back everything
+			rolledBack, err = m.Down(len(migrations.All))
+			assert.NoError(t, err)
+			assert.Equal(t, len(migrations.All), len(rolledBack))
+
+			tables, err := db.Migrator().GetTables()
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, []string{"schema_migrations"}, tables)
+		})
+	}
+}
+
+func TestMigrationsOutOfOrder(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+
+	noop := func(tx *gorm.DB) error { return nil }
+	m := &migrations.Migrator{
+		DB: db,
+		Migrations: []migrations.Migration{
+			{Version: 2, Name: "second", Up: noop, Down: noop},
+			{Version: 1, Name: "first", Up: noop, Down: noop},
+		},
+	}
+
+	_, err = m.Up()
+	assert.Error(t, err)
+}
@@ -8,6 +8,6 @@ type Address struct {
 	City      string `json:"city"`
 	State     string `json:"state"`
 	Country   string `json:"country"`
-	Latitude  string `json:"latitude"`
-	Longitude string `json:"longitude"`
+	Latitude  string `json:"latitude" validate:"omitempty,latitude"`
+	Longitude string `json:"longitude" validate:"omitempty,longitude"`
 }
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	AvailabilitySourceManual = "manual"
+	AvailabilitySourceICal   = "ical"
+)
+
+// Period in which an entry cannot be booked; the period is half-open, like reservations
+//
+// Notes:
+//   - Blocks from an imported calendar (Source ical) are replaced on every sync; ExternalUID is the UID of the event
+//   - Manual blocks are left alone by the sync
+type AvailabilityBlock struct {
+	ID          string    `json:"id" gorm:"type:uuid;primarykey"`
+	EntryID     string    `json:"-" gorm:"type:uuid;index"`
+	StartDate   time.Time `json:"start_date"`
+	EndDate     time.Time `json:"end_date"`
+	Note        string    `json:"note"`
+	Source      string    `json:"source"`
+	ExternalUID string    `json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (base *AvailabilityBlock) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+type SubmitAvailabilityBlock struct {
+	StartDate time.Time `json:"start_date" validate:"required"`
+	EndDate   time.Time `json:"end_date" validate:"required"`
+	Note      string    `json:"note"`
+}
+
+// Remote calendar that's imported as availability blocks; one per entry
+type EntryCalendar struct {
+	ID           string     `json:"-" gorm:"type:uuid;primarykey"`
+	EntryID      string     `json:"-" gorm:"type:uuid;uniqueIndex"`
+	URL          string     `json:"url"`
+	LastSyncedAt *time.Time `json:"last_synced_at"`
+	LastError    string     `json:"last_error"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func (base *EntryCalendar) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+type SubmitEntryCalendar struct {
+	URL string `json:"url" validate:"required,url"`
+}
+
+// Busy period, as shown to anyone; reservations are included without who made them
+type BusyPeriod struct {
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	Reason    string    `json:"reason"`
+}
@@ -1,6 +1,9 @@
 package model
 
 import (
+	"database/sql"
+	"time"
+
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -15,9 +18,9 @@ type Comment struct {
 	Entry       *Entry `json:"entry,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	CreatedByID string `json:"-"  gorm:"type:uuid"`
 	CreatedBy   *User  `json:"created_by,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-	CreatedAt   string `json:"created_at"`
-	UpdatedAt   string `json:"updated_at"`
-	DeletedAt   string `json:"deleted_at"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	DeletedAt   sql.NullTime
 }
 
 // InResponseTo *PublicComment `json:"in_response_to,omitempty"`
@@ -25,6 +28,7 @@ type PublicComment struct {
 	ID        string     `json:"id"`
 	Body      string     `json:"body"`
 	CreatedBy PublicUser `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
 }
 
 type MakeComment struct {
@@ -38,8 +42,9 @@ type EditComment struct {
 
 func (c Comment) ToPublicFormat(domain string) interface{} {
 	pc := PublicComment{
-		ID:   c.ID,
-		Body: c.Body,
+		ID:        c.ID,
+		Body:      c.Body,
+		CreatedAt: c.CreatedAt,
 	}
 
 	if c.CreatedBy != nil {
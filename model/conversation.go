@@ -0,0 +1,202 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// A conversation can't have more participants than this, including the one who starts it
+const MaxConversationParticipants = 10
+
+// Messages are at most this long; encrypted ones may be longer, as armor and keys take room
+const (
+	MaxMessageLength          = 5000
+	MaxEncryptedMessageLength = 20000
+)
+
+// A private conversation between two or more users about an entry; the owner of the entry is always a participant
+// LastMessageAt is when the last message was sent, to sort conversations by
+type Conversation struct {
+	ID            string                    `json:"id" gorm:"type:uuid;primarykey"`
+	EntryID       string                    `json:"-" gorm:"type:uuid;index"`
+	Entry         *Entry                    `json:"entry,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedByID   string                    `json:"-" gorm:"type:uuid"`
+	Participants  []ConversationParticipant `json:"participants,omitempty"`
+	LastMessageAt time.Time                 `json:"last_message_at" gorm:"index"`
+	CreatedAt     time.Time                 `json:"created_at"`
+}
+
+// A user in a conversation
+//
+// Notes:
+//   - Messages up to LastReadAt were read; the rest, sent by others, are unread
+//   - ClearedAt is set when the user deletes the conversation; they don't see messages until then anymore
+//     A deleted conversation comes back with the next message, for the user who deleted it only
+type ConversationParticipant struct {
+	ID             string     `json:"-" gorm:"type:uuid;primarykey"`
+	ConversationID string     `json:"-" gorm:"type:uuid;uniqueIndex:idx_conversation_participants_pair"`
+	UserID         string     `json:"-" gorm:"type:uuid;uniqueIndex:idx_conversation_participants_pair;index"`
+	User           *User      `json:"user,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	LastReadAt     *time.Time `json:"-"`
+	ClearedAt      *time.Time `json:"-"`
+	CreatedAt      time.Time  `json:"-"`
+}
+
+// With Encrypted, Body is an armored PGP message the sender encrypted to the public keys of all participants
+// It's stored and returned as is; only participants can decrypt it, the server never does
+type Message struct {
+	ID             string    `json:"id" gorm:"type:uuid;primarykey"`
+	ConversationID string    `json:"-" gorm:"type:uuid;index:idx_messages_conversation,priority:1"`
+	SenderID       string    `json:"-" gorm:"type:uuid"`
+	Sender         *User     `json:"sender,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Body           string    `json:"body"`
+	Encrypted      bool      `json:"encrypted"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index:idx_messages_conversation,priority:2"`
+}
+
+// A user who doesn't want to hear from another; they can't start conversations with them, or send messages in one
+type UserBlock struct {
+	ID        string    `json:"-" gorm:"type:uuid;primarykey"`
+	UserID    string    `json:"-" gorm:"type:uuid;uniqueIndex:idx_user_blocks_pair"`
+	BlockedID string    `json:"-" gorm:"type:uuid;uniqueIndex:idx_user_blocks_pair"`
+	Blocked   *User     `json:"user,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Conversation to be returned to client; Unread is the number of messages from others the user hasn't read
+type PublicConversation struct {
+	ID            string       `json:"id"`
+	Entry         *PublicEntry `json:"entry,omitempty"`
+	Participants  []PublicUser `json:"participants"`
+	LastMessageAt time.Time    `json:"last_message_at"`
+	Unread        int64        `json:"unread"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+type PublicMessage struct {
+	ID        string     `json:"id"`
+	Sender    PublicUser `json:"sender"`
+	Body      string     `json:"body"`
+	Encrypted bool       `json:"encrypted"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type PublicUserBlock struct {
+	User      PublicUser `json:"user"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Starts a conversation about an entry; its owner is added to ParticipantIDs
+// With Encrypted, Body must be an armored PGP message encrypted to the public keys of all participants; see Message
+type SubmitConversation struct {
+	EntryID        string   `json:"entry_id" validate:"required,uuid"`
+	ParticipantIDs []string `json:"participant_ids" validate:"omitempty,max=9,dive,uuid"`
+	Body           string   `json:"body" validate:"required,max=20000"`
+	Encrypted      bool     `json:"encrypted"`
+}
+
+type SubmitMessage struct {
+	Body      string `json:"body" validate:"required,max=20000"`
+	Encrypted bool   `json:"encrypted"`
+}
+
+type SubmitUserBlock struct {
+	UserID string `json:"user_id" validate:"required,uuid"`
+}
+
+// Total unread messages, and in how many conversations
+type UnreadMessages struct {
+	Conversations int64 `json:"conversations"`
+	Messages      int64 `json:"messages"`
+}
+
+func (base *Conversation) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+func (base *ConversationParticipant) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+func (base *Message) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+func (base *UserBlock) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+// Unread isn't known here; see the handler
+func (c Conversation) ToPublicFormat(domain string) interface{} {
+	pc := PublicConversation{
+		ID:            c.ID,
+		Participants:  []PublicUser{},
+		LastMessageAt: c.LastMessageAt,
+		CreatedAt:     c.CreatedAt,
+	}
+	if c.Entry != nil {
+		pe := c.Entry.ToPublicFormat(domain).(PublicEntry)
+		pc.Entry = &pe
+	}
+	for _, p := range c.Participants {
+		if p.User != nil {
+			pc.Participants = append(pc.Participants, p.User.ToPublicFormat(domain).(PublicUser))
+		}
+	}
+	return pc
+}
+
+func (m Message) ToPublicFormat(domain string) interface{} {
+	pm := PublicMessage{
+		ID:        m.ID,
+		Body:      m.Body,
+		Encrypted: m.Encrypted,
+		CreatedAt: m.CreatedAt,
+	}
+	if m.Sender != nil {
+		pm.Sender = m.Sender.ToPublicFormat(domain).(PublicUser)
+	}
+	return pm
+}
+
+func (b UserBlock) ToPublicFormat(domain string) interface{} {
+	pb := PublicUserBlock{CreatedAt: b.CreatedAt}
+	if b.Blocked != nil {
+		pb.User = b.Blocked.ToPublicFormat(domain).(PublicUser)
+	}
+	return pb
+}
+
+func (c PublicConversation) ToPublicFormat(domain string) interface{} {
+	return c
+}
+
+func (m PublicMessage) ToPublicFormat(domain string) interface{} {
+	return m
+}
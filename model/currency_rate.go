@@ -0,0 +1,41 @@
+package model
+
+import (
+	"math"
+	"time"
+)
+
+// 1 Base is worth Rate Quote, in major units; for ex. EUR/USD 1.08
+// Maintained by admins; rates are only used to compare prices across currencies, never to charge
+type CurrencyRate struct {
+	Base      string    `json:"base" gorm:"primarykey;size:3"`
+	Quote     string    `json:"quote" gorm:"primarykey;size:3"`
+	Rate      float64   `json:"rate"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type SubmitCurrencyRate struct {
+	Rate float64 `json:"rate" validate:"required,gt=0"`
+}
+
+// What an amount in minor units of each currency is multiplied with, to get minor units of target
+// Uses the direct rate, or the inverse of the opposite one; currencies without either are left out
+func ConversionFactors(rates []CurrencyRate, target string) map[string]float64 {
+	factors := map[string]float64{target: 1}
+	for _, r := range rates {
+		if r.Rate <= 0 {
+			continue
+		}
+		switch target {
+		case r.Quote:
+			factors[r.Base] = r.Rate * math.Pow10(CurrencyExponent(target)-CurrencyExponent(r.Base))
+		case r.Base:
+			// A direct rate wins over the inverse of another one
+			if _, ok := factors[r.Quote]; ok && r.Quote != target {
+				continue
+			}
+			factors[r.Quote] = 1 / r.Rate * math.Pow10(CurrencyExponent(target)-CurrencyExponent(r.Quote))
+		}
+	}
+	return factors
+}
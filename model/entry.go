@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,22 +9,16 @@ import (
 	"gorm.io/gorm"
 )
 
-var entryTypes = []string{
-	// > 3 months
-	"apartment-short-term-rental",
-	// < 3 months
-	"apartment-long-term-rental",
-	"pet-sitter",
-	"item-sale",
-	"looking-for",
-}
-
 // Primary entry struct for DB interactions
 // Data is signed and what's transferred should the user move communities
 // City is extracted from Data and matched to the most applicable on the community; if none is found, one is created
+// CityID is nil if Data has no city
 // Flow is data -> entry; so if the user updates the City in entry.data.address.city, entry.city is updated
 // Country is ISO code
 // State is english name
+// Status and ExpiresAt follow the lifecycle in entry_status.go; ExpiresAt is nil if the entry doesn't expire
+// PriceAmount and PriceCurrency are copied from Data (see SetPrice), so prices can be filtered and sorted; nil if Data has no price
+// Latitude and Longitude are copied from data.address the same way (see SetLocation)
 type Entry struct {
 	ID            string         `json:"id" gorm:"type:uuid;primarykey"`
 	Type          string         `json:"type" validate:"required"`
@@ -32,14 +27,19 @@ type Entry struct {
 	Files         []File         `json:"files,omitempty" gorm:"many2many:entry_files;"`
 	CreatedByID   string         `json:"-"  gorm:"type:uuid"`
 	CreatedBy     *User          `json:"created_by,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-	CityID        string         `json:"-" gorm:"type:uuid"`
+	CityID        *string        `json:"-" gorm:"type:uuid"`
 	City          *City          `json:"city,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Status        string         `json:"status" gorm:"default:published;index"`
+	PriceAmount   *int64         `json:"-" gorm:"index:idx_entries_price,priority:2"`
+	PriceCurrency *string        `json:"-" gorm:"size:3;index:idx_entries_price,priority:1"`
+	Latitude      *float64       `json:"-" gorm:"index:idx_entries_location,priority:1"`
+	Longitude     *float64       `json:"-" gorm:"index:idx_entries_location,priority:2"`
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
-	ExpiresAt     time.Time
+	ExpiresAt     *time.Time `json:"expires_at"`
 }
 
-// Entry to be returned to client
+// Entry to be returned to client; DistanceKm is only set when searching near a point
 type PublicEntry struct {
 	ID              string         `json:"id"`
 	IDWithLocalPart string         `json:"id_with_local_part"`
@@ -49,10 +49,15 @@ type PublicEntry struct {
 	Files           []PublicFile   `json:"files,omitempty"`
 	City            PublicCity     `json:"city,omitempty"`
 	CreatedBy       PublicUser     `json:"created_by,omitempty"`
+	Status          string         `json:"status"`
+	Price           *Money         `json:"price,omitempty"`
+	DistanceKm      *float64       `json:"distance_km,omitempty"`
 	CreatedAt       time.Time      `json:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at"`
+	ExpiresAt       *time.Time     `json:"expires_at"`
 	UpVotes         *int64         `json:"up_votes"`
 	DownVotes       *int64         `json:"down_votes"`
+	Favorites       *int64         `json:"favorites"`
 }
 
 func (base *Entry) BeforeCreate(tx *gorm.DB) (err error) {
@@ -65,19 +70,16 @@ func (base *Entry) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+// Status may be draft or published (default)
 type SubmitEntry struct {
-	Type  string         `json:"type" validate:"required"`
-	Data  datatypes.JSON `json:"data" validate:"required"`
-	Files []File         `json:"files" gorm:"many2many:entry_files;"`
+	Type   string         `json:"type" validate:"required"`
+	Data   datatypes.JSON `json:"data" validate:"required"`
+	Files  []File         `json:"files" gorm:"many2many:entry_files;"`
+	Status string         `json:"status" validate:"omitempty,oneof=draft published"`
 }
 
-func (e Entry) TypeIsValid() bool {
-	for _, v := range entryTypes {
-		if v == e.Type {
-			return true
-		}
-	}
-	return false
+type SubmitEntryStatus struct {
+	Status string `json:"status" validate:"required"`
 }
 
 func (e Entry) ToPublicFormat(domain string) interface{} {
@@ -103,12 +105,58 @@ func (e Entry) ToPublicFormat(domain string) interface{} {
 		pe.CreatedBy = e.CreatedBy.ToPublicFormat(domain).(PublicUser)
 	}
 
+	pe.Status = e.Status
+	if e.PriceAmount != nil && e.PriceCurrency != nil {
+		pe.Price = &Money{Amount: *e.PriceAmount, Currency: *e.PriceCurrency}
+	}
 	pe.CreatedAt = e.CreatedAt
 	pe.UpdatedAt = e.UpdatedAt
+	pe.ExpiresAt = e.ExpiresAt
 
 	return pe
 }
 
+// Copies the price from Data; call it whenever Data changes
+func (e *Entry) SetPrice() error {
+	price, err := PriceFromData(e.Data)
+	if err != nil {
+		return err
+	}
+
+	e.PriceAmount, e.PriceCurrency = nil, nil
+	if price != nil {
+		e.PriceAmount = &price.Amount
+		e.PriceCurrency = &price.Currency
+	}
+	return nil
+}
+
+// Copies the coordinates from data.address; call it whenever Data changes
+func (e *Entry) SetLocation() error {
+	location, err := LocationFromData(e.Data)
+	if err != nil {
+		return err
+	}
+
+	e.Latitude, e.Longitude = nil, nil
+	if location != nil {
+		e.Latitude = &location.Lat
+		e.Longitude = &location.Lng
+	}
+	return nil
+}
+
+// data.title; empty if Data has none
+func (e Entry) Title() string {
+	data := struct {
+		Title string `json:"title"`
+	}{}
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		return ""
+	}
+	return data.Title
+}
+
 func (e PublicEntry) ToPublicFormat(domain string) interface{} {
 	return e
 }
@@ -0,0 +1,159 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// How a consumed entry is charged; its price is the rate
+const (
+	PricingRuleFlat    = "flat"
+	PricingRulePerItem = "per_item"
+	PricingRulePerKm   = "per_km"
+	PricingRulePerMile = "per_mile"
+)
+
+const kmPerMile = 1.609344
+
+// An entry (the composite) consumes another entry to be fulfilled; for ex. a pizza consumes a delivery
+//
+// Notes:
+//   - Only the owner of the composite adds what it consumes; the consumed entry may belong to anyone
+//   - The consumed entry's price is the rate; PricingRule decides what it's multiplied with
+//   - A consumed entry can't consume entries itself; composites are one level deep
+type EntryConsumption struct {
+	ID              string    `json:"id" gorm:"type:uuid;primarykey"`
+	EntryID         string    `json:"-" gorm:"type:uuid;uniqueIndex:idx_entry_consumptions_pair"`
+	Entry           *Entry    `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	ConsumedEntryID string    `json:"-" gorm:"type:uuid;uniqueIndex:idx_entry_consumptions_pair;index"`
+	ConsumedEntry   *Entry    `json:"consumed_entry,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	PricingRule     string    `json:"pricing_rule"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// EntryConsumption to be returned to client
+type PublicEntryConsumption struct {
+	ID            string       `json:"id"`
+	ConsumedEntry *PublicEntry `json:"consumed_entry,omitempty"`
+	PricingRule   string       `json:"pricing_rule"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+type SubmitEntryConsumption struct {
+	ConsumedEntryID string `json:"consumed_entry_id" validate:"required,uuid"`
+	PricingRule     string `json:"pricing_rule" validate:"required,oneof=flat per_item per_km per_mile"`
+}
+
+func (base *EntryConsumption) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+func (ec EntryConsumption) ToPublicFormat(domain string) interface{} {
+	pc := PublicEntryConsumption{
+		ID:          ec.ID,
+		PricingRule: ec.PricingRule,
+		CreatedAt:   ec.CreatedAt,
+	}
+
+	if ec.ConsumedEntry != nil {
+		pe := ec.ConsumedEntry.ToPublicFormat(domain).(PublicEntry)
+		pc.ConsumedEntry = &pe
+	}
+
+	return pc
+}
+
+// What's being quoted; DistanceKm is only needed for per_km and per_mile parts
+type QuoteRequest struct {
+	Quantity   int     `query:"quantity" json:"quantity" validate:"omitempty,min=1,max=1000"`
+	DistanceKm float64 `query:"distance_km" json:"distance_km" validate:"omitempty,min=0,max=20000"`
+}
+
+// One line per entry; Units is what the price is multiplied with, for ex. 2 items, or 3.5 miles
+type QuoteLine struct {
+	EntryID     string  `json:"entry_id"`
+	PricingRule string  `json:"pricing_rule,omitempty"`
+	UnitPrice   Money   `json:"unit_price"`
+	Units       float64 `json:"units"`
+	Amount      Money   `json:"amount"`
+}
+
+// Lines are in the currency of their entry; Total is in the currency of the composite
+type Quote struct {
+	Lines []QuoteLine `json:"lines"`
+	Total Money       `json:"total"`
+}
+
+var (
+	ErrNoPrice    = errors.New("entry has no price")
+	ErrNoRate     = errors.New("no rate to convert currency")
+	ErrNoDistance = errors.New("distance is required")
+)
+
+// Prices the composite and every part; parts in another currency are converted with rates
+func QuoteEntry(composite Entry, parts []EntryConsumption, req QuoteRequest, rates []CurrencyRate) (Quote, error) {
+	if req.Quantity < 1 {
+		req.Quantity = 1
+	}
+	if composite.PriceAmount == nil || composite.PriceCurrency == nil {
+		return Quote{}, ErrNoPrice
+	}
+
+	currency := *composite.PriceCurrency
+	factors := ConversionFactors(rates, currency)
+
+	q := Quote{Total: Money{Currency: currency}}
+	q.Lines = append(q.Lines, quoteLine(composite.ID, "", Money{Amount: *composite.PriceAmount, Currency: currency}, float64(req.Quantity)))
+	q.Total.Amount = q.Lines[0].Amount.Amount
+
+	for _, p := range parts {
+		if p.ConsumedEntry == nil || p.ConsumedEntry.PriceAmount == nil || p.ConsumedEntry.PriceCurrency == nil {
+			return Quote{}, ErrNoPrice
+		}
+		price := Money{Amount: *p.ConsumedEntry.PriceAmount, Currency: *p.ConsumedEntry.PriceCurrency}
+
+		units := 1.0
+		switch p.PricingRule {
+		case PricingRulePerItem:
+			units = float64(req.Quantity)
+		case PricingRulePerKm, PricingRulePerMile:
+			if req.DistanceKm <= 0 {
+				return Quote{}, ErrNoDistance
+			}
+			units = req.DistanceKm
+			if p.PricingRule == PricingRulePerMile {
+				units = req.DistanceKm / kmPerMile
+			}
+		}
+
+		line := quoteLine(p.ConsumedEntryID, p.PricingRule, price, units)
+		factor, ok := factors[price.Currency]
+		if !ok {
+			return Quote{}, ErrNoRate
+		}
+		q.Lines = append(q.Lines, line)
+		q.Total.Amount += int64(math.Round(float64(line.Amount.Amount) * factor))
+	}
+
+	return q, nil
+}
+
+func quoteLine(entryID, rule string, price Money, units float64) QuoteLine {
+	return QuoteLine{
+		EntryID:     entryID,
+		PricingRule: rule,
+		UnitPrice:   price,
+		Units:       units,
+		Amount:      Money{Amount: int64(math.Round(float64(price.Amount) * units)), Currency: price.Currency},
+	}
+}
@@ -0,0 +1,56 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"tbd/model"
+)
+
+func pricedEntry(id string, amount int64, currency string) *model.Entry {
+	return &model.Entry{ID: id, PriceAmount: &amount, PriceCurrency: &currency}
+}
+
+func TestQuoteEntry(t *testing.T) {
+	pizza := *pricedEntry("pizza", 1000, "USD")
+	parts := []model.EntryConsumption{
+		{ConsumedEntryID: "box", ConsumedEntry: pricedEntry("box", 50, "USD"), PricingRule: model.PricingRulePerItem},
+		{ConsumedEntryID: "delivery", ConsumedEntry: pricedEntry("delivery", 200, "USD"), PricingRule: model.PricingRulePerMile},
+		{ConsumedEntryID: "tip", ConsumedEntry: pricedEntry("tip", 100, "EUR"), PricingRule: model.PricingRuleFlat},
+	}
+	rates := []model.CurrencyRate{{Base: "EUR", Quote: "USD", Rate: 1.25}}
+
+	q, err := model.QuoteEntry(pizza, parts, model.QuoteRequest{Quantity: 2, DistanceKm: 1.609344 * 3}, rates)
+	assert.NoError(t, err)
+	assert.Len(t, q.Lines, 4)
+	assert.Equal(t, int64(2000), q.Lines[0].Amount.Amount)
+	assert.Equal(t, int64(100), q.Lines[1].Amount.Amount)
+	assert.Equal(t, int64(600), q.Lines[2].Amount.Amount)
+	assert.Equal(t, model.Money{Amount: 100, Currency: "EUR"}, q.Lines[3].Amount)
+	assert.Equal(t, model.Money{Amount: 2000 + 100 + 600 + 125, Currency: "USD"}, q.Total)
+
+	// Quantity defaults to one
+	q, err = model.QuoteEntry(pizza, parts[:1], model.QuoteRequest{}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1050), q.Total.Amount)
+
+	_, err = model.QuoteEntry(pizza, parts[1:2], model.QuoteRequest{}, nil)
+	assert.ErrorIs(t, err, model.ErrNoDistance)
+
+	_, err = model.QuoteEntry(pizza, parts[2:], model.QuoteRequest{}, nil)
+	assert.ErrorIs(t, err, model.ErrNoRate)
+
+	_, err = model.QuoteEntry(model.Entry{ID: "free"}, nil, model.QuoteRequest{}, nil)
+	assert.ErrorIs(t, err, model.ErrNoPrice)
+}
+
+func TestSubOrderTransitions(t *testing.T) {
+	so := model.SubOrder{Status: model.SubOrderStatusRequested}
+	assert.True(t, so.CanTransitionTo(model.SubOrderStatusAccepted))
+	assert.True(t, so.CanTransitionTo(model.SubOrderStatusDeclined))
+	assert.False(t, so.CanTransitionTo(model.SubOrderStatusCancelled))
+
+	so.Status = model.SubOrderStatusDeclined
+	assert.False(t, so.CanTransitionTo(model.SubOrderStatusAccepted))
+}
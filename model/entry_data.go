@@ -11,26 +11,26 @@ type EntryApartmentShortTermRental struct {
 	BaseEntry
 	StartDate     string `json:"from" validate:"required"`
 	EndDate       string `json:"to" validate:"required"`
-	Price         string `json:"price" validate:"required"`
+	Price         *Money `json:"price" validate:"required"`
 	PriceInterval string `json:"price_interval" validate:"required"`
 }
 
 type EntryApartmentLongTermRental struct {
 	BaseEntry
 	StartDate     string `json:"from" validate:"required"`
-	Price         string `json:"price" validate:"required"`
+	Price         *Money `json:"price" validate:"required"`
 	PriceInterval string `json:"price_interval" validate:"required"`
 }
 
 type EntryPetSitter struct {
 	BaseEntry
-	Price         string `json:"price" validate:"required"`
+	Price         *Money `json:"price" validate:"required"`
 	PriceInterval string `json:"price_interval" validate:"required"`
 }
 
 type EntryItemSale struct {
 	BaseEntry
-	Price string `json:"price" validate:"required"`
+	Price *Money `json:"price" validate:"required"`
 }
 
 type EntryLookingFor struct {
@@ -1,14 +1,31 @@
 package model
 
+// Lists are paged with cursor, like PageQueryParams; offset still works, but pages shift when entries are added
+// The list is limited to 100 entries; maps take more
 type EntryQueryParams struct {
-	Offset     int    `query:"offset" validate:"omitempty,number,min=0"`
-	Limit      int    `query:"limit" validate:"omitempty,number,min=1"`
-	Type       string `query:"type"`
-	Price      string `query:"price"`
+	Offset int    `query:"offset" validate:"omitempty,number,min=0"`
+	Limit  int    `query:"limit" validate:"omitempty,number,min=1"`
+	Cursor string `query:"cursor"`
+	Total  bool   `query:"total"`
+	Type   string `query:"type"`
+	// In major units of Currency (default CURRENCY); for ex. price=bt,10,20.50
+	Price    string `query:"price"`
+	Currency string `query:"currency"`
+	// Include prices in other currencies, converted with the rate table
+	Convert bool `query:"convert"`
+	// newest (default), price_asc, price_desc, expiring (soonest first), upvoted or distance (needs near)
+	Sort       string `query:"sort" validate:"omitempty,oneof=newest price_asc price_desc expiring upvoted distance"`
 	StartDate  string `query:"start_date"`
 	EndDate    string `query:"end_date"`
 	Country    string `query:"country"`
 	City       string `query:"city"`
 	CitySlug   string `query:"city_slug"`
 	CityGlobID string `query:"city_glob_id"`
+	// Bookable entries that are free for the whole period; date (2006-01-02) or RFC 3339
+	AvailableFrom string `query:"available_from"`
+	AvailableTo   string `query:"available_to"`
+	// Entries with coordinates around near (lat,lng), within radius_km if given; or in bbox (min_lng,min_lat,max_lng,max_lat)
+	Near     string  `query:"near"`
+	RadiusKm float64 `query:"radius_km" validate:"omitempty,gt=0,max=20000"`
+	BBox     string  `query:"bbox"`
 }
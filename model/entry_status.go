@@ -0,0 +1,60 @@
+package model
+
+import "time"
+
+// Lifecycle of an entry
+//
+// Notes:
+//   - Only published entries that haven't expired are listed, searched and counted
+//   - Entries are published on create, unless submitted as draft; the expiry is set on publish, based on the type
+//   - The sweeper moves published and paused entries past ExpiresAt to expired (see jobs.EntrySweeper)
+//   - Owners renew entries to push ExpiresAt out again; renewing an expired entry publishes it
+//   - Archived is final
+const (
+	EntryStatusDraft     = "draft"
+	EntryStatusPublished = "published"
+	EntryStatusPaused    = "paused"
+	EntryStatusSold      = "sold"
+	EntryStatusExpired   = "expired"
+	EntryStatusArchived  = "archived"
+)
+
+var entryStatusTransitions = map[string][]string{
+	EntryStatusDraft:     {EntryStatusPublished, EntryStatusArchived},
+	EntryStatusPublished: {EntryStatusPaused, EntryStatusSold, EntryStatusExpired, EntryStatusArchived},
+	EntryStatusPaused:    {EntryStatusPublished, EntryStatusExpired, EntryStatusArchived},
+	EntryStatusSold:      {EntryStatusArchived},
+	EntryStatusExpired:   {EntryStatusPublished, EntryStatusArchived},
+	EntryStatusArchived:  {},
+}
+
+// Statuses the sweeper moves to expired, once ExpiresAt has passed
+var EntryStatusesThatExpire = []string{EntryStatusPublished, EntryStatusPaused}
+
+func EntryStatusIsValid(status string) bool {
+	_, ok := entryStatusTransitions[status]
+	return ok
+}
+
+func (e Entry) CanTransitionTo(status string) bool {
+	for _, s := range entryStatusTransitions[e.Status] {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the entry is listed; the same as the listing filter in the entry handlers
+func (e Entry) IsListed(now time.Time) bool {
+	return e.Status == EntryStatusPublished && (e.ExpiresAt == nil || e.ExpiresAt.After(now))
+}
+
+// Counting from now; nil if entries of this type don't expire
+func (t EntryType) ExpiresAt(now time.Time) *time.Time {
+	if t.ExpiresAfterDays <= 0 {
+		return nil
+	}
+	expiresAt := now.UTC().AddDate(0, 0, t.ExpiresAfterDays)
+	return &expiresAt
+}
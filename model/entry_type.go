@@ -0,0 +1,558 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/google/uuid"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Describes what an entry of a given type looks like, and how clients should present it
+//
+// Notes:
+//   - Built-in types are defined in code, and their Data is validated against a struct; see entry_data.go
+//     Their Schema is generated from that struct, so clients can render forms for every type the same way
+//   - Types added by admins at runtime are stored in the DB, and their Data is validated against Schema (JSON Schema)
+//   - Name is what's stored in entry.type; it cannot be changed
+//   - FilterableFields are exposed to FetchEntries as data.<field>=op,value
+//   - Entries expire ExpiresAfterDays after they're published or renewed; 0 means they don't expire
+//   - Entries of a Bookable type can be reserved for a period of time; see Reservation
+//   - Entries of a Purchasable type can be ordered; their data needs a price. See Order
+//   - A price (data.price) is always Money; it's filtered and sorted with the price and currency params, not data.price
+type EntryType struct {
+	ID               string            `json:"-" gorm:"type:uuid;primarykey"`
+	Name             string            `json:"name" gorm:"uniqueIndex"`
+	Label            string            `json:"label"`
+	Description      string            `json:"description"`
+	Icon             string            `json:"icon"`
+	Position         int               `json:"position"`
+	Schema           datatypes.JSON    `json:"schema"`
+	FilterableFields []FilterableField `json:"filterable_fields" gorm:"serializer:json"`
+	ExpiresAfterDays int               `json:"expires_after_days"`
+	Bookable         bool              `json:"bookable"`
+	Purchasable      bool              `json:"purchasable"`
+	IsBuiltin        bool              `json:"is_builtin" gorm:"-"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+
+	newData func() interface{}
+}
+
+// Field is the JSON path within data; for ex. address.city
+// Type decides how the value is compared: number, string or date (RFC 3339; compared as string)
+type FilterableField struct {
+	Field string `json:"field" validate:"required"`
+	Type  string `json:"type" validate:"required,oneof=number string date"`
+	Label string `json:"label"`
+}
+
+func (base *EntryType) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+type SubmitEntryType struct {
+	Name             string            `json:"name" validate:"required"`
+	Label            string            `json:"label" validate:"required"`
+	Description      string            `json:"description"`
+	Icon             string            `json:"icon"`
+	Position         int               `json:"position"`
+	Schema           datatypes.JSON    `json:"schema" validate:"required"`
+	FilterableFields []FilterableField `json:"filterable_fields" validate:"dive"`
+	ExpiresAfterDays int               `json:"expires_after_days" validate:"min=0"`
+	Bookable         bool              `json:"bookable"`
+	Purchasable      bool              `json:"purchasable"`
+}
+
+// Fields that are nil are left as they are
+type UpdateEntryType struct {
+	Label            *string            `json:"label"`
+	Description      *string            `json:"description"`
+	Icon             *string            `json:"icon"`
+	Position         *int               `json:"position"`
+	Schema           datatypes.JSON     `json:"schema"`
+	FilterableFields *[]FilterableField `json:"filterable_fields" validate:"omitempty,dive"`
+	ExpiresAfterDays *int               `json:"expires_after_days" validate:"omitempty,min=0"`
+	Bookable         *bool              `json:"bookable"`
+	Purchasable      *bool              `json:"purchasable"`
+}
+
+var builtinEntryTypes = []EntryType{
+	// < 3 months
+	builtinEntryType(EntryType{
+		Name:             "apartment-short-term-rental",
+		Label:            "Apartment (short term)",
+		Icon:             "apartment",
+		Position:         10,
+		ExpiresAfterDays: 30,
+		Bookable:         true,
+		FilterableFields: []FilterableField{
+			{Field: "from", Type: "date", Label: "From"},
+			{Field: "to", Type: "date", Label: "To"},
+		},
+	}, func() interface{} { return &EntryApartmentShortTermRental{} }),
+	// > 3 months
+	builtinEntryType(EntryType{
+		Name:             "apartment-long-term-rental",
+		Label:            "Apartment (long term)",
+		Icon:             "apartment",
+		Position:         20,
+		ExpiresAfterDays: 60,
+		Bookable:         true,
+		FilterableFields: []FilterableField{
+			{Field: "from", Type: "date", Label: "From"},
+		},
+	}, func() interface{} { return &EntryApartmentLongTermRental{} }),
+	builtinEntryType(EntryType{
+		Name:             "pet-sitter",
+		Label:            "Pet sitter",
+		Icon:             "pet",
+		Position:         30,
+		ExpiresAfterDays: 90,
+		Bookable:         true,
+	}, func() interface{} { return &EntryPetSitter{} }),
+	builtinEntryType(EntryType{
+		Name:             "item-sale",
+		Label:            "For sale",
+		Icon:             "tag",
+		Position:         40,
+		ExpiresAfterDays: 30,
+		Purchasable:      true,
+	}, func() interface{} { return &EntryItemSale{} }),
+	builtinEntryType(EntryType{
+		Name:             "looking-for",
+		Label:            "Looking for",
+		Icon:             "search",
+		Position:         50,
+		ExpiresAfterDays: 30,
+	}, func() interface{} { return &EntryLookingFor{} }),
+}
+
+func builtinEntryType(t EntryType, newData func() interface{}) EntryType {
+	schema, err := json.Marshal(schemaFor(reflect.TypeOf(newData()).Elem()))
+	if err != nil {
+		panic(err)
+	}
+
+	t.Schema = schema
+	t.IsBuiltin = true
+	t.newData = newData
+	if t.FilterableFields == nil {
+		t.FilterableFields = []FilterableField{}
+	}
+	return t
+}
+
+func BuiltinEntryTypes() []EntryType {
+	return append([]EntryType{}, builtinEntryTypes...)
+}
+
+func LookupBuiltinEntryType(name string) (EntryType, bool) {
+	for _, t := range builtinEntryTypes {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return EntryType{}, false
+}
+
+func (t EntryType) FilterableField(field string) (FilterableField, bool) {
+	for _, f := range t.FilterableFields {
+		if f.Field == field {
+			return f, true
+		}
+	}
+	return FilterableField{}, false
+}
+
+var entryTypeName = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Property and filterable field names end up in JSON paths of queries
+var entryTypeFieldName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Checks a type defined at runtime, before it's stored
+// The schema must describe an object, and every filterable field must be one of its properties
+// Names of properties and fields may only contain letters, numbers and underscores
+func (t EntryType) Check() error {
+	if !entryTypeName.MatchString(t.Name) {
+		return errors.New("Name may only contain lowercase letters, numbers and dashes.")
+	}
+	if _, ok := LookupBuiltinEntryType(t.Name); ok {
+		return fmt.Errorf("Name %s is reserved.", t.Name)
+	}
+
+	if _, err := compileSchema(t.Schema); err != nil {
+		return fmt.Errorf("Schema is invalid: %v", err)
+	}
+
+	schema := map[string]interface{}{}
+	if err := json.Unmarshal(t.Schema, &schema); err != nil || schema["type"] != "object" {
+		return errors.New("Schema must be of type object.")
+	}
+
+	if name, ok := unsafePropertyName(schema); !ok {
+		return fmt.Errorf("Property %s may only contain letters, numbers and underscores.", name)
+	}
+
+	for _, f := range t.FilterableFields {
+		for _, name := range strings.Split(f.Field, ".") {
+			if !entryTypeFieldName.MatchString(name) {
+				return fmt.Errorf("Filterable field %s may only contain letters, numbers, underscores and dots.", f.Field)
+			}
+		}
+		if !schemaHasProperty(schema, strings.Split(f.Field, ".")) {
+			return fmt.Errorf("Filterable field %s is not in the schema.", f.Field)
+		}
+	}
+
+	hasPrice := schemaHasProperty(schema, []string{"price"})
+	if t.Purchasable && !hasPrice {
+		return errors.New("Purchasable types need a price in the schema.")
+	}
+	if hasPrice && !(schemaHasProperty(schema, []string{"price", "amount"}) && schemaHasProperty(schema, []string{"price", "currency"})) {
+		return errors.New("Price must be an object with amount and currency.")
+	}
+
+	return nil
+}
+
+// Walks the properties of the schema, and nested ones; returns the first name that isn't safe
+func unsafePropertyName(schema map[string]interface{}) (string, bool) {
+	props, _ := schema["properties"].(map[string]interface{})
+	names := make([]string, 0, len(props))
+	for name := range props {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		prop := props[name]
+		if !entryTypeFieldName.MatchString(name) {
+			return name, false
+		}
+		if nested, ok := prop.(map[string]interface{}); ok {
+			if name, ok := unsafePropertyName(nested); !ok {
+				return name, false
+			}
+		}
+	}
+	return "", true
+}
+
+func schemaHasProperty(schema map[string]interface{}, path []string) bool {
+	props, ok := schema["properties"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	prop, ok := props[path[0]].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if len(path) == 1 {
+		return true
+	}
+	return schemaHasProperty(prop, path[1:])
+}
+
+// Field is the JSON path within data; for ex. address.latitude
+type EntryDataError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+type EntryDataErrors []EntryDataError
+
+func (errs EntryDataErrors) Error() string {
+	msgs := []string{}
+	for _, e := range errs {
+		msgs = append(msgs, e.Message)
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Returns EntryDataErrors for invalid fields
+// Unknown fields are rejected, since whatever is stored is also signed
+func (t EntryType) ValidateData(data datatypes.JSON) error {
+	if t.newData != nil {
+		return validateDataStruct(t.newData(), data)
+	}
+
+	schema, err := cachedSchema(t)
+	if err != nil {
+		return err
+	}
+	if err := validateDataSchema(schema, data); err != nil {
+		return err
+	}
+
+	// The schema only describes the shape of the price
+	price, err := PriceFromData(data)
+	if err != nil {
+		return EntryDataErrors{{Field: "price", Rule: "type", Message: "price must be an object with amount and currency"}}
+	}
+	if price != nil {
+		if errs := price.Validate("price"); len(errs) > 0 {
+			return errs
+		}
+	}
+	return nil
+}
+
+// Embedded structs (BaseEntry) are named "_", so they can be left out of the field path
+var dataValidator = func() *validator.Validate {
+	v := validator.New()
+	v.RegisterValidation("iso4217", func(fl validator.FieldLevel) bool {
+		return CurrencyIsValid(fl.Field().String())
+	})
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		if f.Anonymous {
+			return "_"
+		}
+		return jsonName(f)
+	})
+	return v
+}()
+
+func jsonName(f reflect.StructField) string {
+	name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+// Decodes data into the struct of the type and runs its validate tags
+func validateDataStruct(payload interface{}, data datatypes.JSON) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(payload); err != nil {
+		return decodeError(err)
+	}
+
+	err := dataValidator.Struct(payload)
+	if err == nil {
+		return nil
+	}
+
+	validationErrs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return err
+	}
+
+	errs := EntryDataErrors{}
+	for _, e := range validationErrs {
+		field := fieldPath(e.Namespace())
+		errs = append(errs, EntryDataError{
+			Field:   field,
+			Rule:    e.Tag(),
+			Message: fmt.Sprintf("%s failed on %s", field, e.Tag()),
+		})
+	}
+	return errs
+}
+
+// Drops the struct name and embedded structs; for ex. EntryItemSale._.title -> title
+func fieldPath(namespace string) string {
+	parts := []string{}
+	for i, p := range strings.Split(namespace, ".") {
+		if i == 0 || p == "_" {
+			continue
+		}
+		parts = append(parts, p)
+	}
+	return strings.Join(parts, ".")
+}
+
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return EntryDataErrors{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("%s must be %s", typeErr.Field, typeErr.Type.String()),
+		}}
+	}
+
+	// There's no typed error for this one; for ex. json: unknown field "foo"
+	if strings.HasPrefix(err.Error(), "json: unknown field ") {
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return EntryDataErrors{{
+			Field:   field,
+			Rule:    "unknown",
+			Message: fmt.Sprintf("%s is not a known field", field),
+		}}
+	}
+
+	return EntryDataErrors{{
+		Rule:    "json",
+		Message: "data must be a JSON object",
+	}}
+}
+
+func compileSchema(schema datatypes.JSON) (*jsonschema.Schema, error) {
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource("schema.json", bytes.NewReader(schema)); err != nil {
+		return nil, err
+	}
+	return c.Compile("schema.json")
+}
+
+// Compiled schemas of runtime types; the key includes UpdatedAt, so changes are picked up
+var schemaCache = struct {
+	sync.Mutex
+	schemas map[string]*jsonschema.Schema
+}{schemas: map[string]*jsonschema.Schema{}}
+
+func cachedSchema(t EntryType) (*jsonschema.Schema, error) {
+	key := fmt.Sprintf("%s@%d", t.Name, t.UpdatedAt.UnixNano())
+
+	schemaCache.Lock()
+	defer schemaCache.Unlock()
+
+	if s, ok := schemaCache.schemas[key]; ok {
+		return s, nil
+	}
+
+	s, err := compileSchema(t.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop older versions of the same type
+	for k := range schemaCache.schemas {
+		if strings.HasPrefix(k, t.Name+"@") {
+			delete(schemaCache.schemas, k)
+		}
+	}
+	schemaCache.schemas[key] = s
+	return s, nil
+}
+
+func validateDataSchema(schema *jsonschema.Schema, data datatypes.JSON) error {
+	var payload interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&payload); err != nil {
+		return decodeError(err)
+	}
+
+	err := schema.Validate(payload)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+
+	errs := EntryDataErrors{}
+	collectSchemaErrors(validationErr, &errs)
+	return errs
+}
+
+var quotedProperty = regexp.MustCompile(`'([^']*)'`)
+
+// Only the leaves say what's actually wrong; required and additionalProperties
+// are reported on the object, so they're turned into one error per property
+func collectSchemaErrors(e *jsonschema.ValidationError, errs *EntryDataErrors) {
+	if len(e.Causes) > 0 {
+		for _, cause := range e.Causes {
+			collectSchemaErrors(cause, errs)
+		}
+		return
+	}
+
+	field := strings.ReplaceAll(strings.TrimPrefix(e.InstanceLocation, "/"), "/", ".")
+	keyword := e.KeywordLocation[strings.LastIndex(e.KeywordLocation, "/")+1:]
+
+	switch keyword {
+	case "required", "additionalProperties":
+		rule := "required"
+		if keyword == "additionalProperties" {
+			rule = "unknown"
+		}
+		for _, m := range quotedProperty.FindAllStringSubmatch(e.Message, -1) {
+			property := m[1]
+			if field != "" {
+				property = field + "." + property
+			}
+			*errs = append(*errs, EntryDataError{
+				Field:   property,
+				Rule:    rule,
+				Message: fmt.Sprintf("%s failed on %s", property, rule),
+			})
+		}
+	default:
+		*errs = append(*errs, EntryDataError{
+			Field:   field,
+			Rule:    keyword,
+			Message: fmt.Sprintf("%s: %s", field, e.Message),
+		})
+	}
+}
+
+// JSON Schema of a built-in type; fields tagged required are required
+func schemaFor(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := map[string]interface{}{}
+		required := []string{}
+		collectProperties(t, properties, &required)
+		return map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem())}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Ptr:
+		return schemaFor(t.Elem())
+	default:
+		return map[string]interface{}{"type": "string"}
+	}
+}
+
+func collectProperties(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous {
+			collectProperties(f.Type, properties, required)
+			continue
+		}
+
+		name := jsonName(f)
+		properties[name] = schemaFor(f.Type)
+		for _, rule := range strings.Split(f.Tag.Get("validate"), ",") {
+			if rule == "required" {
+				*required = append(*required, name)
+			}
+		}
+	}
+}
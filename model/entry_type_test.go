@@ -0,0 +1,98 @@
+package model_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+
+	"tbd/model"
+)
+
+var jobSchema = datatypes.JSON(`{
+	"type": "object",
+	"properties": {
+		"title": {"type": "string", "minLength": 1},
+		"salary": {"type": "number", "minimum": 0},
+		"address": {
+			"type": "object",
+			"properties": {"city": {"type": "string"}},
+			"required": ["city"]
+		}
+	},
+	"required": ["title", "salary"],
+	"additionalProperties": false
+}`)
+
+func TestEntryTypeRuntimeValidateData(t *testing.T) {
+	job := model.EntryType{Name: "job", Schema: jobSchema, UpdatedAt: time.Now()}
+	assert.NoError(t, job.Check())
+
+	assert.NoError(t, job.ValidateData(datatypes.JSON(`{"title": "Baker", "salary": 3000}`)))
+
+	err := job.ValidateData(datatypes.JSON(`{"salary": -1, "address": {}, "foo": true}`))
+	errs, ok := err.(model.EntryDataErrors)
+	assert.True(t, ok)
+
+	rules := map[string]string{}
+	for _, e := range errs {
+		rules[e.Field] = e.Rule
+	}
+	assert.Equal(t, map[string]string{
+		"title":        "required",
+		"salary":       "minimum",
+		"address.city": "required",
+		"foo":          "unknown",
+	}, rules)
+}
+
+func TestEntryTypeCheck(t *testing.T) {
+	cases := map[string]model.EntryType{
+		"reserved name":  {Name: "item-sale", Schema: jobSchema},
+		"invalid name":   {Name: "Job Offer", Schema: jobSchema},
+		"not an object":  {Name: "job", Schema: datatypes.JSON(`{"type": "string"}`)},
+		"invalid schema": {Name: "job", Schema: datatypes.JSON(`{"type": 1}`)},
+		"unknown filterable field": {
+			Name:             "job",
+			Schema:           jobSchema,
+			FilterableFields: []model.FilterableField{{Field: "address.street", Type: "string"}},
+		},
+		"purchasable without price": {Name: "job", Schema: jobSchema, Purchasable: true},
+		"unsafe property name": {
+			Name:             "job",
+			Schema:           datatypes.JSON(`{"type": "object", "properties": {"x') OR 1=1 --": {"type": "string"}}}`),
+			FilterableFields: []model.FilterableField{{Field: "x') OR 1=1 --", Type: "string"}},
+		},
+		"unsafe nested property name": {
+			Name:   "job",
+			Schema: datatypes.JSON(`{"type": "object", "properties": {"address": {"type": "object", "properties": {"city'": {"type": "string"}}}}}`),
+		},
+	}
+	for name, c := range cases {
+		assert.Error(t, c.Check(), name)
+	}
+
+	valid := model.EntryType{
+		Name:             "job",
+		Schema:           jobSchema,
+		FilterableFields: []model.FilterableField{{Field: "address.city", Type: "string"}},
+	}
+	assert.NoError(t, valid.Check())
+}
+
+func TestEntryTypeBuiltinSchema(t *testing.T) {
+	itemSale, ok := model.LookupBuiltinEntryType("item-sale")
+	assert.True(t, ok)
+	assert.True(t, itemSale.IsBuiltin)
+
+	schema := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(itemSale.Schema, &schema))
+	assert.Equal(t, "object", schema["type"])
+	assert.ElementsMatch(t, []interface{}{"title", "description", "address", "price"}, schema["required"])
+
+	// Prices are filtered with the price param, which respects currency
+	_, ok = itemSale.FilterableField("price")
+	assert.False(t, ok)
+}
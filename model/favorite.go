@@ -0,0 +1,79 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// A user can't keep more favorites than this
+const MaxFavoritesPerUser = 500
+
+// What changed on a favorited entry; see jobs.FavoriteAlerts
+const (
+	FavoriteChangePrice   = "price"
+	FavoriteChangeStatus  = "status"
+	FavoriteChangeExpired = "expired"
+)
+
+// An entry a user bookmarked; with Notify, they are told when its price or status changes, or it expires
+type Favorite struct {
+	ID        string    `json:"id" gorm:"type:uuid;primarykey"`
+	UserID    string    `json:"-" gorm:"type:uuid;uniqueIndex:idx_favorites_pair"`
+	User      *User     `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	EntryID   string    `json:"-" gorm:"type:uuid;uniqueIndex:idx_favorites_pair;index"`
+	Entry     *Entry    `json:"entry,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Notify    bool      `json:"notify"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Favorite to be returned to client
+type PublicFavorite struct {
+	ID        string       `json:"id"`
+	Entry     *PublicEntry `json:"entry,omitempty"`
+	Notify    bool         `json:"notify"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// Notify defaults to true
+type SubmitFavorite struct {
+	EntryID string `json:"entry_id" validate:"required,uuid"`
+	Notify  *bool  `json:"notify"`
+}
+
+type UpdateFavorite struct {
+	Notify bool `json:"notify"`
+}
+
+// How many users favorited an entry; only for its owner, so who is left out
+type FavoriteInterest struct {
+	EntryID    string `json:"entry_id"`
+	Favorites  int64  `json:"favorites"`
+	Last7Days  int64  `json:"last_7_days"`
+	Last30Days int64  `json:"last_30_days"`
+	Notified   int64  `json:"notified"`
+}
+
+func (base *Favorite) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+func (f Favorite) ToPublicFormat(domain string) interface{} {
+	pf := PublicFavorite{
+		ID:        f.ID,
+		Notify:    f.Notify,
+		CreatedAt: f.CreatedAt,
+	}
+	if f.Entry != nil {
+		pe := f.Entry.ToPublicFormat(domain).(PublicEntry)
+		pf.Entry = &pe
+	}
+	return pf
+}
@@ -1,7 +1,6 @@
 package model
 
 import (
-	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -12,7 +11,7 @@ import (
 //
 // Notes:
 //   - IsProvisional indicates whether the file has ever been associated after uploaded
-//     Files that have not been associated after X hours will be deleted
+//     Files that have not been associated after FILE_PROVISIONAL_TTL will be deleted (see jobs.FileReaper)
 type File struct {
 	ID            string `json:"id" gorm:"type:uuid;primarykey"`
 	Title         string `json:"title"`
@@ -24,8 +23,8 @@ type File struct {
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	ExpiresAt     time.Time
-	IsProvisional bool         `json:"is_provisional"`
-	DeletedAt     sql.NullTime `gorm:"index"`
+	IsProvisional bool           `json:"is_provisional"`
+	DeletedAt     gorm.DeletedAt `gorm:"index"`
 }
 
 // File to be returned to client
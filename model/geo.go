@@ -0,0 +1,149 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"gorm.io/datatypes"
+)
+
+const (
+	earthRadiusKm = 6371.0088
+	// Length of one degree of latitude, and of longitude at the equator
+	KmPerDegree = earthRadiusKm * math.Pi / 180
+)
+
+var (
+	ErrInvalidPoint = errors.New("expected lat,lng")
+	ErrInvalidBBox  = errors.New("expected min_lng,min_lat,max_lng,max_lat")
+)
+
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// West, south, east, north; like GeoJSON. West is greater than east if the box crosses the antimeridian
+type BBox struct {
+	MinLng float64 `json:"min_lng"`
+	MinLat float64 `json:"min_lat"`
+	MaxLng float64 `json:"max_lng"`
+	MaxLat float64 `json:"max_lat"`
+}
+
+func pointIsValid(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180
+}
+
+func parseFloats(value string, n int) ([]float64, bool) {
+	parts := strings.Split(value, ",")
+	if len(parts) != n {
+		return nil, false
+	}
+
+	floats := make([]float64, n)
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, false
+		}
+		floats[i] = f
+	}
+	return floats, true
+}
+
+// For ex. 52.52,13.405
+func ParsePoint(value string) (Point, error) {
+	f, ok := parseFloats(value, 2)
+	if !ok || !pointIsValid(f[0], f[1]) {
+		return Point{}, ErrInvalidPoint
+	}
+	return Point{Lat: f[0], Lng: f[1]}, nil
+}
+
+// For ex. 13.08,52.33,13.76,52.67
+func ParseBBox(value string) (BBox, error) {
+	f, ok := parseFloats(value, 4)
+	if !ok || !pointIsValid(f[1], f[0]) || !pointIsValid(f[3], f[2]) || f[1] > f[3] {
+		return BBox{}, ErrInvalidBBox
+	}
+	return BBox{MinLng: f[0], MinLat: f[1], MaxLng: f[2], MaxLat: f[3]}, nil
+}
+
+// Great-circle distance (haversine)
+func DistanceKm(a, b Point) float64 {
+	lat1, lat2 := a.Lat*math.Pi/180, b.Lat*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (b.Lng - a.Lng) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Smallest box around a circle; the box spans all longitudes if the circle reaches a pole
+func BBoxAround(center Point, radiusKm float64) BBox {
+	dLat := radiusKm / KmPerDegree
+	box := BBox{MinLat: math.Max(-90, center.Lat-dLat), MaxLat: math.Min(90, center.Lat+dLat), MinLng: -180, MaxLng: 180}
+
+	if box.MinLat > -90 && box.MaxLat < 90 {
+		dLng := dLat / math.Cos(center.Lat*math.Pi/180)
+		if dLng < 180 {
+			box.MinLng = wrapLng(center.Lng - dLng)
+			box.MaxLng = wrapLng(center.Lng + dLng)
+		}
+	}
+	return box
+}
+
+func wrapLng(lng float64) float64 {
+	switch {
+	case lng < -180:
+		return lng + 360
+	case lng > 180:
+		return lng - 360
+	}
+	return lng
+}
+
+// Coordinates from data.address; nil if the address has none
+// Latitude and longitude are strings in the builtin types, runtime types may use numbers
+func LocationFromData(data datatypes.JSON) (*Point, error) {
+	fields := struct {
+		Address struct {
+			Latitude  json.RawMessage `json:"latitude"`
+			Longitude json.RawMessage `json:"longitude"`
+		} `json:"address"`
+	}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	lat, ok := coordinate(fields.Address.Latitude)
+	if !ok {
+		return nil, nil
+	}
+	lng, ok := coordinate(fields.Address.Longitude)
+	if !ok {
+		return nil, nil
+	}
+	if !pointIsValid(lat, lng) {
+		return nil, EntryDataErrors{{Field: "address", Rule: "coordinates", Message: "address coordinates are out of range"}}
+	}
+	return &Point{Lat: lat, Lng: lng}, nil
+}
+
+// Empty, null and unparsable values are no coordinate
+func coordinate(raw json.RawMessage) (float64, bool) {
+	value := strings.Trim(strings.TrimSpace(string(raw)), `"`)
+	if value == "" || value == "null" {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
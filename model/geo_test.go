@@ -0,0 +1,89 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+
+	"tbd/model"
+)
+
+func TestParsePoint(t *testing.T) {
+	p, err := model.ParsePoint("52.52, 13.405")
+	assert.NoError(t, err)
+	assert.Equal(t, model.Point{Lat: 52.52, Lng: 13.405}, p)
+
+	for _, v := range []string{"", "52.52", "91,0", "0,181", "a,b", "1,2,3", "NaN,0"} {
+		_, err := model.ParsePoint(v)
+		assert.ErrorIs(t, err, model.ErrInvalidPoint, v)
+	}
+}
+
+func TestParseBBox(t *testing.T) {
+	box, err := model.ParseBBox("13.08,52.33,13.76,52.67")
+	assert.NoError(t, err)
+	assert.Equal(t, model.BBox{MinLng: 13.08, MinLat: 52.33, MaxLng: 13.76, MaxLat: 52.67}, box)
+
+	// Crosses the antimeridian
+	_, err = model.ParseBBox("170,-20,-170,-10")
+	assert.NoError(t, err)
+
+	for _, v := range []string{"", "1,2,3", "0,10,1,5", "0,-91,1,0", "a,0,1,1"} {
+		_, err := model.ParseBBox(v)
+		assert.ErrorIs(t, err, model.ErrInvalidBBox, v)
+	}
+}
+
+func TestDistanceKm(t *testing.T) {
+	berlin := model.Point{Lat: 52.52, Lng: 13.405}
+	paris := model.Point{Lat: 48.8566, Lng: 2.3522}
+	assert.InDelta(t, 878, model.DistanceKm(berlin, paris), 2)
+	assert.Zero(t, model.DistanceKm(berlin, berlin))
+
+	// Across the antimeridian
+	assert.InDelta(t, 222.4, model.DistanceKm(model.Point{Lat: 0, Lng: 179}, model.Point{Lat: 0, Lng: -179}), 0.5)
+}
+
+func TestBBoxAround(t *testing.T) {
+	box := model.BBoxAround(model.Point{Lat: 0, Lng: 0}, model.KmPerDegree)
+	assert.InDelta(t, -1, box.MinLat, 1e-9)
+	assert.InDelta(t, 1, box.MaxLat, 1e-9)
+	assert.InDelta(t, -1, box.MinLng, 1e-9)
+	assert.InDelta(t, 1, box.MaxLng, 1e-9)
+
+	box = model.BBoxAround(model.Point{Lat: 0, Lng: 179.5}, model.KmPerDegree)
+	assert.Greater(t, box.MinLng, box.MaxLng)
+
+	box = model.BBoxAround(model.Point{Lat: 89.5, Lng: 10}, model.KmPerDegree)
+	assert.Equal(t, 90.0, box.MaxLat)
+	assert.Equal(t, -180.0, box.MinLng)
+	assert.Equal(t, 180.0, box.MaxLng)
+}
+
+func TestLocationFromData(t *testing.T) {
+	location, err := model.LocationFromData(datatypes.JSON(`{"address":{"latitude":"52.52","longitude":"13.405"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &model.Point{Lat: 52.52, Lng: 13.405}, location)
+
+	location, err = model.LocationFromData(datatypes.JSON(`{"address":{"latitude":52.52,"longitude":13.405}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &model.Point{Lat: 52.52, Lng: 13.405}, location)
+
+	for _, data := range []string{`{}`, `{"address":{"latitude":"","longitude":""}}`, `{"address":{"latitude":"52.52"}}`} {
+		location, err = model.LocationFromData(datatypes.JSON(data))
+		assert.NoError(t, err, data)
+		assert.Nil(t, location, data)
+	}
+
+	_, err = model.LocationFromData(datatypes.JSON(`{"address":{"latitude":"95","longitude":"0"}}`))
+	assert.Error(t, err)
+}
+
+func TestClusterCells(t *testing.T) {
+	assert.Equal(t, 90.0, model.ClusterCellSize(0))
+	assert.Equal(t, 45.0, model.ClusterCellSize(1))
+
+	assert.Equal(t, []float64{-180, -90, -90, 0}, model.ClusterCellBBox(0, 0, 90))
+	assert.Equal(t, []float64{90, 0, 180, 90}, model.ClusterCellBBox(3, 1, 90))
+}
@@ -0,0 +1,62 @@
+package model
+
+import "math"
+
+// The parts of GeoJSON (RFC 7946) the map endpoint uses; Total is a foreign member, the number of matching entries
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+	Total    int64     `json:"total"`
+}
+
+type Feature struct {
+	Type       string                 `json:"type"`
+	ID         string                 `json:"id,omitempty"`
+	BBox       []float64              `json:"bbox,omitempty"`
+	Geometry   PointGeometry          `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Coordinates are longitude, latitude
+type PointGeometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+func NewFeatureCollection(features []Feature, total int64) FeatureCollection {
+	return FeatureCollection{Type: "FeatureCollection", Features: features, Total: total}
+}
+
+func NewPointFeature(id string, p Point, properties map[string]interface{}) Feature {
+	return Feature{
+		Type:       "Feature",
+		ID:         id,
+		Geometry:   PointGeometry{Type: "Point", Coordinates: [2]float64{p.Lng, p.Lat}},
+		Properties: properties,
+	}
+}
+
+type MapQueryParams struct {
+	// Group entries into grid cells for the zoom level, instead of returning each one
+	Cluster bool `query:"cluster"`
+	// Web map zoom level; 0 shows the whole world on one tile
+	Zoom int `query:"zoom" validate:"omitempty,min=0,max=22"`
+}
+
+// Cells per tile side; 4 gives cells of 64px on 256px tiles
+const clusterCellsPerTile = 4
+
+// Side of a grid cell in degrees; cells are square in degrees, so they look taller away from the equator
+func ClusterCellSize(zoom int) float64 {
+	return 360 / math.Pow(2, float64(zoom)) / clusterCellsPerTile
+}
+
+// West, south, east, north of a cell; x counts from -180 longitude, y from -90 latitude
+func ClusterCellBBox(x, y int64, size float64) []float64 {
+	return []float64{
+		math.Max(-180, -180+float64(x)*size),
+		math.Max(-90, -90+float64(y)*size),
+		math.Min(180, -180+float64(x+1)*size),
+		math.Min(90, -90+float64(y+1)*size),
+	}
+}
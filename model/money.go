@@ -0,0 +1,132 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gorm.io/datatypes"
+)
+
+// Amount in minor units of Currency (ISO 4217); for ex. {"amount": 1250, "currency": "EUR"} is 12.50 EUR
+//
+// Notes:
+//   - Minor units avoid rounding; how many there are depends on the currency (JPY has none, KWD has 3)
+//   - Entries keep their price in data.price; it's copied to Entry.PriceAmount and PriceCurrency for filtering and sorting
+type Money struct {
+	Amount   int64  `json:"amount" validate:"min=0"`
+	Currency string `json:"currency" validate:"required,iso4217"`
+}
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Active ISO 4217 codes; most have 2 minor units
+var currencyExponents = func() map[string]int {
+	exponents := map[string]int{}
+	for _, code := range strings.Fields(`AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND BOB BOV
+		BRL BSD BTN BWP BYN BZD CAD CDF CHE CHF CHW CNY COP COU CRC CUC CUP CVE CZK DKK DOP DZD EGP ERN ETB
+		EUR FJD FKP GBP GEL GHS GIP GMD GTQ GYD HKD HNL HTG HUF IDR ILS INR IRR JMD KES KGS KHR KPW KYD KZT
+		LAK LBP LKR LRD LSL MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MXV MYR MZN NAD NGN NIO NOK NPR
+		NZD PAB PEN PGK PHP PKR PLN QAR RON RSD RUB SAR SBD SCR SDG SEK SGD SHP SLE SLL SOS SRD SSP STN SVC
+		SYP SZL THB TJS TMT TOP TRY TTD TWD TZS UAH USD USN UYU UZS VED VES WST XCD YER ZAR ZMW ZWL`) {
+		exponents[code] = 2
+	}
+	for _, code := range strings.Fields(`BIF CLP DJF GNF ISK JPY KMF KRW PYG RWF UGX UYI VND VUV XAF XOF XPF`) {
+		exponents[code] = 0
+	}
+	for _, code := range strings.Fields(`BHD IQD JOD KWD LYD OMR TND`) {
+		exponents[code] = 3
+	}
+	for _, code := range strings.Fields(`CLF UYW`) {
+		exponents[code] = 4
+	}
+	return exponents
+}()
+
+func CurrencyIsValid(code string) bool {
+	_, ok := currencyExponents[code]
+	return ok
+}
+
+// Number of minor units; for ex. 2 for USD
+func CurrencyExponent(code string) int {
+	return currencyExponents[code]
+}
+
+// Parses an amount in major units, like 12, 12.5 or 12.50, into minor units of the currency
+func ParseAmount(value, currency string) (int64, error) {
+	exponent, ok := currencyExponents[currency]
+	if !ok {
+		return 0, ErrInvalidAmount
+	}
+
+	value = strings.TrimSpace(value)
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" || len(fraction) > exponent || !isDigits(whole) || !isDigits(fraction) {
+		return 0, ErrInvalidAmount
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units >= math.MaxInt64/int64(math.Pow10(exponent)) {
+		return 0, ErrInvalidAmount
+	}
+	minor := int64(0)
+	if fraction != "" {
+		minor, _ = strconv.ParseInt(fraction, 10, 64)
+	}
+	return units*int64(math.Pow10(exponent)) + minor, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// For ex. 12.50 EUR
+func (m Money) String() string {
+	exponent := CurrencyExponent(m.Currency)
+	if exponent == 0 {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+	unit := int64(math.Pow10(exponent))
+	return fmt.Sprintf("%d.%0*d %s", m.Amount/unit, exponent, m.Amount%unit, m.Currency)
+}
+
+// The price in data, if there is one
+func PriceFromData(data datatypes.JSON) (*Money, error) {
+	fields := struct {
+		Price json.RawMessage `json:"price"`
+	}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	if len(fields.Price) == 0 || string(fields.Price) == "null" {
+		return nil, nil
+	}
+
+	price := Money{}
+	if err := json.Unmarshal(fields.Price, &price); err != nil {
+		return nil, err
+	}
+	return &price, nil
+}
+
+// Same rules as the validate tags, for data that isn't validated against a struct
+func (m Money) Validate(field string) EntryDataErrors {
+	errs := EntryDataErrors{}
+	if m.Amount < 0 {
+		errs = append(errs, EntryDataError{Field: field + ".amount", Rule: "min", Message: field + ".amount failed on min"})
+	}
+	if !CurrencyIsValid(m.Currency) {
+		errs = append(errs, EntryDataError{Field: field + ".currency", Rule: "iso4217", Message: field + ".currency failed on iso4217"})
+	}
+	return errs
+}
@@ -0,0 +1,113 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/datatypes"
+
+	"tbd/model"
+)
+
+func TestParseAmount(t *testing.T) {
+	valid := map[[2]string]int64{
+		{"12", "USD"}:      1200,
+		{"12.5", "USD"}:    1250,
+		{"12.50", "EUR"}:   1250,
+		{"0.99", "USD"}:    99,
+		{" 100.1 ", "USD"}: 10010,
+		{"1500", "JPY"}:    1500,
+		{"1.005", "KWD"}:   1005,
+	}
+	for c, expected := range valid {
+		amount, err := model.ParseAmount(c[0], c[1])
+		assert.NoError(t, err, c)
+		assert.Equal(t, expected, amount, c)
+	}
+
+	invalid := [][2]string{
+		{"", "USD"}, {"-1", "USD"}, {"+1", "USD"}, {"1.999", "USD"}, {"1,50", "USD"}, {"abc", "USD"},
+		{".50", "USD"}, {"12.-5", "USD"}, {"99999999999999999999", "USD"}, {"12.5", "JPY"}, {"12", "XYZ"},
+	}
+	for _, c := range invalid {
+		_, err := model.ParseAmount(c[0], c[1])
+		assert.ErrorIs(t, err, model.ErrInvalidAmount, c)
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	assert.Equal(t, "12.50 EUR", model.Money{Amount: 1250, Currency: "EUR"}.String())
+	assert.Equal(t, "0.05 USD", model.Money{Amount: 5, Currency: "USD"}.String())
+	assert.Equal(t, "1500 JPY", model.Money{Amount: 1500, Currency: "JPY"}.String())
+	assert.Equal(t, "1.005 KWD", model.Money{Amount: 1005, Currency: "KWD"}.String())
+}
+
+func TestEntryDataPrice(t *testing.T) {
+	itemSale, _ := model.LookupBuiltinEntryType("item-sale")
+	base := `"title": "Bike", "description": "Red", "address": {"city": "Berlin"}`
+
+	assert.NoError(t, itemSale.ValidateData(datatypes.JSON(`{`+base+`, "price": {"amount": 1250, "currency": "EUR"}}`)))
+
+	err := itemSale.ValidateData(datatypes.JSON(`{` + base + `, "price": {"amount": -1, "currency": "EURO"}}`))
+	errs, ok := err.(model.EntryDataErrors)
+	assert.True(t, ok)
+	fields := []string{}
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	assert.ElementsMatch(t, []string{"price.amount", "price.currency"}, fields)
+
+	// Free-form prices aren't accepted anymore
+	assert.Error(t, itemSale.ValidateData(datatypes.JSON(`{`+base+`, "price": "12.50"}`)))
+
+	e := model.Entry{Data: datatypes.JSON(`{"price": {"amount": 1250, "currency": "EUR"}}`)}
+	assert.NoError(t, e.SetPrice())
+	assert.Equal(t, int64(1250), *e.PriceAmount)
+	assert.Equal(t, "EUR", *e.PriceCurrency)
+
+	e.Data = datatypes.JSON(`{"title": "Free"}`)
+	assert.NoError(t, e.SetPrice())
+	assert.Nil(t, e.PriceAmount)
+}
+
+func TestEntryTypeRuntimePrice(t *testing.T) {
+	shop := model.EntryType{
+		Name:        "shop",
+		Purchasable: true,
+		UpdatedAt:   time.Now(),
+		Schema: datatypes.JSON(`{
+			"type": "object",
+			"properties": {
+				"title": {"type": "string"},
+				"price": {
+					"type": "object",
+					"properties": {"amount": {"type": "integer"}, "currency": {"type": "string"}},
+					"required": ["amount", "currency"]
+				}
+			}
+		}`),
+	}
+	assert.NoError(t, shop.Check())
+	assert.NoError(t, shop.ValidateData(datatypes.JSON(`{"title": "Bread", "price": {"amount": 350, "currency": "EUR"}}`)))
+	assert.Error(t, shop.ValidateData(datatypes.JSON(`{"title": "Bread", "price": {"amount": 350, "currency": "Euro"}}`)))
+
+	numeric := model.EntryType{Name: "shop", Schema: datatypes.JSON(`{"type": "object", "properties": {"price": {"type": "number"}}}`)}
+	assert.Error(t, numeric.Check())
+}
+
+func TestConversionFactors(t *testing.T) {
+	rates := []model.CurrencyRate{
+		{Base: "EUR", Quote: "USD", Rate: 1.25},
+		{Base: "USD", Quote: "JPY", Rate: 150},
+		{Base: "GBP", Quote: "CHF", Rate: 1.1},
+	}
+
+	factors := model.ConversionFactors(rates, "USD")
+	assert.Equal(t, 1.0, factors["USD"])
+	assert.InDelta(t, 1.25, factors["EUR"], 1e-9)
+	// 150 JPY (no minor units) are 100 cents
+	assert.InDelta(t, 100.0/150, factors["JPY"], 1e-9)
+	_, ok := factors["GBP"]
+	assert.False(t, ok)
+}
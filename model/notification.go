@@ -0,0 +1,65 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// Kinds of notifications
+const (
+	NotificationKindSavedSearch = "saved_search"
+	NotificationKindFavorite    = "favorite"
+)
+
+// A message in the in-app inbox of a user; Data depends on the kind, for ex. the ids of matched entries
+type Notification struct {
+	ID        string         `json:"id" gorm:"type:uuid;primarykey"`
+	UserID    string         `json:"-" gorm:"type:uuid;index"`
+	User      *User          `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Kind      string         `json:"kind"`
+	Title     string         `json:"title"`
+	Body      string         `json:"body"`
+	Data      datatypes.JSON `json:"data"`
+	ReadAt    *time.Time     `json:"read_at" gorm:"index"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+type PublicNotification struct {
+	ID        string         `json:"id"`
+	Kind      string         `json:"kind"`
+	Title     string         `json:"title"`
+	Body      string         `json:"body"`
+	Data      datatypes.JSON `json:"data"`
+	ReadAt    *time.Time     `json:"read_at"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// Marks the given notifications read; all of them if IDs is empty
+type ReadNotifications struct {
+	IDs []string `json:"ids" validate:"omitempty,max=100,dive,uuid"`
+}
+
+func (base *Notification) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+func (n Notification) ToPublicFormat(domain string) interface{} {
+	return PublicNotification{
+		ID:        n.ID,
+		Kind:      n.Kind,
+		Title:     n.Title,
+		Body:      n.Body,
+		Data:      n.Data,
+		ReadAt:    n.ReadAt,
+		CreatedAt: n.CreatedAt,
+	}
+}
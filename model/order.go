@@ -0,0 +1,155 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusFulfilled = "fulfilled"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusFailed    = "failed"
+	OrderStatusRefunded  = "refunded"
+)
+
+// Purchase of an entry; the buyer pays through one of the payment providers the community enabled
+//
+// Notes:
+//   - Only entries of a purchasable type can be ordered; see EntryType.Purchasable
+//   - Amount is UnitAmount * Quantity, in minor units of Currency (the price of the entry); fixed when the order is placed
+//   - If the entry consumes other entries, Amount is the quote of the whole, and SubOrders go out to the owners of the parts
+//   - PaymentReference identifies the payment with Provider; webhooks refer to it
+//   - Providers confirm payments and refunds; with a manually settled provider (cash on pickup), the seller does
+type Order struct {
+	ID               string     `json:"id" gorm:"type:uuid;primarykey"`
+	EntryID          string     `json:"-" gorm:"type:uuid;index"`
+	Entry            *Entry     `json:"entry,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	BuyerID          string     `json:"-" gorm:"type:uuid;index"`
+	Buyer            *User      `json:"buyer,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Quantity         int        `json:"quantity"`
+	UnitAmount       int64      `json:"unit_amount"`
+	Amount           int64      `json:"amount"`
+	Currency         string     `json:"currency"`
+	Status           string     `json:"status" gorm:"index"`
+	Provider         string     `json:"provider"`
+	PaymentReference string     `json:"-" gorm:"index"`
+	CheckoutURL      string     `json:"checkout_url"`
+	Instructions     string     `json:"instructions"`
+	SubOrders        []SubOrder `json:"sub_orders,omitempty" gorm:"foreignKey:OrderID"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// Order to be returned to client
+type PublicOrder struct {
+	ID           string           `json:"id"`
+	Entry        *PublicEntry     `json:"entry,omitempty"`
+	Buyer        PublicUser       `json:"buyer,omitempty"`
+	Quantity     int              `json:"quantity"`
+	UnitAmount   int64            `json:"unit_amount"`
+	Amount       int64            `json:"amount"`
+	Currency     string           `json:"currency"`
+	Status       string           `json:"status"`
+	Provider     string           `json:"provider"`
+	CheckoutURL  string           `json:"checkout_url,omitempty"`
+	Instructions string           `json:"instructions,omitempty"`
+	SubOrders    []PublicSubOrder `json:"sub_orders,omitempty"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+// Provider is optional; the first enabled provider is used by default
+// DistanceKm is needed if the entry consumes entries that are priced by distance
+type SubmitOrder struct {
+	Quantity   int     `json:"quantity" validate:"omitempty,min=1,max=1000"`
+	Provider   string  `json:"provider"`
+	DistanceKm float64 `json:"distance_km" validate:"omitempty,min=0,max=20000"`
+}
+
+type SubmitOrderStatus struct {
+	Status string `json:"status" validate:"required"`
+}
+
+func (base *Order) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+// Who may move an order to which status, from a given status
+// "provider" is the payment provider, or the seller if the provider is manually settled
+var orderTransitions = map[string]map[string]string{
+	OrderStatusPending: {
+		OrderStatusPaid:      "provider",
+		OrderStatusFailed:    "provider",
+		OrderStatusCancelled: "any",
+	},
+	OrderStatusPaid: {
+		OrderStatusFulfilled: "seller",
+		OrderStatusRefunded:  "provider",
+	},
+}
+
+func OrderStatusIsValid(status string) bool {
+	switch status {
+	case OrderStatusPending, OrderStatusPaid, OrderStatusFulfilled, OrderStatusCancelled, OrderStatusFailed, OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+// The buyer may only cancel orders that aren't paid yet
+func (o Order) CanTransitionTo(status string, isSeller, isProvider bool) bool {
+	actor, ok := orderTransitions[o.Status][status]
+	if !ok {
+		return false
+	}
+	switch actor {
+	case "any":
+		return true
+	case "seller":
+		return isSeller
+	case "provider":
+		return isProvider
+	}
+	return false
+}
+
+func (o Order) ToPublicFormat(domain string) interface{} {
+	po := PublicOrder{
+		ID:           o.ID,
+		Quantity:     o.Quantity,
+		UnitAmount:   o.UnitAmount,
+		Amount:       o.Amount,
+		Currency:     o.Currency,
+		Status:       o.Status,
+		Provider:     o.Provider,
+		CheckoutURL:  o.CheckoutURL,
+		Instructions: o.Instructions,
+		CreatedAt:    o.CreatedAt,
+		UpdatedAt:    o.UpdatedAt,
+	}
+
+	if o.Entry != nil {
+		pe := o.Entry.ToPublicFormat(domain).(PublicEntry)
+		po.Entry = &pe
+	}
+
+	if o.Buyer != nil {
+		po.Buyer = o.Buyer.ToPublicFormat(domain).(PublicUser)
+	}
+
+	for _, s := range o.SubOrders {
+		po.SubOrders = append(po.SubOrders, s.ToPublicFormat(domain).(PublicSubOrder))
+	}
+
+	return po
+}
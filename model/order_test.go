@@ -0,0 +1,25 @@
+package model_test
+
+import (
+	"tbd/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderTransitions(t *testing.T) {
+	pending := model.Order{Status: model.OrderStatusPending}
+	assert.True(t, pending.CanTransitionTo(model.OrderStatusCancelled, false, false))
+	assert.False(t, pending.CanTransitionTo(model.OrderStatusPaid, true, false))
+	assert.True(t, pending.CanTransitionTo(model.OrderStatusPaid, false, true))
+	assert.False(t, pending.CanTransitionTo(model.OrderStatusFulfilled, true, true))
+
+	paid := model.Order{Status: model.OrderStatusPaid}
+	assert.False(t, paid.CanTransitionTo(model.OrderStatusCancelled, true, true))
+	assert.False(t, paid.CanTransitionTo(model.OrderStatusFulfilled, false, true))
+	assert.True(t, paid.CanTransitionTo(model.OrderStatusFulfilled, true, false))
+	assert.True(t, paid.CanTransitionTo(model.OrderStatusRefunded, false, true))
+
+	fulfilled := model.Order{Status: model.OrderStatusFulfilled}
+	assert.False(t, fulfilled.CanTransitionTo(model.OrderStatusRefunded, true, true))
+}
@@ -0,0 +1,16 @@
+package model
+
+// Paging of lists; limit is at most 100
+//
+// Notes:
+//   - Cursor is the next_cursor of the previous page; pages stay stable when rows are added in between
+//   - Offset still works, but is ignored with a cursor, and pages shift when rows are added
+//   - Counting all matches gets expensive on large communities, so total is only included with total=true
+//   - Sort options depend on the list
+type PageQueryParams struct {
+	Limit  int    `query:"limit" validate:"omitempty,min=1,max=100"`
+	Offset int    `query:"offset" validate:"omitempty,min=0"`
+	Cursor string `query:"cursor"`
+	Total  bool   `query:"total"`
+	Sort   string `query:"sort"`
+}
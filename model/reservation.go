@@ -0,0 +1,131 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	ReservationStatusRequested = "requested"
+	ReservationStatusAccepted  = "accepted"
+	ReservationStatusDeclined  = "declined"
+	ReservationStatusCancelled = "cancelled"
+	ReservationStatusCompleted = "completed"
+)
+
+// Request to book an entry for a period of time; the owner of the entry accepts or declines it
+//
+// Notes:
+//   - Only entries of a bookable type can be reserved; see EntryType.Bookable
+//   - The period is half-open: [StartDate, EndDate); a booking may start on the day another ends
+//   - Accepted reservations of the same entry never overlap; this is checked on request and again on accept
+//   - If the entry consumes other entries, SubOrders go out to the owners of the parts
+type Reservation struct {
+	ID          string     `json:"id" gorm:"type:uuid;primarykey"`
+	EntryID     string     `json:"-" gorm:"type:uuid;index"`
+	Entry       *Entry     `json:"entry,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedByID string     `json:"-" gorm:"type:uuid;index"`
+	CreatedBy   *User      `json:"created_by,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	StartDate   time.Time  `json:"start_date"`
+	EndDate     time.Time  `json:"end_date"`
+	Message     string     `json:"message"`
+	Status      string     `json:"status" gorm:"index"`
+	SubOrders   []SubOrder `json:"sub_orders,omitempty" gorm:"foreignKey:ReservationID"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// Reservation to be returned to client
+type PublicReservation struct {
+	ID        string           `json:"id"`
+	Entry     *PublicEntry     `json:"entry,omitempty"`
+	CreatedBy PublicUser       `json:"created_by,omitempty"`
+	StartDate time.Time        `json:"start_date"`
+	EndDate   time.Time        `json:"end_date"`
+	Message   string           `json:"message"`
+	Status    string           `json:"status"`
+	SubOrders []PublicSubOrder `json:"sub_orders,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// DistanceKm is needed if the entry consumes entries that are priced by distance
+type SubmitReservation struct {
+	StartDate  time.Time `json:"start_date" validate:"required"`
+	EndDate    time.Time `json:"end_date" validate:"required"`
+	Message    string    `json:"message"`
+	DistanceKm float64   `json:"distance_km" validate:"omitempty,min=0,max=20000"`
+}
+
+type SubmitReservationStatus struct {
+	Status string `json:"status" validate:"required"`
+}
+
+func (base *Reservation) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+// Who may move a reservation to which status, from a given status
+// The requester may only cancel; everything else is up to the owner of the entry
+var reservationTransitions = map[string]map[string]string{
+	ReservationStatusRequested: {
+		ReservationStatusAccepted:  "owner",
+		ReservationStatusDeclined:  "owner",
+		ReservationStatusCancelled: "any",
+	},
+	ReservationStatusAccepted: {
+		ReservationStatusCancelled: "any",
+		ReservationStatusCompleted: "owner",
+	},
+}
+
+func ReservationStatusIsValid(status string) bool {
+	switch status {
+	case ReservationStatusRequested, ReservationStatusAccepted, ReservationStatusDeclined, ReservationStatusCancelled, ReservationStatusCompleted:
+		return true
+	}
+	return false
+}
+
+func (r Reservation) CanTransitionTo(status string, isOwner bool) bool {
+	actor, ok := reservationTransitions[r.Status][status]
+	if !ok {
+		return false
+	}
+	return actor == "any" || isOwner
+}
+
+func (r Reservation) ToPublicFormat(domain string) interface{} {
+	pr := PublicReservation{
+		ID:        r.ID,
+		StartDate: r.StartDate,
+		EndDate:   r.EndDate,
+		Message:   r.Message,
+		Status:    r.Status,
+		CreatedAt: r.CreatedAt,
+		UpdatedAt: r.UpdatedAt,
+	}
+
+	if r.Entry != nil {
+		pe := r.Entry.ToPublicFormat(domain).(PublicEntry)
+		pr.Entry = &pe
+	}
+
+	if r.CreatedBy != nil {
+		pr.CreatedBy = r.CreatedBy.ToPublicFormat(domain).(PublicUser)
+	}
+
+	for _, s := range r.SubOrders {
+		pr.SubOrders = append(pr.SubOrders, s.ToPublicFormat(domain).(PublicSubOrder))
+	}
+
+	return pr
+}
@@ -0,0 +1,171 @@
+package model
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// How often the owner of a saved search is told about new matches
+const (
+	AlertFrequencyInstant = "instant"
+	AlertFrequencyDaily   = "daily"
+	AlertFrequencyWeekly  = "weekly"
+)
+
+// A user can't keep more saved searches than this
+const MaxSavedSearchesPerUser = 50
+
+// Paging and sorting don't change what matches, so they aren't saved
+var savedSearchIgnoredParams = []string{"offset", "limit", "cursor", "total", "sort"}
+
+// A named entry query; entries that are created or updated and match it are alerted to the owner
+//
+// Notes:
+//   - Query is the query string of /entries, including data.* filters; for ex. type=apartment-long-term-rental&city_slug=berlin
+//   - Entries updated until CheckedAt were checked; new searches start at creation, so existing entries aren't alerted
+//   - An entry is only alerted once per search, even if it's updated again
+type SavedSearch struct {
+	ID         string     `json:"id" gorm:"type:uuid;primarykey"`
+	UserID     string     `json:"-" gorm:"type:uuid;index"`
+	User       *User      `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Name       string     `json:"name"`
+	Query      string     `json:"query"`
+	Frequency  string     `json:"frequency"`
+	CheckedAt  time.Time  `json:"-"`
+	NotifiedAt *time.Time `json:"notified_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// SavedSearch to be returned to client
+type PublicSavedSearch struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Query      string     `json:"query"`
+	Frequency  string     `json:"frequency"`
+	NotifiedAt *time.Time `json:"notified_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+type SubmitSavedSearch struct {
+	Name      string `json:"name" validate:"required,max=100"`
+	Query     string `json:"query" validate:"required,max=2000"`
+	Frequency string `json:"frequency" validate:"omitempty,oneof=instant daily weekly"`
+}
+
+// Only the given fields are changed; a new query only alerts entries updated from now on
+type UpdateSavedSearch struct {
+	Name      *string `json:"name" validate:"omitempty,min=1,max=100"`
+	Query     *string `json:"query" validate:"omitempty,min=1,max=2000"`
+	Frequency *string `json:"frequency" validate:"omitempty,oneof=instant daily weekly"`
+}
+
+// An entry that matched a saved search; NotifiedAt is set once the owner was told
+type SavedSearchMatch struct {
+	ID            string       `json:"id" gorm:"type:uuid;primarykey"`
+	SavedSearchID string       `json:"-" gorm:"type:uuid;uniqueIndex:idx_saved_search_matches_pair"`
+	SavedSearch   *SavedSearch `json:"-" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	EntryID       string       `json:"-" gorm:"type:uuid;uniqueIndex:idx_saved_search_matches_pair;index"`
+	Entry         *Entry       `json:"entry,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	NotifiedAt    *time.Time   `json:"notified_at" gorm:"index"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+type PublicSavedSearchMatch struct {
+	ID         string       `json:"id"`
+	Entry      *PublicEntry `json:"entry,omitempty"`
+	NotifiedAt *time.Time   `json:"notified_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+func (base *SavedSearch) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+func (base *SavedSearchMatch) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+func (s SavedSearch) ToPublicFormat(domain string) interface{} {
+	return PublicSavedSearch{
+		ID:         s.ID,
+		Name:       s.Name,
+		Query:      s.Query,
+		Frequency:  s.Frequency,
+		NotifiedAt: s.NotifiedAt,
+		CreatedAt:  s.CreatedAt,
+		UpdatedAt:  s.UpdatedAt,
+	}
+}
+
+func (m SavedSearchMatch) ToPublicFormat(domain string) interface{} {
+	pm := PublicSavedSearchMatch{
+		ID:         m.ID,
+		NotifiedAt: m.NotifiedAt,
+		CreatedAt:  m.CreatedAt,
+	}
+
+	if m.Entry != nil {
+		pe := m.Entry.ToPublicFormat(domain).(PublicEntry)
+		pm.Entry = &pe
+	}
+
+	return pm
+}
+
+// Parses a query string as accepted by /entries; a leading ? or the /entries path are fine too
+// Paging and sorting are dropped, and the rest is sorted by key, so equal searches look the same
+func ParseSavedSearchQuery(query string) (url.Values, error) {
+	query = strings.TrimSpace(query)
+	if i := strings.Index(query, "?"); i >= 0 {
+		query = query[i+1:]
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range savedSearchIgnoredParams {
+		values.Del(key)
+	}
+	for key, v := range values {
+		if len(v) == 0 || (len(v) == 1 && v[0] == "") {
+			values.Del(key)
+		}
+	}
+	return values, nil
+}
+
+// When the next digest of a search is due; instant searches are always due, so it's the zero time for them
+func (s SavedSearch) NextAlertAt() time.Time {
+	last := s.CreatedAt
+	if s.NotifiedAt != nil {
+		last = *s.NotifiedAt
+	}
+
+	switch s.Frequency {
+	case AlertFrequencyDaily:
+		return last.Add(24 * time.Hour)
+	case AlertFrequencyWeekly:
+		return last.Add(7 * 24 * time.Hour)
+	default:
+		return time.Time{}
+	}
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSavedSearchQuery(t *testing.T) {
+	values, err := ParseSavedSearchQuery("/entries?type=item-sale&price=lt,1000&city_slug=berlin&limit=5&offset=20&sort=price_asc&city=")
+	assert.NoError(t, err)
+	assert.Equal(t, "city_slug=berlin&price=lt%2C1000&type=item-sale", values.Encode())
+
+	values, err = ParseSavedSearchQuery("?data.color=red&type=item-sale")
+	assert.NoError(t, err)
+	assert.Equal(t, "red", values.Get("data.color"))
+
+	_, err = ParseSavedSearchQuery("type=%zz")
+	assert.Error(t, err)
+}
+
+func TestSavedSearchNextAlertAt(t *testing.T) {
+	created := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	notified := created.Add(30 * time.Hour)
+
+	tests := []struct {
+		frequency  string
+		notifiedAt *time.Time
+		want       time.Time
+	}{
+		{AlertFrequencyInstant, nil, time.Time{}},
+		{AlertFrequencyInstant, &notified, time.Time{}},
+		{AlertFrequencyDaily, nil, created.Add(24 * time.Hour)},
+		{AlertFrequencyDaily, &notified, notified.Add(24 * time.Hour)},
+		{AlertFrequencyWeekly, &notified, notified.Add(7 * 24 * time.Hour)},
+	}
+	for _, tt := range tests {
+		s := SavedSearch{Frequency: tt.frequency, NotifiedAt: tt.notifiedAt, CreatedAt: created}
+		assert.Equal(t, tt.want, s.NextAlertAt(), tt.frequency)
+	}
+}
@@ -0,0 +1,11 @@
+package model
+
+type SearchQueryParams struct {
+	Keyword string `query:"keyword" validate:"required"`
+	// entry, city or user
+	Type      string `query:"type" validate:"omitempty,oneof=entry city user"`
+	EntryType string `query:"entry_type"`
+	CitySlug  string `query:"city_slug"`
+	Offset    int    `query:"offset" validate:"omitempty,min=0"`
+	Limit     int    `query:"limit" validate:"omitempty,min=1,max=100"`
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// A login of a user on a device; access tokens are issued for it, and renewed with its refresh token
+//
+// Notes:
+//   - Only the SHA-256 of the refresh token is stored; each refresh replaces it with a new one
+//   - PreviousTokenHash is the refresh token it replaced. Using that one again means it was stolen, and the session is revoked
+//   - Revoked sessions stay, so their access tokens are denied until they expire
+type Session struct {
+	ID                string     `json:"id" gorm:"type:uuid;primarykey"`
+	UserID            string     `json:"-" gorm:"type:uuid;index"`
+	RefreshTokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	PreviousTokenHash string     `json:"-" gorm:"index"`
+	UserAgent         string     `json:"user_agent"`
+	IP                string     `json:"ip"`
+	ExpiresAt         time.Time  `json:"expires_at"`
+	LastUsedAt        time.Time  `json:"last_used_at"`
+	RevokedAt         *time.Time `json:"-" gorm:"index"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// Session to be returned to client; Current is the session of the request
+type PublicSession struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Current    bool      `json:"current"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type RefreshTokenReq struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+func (base *Session) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+func (s Session) ToPublicFormat(domain string) interface{} {
+	return PublicSession{
+		ID:         s.ID,
+		UserAgent:  s.UserAgent,
+		IP:         s.IP,
+		ExpiresAt:  s.ExpiresAt,
+		LastUsedAt: s.LastUsedAt,
+		CreatedAt:  s.CreatedAt,
+	}
+}
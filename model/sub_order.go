@@ -0,0 +1,116 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	SubOrderStatusRequested = "requested"
+	SubOrderStatusAccepted  = "accepted"
+	SubOrderStatusDeclined  = "declined"
+	SubOrderStatusCancelled = "cancelled"
+)
+
+// Request to the owner of a consumed entry, created when its composite is ordered or booked
+//
+// Notes:
+//   - Belongs to either an Order or a Reservation of the composite
+//   - Amount is the quoted amount of the part, in the currency of the consumed entry
+//   - The owner of the consumed entry accepts or declines; it's cancelled with its order or reservation
+type SubOrder struct {
+	ID            string    `json:"id" gorm:"type:uuid;primarykey"`
+	OrderID       *string   `json:"order_id" gorm:"type:uuid;index"`
+	ReservationID *string   `json:"reservation_id" gorm:"type:uuid;index"`
+	EntryID       string    `json:"-" gorm:"type:uuid;index"`
+	Entry         *Entry    `json:"entry,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	PricingRule   string    `json:"pricing_rule"`
+	Units         float64   `json:"units"`
+	Amount        int64     `json:"amount"`
+	Currency      string    `json:"currency"`
+	Status        string    `json:"status" gorm:"index"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// SubOrder to be returned to client
+type PublicSubOrder struct {
+	ID            string       `json:"id"`
+	OrderID       *string      `json:"order_id,omitempty"`
+	ReservationID *string      `json:"reservation_id,omitempty"`
+	Entry         *PublicEntry `json:"entry,omitempty"`
+	PricingRule   string       `json:"pricing_rule"`
+	Units         float64      `json:"units"`
+	Amount        int64        `json:"amount"`
+	Currency      string       `json:"currency"`
+	Status        string       `json:"status"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+type SubmitSubOrderStatus struct {
+	Status string `json:"status" validate:"required,oneof=accepted declined"`
+}
+
+func (base *SubOrder) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
+
+func SubOrderStatusIsValid(status string) bool {
+	switch status {
+	case SubOrderStatusRequested, SubOrderStatusAccepted, SubOrderStatusDeclined, SubOrderStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// Only requested sub-orders can be accepted or declined
+func (s SubOrder) CanTransitionTo(status string) bool {
+	return s.Status == SubOrderStatusRequested && (status == SubOrderStatusAccepted || status == SubOrderStatusDeclined)
+}
+
+// Sub-orders for every line of a quote, but the first (the composite itself)
+func SubOrdersFromQuote(q Quote) []SubOrder {
+	subOrders := []SubOrder{}
+	for _, line := range q.Lines[1:] {
+		subOrders = append(subOrders, SubOrder{
+			EntryID:     line.EntryID,
+			PricingRule: line.PricingRule,
+			Units:       line.Units,
+			Amount:      line.Amount.Amount,
+			Currency:    line.Amount.Currency,
+			Status:      SubOrderStatusRequested,
+		})
+	}
+	return subOrders
+}
+
+func (s SubOrder) ToPublicFormat(domain string) interface{} {
+	ps := PublicSubOrder{
+		ID:            s.ID,
+		OrderID:       s.OrderID,
+		ReservationID: s.ReservationID,
+		PricingRule:   s.PricingRule,
+		Units:         s.Units,
+		Amount:        s.Amount,
+		Currency:      s.Currency,
+		Status:        s.Status,
+		CreatedAt:     s.CreatedAt,
+		UpdatedAt:     s.UpdatedAt,
+	}
+
+	if s.Entry != nil {
+		pe := s.Entry.ToPublicFormat(domain).(PublicEntry)
+		ps.Entry = &pe
+	}
+
+	return ps
+}
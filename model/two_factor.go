@@ -0,0 +1,97 @@
+package model
+
+import (
+	"crypto/rand"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Recovery codes are from this alphabet of 32, without characters that look alike
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz023456789"
+
+// How many recovery codes users get at once
+const RecoveryCodeCount = 10
+
+// A one-time code to login with, instead of a TOTP code; for ex. when the phone with the app is lost
+// Only the SHA-256 of the code is stored, like user tokens
+type RecoveryCode struct {
+	ID        string     `json:"-" gorm:"type:uuid;primarykey"`
+	UserID    string     `json:"-" gorm:"type:uuid;index"`
+	CodeHash  string     `json:"-"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-"`
+}
+
+// A TOTP code from the app, or a recovery code
+type TwoFactorCodeReq struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// Turning two-factor authentication off takes the password, and a code
+type DisableTwoFactorReq struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required"`
+}
+
+// The second step of a login with two-factor authentication
+type LoginTwoFactorReq struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required"`
+}
+
+// Secret is for apps that can't scan the QR code of URI
+type TwoFactorSetupResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TwoFactorStatus struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	RecoveryCodesLeft int64      `json:"recovery_codes_left"`
+}
+
+// Only shown once; earlier recovery codes stop working
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// Returns the codes to show the user, like xxxxx-xxxxx, and what's stored of them
+func NewRecoveryCodes(userID string, count int) ([]RecoveryCode, []string, error) {
+	recoveryCodes := make([]RecoveryCode, count)
+	codes := make([]string, count)
+	for i := range codes {
+		random := make([]byte, 10)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+
+		code := make([]byte, len(random))
+		for j, b := range random {
+			code[j] = recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)]
+		}
+		codes[i] = string(code[:5]) + "-" + string(code[5:])
+		recoveryCodes[i] = RecoveryCode{UserID: userID, CodeHash: HashRecoveryCode(codes[i])}
+	}
+	return recoveryCodes, codes, nil
+}
+
+// SHA-256 of the code, regardless of case, spaces and dashes
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	return HashToken(code)
+}
+
+func (base *RecoveryCode) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
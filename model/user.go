@@ -17,7 +17,7 @@ import (
 // Primary user struct for DB interactions
 type User struct {
 	ID          string         `json:"id" gorm:"type:uuid;primarykey"`
-	ImageID     string         `json:"image_id"`
+	ImageID     *string        `json:"image_id"`
 	Image       *File          `json:"image" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	Name        *string        `json:"name"`
 	Username    string         `json:"username" gorm:"uniqueIndex"`
@@ -31,9 +31,18 @@ type User struct {
 	IsListed    bool           `json:"is_listed" gorm:"default:false"`
 	PrivateKey  string         `json:"private_key"`
 	PublicKey   string         `json:"public_key"`
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	DeletedAt   sql.NullTime `gorm:"index"`
+	// Bumped when the password changes; logins of an older version are rejected
+	TokenVersion int `json:"-" gorm:"not null;default:0"`
+	// Suspended users can't use their account, until an admin lifts it
+	SuspendedAt *time.Time `json:"-"`
+	// Encrypted to the user's own key; only enabled once they confirmed a code
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"-"`
+	// The time step of the last code used, so each code works once
+	TOTPLastStep int64 `json:"-" gorm:"not null;default:0"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	DeletedAt    sql.NullTime `gorm:"index"`
 }
 
 // Signup a new user
@@ -41,7 +50,7 @@ type User struct {
 type SignupUserReq struct {
 	Name     string `json:"name"`
 	Username string `json:"username" gorm:"uniqueIndex"`
-	Email    string `json:"email" gorm:"uniqueIndex" validate:"email"`
+	Email    string `json:"email" gorm:"uniqueIndex" validate:"omitempty,email"`
 	Phone    string `json:"phone,omitempty"`
 	Password string `json:"password,omitempty" validate:"required"`
 	IsListed bool   `json:"is_listed" gorm:"default:false"`
@@ -60,10 +69,39 @@ type LoginUserReq struct {
 }
 
 // User extracted from JWT token
+// Roles and IsConfirmed are replaced with the current ones from the database, by the authorization middleware
 type AuthUser struct {
-	ID      string   `json:"id"`
-	Roles   []string `json:"roles"`
-	IsAdmin bool     `json:"is_admin"`
+	ID           string   `json:"id"`
+	Roles        []string `json:"roles"`
+	IsAdmin      bool     `json:"is_admin"`
+	IsConfirmed  bool     `json:"-"`
+	TokenVersion int      `json:"-"`
+	SessionID    string   `json:"-"`
+}
+
+// Changes the roles of a user, or suspends them; admin only
+type UpdateUserAccountReq struct {
+	Roles     *[]string `json:"roles" validate:"omitempty,dive,oneof=member admin"`
+	Suspended *bool     `json:"suspended"`
+}
+
+// Asks for a token to reset the password; like login, by email (default) or phone
+// Supported types are: email, phone
+type ForgotPasswordReq struct {
+	Type  string `json:"type"`
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+}
+
+// Sets a new password with the token from ForgotPasswordReq
+type ResetPasswordReq struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+type ChangePasswordReq struct {
+	OldPassword string `json:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=8"`
 }
 
 // User to be returned to client
@@ -83,6 +121,8 @@ type PrivateUser struct {
 	Name                  *string     `json:"name"`
 	Email                 *string     `json:"email"`
 	Phone                 *string     `json:"phone"`
+	IsConfirmed           bool        `json:"is_confirmed"`
+	TwoFactorEnabled      bool        `json:"two_factor_enabled"`
 	Image                 PublicFile  `json:"image,omitempty"`
 	Username              string      `json:"username"`
 	UsernameWithLocalPart string      `json:"username_with_local_part"`
@@ -97,13 +137,21 @@ func (base *User) BeforeCreate(tx *gorm.DB) (err error) {
 		return err
 	}
 
-	name := base.Name
-	email := *base.Email
+	// Users may sign up with only a phone, and without a name
+	name := base.Username
+	if base.Name != nil {
+		name = *base.Name
+	}
+	email := ""
+	if base.Email != nil {
+		email = *base.Email
+	}
 	passphrase := os.Getenv("PGP_PASSPHRASE")
 
-	keyPair, err := pgp.GenerateKeyPair(*name, email, passphrase)
-	if err != nil {
-		log.Println(err)
+	// Users without keys can still sign up; they can't receive encrypted messages
+	keyPair, keyErr := pgp.GenerateKeyPair(name, email, passphrase)
+	if keyErr != nil {
+		log.Println(keyErr)
 	} else {
 		base.PrivateKey = keyPair.PrivateKey
 		base.PublicKey = keyPair.PublicKey
@@ -113,12 +161,21 @@ func (base *User) BeforeCreate(tx *gorm.DB) (err error) {
 	return
 }
 
+// Token is the short-lived access token; RefreshToken gets a new pair once it expires
+// With two-factor authentication, the login only has a ChallengeToken, until ExpiresAt; it's exchanged with a code at /login/2fa
 type LoginUserReqResponse struct {
-	Token string `json:"token"`
+	Token             string     `json:"token"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+	RefreshToken      string     `json:"refresh_token,omitempty"`
+	TwoFactorRequired bool       `json:"two_factor_required,omitempty"`
+	ChallengeToken    string     `json:"challenge_token,omitempty"`
 }
 
+// SessionID is the login the access token was issued for
 type JwtCustomClaims struct {
-	Roles string `json:"roles"`
+	Roles        string `json:"roles"`
+	TokenVersion int    `json:"ver,omitempty"`
+	SessionID    string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -139,6 +196,8 @@ func (user User) ToUserPrivateFormat(domain string) PrivateUser {
 		Name:                  user.Name,
 		Email:                 user.Email,
 		Phone:                 user.Phone,
+		IsConfirmed:           user.IsConfirmed,
+		TwoFactorEnabled:      user.TOTPEnabledAt != nil,
 		Username:              user.Username,
 		UsernameWithLocalPart: UsernameWithLocalPart(user.Username, domain),
 		Profile:               user.Profile,
@@ -148,8 +207,12 @@ func (user User) ToUserPrivateFormat(domain string) PrivateUser {
 }
 
 func (user User) IsAdmin() bool {
-	for _, v := range user.Roles {
-		if v == "admin" {
+	return HasRole(user.Roles, "admin")
+}
+
+func HasRole(roles []string, role string) bool {
+	for _, v := range roles {
+		if v == role {
 			return true
 		}
 	}
@@ -161,7 +224,7 @@ func UsernameWithLocalPart(username, domain string) string {
 	return "@" + domain + ":" + username
 }
 
-func (user SignupUserReq) Strip() {
+func (user *SignupUserReq) Strip() {
 	if user.Username != "" {
 		user.Username = StripUsername(user.Username)
 	}
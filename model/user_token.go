@@ -0,0 +1,81 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// What a token may be used for
+const (
+	UserTokenVerifyEmail   = "verify_email"
+	UserTokenResetPassword = "reset_password"
+	// Issued by a login with two-factor authentication; exchanged with a code for the session
+	UserTokenLoginChallenge = "login_challenge"
+)
+
+// A single-use token sent to a user, for ex. to confirm their email or reset their password
+//
+// Notes:
+//   - Only the SHA-256 of the token is stored; the token itself is only in the message to the user
+//   - UsedAt is set once it's used; used and expired tokens are rejected
+type UserToken struct {
+	ID        string     `json:"-" gorm:"type:uuid;primarykey"`
+	UserID    string     `json:"-" gorm:"type:uuid;index"`
+	Purpose   string     `json:"-"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"-"`
+	UsedAt    *time.Time `json:"-"`
+	// Wrong codes entered with it; only used by login challenges
+	Attempts  int       `json:"-" gorm:"not null;default:0"`
+	CreatedAt time.Time `json:"-"`
+}
+
+// Confirms the email of a user with the token they were sent
+type VerifyEmailReq struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// Returns the token with its random secret, to send to the user
+func NewUserToken(userID, purpose string, ttl time.Duration) (UserToken, string, error) {
+	token, err := NewSecret()
+	if err != nil {
+		return UserToken{}, "", err
+	}
+
+	return UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: HashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}, token, nil
+}
+
+// 32 random bytes, hex encoded; for tokens that are handed out once and stored hashed
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// SHA-256 of a token from NewSecret, hex encoded; what's stored instead of the token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (base *UserToken) BeforeCreate(tx *gorm.DB) (err error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return err
+	}
+
+	base.ID = id.String()
+	return
+}
@@ -9,14 +9,15 @@ import (
 )
 
 // To is either 0 or 1; 0 is a vote for the entry, 1 is a vote against the entry
+// Only one of EntryID and CommentID is set
 type Vote struct {
 	ID          string   `json:"id" gorm:"type:uuid;primarykey"`
 	Vote        int      `json:"vote" validate:"required"`
 	CreatedByID string   `json:"-"  gorm:"type:uuid"`
 	CreatedBy   *User    `json:"created_by,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-	EntryID     string   `json:"-"  gorm:"type:uuid"`
+	EntryID     *string  `json:"-"  gorm:"type:uuid"`
 	Entry       *Entry   `json:"entry,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
-	CommentID   string   `json:"-"  gorm:"type:uuid"`
+	CommentID   *string  `json:"-"  gorm:"type:uuid"`
 	Comment     *Comment `json:"comment,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 
 	CreatedAt time.Time
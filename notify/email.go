@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"tbd/mail"
+)
+
+// Emails the notification to the address of the user; users without one, and deleted users, are skipped
+type Email struct {
+	db     *gorm.DB
+	mailer mail.Mailer
+}
+
+func NewEmail(db *gorm.DB, mailer mail.Mailer) *Email {
+	return &Email{db: db, mailer: mailer}
+}
+
+func (e *Email) Name() string {
+	return "email"
+}
+
+func (e *Email) Notify(ctx context.Context, n Notification) error {
+	emails := []string{}
+	err := e.db.WithContext(ctx).Table("users").
+		Where("id = ? AND deleted_at IS NULL AND email IS NOT NULL AND email <> ''", n.UserID).
+		Pluck("email", &emails).Error
+	if err != nil {
+		return err
+	}
+	if len(emails) == 0 {
+		return nil
+	}
+
+	return e.mailer.Send(ctx, mail.Message{To: emails[0], Subject: n.Title, Body: n.Body})
+}
@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+
+	"gorm.io/gorm"
+
+	"tbd/model"
+)
+
+// Keeps notifications in the database, for the in-app inbox
+type Inbox struct {
+	db *gorm.DB
+}
+
+func NewInbox(db *gorm.DB) *Inbox {
+	return &Inbox{db: db}
+}
+
+func (i *Inbox) Name() string {
+	return "inbox"
+}
+
+func (i *Inbox) Notify(ctx context.Context, n Notification) error {
+	data, err := json.Marshal(n.Data)
+	if err != nil {
+		return err
+	}
+
+	return i.db.WithContext(ctx).Create(&model.Notification{
+		UserID: n.UserID,
+		Kind:   n.Kind,
+		Title:  n.Title,
+		Body:   n.Body,
+		Data:   data,
+	}).Error
+}
@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+
+	"tbd/mail"
+)
+
+// What a user is told; Data is kept with inbox notifications, for ex. the ids of matched entries
+type Notification struct {
+	UserID string
+	Kind   string
+	Title  string
+	Body   string
+	Data   map[string]interface{}
+}
+
+// A channel to reach users through; for ex. the in-app inbox or email
+//
+// Notes:
+//   - Users that can't be reached through a channel (for ex. without an email) are skipped, without an error
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Notifies through all channels
+type Multi []Notifier
+
+func (m Multi) Name() string {
+	return "multi"
+}
+
+// Only fails if no channel succeeded; otherwise a retry would repeat the notification on the channels that worked
+func (m Multi) Notify(ctx context.Context, n Notification) error {
+	errs := []error{}
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, n); err != nil {
+			log.Printf("Notifier %s failed: %v", notifier.Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", notifier.Name(), err))
+		}
+	}
+	if len(m) > 0 && len(errs) == len(m) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// Supported notifiers are: inbox, email
+type Config struct {
+	Notifiers []string
+	DB        *gorm.DB
+	Mailer    mail.Mailer
+}
+
+func New(cfg Config) (Multi, error) {
+	notifiers := Multi{}
+	for _, name := range cfg.Notifiers {
+		switch name {
+		case "inbox":
+			notifiers = append(notifiers, NewInbox(cfg.DB))
+		case "email":
+			if cfg.Mailer == nil {
+				return nil, errors.New("email notifier requires a mailer")
+			}
+			notifiers = append(notifiers, NewEmail(cfg.DB, cfg.Mailer))
+		default:
+			return nil, fmt.Errorf("unsupported notifier: %s", name)
+		}
+	}
+	return notifiers, nil
+}
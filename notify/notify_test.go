@@ -0,0 +1,96 @@
+package notify_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"tbd/mail"
+	"tbd/migrations"
+	"tbd/model"
+	"tbd/notify"
+)
+
+type recordingMailer struct {
+	sent []mail.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, message mail.Message) error {
+	m.sent = append(m.sent, message)
+	return nil
+}
+
+type failingNotifier struct{}
+
+func (failingNotifier) Name() string {
+	return "failing"
+}
+
+func (failingNotifier) Notify(ctx context.Context, n notify.Notification) error {
+	return errors.New("unreachable")
+}
+
+func TestNotifiers(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	_, err = migrations.New(db).Up()
+	assert.NoError(t, err)
+
+	// Without hooks, so no keys are generated
+	email := "ada@example.com"
+	withEmail := model.User{ID: "00000000-0000-0000-0000-000000000001", Username: "ada", Email: &email}
+	withoutEmail := model.User{ID: "00000000-0000-0000-0000-000000000002", Username: "bob"}
+	assert.NoError(t, db.Session(&gorm.Session{SkipHooks: true}).Create(&withEmail).Error)
+	assert.NoError(t, db.Session(&gorm.Session{SkipHooks: true}).Create(&withoutEmail).Error)
+
+	mailer := &recordingMailer{}
+	notifier, err := notify.New(notify.Config{Notifiers: []string{"inbox", "email"}, DB: db, Mailer: mailer})
+	assert.NoError(t, err)
+
+	for _, user := range []model.User{withEmail, withoutEmail} {
+		err := notifier.Notify(context.Background(), notify.Notification{
+			UserID: user.ID,
+			Kind:   model.NotificationKindSavedSearch,
+			Title:  "New match",
+			Body:   "- Lamp\n",
+			Data:   map[string]interface{}{"entry_ids": []string{"1"}},
+		})
+		assert.NoError(t, err)
+	}
+
+	// Both get the inbox; only one has an email to send to
+	var count int64
+	assert.NoError(t, db.Model(&model.Notification{}).Count(&count).Error)
+	assert.Equal(t, int64(2), count)
+	if assert.Len(t, mailer.sent, 1) {
+		assert.Equal(t, mail.Message{To: email, Subject: "New match", Body: "- Lamp\n"}, mailer.sent[0])
+	}
+
+	inbox := model.Notification{}
+	assert.NoError(t, db.First(&inbox, "user_id = ?", withEmail.ID).Error)
+	assert.JSONEq(t, `{"entry_ids": ["1"]}`, string(inbox.Data))
+
+	_, err = notify.New(notify.Config{Notifiers: []string{"pigeon"}})
+	assert.Error(t, err)
+}
+
+// One working channel is enough; otherwise a retry would repeat it
+func TestMultiNotifier(t *testing.T) {
+	mailer := &recordingMailer{}
+	failing := notify.Multi{failingNotifier{}, failingNotifier{}}
+	assert.Error(t, failing.Notify(context.Background(), notify.Notification{}))
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	_, err = migrations.New(db).Up()
+	assert.NoError(t, err)
+
+	partly := notify.Multi{failingNotifier{}, notify.NewInbox(db)}
+	assert.NoError(t, partly.Notify(context.Background(), notify.Notification{UserID: "00000000-0000-0000-0000-000000000000"}))
+	assert.Empty(t, mailer.sent)
+}
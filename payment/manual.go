@@ -0,0 +1,34 @@
+package payment
+
+import (
+	"context"
+	"net/http"
+)
+
+// Cash on pickup, bank transfer, and so on; the seller marks the order paid once they have the money
+type Manual struct {
+	Instructions string
+}
+
+func NewManual(instructions string) *Manual {
+	if instructions == "" {
+		instructions = "Pay the seller on pickup."
+	}
+	return &Manual{Instructions: instructions}
+}
+
+func (m *Manual) Name() string {
+	return "manual"
+}
+
+func (m *Manual) ManuallySettled() bool {
+	return true
+}
+
+func (m *Manual) Checkout(ctx context.Context, order Order) (Checkout, error) {
+	return Checkout{Reference: order.ID, Instructions: m.Instructions}, nil
+}
+
+func (m *Manual) ParseWebhook(r *http.Request) (Event, error) {
+	return Event{}, ErrWebhooksNotSupported
+}
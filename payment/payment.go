@@ -0,0 +1,123 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Payment statuses reported by providers
+const (
+	StatusPending  = "pending"
+	StatusPaid     = "paid"
+	StatusFailed   = "failed"
+	StatusRefunded = "refunded"
+)
+
+var (
+	ErrUnknownProvider       = errors.New("payment provider is not enabled")
+	ErrWebhooksNotSupported  = errors.New("payment provider does not send webhooks")
+	ErrInvalidWebhookPayload = errors.New("invalid webhook payload")
+	ErrInvalidSignature      = errors.New("invalid webhook signature")
+	ErrStaleWebhook          = errors.New("webhook timestamp is out of range")
+)
+
+// What's paid for; Amount is in minor units of Currency (ISO 4217), for ex. cents
+type Order struct {
+	ID          string
+	Amount      int64
+	Currency    string
+	Description string
+}
+
+// What the buyer needs to do next
+// Reference identifies the payment with the provider; webhooks refer to it
+type Checkout struct {
+	Reference    string `json:"reference"`
+	RedirectURL  string `json:"redirect_url,omitempty"`
+	Instructions string `json:"instructions,omitempty"`
+}
+
+// Status change of a payment, reported by the provider
+type Event struct {
+	Reference string
+	Status    string
+}
+
+// A way to settle orders; for ex. cash on pickup, a card processor or a crypto payment gateway
+//
+// Notes:
+//   - Providers that don't confirm payments themselves (ManuallySettled) leave it to the seller to mark orders paid
+//   - ParseWebhook must verify the request came from the provider
+type Provider interface {
+	Name() string
+	ManuallySettled() bool
+	Checkout(ctx context.Context, order Order) (Checkout, error)
+	ParseWebhook(r *http.Request) (Event, error)
+}
+
+// Providers enabled for a community
+type Registry struct {
+	providers map[string]Provider
+	order     []string
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: map[string]Provider{}}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+		r.order = append(r.order, p.Name())
+	}
+	return r
+}
+
+func (r *Registry) Get(name string) (Provider, error) {
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	return p, nil
+}
+
+// The first provider is the default
+func (r *Registry) Default() (Provider, error) {
+	if len(r.order) == 0 {
+		return nil, ErrUnknownProvider
+	}
+	return r.providers[r.order[0]], nil
+}
+
+// In the order they were enabled
+func (r *Registry) Names() []string {
+	return append([]string{}, r.order...)
+}
+
+// Builds the registry from config; providers are enabled by name, in order
+func New(cfg Config) (*Registry, error) {
+	providers := []Provider{}
+	for _, name := range cfg.Providers {
+		switch name {
+		case "manual":
+			providers = append(providers, NewManual(cfg.ManualInstructions))
+		case "webhook":
+			if cfg.WebhookURL == "" || cfg.WebhookSecret == "" {
+				return nil, errors.New("webhook payment provider requires a URL and secret")
+			}
+			providers = append(providers, NewWebhook("webhook", cfg.WebhookURL, cfg.WebhookSecret))
+		default:
+			return nil, fmt.Errorf("unsupported payment provider: %s", name)
+		}
+	}
+	if len(providers) == 0 {
+		return nil, errors.New("no payment provider enabled")
+	}
+	return NewRegistry(providers...), nil
+}
+
+type Config struct {
+	Providers          []string
+	ManualInstructions string
+	WebhookURL         string
+	WebhookSecret      string
+}
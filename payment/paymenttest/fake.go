@@ -0,0 +1,112 @@
+// Local stand-in for a payment provider that speaks the payment.Webhook protocol; for development and tests
+package paymenttest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"tbd/payment"
+)
+
+// What the fake received on checkout
+type CheckoutRequest struct {
+	OrderID     string `json:"order_id"`
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency"`
+	Description string `json:"description"`
+	Reference   string `json:"-"`
+}
+
+// Serve it, for ex. with httptest.NewServer, and point payment.Webhook.URL at it
+// Payments are never settled on their own; call Notify to report a status change, like the real provider would
+type Fake struct {
+	Secret string
+
+	mu        sync.Mutex
+	checkouts []CheckoutRequest
+}
+
+func NewFake(secret string) *Fake {
+	return &Fake{Secret: secret}
+}
+
+func (f *Fake) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get(payment.SignatureHeader) != payment.Sign(f.Secret, body) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	req := CheckoutRequest{}
+	if err := json.Unmarshal(body, &req); err != nil || req.OrderID == "" || req.Amount <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	req.Reference = fmt.Sprintf("fake_%d", len(f.checkouts)+1)
+	f.checkouts = append(f.checkouts, req)
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(payment.Checkout{
+		Reference:   req.Reference,
+		RedirectURL: "https://pay.example.com/checkout/" + req.Reference,
+	})
+}
+
+func (f *Fake) Checkouts() []CheckoutRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]CheckoutRequest{}, f.checkouts...)
+}
+
+// Checkout of an order, if the fake received one
+func (f *Fake) CheckoutFor(orderID string) (CheckoutRequest, bool) {
+	for _, c := range f.Checkouts() {
+		if c.OrderID == orderID {
+			return c, true
+		}
+	}
+	return CheckoutRequest{}, false
+}
+
+// Sends a signed webhook; for ex. to http://localhost:1323/payments/webhooks/webhook
+func (f *Fake) Notify(ctx context.Context, webhookURL, reference, status string) (*http.Response, error) {
+	return f.NotifyAt(ctx, webhookURL, reference, status, time.Now())
+}
+
+// Like Notify, but signed as if it was sent at t; for ex. to replay an old webhook
+func (f *Fake) NotifyAt(ctx context.Context, webhookURL, reference, status string, t time.Time) (*http.Response, error) {
+	body, err := json.Marshal(map[string]string{"reference": reference, "status": status})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(payment.TimestampHeader, strconv.FormatInt(t.Unix(), 10))
+	req.Header.Set(payment.SignatureHeader, payment.SignWebhook(f.Secret, t.Unix(), body))
+
+	return http.DefaultClient.Do(req)
+}
@@ -0,0 +1,162 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Generic provider that talks JSON and signs with a shared secret; a gateway in front of
+// Stripe, a BTC payment processor, or a fake in development
+//
+// Notes:
+//   - Checkout POSTs {order_id, amount, currency, description} to URL, and expects {reference, redirect_url}
+//   - The provider reports status changes by POSTing {reference, status} to /payments/webhooks/<name>
+//   - Both directions are signed: X-Signature is the hex HMAC-SHA256 of the body, with Secret
+//   - Status changes also carry X-Timestamp (unix seconds), and are signed as "<timestamp>.<body>"
+//     Ones older than webhookTolerance are rejected, so a captured webhook can't be replayed later
+type Webhook struct {
+	ProviderName string
+	URL          string
+	Secret       string
+	Client       *http.Client
+}
+
+const (
+	SignatureHeader = "X-Signature"
+	TimestampHeader = "X-Timestamp"
+)
+
+// Webhook bodies larger than this are rejected
+const webhookMaxSize = 64 << 10
+
+// How far the timestamp of a webhook may be off from our clock, either way
+const webhookTolerance = 5 * time.Minute
+
+func NewWebhook(name, url, secret string) *Webhook {
+	return &Webhook{
+		ProviderName: name,
+		URL:          url,
+		Secret:       secret,
+		Client:       &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Signature of a status change, sent at timestamp
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	return Sign(secret, append([]byte(strconv.FormatInt(timestamp, 10)+"."), body...))
+}
+
+func (w *Webhook) Name() string {
+	return w.ProviderName
+}
+
+func (w *Webhook) ManuallySettled() bool {
+	return false
+}
+
+type webhookCheckoutRequest struct {
+	OrderID     string `json:"order_id"`
+	Amount      int64  `json:"amount"`
+	Currency    string `json:"currency"`
+	Description string `json:"description"`
+}
+
+type webhookEvent struct {
+	Reference string `json:"reference"`
+	Status    string `json:"status"`
+}
+
+func (w *Webhook) Checkout(ctx context.Context, order Order) (Checkout, error) {
+	body, err := json.Marshal(webhookCheckoutRequest{
+		OrderID:     order.ID,
+		Amount:      order.Amount,
+		Currency:    order.Currency,
+		Description: order.Description,
+	})
+	if err != nil {
+		return Checkout{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return Checkout{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+
+	res, err := w.Client.Do(req)
+	if err != nil {
+		return Checkout{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
+		return Checkout{}, fmt.Errorf("payment provider %s responded with %d", w.ProviderName, res.StatusCode)
+	}
+
+	checkout := Checkout{}
+	if err := json.NewDecoder(io.LimitReader(res.Body, webhookMaxSize)).Decode(&checkout); err != nil {
+		return Checkout{}, err
+	}
+	if checkout.Reference == "" {
+		return Checkout{}, fmt.Errorf("payment provider %s returned no reference", w.ProviderName)
+	}
+	return checkout, nil
+}
+
+func (w *Webhook) ParseWebhook(r *http.Request) (Event, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, webhookMaxSize+1))
+	if err != nil {
+		return Event{}, err
+	}
+	if len(body) > webhookMaxSize {
+		return Event{}, ErrInvalidWebhookPayload
+	}
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return Event{}, ErrInvalidSignature
+	}
+	signature, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+	if err != nil {
+		return Event{}, ErrInvalidSignature
+	}
+	expected, _ := hex.DecodeString(SignWebhook(w.Secret, timestamp, body))
+	if !hmac.Equal(signature, expected) {
+		return Event{}, ErrInvalidSignature
+	}
+
+	// Checked after the signature, so the timestamp can be trusted
+	age := time.Since(time.Unix(timestamp, 0))
+	if age > webhookTolerance || age < -webhookTolerance {
+		return Event{}, ErrStaleWebhook
+	}
+
+	e := webhookEvent{}
+	if err := json.Unmarshal(body, &e); err != nil || e.Reference == "" {
+		return Event{}, ErrInvalidWebhookPayload
+	}
+
+	switch e.Status {
+	case StatusPaid, StatusFailed, StatusRefunded:
+	default:
+		return Event{}, ErrInvalidWebhookPayload
+	}
+
+	return Event{Reference: e.Reference, Status: e.Status}, nil
+}
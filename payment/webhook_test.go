@@ -0,0 +1,125 @@
+package payment_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"tbd/payment"
+	"tbd/payment/paymenttest"
+)
+
+func TestWebhookCheckout(t *testing.T) {
+	fake := paymenttest.NewFake("secret")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	provider := payment.NewWebhook("webhook", server.URL, "secret")
+	checkout, err := provider.Checkout(context.Background(), payment.Order{ID: "order-1", Amount: 1250, Currency: "USD", Description: "Bike"})
+	assert.NoError(t, err)
+	assert.Equal(t, "fake_1", checkout.Reference)
+	assert.Contains(t, checkout.RedirectURL, checkout.Reference)
+
+	received, ok := fake.CheckoutFor("order-1")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1250), received.Amount)
+	assert.Equal(t, "USD", received.Currency)
+
+	// The fake rejects requests that aren't signed with its secret
+	wrongSecret := payment.NewWebhook("webhook", server.URL, "other")
+	_, err = wrongSecret.Checkout(context.Background(), payment.Order{ID: "order-2", Amount: 100, Currency: "USD"})
+	assert.Error(t, err)
+}
+
+func TestWebhookParse(t *testing.T) {
+	provider := payment.NewWebhook("webhook", "", "secret")
+
+	events := make(chan payment.Event, 1)
+	errs := make(chan error, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e, err := provider.ParseWebhook(r)
+		if err != nil {
+			errs <- err
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		events <- e
+	}))
+	defer server.Close()
+
+	fake := paymenttest.NewFake("secret")
+	res, err := fake.Notify(context.Background(), server.URL, "fake_1", payment.StatusPaid)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, payment.Event{Reference: "fake_1", Status: payment.StatusPaid}, <-events)
+
+	// Signed with another secret
+	res, err = paymenttest.NewFake("other").Notify(context.Background(), server.URL, "fake_1", payment.StatusPaid)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.ErrorIs(t, <-errs, payment.ErrInvalidSignature)
+
+	// Unknown status
+	res, err = fake.Notify(context.Background(), server.URL, "fake_1", "maybe")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.ErrorIs(t, <-errs, payment.ErrInvalidWebhookPayload)
+
+	// Not signed at all
+	res, err = http.Post(server.URL, "application/json", bytes.NewReader([]byte(`{"reference":"fake_1","status":"paid"}`)))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.ErrorIs(t, <-errs, payment.ErrInvalidSignature)
+
+	// Replayed later, or from the future
+	res, err = fake.NotifyAt(context.Background(), server.URL, "fake_1", payment.StatusPaid, time.Now().Add(-10*time.Minute))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.ErrorIs(t, <-errs, payment.ErrStaleWebhook)
+
+	res, err = fake.NotifyAt(context.Background(), server.URL, "fake_1", payment.StatusPaid, time.Now().Add(10*time.Minute))
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.ErrorIs(t, <-errs, payment.ErrStaleWebhook)
+
+	// The timestamp is part of the signature; only signing the body isn't enough
+	body := []byte(`{"reference":"fake_1","status":"paid"}`)
+	req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set(payment.TimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set(payment.SignatureHeader, payment.Sign("secret", body))
+	res, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.ErrorIs(t, <-errs, payment.ErrInvalidSignature)
+}
+
+func TestRegistry(t *testing.T) {
+	_, err := payment.New(payment.Config{Providers: []string{"webhook"}})
+	assert.Error(t, err)
+
+	_, err = payment.New(payment.Config{Providers: []string{"paypal"}})
+	assert.Error(t, err)
+
+	registry, err := payment.New(payment.Config{
+		Providers:     []string{"manual", "webhook"},
+		WebhookURL:    "http://localhost:1324",
+		WebhookSecret: "secret",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"manual", "webhook"}, registry.Names())
+
+	p, err := registry.Default()
+	assert.NoError(t, err)
+	assert.Equal(t, "manual", p.Name())
+	assert.True(t, p.ManuallySettled())
+
+	_, err = registry.Get("paypal")
+	assert.ErrorIs(t, err, payment.ErrUnknownProvider)
+}
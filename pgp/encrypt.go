@@ -0,0 +1,109 @@
+package pgp
+
+import (
+	"errors"
+
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+)
+
+var (
+	ErrNoPublicKeys     = errors.New("no public keys to encrypt to")
+	ErrNotEncrypted     = errors.New("not an encrypted PGP message")
+	ErrMissingRecipient = errors.New("message is not encrypted to all public keys")
+)
+
+// Encrypts data to all public keys, so any of their private keys can decrypt it; returns an armored message
+func EncryptMessage(data string, publicKeys []string) (string, error) {
+	if len(publicKeys) == 0 {
+		return "", ErrNoPublicKeys
+	}
+
+	keyRing, err := crypto.NewKeyRing(nil)
+	if err != nil {
+		return "", err
+	}
+	for _, publicKey := range publicKeys {
+		key, err := crypto.NewKeyFromArmored(publicKey)
+		if err != nil {
+			return "", err
+		}
+		if err := keyRing.AddKey(key); err != nil {
+			return "", err
+		}
+	}
+
+	encrypted, err := keyRing.Encrypt(crypto.NewPlainMessageFromString(data), nil)
+	if err != nil {
+		return "", err
+	}
+	return encrypted.GetArmored()
+}
+
+// Decrypts an armored message with a private key, locked with passphrase
+func DecryptMessage(armored string, privateKey string, passphrase []byte) (string, error) {
+	privateKeyObj, err := crypto.NewKeyFromArmored(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	unlockedKeyObj, err := privateKeyObj.Unlock(passphrase)
+	if err != nil {
+		return "", err
+	}
+	defer unlockedKeyObj.ClearPrivateParams()
+
+	keyRing, err := crypto.NewKeyRing(unlockedKeyObj)
+	if err != nil {
+		return "", err
+	}
+
+	message, err := crypto.NewPGPMessageFromArmored(armored)
+	if err != nil {
+		return "", err
+	}
+
+	decrypted, err := keyRing.Decrypt(message, nil, 0)
+	if err != nil {
+		return "", err
+	}
+	return decrypted.GetString(), nil
+}
+
+// Checks that an armored message, encrypted by someone else, can be read with the private key of every public key
+// Only the key ids of the message are looked at; it's never decrypted
+func CheckEncryptedTo(armored string, publicKeys []string) error {
+	if len(publicKeys) == 0 {
+		return ErrNoPublicKeys
+	}
+
+	message, err := crypto.NewPGPMessageFromArmored(armored)
+	if err != nil {
+		return ErrNotEncrypted
+	}
+	ids, ok := message.GetEncryptionKeyIDs()
+	if !ok {
+		return ErrNotEncrypted
+	}
+	recipients := map[uint64]bool{}
+	for _, id := range ids {
+		recipients[id] = true
+	}
+
+	for _, publicKey := range publicKeys {
+		key, err := crypto.NewKeyFromArmored(publicKey)
+		if err != nil {
+			return err
+		}
+
+		// Messages are encrypted to a subkey, usually
+		entity := key.GetEntity()
+		found := recipients[entity.PrimaryKey.KeyId]
+		for _, subkey := range entity.Subkeys {
+			found = found || recipients[subkey.PublicKey.KeyId]
+		}
+		if !found {
+			return ErrMissingRecipient
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package pgp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptMessage(t *testing.T) {
+	passphrase := []byte("pass")
+	alice, err := GenerateKeyPair("Alice", "alice@example.com", string(passphrase))
+	assert.NoError(t, err)
+	bob, err := GenerateKeyPair("Bob", "bob@example.com", string(passphrase))
+	assert.NoError(t, err)
+	eve, err := GenerateKeyPair("Eve", "eve@example.com", string(passphrase))
+	assert.NoError(t, err)
+
+	armored, err := EncryptMessage("Is it still available?", []string{alice.PublicKey, bob.PublicKey})
+	assert.NoError(t, err)
+	assert.Contains(t, armored, "BEGIN PGP MESSAGE")
+	assert.NotContains(t, armored, "available")
+
+	for _, keyPair := range []KeyPair{alice, bob} {
+		decrypted, err := DecryptMessage(armored, keyPair.PrivateKey, passphrase)
+		assert.NoError(t, err)
+		assert.Equal(t, "Is it still available?", decrypted)
+	}
+
+	_, err = DecryptMessage(armored, eve.PrivateKey, passphrase)
+	assert.Error(t, err)
+	_, err = DecryptMessage(armored, alice.PrivateKey, []byte("wrong"))
+	assert.Error(t, err)
+
+	_, err = EncryptMessage("Hello", nil)
+	assert.ErrorIs(t, err, ErrNoPublicKeys)
+}
+
+func TestCheckEncryptedTo(t *testing.T) {
+	alice, err := GenerateKeyPair("Alice", "alice@example.com", "pass")
+	assert.NoError(t, err)
+	bob, err := GenerateKeyPair("Bob", "bob@example.com", "pass")
+	assert.NoError(t, err)
+	eve, err := GenerateKeyPair("Eve", "eve@example.com", "pass")
+	assert.NoError(t, err)
+
+	armored, err := EncryptMessage("Is it still available?", []string{alice.PublicKey, bob.PublicKey})
+	assert.NoError(t, err)
+
+	assert.NoError(t, CheckEncryptedTo(armored, []string{alice.PublicKey, bob.PublicKey}))
+	assert.NoError(t, CheckEncryptedTo(armored, []string{bob.PublicKey}))
+	assert.ErrorIs(t, CheckEncryptedTo(armored, []string{alice.PublicKey, eve.PublicKey}), ErrMissingRecipient)
+	assert.ErrorIs(t, CheckEncryptedTo("Is it still available?", []string{alice.PublicKey}), ErrNotEncrypted)
+	assert.ErrorIs(t, CheckEncryptedTo(armored, nil), ErrNoPublicKeys)
+
+	// Signatures and keys are armored too, but not messages
+	signed, err := SignData("Hello", alice.PrivateKey, []byte("pass"))
+	assert.NoError(t, err)
+	assert.ErrorIs(t, CheckEncryptedTo(signed, []string{alice.PublicKey}), ErrNotEncrypted)
+	assert.ErrorIs(t, CheckEncryptedTo(alice.PublicKey, []string{alice.PublicKey}), ErrNotEncrypted)
+}
@@ -0,0 +1,79 @@
+package search
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"tbd/dialect"
+)
+
+// Same as the search migration; added by Rebuild if SQLite gained FTS5 after migrating
+var sqliteIndex = []string{
+	`CREATE VIRTUAL TABLE search_index USING fts5(title, body, content='search_documents', content_rowid='id', tokenize='porter unicode61 remove_diacritics 2')`,
+	`CREATE TRIGGER search_documents_ai AFTER INSERT ON search_documents BEGIN
+		INSERT INTO search_index(rowid, title, body) VALUES (new.id, new.title, new.body);
+	END`,
+	`CREATE TRIGGER search_documents_ad AFTER DELETE ON search_documents BEGIN
+		INSERT INTO search_index(search_index, rowid, title, body) VALUES ('delete', old.id, old.title, old.body);
+	END`,
+	`CREATE TRIGGER search_documents_au AFTER UPDATE ON search_documents BEGIN
+		INSERT INTO search_index(search_index, rowid, title, body) VALUES ('delete', old.id, old.title, old.body);
+		INSERT INTO search_index(rowid, title, body) VALUES (new.id, new.title, new.body);
+	END`,
+}
+
+// Documents of all entries, cities and users that aren't deleted; the triggers on those tables do the same per row
+func documentQueries(d dialect.Dialect) []string {
+	id := d.Cast("id", "text")
+	return []string{
+		fmt.Sprintf(`INSERT INTO search_documents(kind, ref_id, slug, entry_type, city_id, title, body)
+			SELECT '%s', %[2]s, %[2]s, type, %s, %s, %s FROM entries`,
+			KindEntry, id, d.Cast("city_id", "text"), d.JSONExtract("data", "title"), d.JSONExtract("data", "description")),
+		fmt.Sprintf(`INSERT INTO search_documents(kind, ref_id, slug, city_id, title, body)
+			SELECT '%s', %[2]s, slug, %[2]s, name, trim(coalesce(state, '') || ' ' || coalesce(country_code, '')) FROM cities`,
+			KindCity, id),
+		fmt.Sprintf(`INSERT INTO search_documents(kind, ref_id, slug, title)
+			SELECT '%s', %[2]s, %[2]s, username FROM users WHERE deleted_at IS NULL`,
+			KindUser, id),
+	}
+}
+
+// Recreates all documents from the source tables, and the index from the documents; returns the number of documents
+// Use it if the index is out of sync, for ex. after writes that bypassed the triggers, or when SQLite gained FTS5
+func Rebuild(db *gorm.DB) (int64, error) {
+	var count int64
+	d := dialect.For(db)
+
+	if d.Name == dialect.SQLite && !FTS5Available(db) {
+		return 0, ErrNoFTS5
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM search_documents").Error; err != nil {
+			return err
+		}
+
+		// After the documents are gone; deleting them would remove them from an index that never had them
+		if d.Name == dialect.SQLite && !indexExists(tx) {
+			for _, statement := range sqliteIndex {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+		}
+		for _, statement := range documentQueries(d) {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		if d.Name == dialect.SQLite && indexExists(tx) {
+			if err := tx.Exec("INSERT INTO search_index(search_index) VALUES('rebuild')").Error; err != nil {
+				return err
+			}
+		}
+		return tx.Table("search_documents").Count(&count).Error
+	})
+	return count, err
+}
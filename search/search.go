@@ -0,0 +1,222 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+
+	"tbd/dialect"
+)
+
+const (
+	KindEntry = "entry"
+	KindCity  = "city"
+	KindUser  = "user"
+)
+
+var (
+	ErrEmptyQuery = errors.New("nothing to search for")
+	ErrNoFTS5     = errors.New("SQLite was built without FTS5; build with -tags sqlite_fts5")
+	ErrNoIndex    = errors.New("the search index is missing; run: tbd search rebuild")
+)
+
+// Query terms are matched against the title and body of entries, cities and users
+//
+// Notes:
+//   - EntriesWhere limits entries; for ex. to those that are visible. It may use columns of entries
+//   - EntryType and CitySlug only leave entries (and the city itself) in the results
+type Query struct {
+	Keyword       string
+	Kind          string
+	EntryType     string
+	CitySlug      string
+	EntriesWhere  string
+	EntriesParams []interface{}
+	Limit         int
+	Offset        int
+}
+
+// Highlights are HTML-escaped, with matches in <mark>; Body is an excerpt
+type Highlights struct {
+	Title string `json:"title"`
+	Body  string `json:"body,omitempty"`
+}
+
+// Slug is the id of entries and users, and the slug of cities
+// A higher score is more relevant; it's only comparable within one search
+type Result struct {
+	Type       string     `json:"type"`
+	ID         string     `json:"id"`
+	Slug       string     `json:"slug"`
+	Title      string     `json:"title"`
+	Highlights Highlights `json:"highlights"`
+	Score      float64    `json:"score"`
+}
+
+// Marks matches in the engines' output; they are replaced after escaping, so the rest of the text can't inject markup
+const (
+	markStart = "\uE000"
+	markEnd   = "\uE001"
+)
+
+func markup(text string) string {
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, markStart, "<mark>")
+	return strings.ReplaceAll(text, markEnd, "</mark>")
+}
+
+// Words in the keyword; anything but letters and digits separates them, so the result is safe to put in a query
+func Terms(keyword string) []string {
+	return strings.FieldsFunc(keyword, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// All terms must match; the last one as a prefix, so results show up while typing
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"`
+	}
+	return strings.Join(quoted, " ") + "*"
+}
+
+func tsQuery(terms []string) string {
+	return strings.Join(terms, " & ") + ":*"
+}
+
+// FTS5 is only compiled into SQLite with the sqlite_fts5 build tag
+func FTS5Available(db *gorm.DB) bool {
+	var used int
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used).Error; err != nil {
+		return false
+	}
+	return used == 1
+}
+
+// Whether the FTS5 index exists; it's left out by the migration if SQLite lacks FTS5, and added by Rebuild
+func indexExists(db *gorm.DB) bool {
+	return db.Migrator().HasTable("search_index")
+}
+
+// Search needs the index; checked on start, after migrating
+// Notes:
+//   - SQLite without FTS5 can't search, and can't write to a database migrated with it either; its triggers use the index
+func Check(db *gorm.DB) error {
+	if dialect.For(db).Name != dialect.SQLite {
+		return nil
+	}
+	if !FTS5Available(db) {
+		return ErrNoFTS5
+	}
+	if !indexExists(db) {
+		return ErrNoIndex
+	}
+	return nil
+}
+
+// Conditions shared by all engines; d is search_documents
+func (q Query) conditions(params *[]interface{}) string {
+	condition := ""
+	if q.EntriesWhere != "" {
+		condition += fmt.Sprintf(" AND (d.kind <> '%s' OR (%s))", KindEntry, q.EntriesWhere)
+		*params = append(*params, q.EntriesParams...)
+	}
+	if q.Kind != "" {
+		condition += " AND d.kind = ?"
+		*params = append(*params, q.Kind)
+	}
+	if q.EntryType != "" {
+		condition += " AND d.kind = ? AND d.entry_type = ?"
+		*params = append(*params, KindEntry, q.EntryType)
+	}
+	if q.CitySlug != "" {
+		condition += " AND d.kind IN (?, ?) AND d.city_id IN (SELECT CAST(id AS TEXT) FROM cities WHERE slug = ?)"
+		*params = append(*params, KindEntry, KindCity, q.CitySlug)
+	}
+	return condition
+}
+
+// Ranked results, and the number of matches
+func Search(db *gorm.DB, q Query) ([]Result, int64, error) {
+	terms := Terms(q.Keyword)
+	if len(terms) == 0 {
+		return nil, 0, ErrEmptyQuery
+	}
+
+	d := dialect.For(db)
+	joins := fmt.Sprintf(" LEFT JOIN entries ON d.kind = '%s' AND %s = d.ref_id", KindEntry, d.Cast("entries.id", "text"))
+
+	var selects, from, match string
+	var params []interface{}
+
+	switch {
+	case d.Name == dialect.Postgres:
+		selects = fmt.Sprintf(`d.kind, d.ref_id, d.slug, COALESCE(d.title, ''),
+			ts_headline('english', COALESCE(d.title, ''), tsq, 'StartSel=%[1]s, StopSel=%[2]s, HighlightAll=true'),
+			ts_headline('english', COALESCE(d.body, ''), tsq, 'StartSel=%[1]s, StopSel=%[2]s, MaxWords=24, MinWords=12'),
+			ts_rank(d.document, tsq) AS score`, markStart, markEnd)
+		from = "search_documents d CROSS JOIN to_tsquery('english', ?) tsq"
+		params = append(params, tsQuery(terms))
+		match = "d.document @@ tsq"
+	case indexExists(db):
+		// bm25 is lower for better matches; titles weigh more
+		selects = fmt.Sprintf(`d.kind, d.ref_id, d.slug, COALESCE(d.title, ''),
+			COALESCE(highlight(search_index, 0, '%[1]s', '%[2]s'), ''),
+			COALESCE(snippet(search_index, 1, '%[1]s', '%[2]s', '…', 16), ''),
+			-bm25(search_index, 10.0, 1.0) AS score`, markStart, markEnd)
+		from = "search_index JOIN search_documents d ON d.id = search_index.rowid"
+		match = "search_index MATCH ?"
+		params = append(params, ftsQuery(terms))
+	default:
+		return nil, 0, ErrNoIndex
+	}
+
+	where := match + q.conditions(&params)
+	countParams := append([]interface{}{}, params...)
+
+	query := fmt.Sprintf("SELECT %s FROM %s%s WHERE %s ORDER BY score DESC, d.id LIMIT ? OFFSET ?", selects, from, joins, where)
+	params = append(params, q.Limit, q.Offset)
+
+	results, err := scanResults(db, query, params, func(title, body string) Highlights {
+		return Highlights{Title: markup(title), Body: markup(body)}
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var count int64
+	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s%s WHERE %s", from, joins, where)
+	if err := db.Raw(countQuery, countParams...).Scan(&count).Error; err != nil {
+		return nil, 0, err
+	}
+	return results, count, nil
+}
+
+// Rows are kind, id, slug, title, then title and body to highlight, and the score
+func scanResults(db *gorm.DB, query string, params []interface{}, highlights func(title, body string) Highlights) ([]Result, error) {
+	rows, err := db.Raw(query, params...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []Result{}
+	for rows.Next() {
+		var r Result
+		var title, body string
+		if err := rows.Scan(&r.Type, &r.ID, &r.Slug, &r.Title, &title, &body, &r.Score); err != nil {
+			return nil, err
+		}
+		r.Highlights = highlights(title, body)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
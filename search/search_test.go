@@ -0,0 +1,192 @@
+package search_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"tbd/migrations"
+	"tbd/search"
+)
+
+// Search needs FTS5, which is only in SQLite with -tags sqlite_fts5
+func openDatabase(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	if !search.FTS5Available(db) {
+		t.Skip("SQLite built without FTS5; run with -tags sqlite_fts5")
+	}
+
+	_, err = migrations.New(db).Up()
+	assert.NoError(t, err)
+	return db
+}
+
+func seed(t *testing.T, db *gorm.DB) {
+	statements := []string{
+		`INSERT INTO cities (id, slug, name, country_code) VALUES ('c1', 'berlin', 'Berlin', 'DE'), ('c2', 'hamburg', 'Hamburg', 'DE')`,
+		`INSERT INTO entries (id, type, data, city_id, status) VALUES
+			('e1', 'item-sale', '{"title": "Red bicycle", "description": "Barely used, with lights"}', 'c1', 'published'),
+			('e2', 'item-sale', '{"title": "Helmet", "description": "Fits any bicycle rider"}', 'c2', 'published'),
+			('e3', 'pet-sitter', '{"title": "Bicycle tours with dogs", "description": "<b>Long</b> walks"}', 'c1', 'published'),
+			('e4', 'item-sale', '{"title": "Bicycle pump", "description": "Draft"}', 'c1', 'draft')`,
+		`INSERT INTO users (id, username) VALUES ('u1', 'bicyclefan'), ('u2', 'walker')`,
+	}
+	for _, statement := range statements {
+		assert.NoError(t, db.Exec(statement).Error)
+	}
+}
+
+func query(keyword string) search.Query {
+	return search.Query{Keyword: keyword, EntriesWhere: "entries.status = ?", EntriesParams: []interface{}{"published"}, Limit: 20}
+}
+
+func ids(results []search.Result) []string {
+	ids := []string{}
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestSearch(t *testing.T) {
+	db := openDatabase(t)
+	seed(t, db)
+
+	results, count, err := search.Search(db, query("bicycle"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), count)
+	assert.ElementsMatch(t, []string{"e1", "e2", "e3", "u1"}, ids(results))
+
+	// Titles first
+	assert.NotEqual(t, "e2", results[0].ID)
+	assert.Equal(t, "e2", results[len(results)-1].ID)
+
+	// Every word, the last one as a prefix
+	results, _, err = search.Search(db, query("red bic"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"e1"}, ids(results))
+
+	// Highlights are escaped
+	results, _, err = search.Search(db, query("long walks"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"e3"}, ids(results))
+	assert.Contains(t, results[0].Highlights.Body, "&lt;b&gt;<mark>Long</mark>&lt;/b&gt; <mark>walks</mark>")
+
+	results, _, err = search.Search(db, query("helmet"))
+	assert.NoError(t, err)
+	assert.Equal(t, "<mark>Helmet</mark>", results[0].Highlights.Title)
+
+	_, _, err = search.Search(db, query(" %_ "))
+	assert.ErrorIs(t, err, search.ErrEmptyQuery)
+}
+
+func TestSearchFilters(t *testing.T) {
+	db := openDatabase(t)
+	seed(t, db)
+
+	q := query("bicycle")
+	q.Kind = search.KindUser
+	results, _, err := search.Search(db, q)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"u1"}, ids(results))
+
+	q = query("bicycle")
+	q.EntryType = "pet-sitter"
+	results, _, err = search.Search(db, q)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"e3"}, ids(results))
+
+	q = query("bicycle")
+	q.CitySlug = "berlin"
+	results, _, err = search.Search(db, q)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"e1", "e3"}, ids(results))
+
+	q = query("bicycle")
+	q.Limit, q.Offset = 2, 2
+	results, count, err := search.Search(db, q)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), count)
+	assert.Len(t, results, 2)
+}
+
+func TestSearchSync(t *testing.T) {
+	db := openDatabase(t)
+	seed(t, db)
+
+	assert.NoError(t, db.Exec(`UPDATE entries SET data = '{"title": "Blue scooter"}' WHERE id = 'e1'`).Error)
+	assert.NoError(t, db.Exec(`DELETE FROM entries WHERE id = 'e3'`).Error)
+	assert.NoError(t, db.Exec(`UPDATE users SET deleted_at = CURRENT_TIMESTAMP WHERE id = 'u1'`).Error)
+	assert.NoError(t, db.Exec(`UPDATE cities SET name = 'Hansestadt Hamburg' WHERE id = 'c2'`).Error)
+
+	results, _, err := search.Search(db, query("bicycle"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"e2"}, ids(results))
+
+	results, _, err = search.Search(db, query("scooter"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"e1"}, ids(results))
+
+	results, _, err = search.Search(db, query("hansestadt"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"c2"}, ids(results))
+	assert.Equal(t, "hamburg", results[0].Slug)
+}
+
+func TestSearchRebuild(t *testing.T) {
+	db := openDatabase(t)
+	seed(t, db)
+
+	// Out of sync, for ex. after a bulk import
+	assert.NoError(t, db.Exec(`DELETE FROM search_documents`).Error)
+	results, _, err := search.Search(db, query("bicycle"))
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+
+	count, err := search.Rebuild(db)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), count)
+
+	results, _, err = search.Search(db, query("bicycle"))
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+}
+
+func TestSearchStemming(t *testing.T) {
+	db := openDatabase(t)
+	seed(t, db)
+
+	results, _, err := search.Search(db, query("bicycles lights"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"e1"}, ids(results))
+}
+
+func TestSearchCheck(t *testing.T) {
+	db := openDatabase(t)
+	seed(t, db)
+	assert.NoError(t, search.Check(db))
+
+	// As if migrated without FTS5
+	for _, statement := range []string{
+		"DROP TRIGGER search_documents_ai",
+		"DROP TRIGGER search_documents_ad",
+		"DROP TRIGGER search_documents_au",
+		"DROP TABLE search_index",
+	} {
+		assert.NoError(t, db.Exec(statement).Error)
+	}
+	assert.ErrorIs(t, search.Check(db), search.ErrNoIndex)
+	_, _, err := search.Search(db, query("bicycle"))
+	assert.ErrorIs(t, err, search.ErrNoIndex)
+
+	_, err = search.Rebuild(db)
+	assert.NoError(t, err)
+	assert.NoError(t, search.Check(db))
+	results, _, err := search.Search(db, query("bicycle"))
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+}
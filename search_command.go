@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+
+	"tbd/search"
+)
+
+const searchUsage = `Usage: tbd search <command>
+
+Commands:
+  rebuild   Recreate the search index from entries, cities and users`
+
+// Entry point for: tbd search rebuild
+func runSearchCommand(args []string) int {
+	if len(args) != 1 || args[0] != "rebuild" {
+		fmt.Println(searchUsage)
+		return 2
+	}
+
+	db, err := openDatabase()
+	if err != nil {
+		fmt.Printf("Failed to open database: %v\n", err)
+		return 1
+	}
+
+	count, err := search.Rebuild(db)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Printf("Indexed %d documents\n", count)
+	return 0
+}
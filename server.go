@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"net/http"
+	"os"
 
 	"github.com/casbin/casbin/v2"
 	"github.com/go-playground/validator"
@@ -10,13 +13,18 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
-	"gorm.io/driver/sqlite"
-	"gorm.io/gorm"
 
 	"github.com/subosito/gotenv"
 
 	"tbd/handler"
-	"tbd/model"
+	"tbd/jobs"
+	"tbd/mail"
+	"tbd/notify"
+	"tbd/payment"
+	"tbd/search"
+	"tbd/session"
+	"tbd/sms"
+	"tbd/storage"
 )
 
 type CustomValidator struct {
@@ -33,18 +41,132 @@ func (cv *CustomValidator) Validate(i interface{}) error {
 func main() {
 	gotenv.Load()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "search" {
+		os.Exit(runSearchCommand(os.Args[2:]))
+	}
+
+	applyMigrations := flag.Bool("migrate", false, "Apply pending migrations before starting")
+	flag.Parse()
+
 	e := echo.New()
 	e.Logger.SetLevel(log.ERROR)
 
 	checkConfig()
 
 	// Database connection and migration
-	db, err := gorm.Open(sqlite.Open(DB_PATH()), &gorm.Config{})
+	db, err := openDatabase()
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	if err := ensureMigrated(db, *applyMigrations || AUTO_MIGRATE()); err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	// Search needs FTS5 on SQLite; without it, writes to a database migrated with it fail too
+	if err := search.Check(db); err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	// File storage
+	store, err := storage.New(storage.Config{
+		Driver:    STORAGE_DRIVER(),
+		LocalPath: STORAGE_PATH(),
+		S3Region:  os.Getenv("AWS_REGION"),
+		S3Bucket:  os.Getenv("AWS_BUCKET_NAME"),
+	})
 	if err != nil {
 		e.Logger.Fatal(err)
 	}
 
-	db.AutoMigrate(&model.User{}, &model.Entry{}, &model.File{}, model.Comment{}, model.City{}, model.Vote{})
+	// Payment providers
+	payments, err := payment.New(payment.Config{
+		Providers:          PAYMENT_PROVIDERS(),
+		ManualInstructions: PAYMENT_MANUAL_INSTRUCTIONS(),
+		WebhookURL:         PAYMENT_WEBHOOK_URL(),
+		WebhookSecret:      PAYMENT_WEBHOOK_SECRET(),
+	})
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	// Notifications
+	mailer, err := mail.New(mail.Config{
+		Driver:   MAIL_DRIVER(),
+		From:     MAIL_FROM(),
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     SMTP_PORT(),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		Path:     MAIL_PATH(),
+	})
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	smsSender, err := sms.New(sms.Config{
+		Driver:        SMS_DRIVER(),
+		Path:          SMS_PATH(),
+		WebhookURL:    os.Getenv("SMS_WEBHOOK_URL"),
+		WebhookSecret: os.Getenv("SMS_WEBHOOK_SECRET"),
+	})
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	notifier, err := notify.New(notify.Config{Notifiers: NOTIFIERS(), DB: db, Mailer: mailer})
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	// Background jobs
+	fileReaper := &jobs.FileReaper{
+		DB:       db,
+		Storage:  store,
+		TTL:      FILE_PROVISIONAL_TTL(),
+		Interval: FILE_REAPER_INTERVAL(),
+		DryRun:   FILE_REAPER_DRY_RUN(),
+	}
+	go fileReaper.Start(context.Background())
+
+	favoriteAlerts := &jobs.FavoriteAlerts{
+		DB:       db,
+		Notifier: notifier,
+	}
+	go favoriteAlerts.Start(context.Background())
+
+	entrySweeper := &jobs.EntrySweeper{
+		DB:             db,
+		Interval:       ENTRY_SWEEPER_INTERVAL(),
+		FavoriteAlerts: favoriteAlerts,
+	}
+	go entrySweeper.Start(context.Background())
+
+	calendarSync := &jobs.CalendarSync{
+		DB:       db,
+		Interval: CALENDAR_SYNC_INTERVAL(),
+		Client:   jobs.NewCalendarClient(CALENDAR_IMPORT_ALLOW_PRIVATE()),
+	}
+	go calendarSync.Start(context.Background())
+
+	// Matches are found with the entry filter of the handlers; started once those exist
+	savedSearchAlerts := &jobs.SavedSearchAlerts{
+		DB:       db,
+		Notifier: notifier,
+		Interval: SAVED_SEARCH_INTERVAL(),
+	}
+
+	sessions := &session.Denylist{
+		DB:       db,
+		TTL:      ACCESS_TOKEN_TTL(),
+		Interval: SESSION_DENYLIST_INTERVAL(),
+	}
+	go sessions.Start(context.Background())
+
+	accounts := &session.Accounts{DB: db, TTL: ACCOUNT_CACHE_TTL()}
 
 	// e.Use(middleware.Logger())
 
@@ -70,7 +192,7 @@ func main() {
 	// }))
 
 	// Authenticate
-	e.Use(echojwt.WithConfig(getJwtMVConfig()))
+	e.Use(echojwt.WithConfig(getJwtMVConfig(sessions)))
 
 	// Authorize
 
@@ -85,15 +207,33 @@ func main() {
 		panic(fmt.Sprintf("failed to load policy: %s", err))
 	}
 
-	e.Use(AuthorizationMW{Enforcer: authEnforcer}.Authorize)
+	e.Use(AuthorizationMW{Enforcer: authEnforcer, Accounts: accounts}.Authorize)
 
 	// Initialize handler
 	e.Validator = &CustomValidator{validator: validator.New()}
-	h := &handler.Handler{DB: db}
+	h := &handler.Handler{DB: db, Storage: store, FileReaper: fileReaper, CalendarSync: calendarSync, Payments: payments, Currency: CURRENCY(), SavedSearchAlerts: savedSearchAlerts, FavoriteAlerts: favoriteAlerts, Mailer: mailer, EmailVerificationTTL: EMAIL_VERIFICATION_TTL(), RequireConfirmedEmail: REQUIRE_CONFIRMED_EMAIL(), SMS: smsSender, PasswordResetTTL: PASSWORD_RESET_TTL(), Sessions: sessions, Accounts: accounts, AccessTokenTTL: ACCESS_TOKEN_TTL(), RefreshTokenTTL: REFRESH_TOKEN_TTL()}
+
+	savedSearchAlerts.Match = h.MatchSavedSearch
+	go savedSearchAlerts.Start(context.Background())
 
 	// Routes
 	e.POST("/signup", h.Signup)
 	e.POST("/login", h.Login)
+	e.POST("/login/2fa", h.LoginTwoFactor)
+	e.POST("/refresh", h.RefreshSession)
+	e.POST("/logout", h.Logout)
+	e.POST("/logout/all", h.LogoutAll)
+	e.POST("/account/verify", h.VerifyEmail)
+	e.POST("/account/password/forgot", h.ForgotPassword)
+	e.POST("/account/password/reset", h.ResetPassword)
+	e.POST("/account/password/change", h.ChangePassword)
+	e.GET("/account/sessions", h.FetchMySessions)
+	e.DELETE("/account/sessions/:id", h.RevokeSession)
+	e.GET("/account/2fa", h.FetchTwoFactor)
+	e.POST("/account/2fa/setup", h.SetupTwoFactor)
+	e.POST("/account/2fa/confirm", h.ConfirmTwoFactor)
+	e.POST("/account/2fa/disable", h.DisableTwoFactor)
+	e.POST("/account/2fa/recovery-codes", h.RegenerateRecoveryCodes)
 
 	e.GET("/users", h.FetchUsers)
 	e.GET("/users/:id", h.FetchUser)
@@ -101,6 +241,7 @@ func main() {
 
 	e.POST("/entries", h.CreateEntry)
 	e.GET("/entries", h.FetchEntries)
+	e.GET("/entries.geojson", h.FetchEntriesGeoJSON)
 	e.GET("/entries/by-city/count", h.EntriesByCity)
 	e.GET("/entries/by-country/count", h.EntriesByCountry)
 	e.GET("/entries/by-type/count", h.EntriesByType)
@@ -108,14 +249,58 @@ func main() {
 	e.GET("/entries/:id", h.FetchEntry)
 	e.PATCH("/entries/:id", h.UpdateEntry)
 	e.DELETE("/entries/:id", h.DeleteEntry)
+	e.PATCH("/entries/:id/status", h.UpdateEntryStatus)
+	e.POST("/entries/:id/renew", h.RenewEntry)
+	e.GET("/entries/:id/interest", h.FetchEntryInterest)
+	e.POST("/entries/:id/reservations", h.CreateReservation)
+	e.GET("/entries/:id/reservations", h.FetchEntryReservations)
+	e.GET("/entries/:id/availability", h.FetchEntryAvailability)
+	e.POST("/entries/:id/availability", h.CreateAvailabilityBlock)
+	e.DELETE("/entries/:id/availability/:block_id", h.DeleteAvailabilityBlock)
+	e.GET("/entries/:id/calendar.ics", h.ExportEntryCalendar)
+	e.GET("/entries/:id/calendar", h.FetchEntryCalendar)
+	e.PUT("/entries/:id/calendar", h.SetEntryCalendar)
+	e.DELETE("/entries/:id/calendar", h.DeleteEntryCalendar)
+	e.POST("/entries/:id/calendar/sync", h.SyncEntryCalendar)
+	e.POST("/entries/:id/orders", h.CreateOrder)
+	e.GET("/entries/:id/consumes", h.FetchEntryConsumptions)
+	e.POST("/entries/:id/consumes", h.CreateEntryConsumption)
+	e.DELETE("/entries/:id/consumes/:consumption_id", h.DeleteEntryConsumption)
+	e.GET("/entries/:id/quote", h.QuoteEntry)
+
+	e.GET("/entry-types", h.FetchEntryTypes)
+	e.GET("/entry-types/:name", h.FetchEntryType)
 
 	e.GET("/search", h.Search)
 
+	e.GET("/currency-rates", h.FetchCurrencyRates)
+
 	e.GET("/files", h.FetchFiles)
 	e.POST("/files/multi", h.CreateFiles)
 	e.DELETE("/files/:id", h.DeleteFile)
 	e.GET("/files/:id/download", h.DownloadFile)
 
+	e.GET("/admin/files/reaper", h.FileReaperMetrics)
+	e.POST("/admin/files/reaper", h.RunFileReaper)
+	e.POST("/admin/search/rebuild", h.RebuildSearchIndex)
+	e.POST("/admin/entry-types", h.CreateEntryType)
+	e.PATCH("/admin/entry-types/:name", h.UpdateEntryType)
+	e.DELETE("/admin/entry-types/:name", h.DeleteEntryType)
+	e.PUT("/admin/currency-rates/:base/:quote", h.SetCurrencyRate)
+	e.DELETE("/admin/currency-rates/:base/:quote", h.DeleteCurrencyRate)
+	e.PATCH("/admin/users/:id", h.UpdateUserAccount)
+
+	e.GET("/reservations/:id", h.FetchReservation)
+	e.PATCH("/reservations/:id/status", h.UpdateReservationStatus)
+
+	e.GET("/orders/:id", h.FetchOrder)
+	e.PATCH("/orders/:id/status", h.UpdateOrderStatus)
+
+	e.PATCH("/sub-orders/:id/status", h.UpdateSubOrderStatus)
+
+	e.GET("/payments/providers", h.FetchPaymentProviders)
+	e.POST("/payments/webhooks/:provider", h.PaymentWebhook)
+
 	e.GET("/comments", h.FetchComments)
 	e.POST("/comments", h.MakeComment)
 	e.PATCH("/comments/:id", h.EditComment)
@@ -127,6 +312,36 @@ func main() {
 
 	e.GET("/account/me", h.Me)
 	e.PATCH("/account/me", h.UpdateMe)
+	e.POST("/account/me/verify", h.ResendVerification)
+	e.GET("/account/me/reservations", h.FetchMyReservations)
+	e.GET("/account/me/reservations/received", h.FetchReceivedReservations)
+	e.GET("/account/me/orders", h.FetchMyOrders)
+	e.GET("/account/me/orders/received", h.FetchReceivedOrders)
+	e.GET("/account/me/sub-orders", h.FetchReceivedSubOrders)
+	e.GET("/account/me/saved-searches", h.FetchMySavedSearches)
+	e.POST("/account/me/saved-searches", h.CreateSavedSearch)
+	e.PATCH("/account/me/saved-searches/:id", h.UpdateSavedSearch)
+	e.DELETE("/account/me/saved-searches/:id", h.DeleteSavedSearch)
+	e.GET("/account/me/saved-searches/:id/matches", h.FetchSavedSearchMatches)
+	e.GET("/account/me/notifications", h.FetchMyNotifications)
+	e.POST("/account/me/notifications/read", h.ReadMyNotifications)
+	e.GET("/account/me/favorites", h.FetchMyFavorites)
+	e.POST("/account/me/favorites", h.CreateFavorite)
+	e.PATCH("/account/me/favorites/:entry_id", h.UpdateFavorite)
+	e.DELETE("/account/me/favorites/:entry_id", h.DeleteFavorite)
+	e.GET("/account/me/conversations", h.FetchMyConversations)
+	e.GET("/account/me/conversations/unread", h.FetchMyUnreadMessages)
+	e.GET("/account/me/blocks", h.FetchMyBlocks)
+	e.POST("/account/me/blocks", h.BlockUser)
+	e.DELETE("/account/me/blocks/:user_id", h.UnblockUser)
+
+	// Conversations
+	e.POST("/conversations", h.CreateConversation)
+	e.GET("/conversations/:id", h.FetchConversation)
+	e.DELETE("/conversations/:id", h.DeleteConversation)
+	e.GET("/conversations/:id/messages", h.FetchMessages)
+	e.POST("/conversations/:id/messages", h.SendMessage)
+	e.POST("/conversations/:id/read", h.ReadConversation)
 
 	// Start server
 	e.Logger.Fatal(e.Start(":1323"))
@@ -0,0 +1,143 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Once the cache holds this many accounts, expired ones are dropped
+const accountsPruneSize = 10000
+
+// Current roles and state of a user, as authorization sees them
+// Deleted is also set for users that don't exist
+type Account struct {
+	ID           string
+	Roles        []string
+	TokenVersion int
+	IsConfirmed  bool
+	Suspended    bool
+	Deleted      bool
+}
+
+func (a Account) IsAdmin() bool {
+	for _, role := range a.Roles {
+		if role == "admin" {
+			return true
+		}
+	}
+	return false
+}
+
+type cachedAccount struct {
+	account   Account
+	expiresAt time.Time
+}
+
+// Accounts from the database, cached for TTL so not every request has to load them
+//
+// Notes:
+//   - Changes through Invalidate take effect right away; changes on other instances once the cached account expires
+//   - Invalidate is safe to call on a nil cache
+//   - Loads that overlap an Invalidate of the same account aren't cached, as they may have read the old state
+type Accounts struct {
+	DB  *gorm.DB
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedAccount
+	// Bumped by Invalidate
+	generations map[string]uint64
+}
+
+func (a *Accounts) Get(ctx context.Context, id string) (Account, error) {
+	now := time.Now()
+	a.mu.Lock()
+	cached, ok := a.entries[id]
+	generation := a.generations[id]
+	a.mu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.account, nil
+	}
+
+	account, err := a.load(ctx, id)
+	if err != nil {
+		return account, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.generations[id] != generation {
+		return account, nil
+	}
+	if a.entries == nil {
+		a.entries = map[string]cachedAccount{}
+	}
+	if len(a.entries) >= accountsPruneSize {
+		for key, cached := range a.entries {
+			if now.After(cached.expiresAt) {
+				delete(a.entries, key)
+			}
+		}
+	}
+	a.entries[id] = cachedAccount{account: account, expiresAt: now.Add(a.TTL)}
+	return account, nil
+}
+
+func (a *Accounts) load(ctx context.Context, id string) (Account, error) {
+	type userRow struct {
+		ID           string
+		Roles        string
+		TokenVersion int
+		IsConfirmed  bool
+		SuspendedAt  sql.NullTime
+		DeletedAt    sql.NullTime
+	}
+	rows := []userRow{}
+	err := a.DB.WithContext(ctx).Table("users").
+		Select("id, roles, token_version, is_confirmed, suspended_at, deleted_at").
+		Where("id = ?", id).Limit(1).Find(&rows).Error
+	if err != nil {
+		return Account{}, err
+	}
+	if len(rows) == 0 {
+		return Account{ID: id, Deleted: true}, nil
+	}
+
+	row := rows[0]
+	account := Account{
+		ID:           row.ID,
+		Roles:        []string{},
+		TokenVersion: row.TokenVersion,
+		IsConfirmed:  row.IsConfirmed,
+		Suspended:    row.SuspendedAt.Valid,
+		Deleted:      row.DeletedAt.Valid,
+	}
+	if row.Roles != "" {
+		if err := json.Unmarshal([]byte(row.Roles), &account.Roles); err != nil {
+			return Account{}, err
+		}
+	}
+	return account, nil
+}
+
+// Drops the accounts from the cache, so the next request loads them again
+func (a *Accounts) Invalidate(ids ...string) {
+	if a == nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.generations == nil {
+		a.generations = map[string]uint64{}
+	}
+	for _, id := range ids {
+		delete(a.entries, id)
+		a.generations[id]++
+	}
+}
@@ -0,0 +1,94 @@
+package session
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"tbd/migrations"
+	"tbd/model"
+)
+
+func TestAccounts(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	assert.NoError(t, err)
+	_, err = migrations.New(db).Up()
+	assert.NoError(t, err)
+
+	user := model.User{ID: "00000000-0000-0000-0000-000000000001", Username: "admin", Roles: []string{"member", "admin"}, IsConfirmed: true}
+	assert.NoError(t, db.Session(&gorm.Session{SkipHooks: true}).Create(&user).Error)
+
+	ctx := context.Background()
+	a := &Accounts{DB: db, TTL: time.Hour}
+
+	account, err := a.Get(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.True(t, account.IsAdmin())
+	assert.True(t, account.IsConfirmed)
+	assert.False(t, account.Suspended)
+	assert.False(t, account.Deleted)
+
+	assert.NoError(t, db.Model(&model.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{"roles": `["member"]`, "suspended_at": time.Now()}).Error)
+
+	// Cached until it expires, or is invalidated
+	account, _ = a.Get(ctx, user.ID)
+	assert.True(t, account.IsAdmin())
+
+	a.Invalidate(user.ID)
+	account, _ = a.Get(ctx, user.ID)
+	assert.False(t, account.IsAdmin())
+	assert.True(t, account.Suspended)
+
+	account, err = a.Get(ctx, "00000000-0000-0000-0000-000000000002")
+	assert.NoError(t, err)
+	assert.True(t, account.Deleted)
+
+	var none *Accounts
+	none.Invalidate(user.ID)
+}
+
+func TestAccountsInvalidateDuringLoad(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	assert.NoError(t, err)
+	_, err = migrations.New(db).Up()
+	assert.NoError(t, err)
+
+	user := model.User{ID: "00000000-0000-0000-0000-000000000001", Username: "admin", Roles: []string{"member", "admin"}}
+	assert.NoError(t, db.Session(&gorm.Session{SkipHooks: true}).Create(&user).Error)
+
+	ctx := context.Background()
+	a := &Accounts{DB: db, TTL: time.Hour}
+
+	// The admin is demoted right after the first load read the user, before it's cached
+	demoted := false
+	demote := func(tx *gorm.DB) {
+		if demoted || tx.Statement.Table != "users" {
+			return
+		}
+		demoted = true
+		assert.NoError(t, db.Model(&model.User{}).Where("id = ?", user.ID).Update("roles", `["member"]`).Error)
+		a.Invalidate(user.ID)
+	}
+	assert.NoError(t, db.Callback().Query().After("gorm:query").Register("test:demote", demote))
+
+	account, err := a.Get(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.True(t, demoted)
+	assert.True(t, account.IsAdmin())
+
+	// What the load read is not kept
+	account, err = a.Get(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.False(t, account.IsAdmin())
+
+	// Later loads are cached again
+	assert.NoError(t, db.Model(&model.User{}).Where("id = ?", user.ID).Update("roles", `["member","admin"]`).Error)
+	account, _ = a.Get(ctx, user.ID)
+	assert.False(t, account.IsAdmin())
+}
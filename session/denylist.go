@@ -0,0 +1,109 @@
+package session
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Revoked sessions, kept in memory so access tokens are checked without going to the database
+//
+// Notes:
+//   - Sessions revoked through Revoke are denied right away; those revoked elsewhere (other instances) once the list is loaded again, every Interval
+//   - Access tokens expire after TTL, so sessions revoked longer ago than that are dropped from the list
+//   - Methods are safe to call on a nil list; nothing is denied then
+type Denylist struct {
+	DB       *gorm.DB
+	TTL      time.Duration
+	Interval time.Duration
+
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+func (d *Denylist) Start(ctx context.Context) {
+	if err := d.Load(ctx); err != nil {
+		log.Println("Session denylist:", err)
+	}
+
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Load(ctx); err != nil {
+				log.Println("Session denylist:", err)
+			}
+		}
+	}
+}
+
+// Replaces the list with the sessions revoked within TTL
+func (d *Denylist) Load(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+
+	type revokedSession struct {
+		ID        string
+		RevokedAt time.Time
+	}
+	rows := []revokedSession{}
+	since := time.Now().Add(-d.TTL)
+	err := d.DB.WithContext(ctx).Table("sessions").Select("id, revoked_at").
+		Where("revoked_at IS NOT NULL AND revoked_at > ?", since.Local()).
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	revoked := make(map[string]time.Time, len(rows))
+	for _, row := range rows {
+		revoked[row.ID] = row.RevokedAt
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Revoked here while loading
+	for id, at := range d.revoked {
+		if _, ok := revoked[id]; !ok && at.After(since) {
+			revoked[id] = at
+		}
+	}
+	d.revoked = revoked
+	return nil
+}
+
+// Denies the sessions right away; they're revoked in the database by the caller
+func (d *Denylist) Revoke(ids ...string) {
+	if d == nil || len(ids) == 0 {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.revoked == nil {
+		d.revoked = map[string]time.Time{}
+	}
+	now := time.Now()
+	for _, id := range ids {
+		d.revoked[id] = now
+	}
+}
+
+func (d *Denylist) IsRevoked(id string) bool {
+	if d == nil {
+		return false
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, ok := d.revoked[id]
+	return ok
+}
@@ -0,0 +1,49 @@
+package session
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"tbd/migrations"
+	"tbd/model"
+)
+
+func TestDenylist(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	assert.NoError(t, err)
+	_, err = migrations.New(db).Up()
+	assert.NoError(t, err)
+
+	now := time.Now()
+	long := now.Add(-time.Hour)
+	sessions := []model.Session{
+		{UserID: "00000000-0000-0000-0000-000000000001", RefreshTokenHash: "a", RevokedAt: &now},
+		{UserID: "00000000-0000-0000-0000-000000000001", RefreshTokenHash: "b", RevokedAt: &long},
+		{UserID: "00000000-0000-0000-0000-000000000001", RefreshTokenHash: "c"},
+	}
+	for i := range sessions {
+		assert.NoError(t, db.Create(&sessions[i]).Error)
+	}
+
+	d := &Denylist{DB: db, TTL: 15 * time.Minute}
+	d.Revoke("local")
+	assert.NoError(t, d.Load(context.Background()))
+
+	assert.True(t, d.IsRevoked(sessions[0].ID))
+	// Its access tokens expired already
+	assert.False(t, d.IsRevoked(sessions[1].ID))
+	assert.False(t, d.IsRevoked(sessions[2].ID))
+	// Revoked here, before it's in the database
+	assert.True(t, d.IsRevoked("local"))
+
+	var none *Denylist
+	none.Revoke("local")
+	assert.False(t, none.IsRevoked("local"))
+}
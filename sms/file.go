@@ -0,0 +1,35 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Writes every text message to a file in a directory instead of sending it; for development and tests
+// Files are named <unix nano>-<phone>.txt, so they sort in the order they were sent
+type File struct {
+	dir string
+}
+
+func NewFile(dir string) (*File, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("file sms sender requires a directory")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &File{dir: dir}, nil
+}
+
+func (f *File) Send(ctx context.Context, m Message) error {
+	if strings.ContainsAny(m.To, "/\\\r\n") {
+		return fmt.Errorf("invalid recipient: %q", m.To)
+	}
+
+	name := fmt.Sprintf("%d-%s.txt", time.Now().UnixNano(), m.To)
+	return os.WriteFile(filepath.Join(f.dir, name), []byte(m.Body+"\n"), 0o644)
+}
@@ -0,0 +1,18 @@
+package sms
+
+import (
+	"context"
+	"log"
+)
+
+// Writes text messages to the log instead of sending them; for development
+type Log struct{}
+
+func NewLog() *Log {
+	return &Log{}
+}
+
+func (l *Log) Send(ctx context.Context, m Message) error {
+	log.Printf("SMS to %s: %s", m.To, m.Body)
+	return nil
+}
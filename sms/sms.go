@@ -0,0 +1,40 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+)
+
+// A text message to a phone number
+type Message struct {
+	To   string
+	Body string
+}
+
+// Sender is implemented by every SMS backend
+type Sender interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Supported drivers are: log, file, webhook
+type Config struct {
+	Driver string
+	// Only used by the file driver
+	Path string
+	// Only used by the webhook driver
+	WebhookURL    string
+	WebhookSecret string
+}
+
+func New(cfg Config) (Sender, error) {
+	switch cfg.Driver {
+	case "log":
+		return NewLog(), nil
+	case "file":
+		return NewFile(cfg.Path)
+	case "webhook":
+		return NewWebhook(cfg.WebhookURL, cfg.WebhookSecret)
+	default:
+		return nil, fmt.Errorf("unsupported sms driver: %s", cfg.Driver)
+	}
+}
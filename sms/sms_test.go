@@ -0,0 +1,57 @@
+package sms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFile(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sms")
+	sender, err := New(Config{Driver: "file", Path: dir})
+	assert.NoError(t, err)
+
+	assert.NoError(t, sender.Send(context.Background(), Message{To: "+4915112345678", Body: "Hello"}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*-+4915112345678.txt"))
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1) {
+		content, err := os.ReadFile(files[0])
+		assert.NoError(t, err)
+		assert.Equal(t, "Hello\n", string(content))
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	received := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		if r.Header.Get("X-Signature") != hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	sender, err := New(Config{Driver: "webhook", WebhookURL: server.URL, WebhookSecret: "secret"})
+	assert.NoError(t, err)
+	assert.NoError(t, sender.Send(context.Background(), Message{To: "+4915112345678", Body: "Hello"}))
+	assert.Equal(t, map[string]string{"to": "+4915112345678", "body": "Hello"}, received)
+
+	sender, _ = New(Config{Driver: "webhook", WebhookURL: server.URL, WebhookSecret: "wrong"})
+	assert.Error(t, sender.Send(context.Background(), Message{To: "+4915112345678", Body: "Hello"}))
+}
@@ -0,0 +1,60 @@
+package sms
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Hands text messages to a gateway in front of an SMS provider
+//
+// Notes:
+//   - POSTs {to, body} to URL, and expects a 2xx
+//   - X-Signature is the hex HMAC-SHA256 of the body, with Secret; like payment webhooks
+type Webhook struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func NewWebhook(url, secret string) (*Webhook, error) {
+	if url == "" || secret == "" {
+		return nil, errors.New("webhook sms sender requires a url and secret")
+	}
+	return &Webhook{URL: url, Secret: secret, Client: &http.Client{Timeout: 15 * time.Second}}, nil
+}
+
+func (w *Webhook) Send(ctx context.Context, m Message) error {
+	body, err := json.Marshal(map[string]string{"to": m.To, "body": m.Body})
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature", hex.EncodeToString(mac.Sum(nil)))
+
+	res, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("sms gateway responded with %d", res.StatusCode)
+	}
+	return nil
+}
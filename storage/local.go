@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores files on disk, below Root
+type Local struct {
+	Root string
+}
+
+func NewLocal(root string) (*Local, error) {
+	if root == "" {
+		root = "uploads"
+	}
+
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+
+	return &Local{Root: root}, nil
+}
+
+// Backslashes and ".." segments are rejected, so we never leave Root; for ex. ../../etc/passwd
+func (l *Local) fullPath(p string) (string, error) {
+	if p == "" || strings.Contains(p, "\\") {
+		return "", ErrInvalidPath
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." {
+			return "", ErrInvalidPath
+		}
+	}
+	return filepath.Join(l.Root, filepath.FromSlash(path.Clean("/"+p))), nil
+}
+
+func (l *Local) Put(ctx context.Context, p string, body io.Reader, contentType string) error {
+	full, err := l.fullPath(p)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so readers never see partial uploads
+	tmp, err := os.CreateTemp(filepath.Dir(full), ".upload-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), full)
+}
+
+func (l *Local) Get(ctx context.Context, p string) ([]byte, error) {
+	full, err := l.fullPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(full)
+	if err != nil {
+		return nil, mapLocalError(err)
+	}
+	return data, nil
+}
+
+func (l *Local) Stream(ctx context.Context, p string) (io.ReadCloser, Object, error) {
+	full, err := l.fullPath(p)
+	if err != nil {
+		return nil, Object{}, err
+	}
+
+	f, err := os.Open(full)
+	if err != nil {
+		return nil, Object{}, mapLocalError(err)
+	}
+
+	obj, err := l.stat(f, p)
+	if err != nil {
+		f.Close()
+		return nil, Object{}, err
+	}
+
+	return f, obj, nil
+}
+
+func (l *Local) Stat(ctx context.Context, p string) (Object, error) {
+	full, err := l.fullPath(p)
+	if err != nil {
+		return Object{}, err
+	}
+
+	f, err := os.Open(full)
+	if err != nil {
+		return Object{}, mapLocalError(err)
+	}
+	defer f.Close()
+
+	return l.stat(f, p)
+}
+
+func (l *Local) Delete(ctx context.Context, p string) error {
+	full, err := l.fullPath(p)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(full)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) stat(f *os.File, p string) (Object, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return Object{}, err
+	}
+	if info.IsDir() {
+		return Object{}, ErrNotFound
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(p))
+	if contentType == "" {
+		// Sniff the first 512 bytes and rewind
+		buf := make([]byte, 512)
+		n, _ := f.Read(buf)
+		contentType = http.DetectContentType(buf[:n])
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return Object{}, err
+		}
+	}
+
+	return Object{
+		Path:         p,
+		Size:         info.Size(),
+		ContentType:  contentType,
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+func mapLocalError(err error) error {
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	root := filepath.Join(t.TempDir(), "uploads")
+	store, err := New(Config{Driver: "local", LocalPath: root})
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.Put(ctx, "general/a.txt", strings.NewReader("hello"), "text/plain"))
+	data, err := store.Get(ctx, "general/a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	reader, obj, err := store.Stream(ctx, "general/a.txt")
+	if assert.NoError(t, err) {
+		data, err = io.ReadAll(reader)
+		assert.NoError(t, err)
+		assert.NoError(t, reader.Close())
+		assert.Equal(t, "hello", string(data))
+	}
+	assert.Equal(t, int64(5), obj.Size)
+	assert.Equal(t, "general/a.txt", obj.Path)
+	assert.True(t, strings.HasPrefix(obj.ContentType, "text/plain"))
+
+	// Overwrites leave no temporary files behind
+	assert.NoError(t, store.Put(ctx, "general/a.txt", strings.NewReader("bye"), "text/plain"))
+	entries, err := os.ReadDir(filepath.Join(root, "general"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	assert.NoError(t, store.Delete(ctx, "general/a.txt"))
+	assert.NoError(t, store.Delete(ctx, "general/a.txt"))
+
+	_, err = store.Get(ctx, "general/a.txt")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, err = store.Stream(ctx, "general/a.txt")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = store.Stat(ctx, "general")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Nothing outside of the root is read, written or deleted
+	outside := filepath.Join(filepath.Dir(root), "secret.txt")
+	assert.NoError(t, os.WriteFile(outside, []byte("secret"), 0o600))
+
+	for _, p := range []string{"../secret.txt", "general/../../secret.txt", "..", "..\\secret.txt", ""} {
+		_, err = store.Get(ctx, p)
+		assert.ErrorIs(t, err, ErrInvalidPath, p)
+		_, err = store.Stat(ctx, p)
+		assert.ErrorIs(t, err, ErrInvalidPath, p)
+		assert.ErrorIs(t, store.Put(ctx, p, strings.NewReader("overwritten"), "text/plain"), ErrInvalidPath, p)
+		assert.ErrorIs(t, store.Delete(ctx, p), ErrInvalidPath, p)
+	}
+
+	data, err = os.ReadFile(outside)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(data))
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type S3 struct {
+	client *s3.Client
+	bucket string
+}
+
+// Credentials are picked up from the AWS_* env variables
+func NewS3(region, bucket string) (*S3, error) {
+	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3{
+		client: s3.NewFromConfig(cfg),
+		bucket: bucket,
+	}, nil
+}
+
+func (s *S3) Put(ctx context.Context, path string, body io.Reader, contentType string) error {
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path),
+		Body:   body,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	uploader := manager.NewUploader(s.client)
+	_, err := uploader.Upload(ctx, input)
+	return err
+}
+
+func (s *S3) Get(ctx context.Context, path string) ([]byte, error) {
+	body, _, err := s.Stream(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return io.ReadAll(body)
+}
+
+func (s *S3) Stream(ctx context.Context, path string) (io.ReadCloser, Object, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		return nil, Object{}, s.mapError(err)
+	}
+
+	obj := Object{
+		Path:        path,
+		Size:        output.ContentLength,
+		ContentType: aws.ToString(output.ContentType),
+	}
+	if output.LastModified != nil {
+		obj.LastModified = *output.LastModified
+	}
+
+	return output.Body, obj, nil
+}
+
+func (s *S3) Stat(ctx context.Context, path string) (Object, error) {
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path),
+	})
+	if err != nil {
+		return Object{}, s.mapError(err)
+	}
+
+	obj := Object{
+		Path:        path,
+		Size:        output.ContentLength,
+		ContentType: aws.ToString(output.ContentType),
+	}
+	if output.LastModified != nil {
+		obj.LastModified = *output.LastModified
+	}
+
+	return obj, nil
+}
+
+func (s *S3) Delete(ctx context.Context, path string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(path),
+	})
+	return err
+}
+
+func (s *S3) mapError(err error) error {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFound    = errors.New("file not found")
+	ErrInvalidPath = errors.New("invalid file path")
+)
+
+// Object describes a stored file, independent of the backend
+type Object struct {
+	Path         string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// Storage is implemented by every file backend
+// Paths are always slash-separated and relative to the backend root; for ex. general/<id>.jpg
+//
+// Notes:
+//   - Delete does not fail if the file is already gone
+//   - Stream returns a reader that must be closed by the caller
+type Storage interface {
+	Put(ctx context.Context, path string, body io.Reader, contentType string) error
+	Get(ctx context.Context, path string) ([]byte, error)
+	Stream(ctx context.Context, path string) (io.ReadCloser, Object, error)
+	Stat(ctx context.Context, path string) (Object, error)
+	Delete(ctx context.Context, path string) error
+}
+
+// Supported drivers are: s3, local
+type Config struct {
+	Driver    string
+	LocalPath string
+	S3Region  string
+	S3Bucket  string
+}
+
+func New(cfg Config) (Storage, error) {
+	switch cfg.Driver {
+	case "s3":
+		return NewS3(cfg.S3Region, cfg.S3Bucket)
+	case "local":
+		return NewLocal(cfg.LocalPath)
+	default:
+		return nil, fmt.Errorf("unsupported storage driver: %s", cfg.Driver)
+	}
+}
@@ -0,0 +1,60 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The SHA-1 test vectors of RFC 6238, appendix B
+func TestHOTPVectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "94287082",
+		1111111109:  "07081804",
+		1111111111:  "14050471",
+		1234567890:  "89005924",
+		2000000000:  "69279037",
+		20000000000: "65353130",
+	}
+	for unix, code := range vectors {
+		assert.Equal(t, code, hotp(key, uint64(Step(time.Unix(unix, 0))), 8), unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	now := time.Now()
+	code, err := Code(secret, Step(now))
+	assert.NoError(t, err)
+	assert.Len(t, code, Digits)
+
+	step, ok := Validate(secret, code, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	// Still valid a step later, not two
+	_, ok = Validate(secret, code, now.Add(Period), 0)
+	assert.True(t, ok)
+	_, ok = Validate(secret, code, now.Add(2*Period), 0)
+	assert.False(t, ok)
+
+	// Not again, once it was used
+	_, ok = Validate(secret, code, now, step)
+	assert.False(t, ok)
+
+	_, ok = Validate(secret, "12345", now, 0)
+	assert.False(t, ok)
+	_, ok = Validate(strings.ToLower(secret), code[:3]+" "+code[3:], now, 0)
+	assert.True(t, ok)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("JBSWY3DPEHPK3PXP", "example.com", "alice@example.com")
+	assert.Equal(t, "otpauth://totp/example.com:alice@example.com?algorithm=SHA1&digits=6&issuer=example.com&period=30&secret=JBSWY3DPEHPK3PXP", uri)
+}